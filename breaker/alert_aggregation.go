@@ -0,0 +1,207 @@
+package breaker
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// AggregatedTrip is a trip whose open alert waits for the end of the aggregation window
+// (see alert_aggregation_seconds), to be sent together with the other trips in it
+type AggregatedTrip struct {
+	Breaker       string // Name of the breaker (see Config.Name); empty for the API identifier
+	Reason        string // Trip reason (see the TripReason constants)
+	LatencyMs     int64  // Latency percentile when the breaker tripped
+	MemoryOK      bool   // Memory was below the threshold
+	WaitTime      int    // Seconds before the breaker can close
+	CorrelationID string // Request that caused the trip, if known
+
+	CoalescedTrips int // Later trips folded into the alert of this trip (see max_pending_alerts)
+
+	LatencyThresholdMs int64  // Latency threshold of the breaker, for priority_by_magnitude (0 = not scaled)
+	Priority           string // Replaces the global priority of the alert, e.g. for staged alerts (empty = priority)
+}
+
+// AggregateBreakerOpenAlert sends the open alert of a trip. With alert_aggregation_seconds
+// set, the first trip opens an aggregation window and the alert waits for it to end:
+// the trips within the window, from every breaker sharing the client, are sent as a
+// single open alert that lists the breakers and reasons. Unlike the cooldown, which
+// drops repeats of the same alert, no trip is left out.
+func (o *OpsGenieClient) AggregateBreakerOpenAlert(trip AggregatedTrip) error {
+	if o == nil || o.currentConfig() == nil {
+		return nil
+	}
+	if o.currentConfig().AlertAggregationSeconds <= 0 {
+		return o.SendBreakerOpenAlertForTrip(trip)
+	}
+
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	o.aggregatedTrips = append(o.aggregatedTrips, trip)
+	if o.aggregationTimer == nil {
+		window := time.Duration(o.currentConfig().AlertAggregationSeconds) * time.Second
+		o.aggregationTimer = time.AfterFunc(window, func() {
+			if err := o.FlushAggregatedAlerts(); err != nil {
+				log.Printf("Failed to send aggregated OpsGenie alert for breaker open: %v", err)
+			}
+		})
+		log.Printf("Aggregating open alerts for %v", window)
+	}
+	return nil
+}
+
+// FlushAggregatedAlerts ends the current aggregation window, if any, and sends the open
+// alert of its trips without waiting. A window with a single trip sends the usual open
+// alert.
+func (o *OpsGenieClient) FlushAggregatedAlerts() error {
+	if o == nil {
+		return nil
+	}
+
+	o.mutex.Lock()
+	trips := o.aggregatedTrips
+	o.aggregatedTrips = nil
+	if o.aggregationTimer != nil {
+		o.aggregationTimer.Stop()
+		o.aggregationTimer = nil
+	}
+	o.mutex.Unlock()
+
+	switch len(trips) {
+	case 0:
+		return nil
+	case 1:
+		return o.SendBreakerOpenAlertForTrip(trips[0])
+	default:
+		return o.sendAggregatedOpenAlert(trips)
+	}
+}
+
+// sendAggregatedOpenAlert sends a single open alert for several trips, with the highest
+// latency, wait time and breach magnitude among them, the most severe of their priorities
+// and the correlation IDs of all of them
+func (o *OpsGenieClient) sendAggregatedOpenAlert(trips []AggregatedTrip) error {
+	if !o.currentConfig().Enabled || !o.currentConfig().TriggerOnOpen || !o.isEnabledForEnvironment() {
+		return nil
+	}
+
+	if !o.IsInitialized() {
+		log.Printf("OpsGenie client not initialized or not enabled for environment, skipping alert")
+		return nil
+	}
+
+	alertType := "circuit-open"
+	alertKey := o.determineAlertKey(alertType, "aggregated")
+	if o.IsOnCooldown(alertKey) {
+		log.Printf("Skipping alert for %s due to cooldown period", alertKey)
+		return nil
+	}
+
+	breakers := make(map[string]bool)
+	reasons := make(map[string]bool)
+	correlationIDs := make(map[string]bool)
+	priority, hasTripPriority := "", false
+	coalescedTrips := 0
+	data := o.newAlertMessageData()
+	data.MemoryOK = true
+	magnitude := 0.0
+	for _, trip := range trips {
+		name := trip.Breaker
+		if name == "" {
+			name = data.API
+		}
+		breakers[name] = true
+		if trip.Reason != "" {
+			reasons[trip.Reason] = true
+		}
+		if trip.CorrelationID != "" {
+			correlationIDs[trip.CorrelationID] = true
+		}
+		coalescedTrips += trip.CoalescedTrips
+
+		// A trip without its own priority has the global one; P1 is the most severe
+		tripPriority := trip.Priority
+		if tripPriority == "" {
+			tripPriority = o.currentConfig().Priority
+		} else {
+			hasTripPriority = true
+		}
+		if !isValidPriority(tripPriority) {
+			tripPriority = "P3"
+		}
+		if priority == "" || tripPriority < priority {
+			priority = tripPriority
+		}
+		if trip.LatencyMs > data.LatencyMs {
+			data.LatencyMs = trip.LatencyMs
+		}
+		if trip.WaitTime > data.WaitTimeSeconds {
+			data.WaitTimeSeconds = trip.WaitTime
+		}
+		data.MemoryOK = data.MemoryOK && trip.MemoryOK
+		magnitude = max(magnitude, breachMagnitude(float64(trip.LatencyMs), float64(trip.LatencyThresholdMs)))
+	}
+	breakerNames := sortedKeys(breakers)
+	reasonNames := sortedKeys(reasons)
+	correlationIDNames := sortedKeys(correlationIDs)
+
+	message := truncateAlertMessage(fmt.Sprintf("%s (%d trips)", o.RenderAlertMessage(MessageTemplateOpen, data), len(trips)))
+	description := fmt.Sprintf("%d breaker trips within %ds: %s\n\n%s",
+		len(trips), o.currentConfig().AlertAggregationSeconds, strings.Join(breakerNames, ", "), o.buildEnhancedDescription())
+
+	specificDetails := map[string]string{
+		"Latency":             fmt.Sprintf("%d", data.LatencyMs),
+		"Memory OK":           fmt.Sprintf("%t", data.MemoryOK),
+		"Wait Time":           fmt.Sprintf("%d", data.WaitTimeSeconds),
+		"Alert Type":          alertType,
+		"Trip Count":          fmt.Sprintf("%d", len(trips)),
+		"Affected Breakers":   strings.Join(breakerNames, ", "),
+		"Aggregation Seconds": fmt.Sprintf("%d", o.currentConfig().AlertAggregationSeconds),
+	}
+	if len(reasonNames) > 0 {
+		specificDetails["Trigger Reason"] = strings.Join(reasonNames, ", ")
+	}
+	if len(correlationIDNames) > 0 {
+		specificDetails["Correlation IDs"] = strings.Join(correlationIDNames, ", ")
+	}
+	if coalescedTrips > 0 {
+		specificDetails["Coalesced Trips"] = fmt.Sprintf("%d", coalescedTrips)
+		description = coalescedTripsNote(coalescedTrips) + description
+	}
+
+	req, err := o.createValidatedAlertRequest(alertType, message, description, specificDetails)
+	if err != nil {
+		log.Printf("Failed to create validated alert request: %v", err)
+		return err
+	}
+	if hasTripPriority {
+		req.Priority = alertPriority(o.scaledPriority(priority, "", magnitude))
+	} else {
+		o.scaleAlertPriority(req, magnitude)
+	}
+	req.Tags = append(req.Tags, "aggregated")
+	for _, reason := range reasonNames {
+		req.Tags = append(req.Tags, "reason:"+reason)
+	}
+	for _, correlationID := range correlationIDNames {
+		req.Tags = append(req.Tags, "correlation_id:"+correlationID)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), opsGenieRequestTimeout)
+	defer cancel()
+	requestID, err := o.createAlert(ctx, alertType, req)
+	if err != nil {
+		log.Printf("Error sending OpsGenie alert: %v", err)
+		return err
+	}
+
+	o.RecordAlert(alertKey)
+	o.recordAlias(alertType, req.Alias)
+
+	log.Printf("ALERT SENT: Circuit breaker OPEN alert for %d trips (%s) sent to OpsGenie. RequestID: %s, Priority: %s, Key: %s",
+		len(trips), strings.Join(breakerNames, ", "), requestID, req.Priority, alertKey)
+
+	return nil
+}
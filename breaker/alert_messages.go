@@ -0,0 +1,130 @@
+package breaker
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"text/template"
+)
+
+// Keys of message_templates, one per alert sent by the Send*Alert methods
+const (
+	MessageTemplateOpen       = "open"
+	MessageTemplateReset      = "reset"
+	MessageTemplateMemory     = "memory"
+	MessageTemplateMemoryWarn = "memory-warning"
+	MessageTemplateLatency    = "latency"
+	MessageTemplateStuckOpen  = "stuck-open"
+)
+
+// maxAlertMessageLength is the longest message accepted by the OpsGenie API
+const maxAlertMessageLength = 130
+
+// defaultMessageTemplates are used for the alert types without a configured template
+var defaultMessageTemplates = map[string]string{
+	MessageTemplateOpen:       `[{{.Environment}}] Circuit Breaker OPEN - {{.API}}`,
+	MessageTemplateReset:      `[{{.Environment}}] Circuit Breaker RESET{{if .ResetReason}} ({{.ResetReason}}){{end}} - {{.API}}`,
+	MessageTemplateMemory:     `[{{.Environment}}] Memory Threshold Exceeded - {{.API}} ({{printf "%.2f" .MemoryUsagePercent}}%)`,
+	MessageTemplateMemoryWarn: `[{{.Environment}}] Memory Usage Approaching Threshold - {{.API}} ({{printf "%.2f" .MemoryUsagePercent}}%)`,
+	MessageTemplateLatency:    `[{{.Environment}}] High Latency Detected - {{.API}} ({{.LatencyMs}}ms)`,
+	MessageTemplateStuckOpen:  `[{{.Environment}}] Circuit Breaker STUCK OPEN - {{.API}} ({{.OpenSeconds}}s)`,
+}
+
+// AlertMessageData is the data available to the message templates. Metrics that do not
+// apply to an alert type are zero (e.g. LatencyMs in a memory alert).
+type AlertMessageData struct {
+	// Mandatory fields, with fallbacks applied
+	Team        string
+	Environment string
+	BookmakerID string
+	Host        string
+	Business    string
+
+	// API information
+	API         string // Namespace/name of the API, or the alert source
+	APIName     string
+	ServiceTier string
+
+	// Metrics
+	LatencyMs              int64
+	ThresholdMs            int64
+	MemoryOK               bool
+	MemoryUsagePercent     float64
+	MemoryThresholdPercent float64
+	WaitTimeSeconds        int
+	OpenSeconds            int64  // How long the breaker has been open (stuck-open alert)
+	ResetReason            string // ResetAlertAutomatic, ResetAlertManual or empty (reset alert)
+}
+
+// validateMessageTemplate returns why a message_templates entry cannot be used, or ""
+func validateMessageTemplate(key, text string) string {
+	if _, known := defaultMessageTemplates[key]; !known {
+		return fmt.Sprintf("unknown alert type %q (must be one of %s)", key, strings.Join(sortedKeys(defaultMessageTemplates), ", "))
+	}
+	// Executing catches references to unknown fields, which parsing does not
+	if _, err := executeMessageTemplate(key, text, AlertMessageData{}); err != nil {
+		return fmt.Sprintf("invalid template for %q: %v", key, err)
+	}
+	return ""
+}
+
+// newAlertMessageData fills the template data shared by every alert type
+func (o *OpsGenieClient) newAlertMessageData() AlertMessageData {
+	mandatoryFields := o.buildMandatoryFieldsWithFallbacks()
+	return AlertMessageData{
+		Team:        mandatoryFields["Team"],
+		Environment: mandatoryFields["Environment"],
+		BookmakerID: mandatoryFields["BookmakerId"],
+		Host:        mandatoryFields["Host"],
+		Business:    mandatoryFields["Business"],
+		API:         o.getAPIIdentifier(),
+		APIName:     o.currentConfig().APIName,
+		ServiceTier: o.currentConfig().ServiceTier,
+	}
+}
+
+// RenderAlertMessage renders the message of an alert with the template configured for
+// alertType in message_templates. The built-in message is used when there is no such
+// template or when it fails, and messages longer than OpsGenie accepts are truncated.
+func (o *OpsGenieClient) RenderAlertMessage(alertType string, data AlertMessageData) string {
+	if o != nil && o.currentConfig() != nil {
+		if text, exists := o.currentConfig().MessageTemplates[alertType]; exists {
+			message, err := executeMessageTemplate(alertType, text, data)
+			if err == nil && message != "" {
+				return truncateAlertMessage(message)
+			}
+			if err == nil {
+				err = fmt.Errorf("empty message")
+			}
+			log.Printf("Warning: OpsGenie message template for %q failed, using the default message: %v", alertType, err)
+		}
+	}
+
+	text, known := defaultMessageTemplates[alertType]
+	message, err := executeMessageTemplate(alertType, text, data)
+	if !known || err != nil {
+		return truncateAlertMessage(fmt.Sprintf("[%s] Circuit Breaker %s - %s", data.Environment, alertType, data.API))
+	}
+	return truncateAlertMessage(message)
+}
+
+func executeMessageTemplate(name, text string, data AlertMessageData) (string, error) {
+	tmpl, err := template.New(name).Parse(text)
+	if err != nil {
+		return "", err
+	}
+
+	var message strings.Builder
+	if err := tmpl.Execute(&message, data); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(message.String()), nil
+}
+
+func truncateAlertMessage(message string) string {
+	runes := []rune(message)
+	if len(runes) <= maxAlertMessageLength {
+		return message
+	}
+	return string(runes[:maxAlertMessageLength-3]) + "..."
+}
@@ -1,16 +1,43 @@
 package breaker
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"math"
+	"math/rand"
 	"runtime"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
+// LabeledBreaker is a Breaker that records a label with each latency. BreakerDriver and
+// CompositeBreaker implement it; it is separate from Breaker so that implementations of
+// Breaker outside this package need not.
+type LabeledBreaker interface {
+	Breaker
+
+	// DoneLabeled behaves like Done and records the latency with a label (an endpoint
+	// path or a customer tier, for instance) that tells which operation was slow
+	DoneLabeled(startTime, endTime time.Time, label string)
+
+	// LatencyRecordsAboveThreshold returns the records of the recent latencies above
+	// threshold (in milliseconds), with their labels, oldest first
+	LatencyRecordsAboveThreshold(threshold int64) []LatencyRecord
+}
+
+var _ LabeledBreaker = (*BreakerDriver)(nil)
+
 type Breaker interface {
 	Allow() bool                       // Returns if the operation can continue and updates the state of the Breaker
 	Done(startTime, endTime time.Time) // Reports the latency of an operation finished
-	TriggeredByLatencies() bool        // Indicate if the BreakerDriver is activated
+	Triggered() bool                   // Indicates if the Breaker is open, whatever the reason
 	Reset()                            // Restores the state of Breaker
+	ResetState()                       // Closes the Breaker keeping the latency history
 	LatenciesAboveThreshold(threshold int64) []int64
 	MemoryOK() bool
 	LatencyOK() bool
@@ -18,48 +45,174 @@ type Breaker interface {
 	Disable()
 	Enable()
 	GetConfigFile() string
+	Close() error // Stops background workers owned by the Breaker; safe to call more than once
+
+	// AllowCtx and DoneCtx behave like Allow and Done, and also report the decision
+	// to the decision hook (see DecisionHook) with the given context
+	AllowCtx(ctx context.Context) bool
+	DoneCtx(ctx context.Context, startTime, endTime time.Time)
+
+	// DoneDependency behaves like Done and also attributes the latency to the named
+	// downstream dependency, so that the slowest dependency can be reported
+	DoneDependency(dependency string, startTime, endTime time.Time)
+
+	// DoneWithStatus behaves like Done unless statusCode matches excluded_status_codes,
+	// in which case the latency is not recorded
+	DoneWithStatus(startTime, endTime time.Time, statusCode int)
+
+	// DoneWithError behaves like Done for a failed operation; a positive retryAfter (the
+	// downstream's backoff request) keeps an open breaker open at least that long
+	DoneWithError(startTime, endTime time.Time, err error, retryAfter time.Duration)
+
+	// TripReason returns why the breaker is open (one of the TripReason constants, or
+	// several joined with "+"), or an empty string when it is closed
+	TripReason() string
+
+	// TriggeredByLatencies indicates if the Breaker is open because of its latencies.
+	//
+	// Deprecated: use Triggered, which also covers memory and remote trips, or TripReason.
+	TriggeredByLatencies() bool
 }
 
 type BreakerDriver struct {
 	mu             sync.Mutex
 	config         Config
 	triggered      bool
+	tripReason     string // Why the breaker tripped; meaningful only while triggered
 	lastTripTime   time.Time
 	latencyWindow  *LatencyWindow
-	enabled        bool
+	enabled        atomic.Bool // Written with the lock held; read without it on the hot paths
 	logger         *Logger
 	opsGenieClient *OpsGenieClient // OpsGenie client for sending alerts
 	configFile     string          // Path to the config file that was used to create this breaker
+	registeredName string          // Name in DefaultRegistry, if registered (see Config.Name)
 
 	stagedAlertManager *StagedAlertManager // stagedAlertManager manages the staggered alert system for circuit breaker events.
 	lastTriggerTime    time.Time           //
+	closed             bool                // Set once Close has released the background workers
+	decisionHook       DecisionHook        // Observer of the decisions taken through AllowCtx/DoneCtx
+	slowCorrelationID  string              // Correlation ID of the latest request above the latency threshold (see DoneCtx)
+	tripCorrelationID  string              // slowCorrelationID when the breaker last tripped on latency
+
+	dependencyWindows   map[string]*LatencyWindow // Latency windows per downstream dependency (see DoneDependency)
+	excludedStatusCodes []StatusCodeRange         // Status codes whose latencies are ignored (see DoneWithStatus)
+
+	memoryOverride   atomic.Pointer[bool] // Forced result of MemoryOK; nil uses the real check (see SetMemoryOverride)
+	memoryThreshold  atomic.Uint64        // Bits of config.MemoryThreshold, which MemoryOK reads without the lock
+	memoryFailClosed atomic.Bool          // memory_check_failure_policy is closed, read by MemoryOK without the lock
+
+	sampling       atomic.Pointer[samplingPolicy] // Read by Done without the lock (see sample_rate)
+	lastPercentile atomic.Int64                   // Latency percentile computed by the last recorded Done
+
+	latencySeries *percentileSeries // Recent percentiles, one per second (see LatencySeries)
+
+	stateStore    StateStore         // Store shared with other replicas, if any (see SetStateStore)
+	instanceID    string             // Identifies this breaker in the shared states it publishes
+	remoteTrip    bool               // The breaker is open because another replica tripped
+	cancelSharing context.CancelFunc // Stops the shared state subscription and publisher
+	sharing       sync.WaitGroup     // Subscription and publisher goroutines
+	pendingStates []SharedState      // States waiting for the publisher, oldest first
+	publishSignal chan struct{}      // Wakes the publisher when pendingStates grows
+
+	clock Clock // Tells the time; nil means RealClock (see SetClock)
+
+	retryAfterUntil time.Time   // The breaker stays open until then (see DoneWithError)
+	breachStart     time.Time   // When the latency went above the threshold (see breach_duration_seconds); zero while below
+	recoveryChecks  int         // Consecutive trial requests after the wait time that found latency OK (see recovery_consecutive_checks)
+	recoveryTrial   time.Time   // When Allow let through the trial request whose Done is awaited; zero if none
+	nextRecovery    time.Time   // When Allow may let the next trial request through (see recovery_check_interval_seconds)
+	warmupTrials    int         // Trial requests let through by a fail-closed warm-up since nextWarmup minus the interval
+	nextWarmup      time.Time   // When a fail-closed warm-up may let the next batch of trial requests through
+	probe           *probeState // Active-probe mode, nil when disabled (see SetProbe)
+
+	openSince        time.Time      // When the current open episode began; lastTripTime moves on every trip
+	lastCloseTime    time.Time      // When the breaker last closed by itself; a re-trip within wait_time continues the episode
+	stuckOpenAlerted bool           // The stuck-open alert was sent in the current open episode
+	stopStuckOpen    chan struct{}  // Stops the stuck-open check (see max_open_duration_seconds)
+	stuckOpenMonitor sync.WaitGroup // Stuck-open check
+
+	checksConnectivity bool // Holds the OpsGenie connectivity check of its client (see connectivity_check_seconds)
+
+	events         atomic.Pointer[chan BreakerEvent] // Created by Events; nil until then
+	droppedEvents  atomic.Uint64                     // Events dropped because the buffer was full
+	memoryBreached bool                              // Memory was above the threshold at the last Done
+	memoryWarned   bool                              // Memory was above memory_warn_threshold at the last Done
+	tripCount      atomic.Uint64                     // Times the breaker went from closed to open (see TripCount)
+	rejectedCount  atomic.Uint64                     // Requests denied by Allow (see RejectedCount)
+	tripTimes      []time.Time                       // When the recent trips happened, oldest first (see RecentTripCount)
+}
+
+// DecisionEvent describes a decision taken by the breaker through AllowCtx or DoneCtx
+type DecisionEvent struct {
+	Operation         string  // "allow" or "done"
+	Allowed           bool    // Result of AllowCtx (always true for done)
+	Triggered         bool    // Whether the breaker is open after the operation
+	Enabled           bool    // Whether the breaker is enabled
+	LatencyMs         int64   // Latency reported to DoneCtx (zero for allow)
+	LatencyPercentile int64   // Current latency percentile in milliseconds
+	LatencyThreshold  int64   // Configured latency threshold in milliseconds
+	Percentile        float64 // Configured percentile
+}
+
+// DecisionHook is called after every AllowCtx/DoneCtx with the context given by the
+// caller, so integrations (e.g. tracing, see the otelbreaker package) can annotate it
+type DecisionHook func(ctx context.Context, event DecisionEvent)
+
+// globallyDisabled is the process-wide switch set by SetGloballyDisabled
+var globallyDisabled atomic.Bool
+
+// SetGloballyDisabled turns circuit breaking off (true) or back on (false) for every
+// breaker in the process. While it is off, Allow always returns true whatever the state
+// of each breaker. Latencies are still recorded, so breakers reflect the real state of
+// their dependencies when circuit breaking is turned back on.
+func SetGloballyDisabled(disabled bool) {
+	if globallyDisabled.Swap(disabled) != disabled {
+		log.Printf("Circuit breaking globally disabled: %t", disabled)
+	}
+}
+
+// IsGloballyDisabled reports whether circuit breaking is turned off for every breaker
+func IsGloballyDisabled() bool {
+	return globallyDisabled.Load()
 }
 
 func (b *BreakerDriver) IsEnabled() bool {
-	b.mu.Lock()
-	defer b.mu.Unlock()
-	return b.enabled
+	return b.enabled.Load()
 }
 
 func (b *BreakerDriver) Disable() {
 	b.mu.Lock()
 	defer b.mu.Unlock()
-	b.enabled = false
+	b.enabled.Store(false)
 }
 
 func (b *BreakerDriver) Enable() {
 	b.Reset()
 }
 
-func NewBreaker(config *Config, configFile string) Breaker {
-
+// newConfiguredLatencyWindow creates a latency window sized and aged according to config
+func newConfiguredLatencyWindow(config *Config) *LatencyWindow {
 	lw := NewLatencyWindow(config.LatencyWindowSize)
+	configureLatencyWindow(lw, config)
+	return lw
+}
 
+// configureLatencyWindow applies the age and trend settings of config to a window that
+// is not shared yet
+func configureLatencyWindow(lw *LatencyWindow, config *Config) {
 	// Use the WaitTime value (in seconds) as the maximum age for latencies
 	// This means latencies older than the circuit breaker wait time will not be considered
 	if config.WaitTime > 0 {
 		lw.MaxAgeSeconds = config.WaitTime
 	}
+	lw.TrendWindowSize = config.TrendWindowSize
+	lw.MaxLatencyMs = config.MaxAcceptedLatencyMs
+	lw.PercentileMethod = config.PercentileMethod
+}
+
+func NewBreaker(config *Config, configFile string) Breaker {
+
+	lw := newConfiguredLatencyWindow(config)
 
 	// Create a new OpsGenie client if configuration is provided
 	var opsGenieClient *OpsGenieClient
@@ -103,13 +256,38 @@ func NewBreaker(config *Config, configFile string) Breaker {
 		}
 	}
 
+	excludedStatusCodes, err := ParseStatusCodeRanges(config.ExcludedStatusCodes)
+	if err != nil {
+		logger.Logf("Warning: ignoring excluded_status_codes: %v", err)
+	}
+
 	driver := &BreakerDriver{
-		config:         *config,
-		latencyWindow:  lw,
-		enabled:        true,
-		logger:         logger,
-		opsGenieClient: opsGenieClient,
-		configFile:     configFile,
+		config:              *config,
+		latencyWindow:       lw,
+		logger:              logger,
+		opsGenieClient:      opsGenieClient,
+		configFile:          configFile,
+		dependencyWindows:   make(map[string]*LatencyWindow),
+		excludedStatusCodes: excludedStatusCodes,
+		latencySeries:       newPercentileSeries(config.LatencySeriesSize),
+	}
+
+	if !config.TripsOnMemory() && !config.TripsOnLatency() {
+		logger.Logf("Warning: trip_on_memory and trip_on_latency are both false; the breaker will never open")
+	}
+
+	driver.enabled.Store(true)
+	driver.sampling.Store(newSamplingPolicy(config))
+	driver.memoryThreshold.Store(math.Float64bits(config.MemoryThreshold))
+	driver.memoryFailClosed.Store(config.memoryCheckFailurePolicy() == MemoryCheckFailClosed)
+	if config.TripsOnMemory() {
+		logger.Logf("Memory check failure policy: %s (memory limit %s)", config.memoryCheckFailurePolicy(), memoryLimitStatus())
+	}
+	if config.SampleRate > 0 && config.SampleRate < 1 {
+		logger.Logf("Sampling %.0f%% of latencies below %dms", config.SampleRate*100, driver.sampling.Load().nearLatency)
+	}
+	if percent := config.protectionPercent(); percent < 100 {
+		logger.Logf("Protecting %.2f%% of requests; the others pass through whatever the breaker state", percent)
 	}
 
 	// Initialize the staged alert manager
@@ -119,6 +297,14 @@ func NewBreaker(config *Config, configFile string) Breaker {
 		logger.Logf("Staged alerting enabled (escalation after %ds)", config.OpsGenie.TimeBeforeSendAlert)
 	}
 
+	driver.startStuckOpenMonitor()
+	driver.startConnectivityMonitor()
+
+	if config.Name != "" {
+		driver.registeredName = config.Name
+		DefaultRegistry.Register(config.Name, driver)
+	}
+
 	return driver
 }
 
@@ -134,7 +320,7 @@ func NewBreakerFromConfigFile(configPath string) (Breaker, error) {
 	}
 
 	// If the OpsGenie section is present but incomplete, try loading from a separate OpsGenie config file
-	if config.OpsGenie != nil && config.OpsGenie.Enabled && config.OpsGenie.APIKey == "" {
+	if config.OpsGenie != nil && config.OpsGenie.Enabled && config.OpsGenie.APIKey == "" && config.OpsGenie.APIKeyFile == "" {
 		// Try to load from the default OpsGenie config path
 		opsGenieConfig, opsGenieErr := LoadOpsGenieConfig(GetOpsGenieConfigPath())
 		if opsGenieErr == nil {
@@ -156,68 +342,482 @@ func (b *BreakerDriver) isHealthy() bool {
 	return b.MemoryOK() && b.LatencyOK()
 }
 
+// Allow reports whether the operation can continue and updates the state of the breaker.
+// With protection_percent below 100, a random share of the calls passes through whatever
+// the state; AllowKey picks that share by key instead.
 func (b *BreakerDriver) Allow() bool {
+	return b.allow(rand.Float64() * 100)
+}
+
+// AllowKey behaves like Allow, but decides whether the call is protected (see
+// protection_percent) from a hash of key, so that the same key (a user or tenant ID,
+// for instance) is always protected or always passed through
+func (b *BreakerDriver) AllowKey(key string) bool {
+	return b.allow(keyPercent(key))
+}
+
+// keyPercent maps key to a value in [0, 100), uniformly enough for protection_percent
+func keyPercent(key string) float64 {
+	hash := fnv.New32a()
+	hash.Write([]byte(key))
+	return float64(hash.Sum32()%10000) / 100
+}
+
+// allow implements Allow for a call that falls at roll, in [0, 100), of the traffic.
+// Calls at or above protection_percent pass through.
+func (b *BreakerDriver) allow(roll float64) bool {
+	// A disabled breaker lets everything through without taking the lock
+	if IsGloballyDisabled() || !b.enabled.Load() {
+		return true
+	}
+
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
-	if !b.enabled {
+	// Disable may have run while waiting for the lock
+	if !b.enabled.Load() {
+		return true
+	}
+
+	if roll >= b.config.protectionPercent() {
 		return true
 	}
 
 	if b.triggered {
-		timeWaiting := time.Since(b.lastTripTime)
+		now := b.now()
+		timeWaiting := now.Sub(b.lastTripTime)
 		waitDuration := time.Duration(b.config.WaitTime) * time.Second
-		memoryStatus := b.MemoryOK()
+		memoryStatus := b.memoryGateOK()
 
 		b.logger.Logf("Breaker Allow check: triggered=%v, time since trip=%v, wait time=%v, memory ok=%v",
 			b.triggered, timeWaiting, waitDuration, memoryStatus)
 
-		if timeWaiting > waitDuration && memoryStatus {
-			b.triggered = false
-			b.logger.BreakerReset()
-			b.logger.Logf("INFO: Breaker automatically reset after waiting %v (required %v) and memory status OK",
-				timeWaiting, waitDuration)
+		retryAfterPending := now.Before(b.retryAfterUntil)
+
+		// An open breaker only records the latencies of the requests it does not protect
+		// (see protection_percent) and of those started before the trip, so after the
+		// wait the window cannot tell whether the downstream recovered. The breaker goes
+		// half-open instead: it lets a trial request through every
+		// recovery_check_interval_seconds, and Done closes it once
+		// recovery_consecutive_checks trials in a row were fast enough (see
+		// recoverFromTrial). In the active-probe mode only the probes close the breaker.
+		probing := b.probe != nil && !b.remoteTrip
+		waited := !probing && timeWaiting > waitDuration && memoryStatus && !retryAfterPending
+		if !waited {
+			b.recoveryChecks = 0
+			b.recoveryTrial = time.Time{}
+		} else if !now.Before(b.nextRecovery) {
+			b.nextRecovery = now.Add(b.config.recoveryCheckInterval())
+			if b.recoveryNeedsTrials() {
+				b.recoveryTrial = now
+				b.logger.Logf("HALF-OPEN: Letting a trial request through after waiting %v (%d of %d checks OK)",
+					timeWaiting, b.recoveryChecks, b.config.recoveryConsecutiveChecks())
+				return true
+			}
 
-			// Send OpsGenie alert for breaker reset
-			if b.opsGenieClient != nil && b.config.OpsGenie != nil && b.config.OpsGenie.Enabled {
-				go func() {
-					if err := b.opsGenieClient.SendBreakerResetAlert(); err != nil {
-						b.logger.Logf("Failed to send OpsGenie alert for breaker reset: %v", err)
-					}
-				}()
+			// Memory, the only condition that can trip the breaker, was just read
+			b.recoveryChecks++
+			if b.recoveryChecks >= b.config.recoveryConsecutiveChecks() {
+				b.resetAfterRecovery(ResetReasonWaitTime)
+				b.logger.Logf("INFO: Breaker automatically reset after waiting %v (required %v) with memory OK",
+					timeWaiting, waitDuration)
+				return true
 			}
+		}
+
+		if !memoryStatus {
+			b.logger.Logf("DENY: Request denied because memory is still above threshold")
+			b.reject(TripReasonMemory)
+		} else if retryAfterPending {
+			b.logger.Logf("DENY: Request denied because the downstream asked to retry after %s",
+				b.retryAfterUntil.Format(time.RFC3339))
+			b.reject(RejectReasonRetryAfter)
+		} else if probing {
+			b.logger.Logf("DENY: Request denied because the breaker is open until probes succeed")
+			b.reject(RejectReasonProbing)
+		} else if waited {
+			b.logger.Logf("DENY: Request denied while the breaker is half-open: %d of %d checks OK, next one at %s",
+				b.recoveryChecks, b.config.recoveryConsecutiveChecks(), b.nextRecovery.Format(time.RFC3339))
+			b.reject(RejectReasonRecovering)
 		} else {
-			if !memoryStatus {
-				b.logger.Logf("DENY: Request denied because memory is still above threshold")
-			} else {
-				b.logger.Logf("DENY: Request denied because wait time (%v) has not elapsed yet (%v passed)",
-					waitDuration, timeWaiting)
-			}
-			return false
+			b.logger.Logf("DENY: Request denied because wait time (%v) has not elapsed yet (%v passed)",
+				waitDuration, timeWaiting)
+			b.reject(RejectReasonOpen)
 		}
+		return false
 	}
 
-	memoryOk := b.MemoryOK()
+	memoryOk := b.memoryGateOK()
 	if !memoryOk {
 		b.logger.Logf("DENY: Request denied due to memory threshold exceeded")
+		b.reject(TripReasonMemory)
+		return false
 	}
-	return memoryOk
+
+	// Without enough latencies the breaker cannot tell a healthy dependency from an
+	// unmeasured one (see warmup_policy). Since latencies come from allowed requests,
+	// fail-closed still lets the missing number of trial requests through every
+	// recovery_check_interval_seconds, so that a breaker without traffic warms up.
+	if b.config.WarmupPolicy == WarmupFailClosed && b.config.TripsOnLatency() && !b.hasSufficientData() {
+		now := b.now()
+		if !now.Before(b.nextWarmup) {
+			b.warmupTrials = 0
+			b.nextWarmup = now.Add(b.config.recoveryCheckInterval())
+		}
+		missing := b.config.warmupMinSamples() - b.latencyWindow.RecentSampleCount()
+		if b.warmupTrials < missing {
+			b.warmupTrials++
+			b.logger.Logf("WARM-UP: Letting a trial request through (%d of %d missing latencies)",
+				b.warmupTrials, missing)
+			return true
+		}
+
+		b.logger.Logf("DENY: Request denied because the latency window holds fewer than %d recent latencies",
+			b.config.warmupMinSamples())
+		b.reject(RejectReasonWarmup)
+		return false
+	}
+	return true
+}
+
+// resetAfterRecovery closes the breaker once the downstream recovered, as found by
+// Allow after the wait time or by the probes, and sends the automatic reset alert. It
+// must run in a critical section.
+func (b *BreakerDriver) resetAfterRecovery(reason string) {
+	if !b.remoteTrip {
+		b.publishState(false, time.Time{})
+	}
+	b.triggered = false
+	b.remoteTrip = false
+	b.lastCloseTime = b.now()
+	b.resetRecovery()
+	b.emitEvent(EventReset, reason)
+	b.logger.BreakerReset()
+
+	// Send OpsGenie alert for breaker reset
+	if b.opsGenieClient != nil && b.config.OpsGenie != nil && b.config.OpsGenie.Enabled {
+		go func() {
+			if err := b.opsGenieClient.SendBreakerResetAlertWithReason(ResetAlertAutomatic); err != nil {
+				b.logger.Logf("Failed to send OpsGenie alert for breaker reset: %v", err)
+			}
+		}()
+	}
+}
+
+// resetRecovery forgets the recovery checks and trial requests of the last opening. It
+// must run in a critical section.
+func (b *BreakerDriver) resetRecovery() {
+	b.recoveryChecks = 0
+	b.recoveryTrial = time.Time{}
+	b.nextRecovery = time.Time{}
+}
+
+// recoveryNeedsTrials reports whether the breaker needs trial requests to close, that
+// is, whether latency can trip it
+func (b *BreakerDriver) recoveryNeedsTrials() bool {
+	return b.config.TripsOnLatency() || b.config.tripsOnHealthScore()
+}
+
+// isTrial reports whether the request that started at startTime can be the awaited
+// trial request. Requests started before Allow let the trial through, such as those in
+// flight when the breaker tripped, cannot; one started since then, even if it is not
+// protected (see protection_percent), reached the downstream after the wait time and is
+// judged as the trial. It must run in a critical section.
+func (b *BreakerDriver) isTrial(startTime time.Time) bool {
+	return b.triggered && !b.recoveryTrial.IsZero() && !startTime.Before(b.recoveryTrial)
+}
+
+// recoverFromTrial judges the trial request let through by Allow after the wait time,
+// from its latency and the latency percentile (in nanoseconds) with it:
+// recovery_consecutive_checks trials in a row that succeed close the breaker, and one
+// that fails keeps it open for another wait time. It must run in a critical section.
+func (b *BreakerDriver) recoverFromTrial(latency time.Duration, percentileNs int64, memoryOK bool, now time.Time) {
+	b.recoveryTrial = time.Time{}
+	if failure := b.trialFailure(latency, percentileNs, memoryOK); failure != "" {
+		b.recoveryChecks = 0
+		b.lastTripTime = now
+		b.logger.Logf("Trial request failed, the breaker stays open for another %ds: %s", b.config.WaitTime, failure)
+		return
+	}
+
+	b.recoveryChecks++
+	required := b.config.recoveryConsecutiveChecks()
+	if b.recoveryChecks < required {
+		b.logger.Logf("Trial request succeeded in %v (%d of %d)", latency, b.recoveryChecks, required)
+		return
+	}
+	b.resetAfterRecovery(ResetReasonWaitTime)
+	b.logger.Logf("INFO: Breaker automatically reset after %d successful trial requests (last one took %v)", required, latency)
+}
+
+// trialFailure tells why a trial request failed, or returns an empty string when it
+// succeeded: the trial and the latency percentile must both be below the threshold, so
+// that the breaker does not close while the other recent latencies are still slow. It
+// must run in a critical section.
+func (b *BreakerDriver) trialFailure(latency time.Duration, percentileNs int64, memoryOK bool) string {
+	if b.config.tripsOnHealthScore() {
+		if score := b.healthScore(max(latency.Nanoseconds(), percentileNs), memoryOK); score >= b.config.HealthScoreThreshold {
+			return fmt.Sprintf("health score %.2f is not below the threshold of %.2f", score, b.config.HealthScoreThreshold)
+		}
+		return ""
+	}
+	if b.config.TripsOnMemory() && !memoryOK {
+		return "memory is above the threshold"
+	}
+	if b.config.TripsOnLatency() && percentileNs >= millisToNanos(b.config.LatencyThreshold) {
+		return fmt.Sprintf("latency percentile %dms is not below the threshold of %dms", nanosToMillis(percentileNs), b.config.LatencyThreshold)
+	}
+	return b.probeFailure(latency, nil)
+}
+
+// reject counts a request denied by Allow and emits its rejected event
+func (b *BreakerDriver) reject(reason string) {
+	b.rejectedCount.Add(1)
+	b.emitEvent(EventRejected, reason)
+}
+
+// memoryGateOK returns MemoryOK, or true when memory is out of the trip scope (see
+// trip_on_memory) or only counts through the health score (see health_score_threshold)
+func (b *BreakerDriver) memoryGateOK() bool {
+	return !b.config.TripsOnMemory() || b.config.tripsOnHealthScore() || b.MemoryOK()
+}
+
+// Track starts timing an operation and returns a function that reports its latency
+// through Done when called, so that the measured interval cannot be wrong:
+//
+//	if !b.Allow() {
+//		return errServiceUnavailable
+//	}
+//	defer b.Track()()
+//
+// The function records the latency only once: calling it again (for instance from both
+// a defer and an early return) logs a warning instead of skewing the window with a
+// second sample of the same operation.
+func (b *BreakerDriver) Track() func() {
+	startTime := b.now()
+	var recorded atomic.Bool
+	return func() {
+		if recorded.Swap(true) {
+			b.logger.Logf("WARNING: the latency of an operation started at %v was already recorded; ignoring the repeated Done",
+				startTime.Format(time.RFC3339Nano))
+			return
+		}
+		b.Done(startTime, b.now())
+	}
+}
+
+// AllowCtx behaves like Allow and reports the decision to the decision hook, if any
+func (b *BreakerDriver) AllowCtx(ctx context.Context) bool {
+	allowed := b.Allow()
+	b.notifyDecision(ctx, "allow", allowed, 0)
+	return allowed
+}
+
+// DoneCtx behaves like Done and reports the recorded latency to the decision hook, if any.
+// A correlation ID in ctx (see WithCorrelationID) is remembered if the latency is above
+// the threshold, and reported in the open alert if the breaker trips on latency.
+func (b *BreakerDriver) DoneCtx(ctx context.Context, startTime, endTime time.Time) {
+	b.done(startTime, endTime, CorrelationIDFromContext(ctx), "")
+
+	latency := endTime.Sub(startTime).Milliseconds()
+	if latency < 0 {
+		latency = 0
+	}
+	b.notifyDecision(ctx, "done", true, latency)
+}
+
+// SetDecisionHook installs the hook called after every AllowCtx/DoneCtx. A nil hook disables it.
+func (b *BreakerDriver) SetDecisionHook(hook DecisionHook) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.decisionHook = hook
+}
+
+// notifyDecision builds a DecisionEvent from the current state and passes it to the hook.
+// The hook runs outside the breaker lock.
+func (b *BreakerDriver) notifyDecision(ctx context.Context, operation string, allowed bool, latency int64) {
+	b.mu.Lock()
+	hook := b.decisionHook
+	if hook == nil {
+		b.mu.Unlock()
+		return
+	}
+
+	event := DecisionEvent{
+		Operation:         operation,
+		Allowed:           allowed,
+		Triggered:         b.triggered,
+		Enabled:           b.enabled.Load(),
+		LatencyMs:         latency,
+		LatencyPercentile: b.latencyWindow.Percentile(b.config.Percentile),
+		LatencyThreshold:  b.config.LatencyThreshold,
+		Percentile:        b.config.Percentile,
+	}
+	b.mu.Unlock()
+
+	hook(ctx, event)
+}
+
+// DoneDependency records the latency like Done and also in the window of the given
+// downstream dependency. An empty dependency behaves exactly like Done.
+func (b *BreakerDriver) DoneDependency(dependency string, startTime, endTime time.Time) {
+	if dependency != "" && b.enabled.Load() {
+		b.mu.Lock()
+		if b.enabled.Load() {
+			if b.dependencyWindows == nil {
+				b.dependencyWindows = make(map[string]*LatencyWindow)
+			}
+			window, exists := b.dependencyWindows[dependency]
+			if !exists {
+				window = newConfiguredLatencyWindow(&b.config)
+				window.Clock = b.clock
+				b.dependencyWindows[dependency] = window
+			}
+			window.Add(startTime, endTime)
+		}
+		b.mu.Unlock()
+	}
+
+	b.Done(startTime, endTime)
+}
+
+// DoneWithStatus reports the latency of an operation that finished with the given
+// HTTP status code. Latencies of excluded status codes (e.g. fast-failing 4xx client
+// errors) are dropped so they do not skew the trip decision.
+func (b *BreakerDriver) DoneWithStatus(startTime, endTime time.Time, statusCode int) {
+	if !b.enabled.Load() || b.isExcludedStatusCode(statusCode) {
+		return
+	}
+	b.Done(startTime, endTime)
+}
+
+// DoneWithError behaves like Done for an operation that failed with err. When the
+// downstream asked to back off, retryAfter is the duration it asked for (for instance
+// parsed with ParseRetryAfter from a 429 or 503 response). If the breaker is open after
+// recording the latency, it then stays open at least that long, on top of wait_time.
+func (b *BreakerDriver) DoneWithError(startTime, endTime time.Time, err error, retryAfter time.Duration) {
+	b.Done(startTime, endTime)
+
+	if err == nil || retryAfter <= 0 {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.enabled.Load() || !b.triggered {
+		return
+	}
+
+	if until := b.now().Add(retryAfter); until.After(b.retryAfterUntil) {
+		b.retryAfterUntil = until
+		b.logger.Logf("Downstream asked to retry after %v (%v); keeping the breaker open until %s",
+			retryAfter, err, until.Format(time.RFC3339))
+	}
+}
+
+// isExcludedStatusCode reports whether latencies with statusCode must not be recorded
+func (b *BreakerDriver) isExcludedStatusCode(statusCode int) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, r := range b.excludedStatusCodes {
+		if r.Contains(statusCode) {
+			return true
+		}
+	}
+	return false
+}
+
+// DependencyLatencies returns the current latency percentile of every dependency
+// with recent samples
+func (b *BreakerDriver) DependencyLatencies() map[string]int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.dependencyPercentiles()
+}
+
+// SlowestDependency returns the dependency with the highest latency percentile and
+// that percentile. It returns an empty name when no dependency has recent samples.
+func (b *BreakerDriver) SlowestDependency() (string, int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return slowestDependency(b.dependencyPercentiles())
+}
+
+// dependencyPercentiles must run in a critical section
+func (b *BreakerDriver) dependencyPercentiles() map[string]int64 {
+	percentiles := make(map[string]int64)
+	for dependency, window := range b.dependencyWindows {
+		if len(window.GetRecentLatencies()) == 0 {
+			continue
+		}
+		percentiles[dependency] = window.Percentile(b.config.Percentile)
+	}
+	return percentiles
+}
+
+// slowestDependency picks the highest percentile; ties are resolved by name so the result is stable
+func slowestDependency(percentiles map[string]int64) (string, int64) {
+	slowest := ""
+	var slowestLatency int64
+	for dependency, latency := range percentiles {
+		if slowest == "" || latency > slowestLatency || (latency == slowestLatency && dependency < slowest) {
+			slowest = dependency
+			slowestLatency = latency
+		}
+	}
+	return slowest, slowestLatency
 }
 
 func (b *BreakerDriver) Done(startTime, endTime time.Time) {
+	b.done(startTime, endTime, "", "")
+}
+
+// DoneLabeled behaves like Done and records the latency with label, so that
+// SlowestByLabel and the status can tell which operations were slow. An empty label
+// behaves exactly like Done.
+func (b *BreakerDriver) DoneLabeled(startTime, endTime time.Time, label string) {
+	b.done(startTime, endTime, "", label)
+}
+
+// done records a latency; correlationID identifies the request and label the
+// operation, if known
+func (b *BreakerDriver) done(startTime, endTime time.Time, correlationID, label string) {
+	// A disabled breaker records nothing, and sampling is decided before taking the
+	// lock, which is the point of sampling
+	if !b.enabled.Load() || !b.sampled(endTime.Sub(startTime).Milliseconds()) {
+		return
+	}
+
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
-	if !b.enabled {
+	// Disable may have run while waiting for the lock
+	if !b.enabled.Load() {
 		return
 	}
 
-	b.latencyWindow.Add(startTime, endTime)
-	latencyPercentile := b.latencyWindow.Percentile(b.config.Percentile)
-	memoryStatus := b.MemoryOK()
+	if endTime.Before(startTime) {
+		b.logger.Logf("WARNING: Done called with endTime %v before startTime %v; recording zero latency",
+			endTime.Format(time.RFC3339Nano), startTime.Format(time.RFC3339Nano))
+	}
 
-	// Check if latency is above the threshold
-	latencyAboveThreshold := latencyPercentile > b.config.LatencyThreshold
+	b.latencyWindow.AddLabeled(startTime, endTime, label)
+	if correlationID != "" && int64(endTime.Sub(startTime)) > millisToNanos(b.config.LatencyThreshold) {
+		b.slowCorrelationID = correlationID
+	}
+	percentileNs := b.latencyWindow.PercentileNs(b.config.Percentile)
+	latencyPercentile := nanosToMillis(percentileNs)
+	b.lastPercentile.Store(latencyPercentile)
+	b.latencySeries.add(endTime, latencyPercentile)
+	memoryStatus, usedBytes := b.memoryStatus()
+
+	now := b.now()
+	if b.isTrial(startTime) {
+		b.recoverFromTrial(endTime.Sub(startTime), percentileNs, memoryStatus, now)
+	}
+	latencyAboveThreshold := b.latencyBreached(percentileNs, now)
 
 	// Logging for debugging
 	b.logger.LatencyInfo(latencyPercentile, b.config.LatencyThreshold, latencyAboveThreshold)
@@ -229,80 +829,96 @@ func (b *BreakerDriver) Done(startTime, endTime time.Time) {
 		b.logger.Logf("ALERT: Latency %dms exceeds threshold of %dms", latencyPercentile, b.config.LatencyThreshold)
 	}
 
+	if !memoryStatus && !b.memoryBreached {
+		b.emitEvent(EventMemoryThresholdBreached, "")
+	}
+	b.memoryBreached = !memoryStatus
+	b.checkMemoryWarning(memoryStatus, usedBytes)
+
 	// Add explicit log when memory has issues
-	if !memoryStatus {
-		memStats := new(runtime.MemStats)
-		runtime.ReadMemStats(memStats)
+	if !memoryStatus && usedBytes >= 0 {
 		memLimit := float64(MemoryLimit) * (b.config.MemoryThreshold / 100.0)
 		b.logger.Logf("ALERT: Memory threshold exceeded - Current: %dMB, Limit: %.2fMB (%.2f%% of %dMB)",
-			memStats.Alloc/1024/1024, memLimit/1024/1024, b.config.MemoryThreshold, MemoryLimit/1024/1024)
+			usedBytes/1024/1024, memLimit/1024/1024, b.config.MemoryThreshold, MemoryLimit/1024/1024)
+	}
+
+	// Only the conditions within the trip scope (trip_on_memory, trip_on_latency) count
+	memoryBreach := !memoryStatus && b.config.TripsOnMemory()
+	latencyBreach := latencyAboveThreshold && b.config.TripsOnLatency()
+
+	// The health score, when configured, replaces the independent thresholds
+	scoreBreach := false
+	if b.config.tripsOnHealthScore() {
+		score := b.healthScore(percentileNs, memoryStatus)
+		scoreBreach = score >= b.config.HealthScoreThreshold
+		memoryBreach, latencyBreach = false, false
+		b.logger.Logf("Health score: %.2f (threshold %.2f)", score, b.config.HealthScoreThreshold)
 	}
 
 	// Determine whether to trigger the breaker
 	shouldTrigger := false
+	var tripReasons []string
 
 	// If there's a memory issue, always trigger
-	if !memoryStatus {
+	if memoryBreach {
 		shouldTrigger = true
+		tripReasons = append(tripReasons, TripReasonMemory)
 		b.logger.Logf("TRIGGER REASON: Memory threshold exceeded")
 	}
 
-	// For latency issues, check if we need to consider trend analysis
-	if latencyAboveThreshold {
-		if b.config.TrendAnalysisEnabled {
-			// Only trigger if there's a positive trend in latencies, or if latencies
-			// have been consistently high for a while (plateau)
-			hasTrend := b.latencyWindow.HasPositiveTrend(b.config.TrendAnalysisMinSampleCount)
-			b.logger.TrendAnalysisInfo(hasTrend)
-
-			if hasTrend {
-				b.logger.Logf("TRIGGER REASON: Latency above threshold AND positive trend detected")
-				shouldTrigger = true
-			} else {
-				// Check for a plateau - latencies consistently above threshold
-				// We consider it a plateau if we have at least 5 samples, and they're all above threshold
-				latencies := b.latencyWindow.GetRecentLatencies()
-
-				// If we have enough samples, and they're all high, consider it a plateau
-				if len(latencies) >= 5 {
-					allAboveThreshold := true
-					for _, lat := range latencies {
-						if lat <= b.config.LatencyThreshold {
-							allAboveThreshold = false
-							break
-						}
-					}
-
-					if allAboveThreshold {
-						b.logger.Logf("TRIGGER REASON: Latency plateau detected above threshold")
-						shouldTrigger = true
-					} else {
-						b.logger.Logf("Latency above threshold but NO positive trend or plateau. Not triggering breaker.")
-					}
-				} else {
-					b.logger.Logf("Latency above threshold but NO positive trend. Not triggering breaker.")
-				}
-			}
-		} else {
-			// No trend analysis, trigger based on a threshold only
+	if latencyBreach {
+		if reason := b.latencyTripReason(percentileNs); reason != "" {
 			shouldTrigger = true
-			b.logger.Logf("TRIGGER REASON: Latency above threshold (trend analysis disabled)")
+			tripReasons = append(tripReasons, reason)
 		}
 	}
 
+	if scoreBreach {
+		shouldTrigger = true
+		tripReasons = append(tripReasons, TripReasonHealthScore)
+		b.logger.Logf("TRIGGER REASON: Health score at or above threshold")
+	}
+
 	if shouldTrigger {
+		if !b.triggered || b.remoteTrip {
+			b.publishState(true, now)
+		}
+		tripReason := strings.Join(tripReasons, "+")
+		wasTriggered := b.triggered
+		if !wasTriggered {
+			b.markOpened(now)
+			b.breachStart = time.Time{}
+		}
 		b.triggered = true
-		b.lastTripTime = time.Now()
+		b.tripReason = tripReason
+		b.remoteTrip = false
+		b.lastTripTime = now
+		b.resetRecovery()
+		if b.probe != nil {
+			b.probe.successes = 0
+		}
+		if !wasTriggered {
+			b.recordTrip(now)
+			b.tripCorrelationID = ""
+			if latencyBreach {
+				b.tripCorrelationID = b.slowCorrelationID
+			}
+			b.slowCorrelationID = ""
+			b.emitEvent(EventTripped, tripReason)
+		}
+		correlationID := b.tripCorrelationID
 		b.logger.BreakerTriggered(latencyPercentile, memoryStatus, b.config.TrendAnalysisEnabled, b.config.WaitTime)
 
 		// Log the breaker triggered event with more details
 		triggerReason := "latency and/or memory issues"
-		if !memoryStatus && latencyAboveThreshold {
+		if memoryBreach && latencyBreach {
 			triggerReason = "both latency and memory issues"
-		} else if !memoryStatus {
+		} else if memoryBreach {
 			triggerReason = "memory issues"
-		} else if latencyAboveThreshold {
+		} else if latencyBreach {
 			triggerReason = "latency issues"
+		} else if scoreBreach {
+			triggerReason = "the health score"
 		}
 		b.logger.Logf("ACTION: Circuit breaker TRIGGERED due to %s. Waiting %d seconds before reset attempt",
 			triggerReason, b.config.WaitTime)
@@ -312,20 +928,33 @@ func (b *BreakerDriver) Done(startTime, endTime time.Time) {
 			if b.stagedAlertManager != nil {
 				// Use staggered alert system
 				context := &AlertContext{
-					TriggerTime:     time.Now(),
+					TriggerTime:     now,
 					PeakLatency:     latencyPercentile,
 					AverageLatency:  latencyPercentile, // Simplificado - puedes calcular promedio real
-					TriggerReason:   triggerReason,
+					TriggerReason:   tripReason,
 					MemoryUsage:     b.getMemoryUsagePercent(),
 					RecentLatencies: b.latencyWindow.GetRecentLatencies(),
 					WaitTime:        b.config.WaitTime,
 					TimeBeforeAlert: b.config.OpsGenie.TimeBeforeSendAlert,
+					CorrelationID:   correlationID,
+
+					LatencyThresholdMs: b.config.LatencyThreshold,
 				}
 				go b.stagedAlertManager.OnBreakerTriggered(context, b)
 			} else {
 				// Use original immediate alert system
 				go func() {
-					if err := b.opsGenieClient.SendBreakerOpenAlert(latencyPercentile, memoryStatus, b.config.WaitTime); err != nil {
+					trip := AggregatedTrip{
+						Breaker:       b.config.Name,
+						Reason:        tripReason,
+						LatencyMs:     latencyPercentile,
+						MemoryOK:      memoryStatus,
+						WaitTime:      b.config.WaitTime,
+						CorrelationID: correlationID,
+
+						LatencyThresholdMs: b.config.LatencyThreshold,
+					}
+					if err := b.opsGenieClient.AggregateBreakerOpenAlert(trip); err != nil {
 						b.logger.Logf("Failed to send OpsGenie alert for breaker open: %v", err)
 					}
 				}()
@@ -334,15 +963,215 @@ func (b *BreakerDriver) Done(startTime, endTime time.Time) {
 	}
 }
 
-// TriggeredByLatencies returns a boolean indicating if the BreakerDriver is currently triggered.
-// The BreakerDriver is triggered when both the memory usage is above the threshold
-// and the latency percentile is above the latency threshold.
-func (b *BreakerDriver) TriggeredByLatencies() bool {
+// latencyBreached reports whether the latency percentile (in nanoseconds) is a breach at
+// now: above the threshold, in nanoseconds so that sub-millisecond latencies are not
+// rounded away, with enough samples above it and for long enough. It keeps track of when
+// the breach started; callers must hold the lock.
+func (b *BreakerDriver) latencyBreached(percentileNs int64, now time.Time) bool {
+	latencyPercentile := nanosToMillis(percentileNs)
+	latencyAboveThreshold := percentileNs > millisToNanos(b.config.LatencyThreshold)
+
+	// A lone outlier must not trip the breaker by itself (see min_samples_above_threshold)
+	if latencyAboveThreshold && b.config.MinSamplesAboveThreshold > 1 {
+		slowSamples := len(b.latencyWindow.AboveThresholdLatencies(b.config.LatencyThreshold))
+		if slowSamples < b.config.MinSamplesAboveThreshold {
+			b.logger.Logf("Latency percentile %dms is above threshold but only %d of the %d required samples are; not tripping",
+				latencyPercentile, slowSamples, b.config.MinSamplesAboveThreshold)
+			latencyAboveThreshold = false
+		}
+	}
+
+	// A momentary spike must not trip the breaker either (see breach_duration_seconds):
+	// the breach has to last, and the timer restarts whenever the latency drops below
+	if !latencyAboveThreshold {
+		b.breachStart = time.Time{}
+	} else if b.config.BreachDurationSeconds > 0 {
+		if b.breachStart.IsZero() {
+			b.breachStart = now
+		}
+		if breachDuration := now.Sub(b.breachStart); breachDuration < time.Duration(b.config.BreachDurationSeconds)*time.Second {
+			b.logger.Logf("Latency percentile %dms has been above threshold for %v, less than the %ds required; not tripping",
+				latencyPercentile, breachDuration.Round(time.Millisecond), b.config.BreachDurationSeconds)
+			latencyAboveThreshold = false
+		}
+	}
+	return latencyAboveThreshold
+}
+
+// latencyTripReason returns the reason to trip on a latency breach of percentileNs:
+// TripReasonLatency without trend analysis, TripReasonLatencyTrend,
+// TripReasonLatencyPlateau or TripReasonLatencySevere with it, or an empty string when
+// nothing justifies the trip
+func (b *BreakerDriver) latencyTripReason(percentileNs int64) string {
+	if !b.config.TrendAnalysisEnabled {
+		// No trend analysis, trigger based on a threshold only
+		b.logger.Logf("TRIGGER REASON: Latency above threshold (trend analysis disabled)")
+		return TripReasonLatency
+	}
+
+	// Only trigger if there's a positive trend in latencies, or if latencies
+	// have been consistently high for a while (plateau)
+	hasTrend := b.latencyWindow.HasPositiveTrend(b.config.TrendAnalysisMinSampleCount)
+	b.logger.TrendAnalysisInfo(hasTrend)
+	if hasTrend {
+		b.logger.Logf("TRIGGER REASON: Latency above threshold AND positive trend detected")
+		return TripReasonLatencyTrend
+	}
+
+	// Check for a plateau - latencies consistently above threshold. It takes
+	// plateau_min_samples recent samples, and plateau_min_fraction of them
+	// above the threshold, so a single borderline dip does not hide it.
+	latencies := b.latencyWindow.GetRecentLatenciesNs()
+	if len(latencies) < b.config.plateauMinSamples() {
+		if b.severeSparseLatency(percentileNs) {
+			return TripReasonLatencySevere
+		}
+		b.logger.Logf("Latency above threshold but NO positive trend. Not triggering breaker.")
+		return ""
+	}
+
+	aboveThreshold := 0
+	for _, lat := range latencies {
+		if lat > millisToNanos(b.config.LatencyThreshold) {
+			aboveThreshold++
+		}
+	}
+	if float64(aboveThreshold)/float64(len(latencies)) < b.config.plateauMinFraction() {
+		if b.severeSparseLatency(percentileNs) {
+			return TripReasonLatencySevere
+		}
+		b.logger.Logf("Latency above threshold but NO positive trend or plateau. Not triggering breaker.")
+		return ""
+	}
+	b.logger.Logf("TRIGGER REASON: Latency plateau detected above threshold (%d of %d samples)",
+		aboveThreshold, len(latencies))
+	return TripReasonLatencyPlateau
+}
+
+// severeSparseLatency reports whether the latency percentile (in nanoseconds) is far
+// enough above the threshold, sparse_trip_factor times, to trip the breaker while there
+// are too few samples for trend analysis to decide
+func (b *BreakerDriver) severeSparseLatency(percentileNs int64) bool {
+	samples := len(b.latencyWindow.GetRecentLatenciesNs())
+	if trendWindow := b.latencyWindow.TrendWindowSize; trendWindow > 0 && samples > trendWindow {
+		samples = trendWindow // HasPositiveTrend only looks at these
+	}
+	if samples >= b.config.TrendAnalysisMinSampleCount {
+		return false
+	}
+	factor := b.config.sparseTripFactor()
+	if float64(percentileNs) <= factor*float64(millisToNanos(b.config.LatencyThreshold)) {
+		return false
+	}
+	b.logger.Logf("TRIGGER REASON: Latency percentile %dms above %.2fx the threshold with only %d samples for trend analysis",
+		nanosToMillis(percentileNs), factor, samples)
+	return true
+}
+
+// sampleNearThresholdFraction is the fraction of the latency threshold from which
+// latencies are always recorded, whatever the sample rate
+const sampleNearThresholdFraction = 0.8
+
+// Trip reasons, reported in the open alert as a "reason:<reason>" tag. When memory and
+// latency trip the breaker together, the reasons are joined with "+", as in
+// "memory+latency-trend".
+const (
+	TripReasonMemory         = "memory"          // Memory usage above memory_threshold
+	TripReasonLatency        = "latency"         // Latency percentile above the threshold, trend analysis disabled
+	TripReasonLatencyTrend   = "latency-trend"   // Latency above the threshold with a positive trend
+	TripReasonLatencyPlateau = "latency-plateau" // Every recent latency above the threshold
+	TripReasonLatencySevere  = "latency-severe"  // Latency far above the threshold, too few samples for trend analysis
+	TripReasonRemote         = "remote"          // Another replica tripped (see RemoteTrip)
+	TripReasonHealthScore    = "health-score"    // Health score at or above health_score_threshold
+)
+
+// samplingPolicy holds the settings read by sampled, which does not take the lock
+type samplingPolicy struct {
+	rate        float64 // Fraction of latencies recorded by Done (see sample_rate)
+	nearLatency int64   // Latencies (and percentiles) from here on are always recorded
+}
+
+func newSamplingPolicy(config *Config) *samplingPolicy {
+	return &samplingPolicy{
+		rate:        config.SampleRate,
+		nearLatency: int64(float64(config.LatencyThreshold) * sampleNearThresholdFraction),
+	}
+}
+
+// sampled decides whether Done records a latency. With a sample rate below 1, latencies
+// are recorded with that probability, except that every latency is recorded while the
+// latency or the current percentile is near the threshold, so that sampling can delay
+// but not hide a trip. It does not take the lock.
+func (b *BreakerDriver) sampled(latency int64) bool {
+	policy := b.sampling.Load()
+	if policy.rate <= 0 || policy.rate >= 1 {
+		return true
+	}
+
+	if latency >= policy.nearLatency || b.lastPercentile.Load() >= policy.nearLatency {
+		return true
+	}
+
+	return rand.Float64() < policy.rate
+}
+
+// Triggered reports whether the breaker is open, whatever tripped it (see TripReason)
+func (b *BreakerDriver) Triggered() bool {
 	b.mu.Lock()
 	defer b.mu.Unlock()
 	return b.triggered
 }
 
+// TriggeredByLatencies reports whether the breaker is open because of its latencies,
+// alone or together with memory. It is false for memory-only and remote trips.
+//
+// Deprecated: use Triggered, which also covers memory and remote trips, or TripReason.
+func (b *BreakerDriver) TriggeredByLatencies() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.triggered && strings.Contains(b.tripReason, "latency")
+}
+
+// TripReason returns why the breaker is open (one of the TripReason constants, or several
+// joined with "+" when memory and latency tripped it together), or an empty string when
+// it is closed
+func (b *BreakerDriver) TripReason() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.triggered {
+		return ""
+	}
+	return b.tripReason
+}
+
+// TripCount returns how many times the breaker went from closed to open since it was
+// created, including trips honored from other replicas
+func (b *BreakerDriver) TripCount() uint64 {
+	return b.tripCount.Load()
+}
+
+// RejectedCount returns how many requests Allow denied since the breaker was created
+func (b *BreakerDriver) RejectedCount() uint64 {
+	return b.rejectedCount.Load()
+}
+
+// LatencyPercentile returns the p-th percentile of the recent latencies in milliseconds,
+// computed with the configured percentile_method (0 without latencies, see
+// HasSufficientData)
+func (b *BreakerDriver) LatencyPercentile(p float64) int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return nanosToMillis(b.latencyWindow.PercentileNs(p))
+}
+
+// TripCorrelationID returns the correlation ID (see WithCorrelationID) of the slow request
+// that led to the latest latency trip, or an empty string if it was not known
+func (b *BreakerDriver) TripCorrelationID() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.tripCorrelationID
+}
+
 // LatenciesAboveThreshold Return latencies above the threshold
 func (b *BreakerDriver) LatenciesAboveThreshold(threshold int64) []int64 {
 	b.mu.Lock()
@@ -350,6 +1179,30 @@ func (b *BreakerDriver) LatenciesAboveThreshold(threshold int64) []int64 {
 	return b.latencyWindow.AboveThresholdLatencies(threshold)
 }
 
+// LatencyRecordsAboveThreshold returns the records of the recent latencies above
+// threshold (in milliseconds), with their labels, oldest first
+func (b *BreakerDriver) LatencyRecordsAboveThreshold(threshold int64) []LatencyRecord {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.latencyWindow.AboveThresholdRecords(threshold)
+}
+
+// SlowestByLabel summarizes the recent latencies of each label recorded with
+// DoneLabeled, slowest label first, counting those above the latency threshold
+func (b *BreakerDriver) SlowestByLabel() []LabelLatencySummary {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.latencyWindow.SlowestByLabel(b.config.LatencyThreshold)
+}
+
+// LatencyRecordsSince returns the latencies recorded within the last d, oldest first,
+// regardless of the maximum age of the latency window (see LatencyWindow.LatencyRecordsSince)
+func (b *BreakerDriver) LatencyRecordsSince(d time.Duration) []LatencyRecord {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.latencyWindow.LatencyRecordsSince(d)
+}
+
 func (b *BreakerDriver) Reset() {
 	b.mu.Lock()
 	defer b.mu.Unlock()
@@ -357,15 +1210,61 @@ func (b *BreakerDriver) Reset() {
 	// Only send reset alert if previously triggered
 	wasTriggered := b.triggered
 
+	if wasTriggered && !b.remoteTrip {
+		b.publishState(false, time.Time{})
+	}
+
 	b.triggered = false
+	b.remoteTrip = false
 	b.lastTripTime = time.Time{}
-	b.enabled = true
+	b.lastCloseTime = time.Time{}
+	b.retryAfterUntil = time.Time{}
+	b.breachStart = time.Time{}
+	b.warmupTrials = 0
+	b.nextWarmup = time.Time{}
+	b.enabled.Store(true)
 	b.latencyWindow.Reset()
+	b.lastPercentile.Store(0)
+	b.latencySeries.reset()
+	b.dependencyWindows = make(map[string]*LatencyWindow)
+	b.slowCorrelationID = ""
+
+	b.notifyManualReset(wasTriggered)
+}
+
+// ResetState closes the breaker (clears triggered and the last trip time) but keeps
+// the latency history, so a still-unhealthy downstream trips the breaker again on the
+// next reported latency instead of being let through while history is rebuilt.
+func (b *BreakerDriver) ResetState() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	wasTriggered := b.triggered
+
+	if wasTriggered && !b.remoteTrip {
+		b.publishState(false, time.Time{})
+	}
+
+	b.triggered = false
+	b.remoteTrip = false
+	b.lastTripTime = time.Time{}
+	b.lastCloseTime = time.Time{}
+	b.retryAfterUntil = time.Time{}
+	b.breachStart = time.Time{}
+
+	b.notifyManualReset(wasTriggered)
+}
+
+// notifyManualReset sends the reset alerts and event after a manual reset and must run in a critical section
+func (b *BreakerDriver) notifyManualReset(wasTriggered bool) {
+	if wasTriggered {
+		b.emitEvent(EventReset, ResetReasonManual)
+	}
 
 	// If the breaker was previously triggered, send a reset alert
 	if wasTriggered && b.opsGenieClient != nil && b.config.OpsGenie != nil && b.config.OpsGenie.Enabled {
 		go func() {
-			if err := b.opsGenieClient.SendBreakerResetAlert(); err != nil {
+			if err := b.opsGenieClient.SendBreakerResetAlertWithReason(ResetAlertManual); err != nil {
 				b.logger.Logf("Failed to send OpsGenie alert for manual breaker reset: %v", err)
 			}
 		}()
@@ -378,9 +1277,139 @@ func (b *BreakerDriver) Reset() {
 
 // LatencyOK reports whether the current latency percentile is below the configured threshold
 func (b *BreakerDriver) LatencyOK() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.latencyOK()
+}
+
+// HasSufficientData reports whether the latency window holds warmup_min_samples recent
+// latencies, so that LatencyOK reflects measurements rather than an empty window
+func (b *BreakerDriver) HasSufficientData() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.hasSufficientData()
+}
+
+// hasSufficientData is HasSufficientData for callers that hold the lock
+func (b *BreakerDriver) hasSufficientData() bool {
+	return b.latencyWindow.HasSufficientData(b.config.warmupMinSamples())
+}
+
+// latencyOK is LatencyOK for callers that hold the lock
+func (b *BreakerDriver) latencyOK() bool {
 	return b.latencyWindow.BelowThreshold(b.config.LatencyThreshold)
 }
 
+// Config returns a copy of the configuration the breaker is running with
+func (b *BreakerDriver) Config() Config {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.config
+}
+
+// UpdateConfig validates config and applies it as a whole to the running breaker. The
+// latency windows are resized keeping their most recent latencies and the trip state is
+// kept. The OpsGenie client and the staged alert manager are not recreated: they switch
+// to a copy of the new OpsGenie settings, so alerts being sent keep the settings they
+// started with. The config file is not written (see SaveConfig).
+func (b *BreakerDriver) UpdateConfig(config *Config) error {
+	if err := ValidateConfig(config); err != nil {
+		return err
+	}
+	excludedStatusCodes, err := ParseStatusCodeRanges(config.ExcludedStatusCodes)
+	if err != nil {
+		return fmt.Errorf("invalid excluded_status_codes: %w", err)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.latencyWindow = reconfiguredLatencyWindow(b.latencyWindow, config)
+	for dependency, window := range b.dependencyWindows {
+		b.dependencyWindows[dependency] = reconfiguredLatencyWindow(window, config)
+	}
+	if config.LatencySeriesSize != b.config.LatencySeriesSize {
+		b.latencySeries = b.latencySeries.resized(config.LatencySeriesSize)
+	}
+
+	b.excludedStatusCodes = excludedStatusCodes
+	b.sampling.Store(newSamplingPolicy(config))
+	b.memoryThreshold.Store(math.Float64bits(config.MemoryThreshold))
+	b.memoryFailClosed.Store(config.memoryCheckFailurePolicy() == MemoryCheckFailClosed)
+
+	b.config = *config
+	if config.OpsGenie != nil {
+		// A new section, rather than an update in place, which would race with the
+		// alerts being sent
+		opsGenie := *config.OpsGenie
+		b.config.OpsGenie = &opsGenie
+		if b.opsGenieClient != nil {
+			b.opsGenieClient.setConfig(&opsGenie)
+		}
+		if b.stagedAlertManager != nil {
+			b.stagedAlertManager.setConfig(&opsGenie)
+		}
+	}
+
+	b.logger.Logf("Configuration updated: memory threshold %.2f%%, latency threshold %dms, window %d, percentile %.2f, wait time %ds",
+		config.MemoryThreshold, config.LatencyThreshold, config.LatencyWindowSize, config.Percentile, config.WaitTime)
+	return nil
+}
+
+// SnapshotLatencies serializes the latency window of the breaker (see
+// LatencyWindow.MarshalJSON), so that it can be restored with RestoreLatencies
+func (b *BreakerDriver) SnapshotLatencies() ([]byte, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return json.Marshal(b.latencyWindow)
+}
+
+// RestoreLatencies replaces the latency window of the breaker with one saved by
+// SnapshotLatencies, so that a restarted breaker does not start blind. The window is
+// resized to latency_window_size keeping its most recent latencies, and latencies older
+// than the wait time are ignored as usual. The breaker state is not changed: it trips
+// only if the next reported latency finds the restored window above the threshold.
+func (b *BreakerDriver) RestoreLatencies(data []byte) error {
+	var restored LatencyWindow
+	if err := json.Unmarshal(data, &restored); err != nil {
+		return fmt.Errorf("failed to restore latencies: %w", err)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.latencyWindow = reconfiguredLatencyWindow(&restored, &b.config)
+	b.latencyWindow.Clock = b.clock
+	b.logger.Logf("Restored %d latencies from a snapshot", len(b.latencyWindow.GetRecentLatenciesNs()))
+	return nil
+}
+
+// reconfiguredLatencyWindow returns a copy of lw sized and aged according to config
+func reconfiguredLatencyWindow(lw *LatencyWindow, config *Config) *LatencyWindow {
+	resized := lw.resized(config.LatencyWindowSize)
+	configureLatencyWindow(resized, config)
+	return resized
+}
+
+// ApproxMemoryBytes returns an estimate of the memory held by the latency history of the
+// breaker: its latency window, the windows of its dependencies and the percentile series.
+// Most of it is allocated when the breaker is created, in proportion to
+// latency_window_size and latency_series_size.
+func (b *BreakerDriver) ApproxMemoryBytes() int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.approxMemoryBytes()
+}
+
+// approxMemoryBytes is ApproxMemoryBytes for callers that hold the lock
+func (b *BreakerDriver) approxMemoryBytes() int64 {
+	bytes := b.latencyWindow.ApproxMemoryBytes() + b.latencySeries.approxMemoryBytes()
+	for _, window := range b.dependencyWindows {
+		bytes += window.ApproxMemoryBytes()
+	}
+	return bytes
+}
+
 // GetConfigFile returns the configuration file path used to create this breaker
 func (b *BreakerDriver) GetConfigFile() string {
 	b.mu.Lock()
@@ -405,15 +1434,14 @@ func (b *BreakerDriver) determineTriggerReason(memoryOK bool, latencyAboveThresh
 	return "circuit_breaker_triggered"
 }
 
-// getMemoryUsagePercent Calculate the percentage of memory use
+// getMemoryUsagePercent Calculate the percentage of memory use, which is zero when no
+// memory limit is known
 func (b *BreakerDriver) getMemoryUsagePercent() float64 {
-	if MemoryLimit <= 0 {
+	if !MemoryCheckEnabled() {
 		return 0.0
 	}
 
-	var m runtime.MemStats
-	runtime.ReadMemStats(&m)
-	return float64(m.Alloc) / float64(MemoryLimit) * 100.0
+	return MemoryPercent(MemoryUsageBytes(), MemoryLimit)
 }
 
 func (b *BreakerDriver) GetStagedAlertInfo() map[string]interface{} {
@@ -435,3 +1463,35 @@ func (b *BreakerDriver) GetStagedAlertInfo() map[string]interface{} {
 
 	return info
 }
+
+// Close stops the background workers owned by the breaker (the staged alert manager
+// and its ticker, the stuck-open check, and the shared state subscription). The breaker keeps evaluating requests after Close,
+// but no further staged alerts are scheduled. Calling Close more than once is a no-op.
+func (b *BreakerDriver) Close() error {
+	// The shared state subscription, the stuck-open check and the probes take the lock,
+	// so they are stopped before taking it
+	b.stopSharing()
+	b.stopStuckOpenMonitor()
+	b.stopConnectivityMonitor()
+	b.stopProbes()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return nil
+	}
+	b.closed = true
+
+	if b.registeredName != "" {
+		DefaultRegistry.Unregister(b.registeredName, b)
+	}
+
+	if b.stagedAlertManager != nil {
+		b.stagedAlertManager.Stop()
+		b.stagedAlertManager = nil
+	}
+
+	b.logger.Logf("Breaker closed")
+	return nil
+}
@@ -0,0 +1,121 @@
+// Package breakertest provides helpers to put breakers into known states from tests.
+//
+// It is meant for code that embeds a breaker and wants deterministic tests without
+// depending on real latencies or on the memory of the test process:
+//
+//	b := breakertest.NewTestBreaker(breakertest.WithLatencyThreshold(200))
+//	defer b.Close()
+//
+//	if err := breakertest.TriggerByLatency(b); err != nil {
+//		t.Fatal(err)
+//	}
+//	// ... exercise the code path that handles an open breaker ...
+//
+//	breakertest.SetHealthy(b)
+package breakertest
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/lrleon/go-breaker/breaker"
+)
+
+// maxTriggerAttempts bounds the latencies reported by TriggerByLatency, which is far
+// more than any realistic latency window needs to trip
+const maxTriggerAttempts = 10000
+
+// tripLatency is reported by TriggerByLatency; it is above any sensible threshold
+const tripLatency = time.Hour
+
+// Option customizes the configuration used by NewTestBreaker
+type Option func(config *breaker.Config)
+
+// WithLatencyThreshold sets the latency threshold in milliseconds
+func WithLatencyThreshold(threshold int64) Option {
+	return func(config *breaker.Config) {
+		config.LatencyThreshold = threshold
+	}
+}
+
+// WithLatencyWindowSize sets the number of latencies kept by the breaker
+func WithLatencyWindowSize(size int) Option {
+	return func(config *breaker.Config) {
+		config.LatencyWindowSize = size
+	}
+}
+
+// WithPercentile sets the percentile compared against the latency threshold
+func WithPercentile(percentile float64) Option {
+	return func(config *breaker.Config) {
+		config.Percentile = percentile
+	}
+}
+
+// WithWaitTime sets the seconds the breaker stays open before it can reset
+func WithWaitTime(seconds int) Option {
+	return func(config *breaker.Config) {
+		config.WaitTime = seconds
+	}
+}
+
+// WithConfig lets the caller change any other configuration field
+func WithConfig(apply func(config *breaker.Config)) Option {
+	return apply
+}
+
+// NewTestBreaker returns a healthy breaker with a small latency window and no OpsGenie
+// integration. The defaults (100ms threshold, 10 latencies, p95, 1s wait time) can be
+// changed with options.
+func NewTestBreaker(opts ...Option) *breaker.BreakerDriver {
+	config := &breaker.Config{
+		MemoryThreshold:   80,
+		LatencyThreshold:  100,
+		LatencyWindowSize: 10,
+		Percentile:        0.95,
+		WaitTime:          1,
+	}
+	for _, opt := range opts {
+		opt(config)
+	}
+
+	driver := breaker.NewBreaker(config, "").(*breaker.BreakerDriver)
+	SetHealthy(driver)
+	return driver
+}
+
+// TriggerByLatency reports increasing latencies far above any sensible threshold until
+// the breaker trips. The latencies grow so that the breaker also trips when trend
+// analysis is enabled. It returns an error if the breaker is disabled or does not trip.
+func TriggerByLatency(b breaker.Breaker) error {
+	if !b.IsEnabled() {
+		return errors.New("breakertest: cannot trigger a disabled breaker")
+	}
+
+	for i := 0; i < maxTriggerAttempts && !trippedByLatency(b); i++ {
+		end := time.Now()
+		b.Done(end.Add(-tripLatency-time.Duration(i)*time.Millisecond), end)
+	}
+
+	if !trippedByLatency(b) {
+		return errors.New("breakertest: breaker did not trip after reporting high latencies")
+	}
+	return nil
+}
+
+func trippedByLatency(b breaker.Breaker) bool {
+	return b.Triggered() && strings.Contains(b.TripReason(), "latency")
+}
+
+// SetHealthy enables the breaker, closes it, clears its latency history and makes the
+// memory check pass, so the next Allow returns true
+func SetHealthy(b breaker.Breaker) {
+	// Enable also resets the breaker
+	b.Enable()
+
+	if driver, ok := b.(*breaker.BreakerDriver); ok {
+		memoryOK := true
+		driver.SetMemoryOverride(&memoryOK)
+	}
+}
@@ -0,0 +1,79 @@
+package breaker
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock tells the time to the breaker, its latency windows and the staged alert manager.
+// The default is RealClock; tests use a MockClock to move time forward without sleeping.
+type Clock interface {
+	Now() time.Time
+}
+
+// RealClock is the system clock
+type RealClock struct{}
+
+// Now returns the current time
+func (RealClock) Now() time.Time {
+	return time.Now()
+}
+
+// MockClock is a clock that only moves when told to. It is safe for concurrent use.
+type MockClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// NewMockClock returns a clock stopped at now
+func NewMockClock(now time.Time) *MockClock {
+	return &MockClock{now: now}
+}
+
+// Now returns the time the clock is stopped at
+func (c *MockClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Advance moves the clock forward by d
+func (c *MockClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// Set stops the clock at now
+func (c *MockClock) Set(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = now
+}
+
+// SetClock makes the breaker, its latency windows and its staged alert manager tell the
+// time with clock: wait times, latency ages, breach durations and trip frequencies are
+// then measured against it, so that tests can move time forward instead of sleeping.
+// Latencies are still reported by the caller. A nil clock restores RealClock. It should
+// be called before the breaker is shared between goroutines.
+func (b *BreakerDriver) SetClock(clock Clock) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.clock = clock
+	b.latencyWindow.Clock = clock
+	for _, window := range b.dependencyWindows {
+		window.Clock = clock
+	}
+	if b.stagedAlertManager != nil {
+		b.stagedAlertManager.SetClock(clock)
+	}
+}
+
+// now returns the current time of the breaker's clock
+func (b *BreakerDriver) now() time.Time {
+	if b.clock == nil {
+		return time.Now()
+	}
+	return b.clock.Now()
+}
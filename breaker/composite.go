@@ -0,0 +1,225 @@
+package breaker
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+)
+
+// CompositePolicy is how a CompositeBreaker combines the decisions of its breakers
+type CompositePolicy int
+
+const (
+	// CompositeAnd allows an operation only if every breaker allows it, e.g. for a call
+	// that needs both a primary and a secondary downstream
+	CompositeAnd CompositePolicy = iota
+	// CompositeOr allows an operation if any breaker allows it, e.g. for a call that can
+	// use either of two downstreams
+	CompositeOr
+)
+
+// String returns "AND" or "OR"
+func (p CompositePolicy) String() string {
+	if p == CompositeOr {
+		return "OR"
+	}
+	return "AND"
+}
+
+// CompositeBreaker is a Breaker made of several breakers, one per downstream, whose
+// decisions are combined with a CompositePolicy. Allow asks every breaker, so that each
+// one updates its state, and the latencies are reported to every breaker.
+//
+// With CompositeAnd the composite is open as soon as one breaker is open; with
+// CompositeOr it is open only while every breaker is open.
+type CompositeBreaker struct {
+	policy   CompositePolicy
+	breakers []Breaker
+}
+
+var _ LabeledBreaker = (*CompositeBreaker)(nil)
+
+// NewCompositeBreaker combines the given breakers with policy. Nil breakers are ignored.
+func NewCompositeBreaker(policy CompositePolicy, breakers ...Breaker) *CompositeBreaker {
+	composite := &CompositeBreaker{policy: policy}
+	for _, b := range breakers {
+		if b != nil {
+			composite.breakers = append(composite.breakers, b)
+		}
+	}
+	return composite
+}
+
+// Policy returns how the decisions of the breakers are combined
+func (c *CompositeBreaker) Policy() CompositePolicy {
+	return c.policy
+}
+
+// Breakers returns the combined breakers
+func (c *CompositeBreaker) Breakers() []Breaker {
+	return append([]Breaker(nil), c.breakers...)
+}
+
+// combine evaluates check on every breaker, without short-circuiting, and combines the
+// results with the policy. Without breakers, AND is true and OR is false.
+func (c *CompositeBreaker) combine(check func(b Breaker) bool) bool {
+	result := c.policy == CompositeAnd
+	for _, b := range c.breakers {
+		ok := check(b)
+		if c.policy == CompositeAnd {
+			result = result && ok
+		} else {
+			result = result || ok
+		}
+	}
+	return result
+}
+
+// each calls do on every breaker
+func (c *CompositeBreaker) each(do func(b Breaker)) {
+	for _, b := range c.breakers {
+		do(b)
+	}
+}
+
+func (c *CompositeBreaker) Allow() bool {
+	return c.combine(func(b Breaker) bool { return b.Allow() })
+}
+
+func (c *CompositeBreaker) AllowCtx(ctx context.Context) bool {
+	return c.combine(func(b Breaker) bool { return b.AllowCtx(ctx) })
+}
+
+func (c *CompositeBreaker) Done(startTime, endTime time.Time) {
+	c.each(func(b Breaker) { b.Done(startTime, endTime) })
+}
+
+func (c *CompositeBreaker) DoneCtx(ctx context.Context, startTime, endTime time.Time) {
+	c.each(func(b Breaker) { b.DoneCtx(ctx, startTime, endTime) })
+}
+
+// DoneLabeled reports the latency with its label to every breaker, and without it to
+// the breakers that do not record labels
+func (c *CompositeBreaker) DoneLabeled(startTime, endTime time.Time, label string) {
+	c.each(func(b Breaker) {
+		if labeled, ok := b.(LabeledBreaker); ok {
+			labeled.DoneLabeled(startTime, endTime, label)
+		} else {
+			b.Done(startTime, endTime)
+		}
+	})
+}
+
+func (c *CompositeBreaker) DoneDependency(dependency string, startTime, endTime time.Time) {
+	c.each(func(b Breaker) { b.DoneDependency(dependency, startTime, endTime) })
+}
+
+func (c *CompositeBreaker) DoneWithStatus(startTime, endTime time.Time, statusCode int) {
+	c.each(func(b Breaker) { b.DoneWithStatus(startTime, endTime, statusCode) })
+}
+
+func (c *CompositeBreaker) DoneWithError(startTime, endTime time.Time, err error, retryAfter time.Duration) {
+	c.each(func(b Breaker) { b.DoneWithError(startTime, endTime, err, retryAfter) })
+}
+
+// Triggered reports whether the composite is open: with AND, whether any breaker is
+// open; with OR, whether all of them are
+func (c *CompositeBreaker) Triggered() bool {
+	return !c.combine(func(b Breaker) bool { return !b.Triggered() })
+}
+
+// TriggeredByLatencies reports, like Triggered, whether the composite is open because
+// of the latencies of its breakers.
+//
+// Deprecated: use Triggered or TripReason.
+func (c *CompositeBreaker) TriggeredByLatencies() bool {
+	return !c.combine(func(b Breaker) bool { return !b.TriggeredByLatencies() })
+}
+
+// TripReason returns the distinct reasons of the open breakers joined with "+", or an
+// empty string when the composite is closed
+func (c *CompositeBreaker) TripReason() string {
+	if !c.Triggered() {
+		return ""
+	}
+
+	var reasons []string
+	seen := make(map[string]bool)
+	for _, b := range c.breakers {
+		reason := b.TripReason()
+		if reason != "" && !seen[reason] {
+			seen[reason] = true
+			reasons = append(reasons, reason)
+		}
+	}
+	return strings.Join(reasons, "+")
+}
+
+func (c *CompositeBreaker) Reset() {
+	c.each(func(b Breaker) { b.Reset() })
+}
+
+func (c *CompositeBreaker) ResetState() {
+	c.each(func(b Breaker) { b.ResetState() })
+}
+
+// LatenciesAboveThreshold returns the latencies above threshold of every breaker
+func (c *CompositeBreaker) LatenciesAboveThreshold(threshold int64) []int64 {
+	var latencies []int64
+	c.each(func(b Breaker) { latencies = append(latencies, b.LatenciesAboveThreshold(threshold)...) })
+	return latencies
+}
+
+// LatencyRecordsAboveThreshold returns the latency records above threshold of every
+// breaker that records labels
+func (c *CompositeBreaker) LatencyRecordsAboveThreshold(threshold int64) []LatencyRecord {
+	var records []LatencyRecord
+	c.each(func(b Breaker) {
+		if labeled, ok := b.(LabeledBreaker); ok {
+			records = append(records, labeled.LatencyRecordsAboveThreshold(threshold)...)
+		}
+	})
+	return records
+}
+
+// MemoryOK combines the memory checks of the breakers with the policy
+func (c *CompositeBreaker) MemoryOK() bool {
+	return c.combine(func(b Breaker) bool { return b.MemoryOK() })
+}
+
+// LatencyOK combines the latency checks of the breakers with the policy
+func (c *CompositeBreaker) LatencyOK() bool {
+	return c.combine(func(b Breaker) bool { return b.LatencyOK() })
+}
+
+// IsEnabled reports whether any breaker is enabled
+func (c *CompositeBreaker) IsEnabled() bool {
+	enabled := false
+	c.each(func(b Breaker) { enabled = enabled || b.IsEnabled() })
+	return enabled
+}
+
+func (c *CompositeBreaker) Disable() {
+	c.each(func(b Breaker) { b.Disable() })
+}
+
+func (c *CompositeBreaker) Enable() {
+	c.each(func(b Breaker) { b.Enable() })
+}
+
+// GetConfigFile returns an empty string, since each breaker has its own config file
+func (c *CompositeBreaker) GetConfigFile() string {
+	return ""
+}
+
+// Close closes every breaker and returns their errors joined
+func (c *CompositeBreaker) Close() error {
+	var errs []error
+	c.each(func(b Breaker) {
+		if err := b.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	})
+	return errors.Join(errs...)
+}
@@ -1,12 +1,20 @@
 package breaker
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"log"
+	"net"
+	"net/url"
 	"os"
 	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/BurntSushi/toml"
 )
@@ -20,22 +28,84 @@ type ContactInfo struct {
 	AdditionalEmails []string `toml:"additional_emails"` // Additional notification emails
 }
 
-// EnvironmentSettingsConfig represents environment-specific settings
-type EnvironmentSettingsConfig struct {
-	Enabled  bool   `toml:"enabled"`
-	Priority string `toml:"priority"`
+// EnvOpsConfig holds OpsGenie overrides applied when running in a specific environment.
+// They are only used when use_environments is enabled and the entry key matches the
+// resolved environment (case-insensitive). Example:
+//
+//	[opsgenie.environment_settings.prod]
+//	enabled = true
+//	priority = "P1"
+//	cooldown_seconds = 60
+//	tags = ["Environment:prod", "Team:platform"]
+//
+//	[opsgenie.environment_settings.dev]
+//	enabled = true
+//	max_priority = "P4" # Never page from dev, even for P1 alerts
+type EnvOpsConfig struct {
+	Enabled         *bool    `toml:"enabled"`          // Send alerts in this environment (nil = use the global enabled)
+	Priority        string   `toml:"priority"`         // Overrides priority (P1-P5, empty = use global value)
+	MaxPriority     string   `toml:"max_priority"`     // Most severe priority sent (P1-P5, empty = no cap)
+	CooldownSeconds int      `toml:"cooldown_seconds"` // Overrides alert_cooldown_seconds for the types without an alert_cooldowns entry (0 = use global values)
+	Tags            []string `toml:"tags"`             // Replaces the global tags (empty = use global tags)
+}
+
+// knownEnvironments lists the keys accepted in environment_settings
+var knownEnvironments = map[string]bool{
+	"dev":         true,
+	"development": true,
+	"ci":          true,
+	"qa":          true,
+	"test":        true,
+	"uat":         true,
+	"stage":       true,
+	"staging":     true,
+	"preprod":     true,
+	"prod":        true,
+	"production":  true,
+}
+
+// isKnownEnvironment reports whether env is a valid environment_settings key
+func isKnownEnvironment(env string) bool {
+	return knownEnvironments[strings.ToLower(env)]
+}
+
+// customAttributePrefix is prepended to the api_custom_attributes keys in alert details,
+// so that they never replace the details set by the breaker itself
+const customAttributePrefix = "Custom_"
+
+// sortedKeys returns the keys of m in order, so that validation errors are stable
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// customAttributeError returns why key cannot be used in api_custom_attributes, or ""
+func customAttributeError(key string) string {
+	name := strings.ToLower(strings.TrimSpace(key))
+	switch {
+	case name == "":
+		return "empty key"
+	case strings.HasPrefix(name, strings.ToLower(customAttributePrefix)):
+		return fmt.Sprintf("%q must not start with %s, which is added automatically", key, customAttributePrefix)
+	}
+	return ""
 }
 
 // OpsGenieConfig represents the OpsGenie integration configuration with all mandatory fields
 type OpsGenieConfig struct {
 	// Basic OpsGenie Settings
-	Enabled  bool     `toml:"enabled"`  // Enable OpsGenie alerts
-	APIKey   string   `toml:"api_key"`  // OpsGenie API key
-	Region   string   `toml:"region"`   // OpsGenie region: "us" or "eu"
-	APIURL   string   `toml:"api_url"`  // Custom API URL (optional)
-	Priority string   `toml:"priority"` // Default priority (P1-P5)
-	Source   string   `toml:"source"`   // Source identifier
-	Tags     []string `toml:"tags"`     // Alert tags
+	Enabled    bool     `toml:"enabled"`      // Enable OpsGenie alerts
+	APIKey     string   `toml:"api_key"`      // OpsGenie API key
+	APIKeyFile string   `toml:"api_key_file"` // File holding the API key (e.g. /run/secrets/opsgenie_api_key)
+	Region     string   `toml:"region"`       // OpsGenie region: "us" or "eu"
+	APIURL     string   `toml:"api_url"`      // Custom API URL (optional)
+	Priority   string   `toml:"priority"`     // Default priority (P1-P5)
+	Source     string   `toml:"source"`       // Source identifier
+	Tags       []string `toml:"tags"`         // Alert tags
 
 	// Alert Triggers
 	TriggerOnOpen    bool `toml:"trigger_on_breaker_open"`      // Alert when breaker opens
@@ -49,12 +119,37 @@ type OpsGenieConfig struct {
 	IncludeSystemInfo     bool `toml:"include_system_info"`     // Include system info in alert
 
 	// Rate Limiting
-	AlertCooldownSeconds int `toml:"alert_cooldown_seconds"` // Minimum time between alerts
+	AlertCooldownSeconds int            `toml:"alert_cooldown_seconds"` // Minimum time between alerts
+	AlertCooldowns       map[string]int `toml:"alert_cooldowns"`        // Per-type cooldowns keyed by open, reset, memory, memory-warning or latency (0 = alert_cooldown_seconds)
+
+	// Trips within alert_aggregation_seconds of the first are sent as a single open alert
+	AlertAggregationSeconds int `toml:"alert_aggregation_seconds"` // Aggregation window (0 = one open alert per trip)
+
+	// Environment Overrides
+	UseEnvironments     bool                    `toml:"use_environments"`     // Apply per-environment overrides
+	EnvironmentSettings map[string]EnvOpsConfig `toml:"environment_settings"` // Overrides keyed by environment (dev, prod, ...)
+
+	// Request Settings
+	ConnectivityCheckSeconds int `toml:"connectivity_check_seconds"` // Seconds between OpsGenie connectivity checks (0 = disabled)
+
+	// Alert Messages (text/template keyed by open, reset, memory, memory-warning or latency; see AlertMessageData)
+	MessageTemplates map[string]string `toml:"message_templates"`
 
 	// ===== STAGED ALERTING CONFIGURATION (NEW) =====
 	TimeBeforeSendAlert    int    `toml:"time_before_send_alert"`   // Seconds to wait before escalating
 	InitialAlertPriority   string `toml:"initial_alert_priority"`   // Priority for initial alert (P3, P4)
 	EscalatedAlertPriority string `toml:"escalated_alert_priority"` // Priority for escalated alert (P1, P2)
+	MaxPendingAlerts       int    `toml:"max_pending_alerts"`       // Pending staged alerts kept at once; further trips are coalesced (default 10)
+
+	// Priorities sent while the breaker stays open, replacing the escalated alert when set
+	PriorityEscalationLadder []PriorityEscalationStep `toml:"priority_escalation_ladder"`
+
+	// Priorities raised by how many times an alert value exceeds its threshold
+	PriorityByMagnitude []MagnitudePriority `toml:"priority_by_magnitude"`
+
+	// Stuck-open alert, sent once when the breaker stays open longer than max_open_duration_seconds
+	MaxOpenDurationSeconds int    `toml:"max_open_duration_seconds"` // Seconds open before the stuck-open alert (0 = disabled)
+	StuckOpenAlertPriority string `toml:"stuck_open_alert_priority"` // Priority of the stuck-open alert (empty = priority)
 
 	// MANDATORY FIELDS - Required for all alerts
 	Team         string `toml:"team"`          // OpsGenie team name (must match OpsGenie)
@@ -79,27 +174,226 @@ type OpsGenieConfig struct {
 	APIDescription  string   `toml:"api_description"`  // Brief description of the API's purpose
 	APIPriority     string   `toml:"api_priority"`     // Business priority of the API (critical, high, medium, low)
 
+	// Custom alert details, sent as Custom_<key> (see customAttributeError for the allowed keys)
+	APICustomAttributes map[string]string `toml:"api_custom_attributes"`
+
+	// Redaction of sensitive values: matching alert details and description lines are sent as ****
+	RedactKeys    []string `toml:"redact_keys"`    // Detail names or description labels to mask (case-insensitive; Custom_ is optional)
+	RedactPattern string   `toml:"redact_pattern"` // Regular expression matched against the same names (empty = none)
+
 	// Service Configuration
 	ServiceTier    string      `toml:"service_tier"`    // critical, high, medium, low
 	ContactDetails ContactInfo `toml:"contact_details"` // Contact information
 }
 
+// DatadogConfig is the [datadog] section, used by the datadog package to send alerts as
+// Datadog events and breaker metrics through DogStatsD. The breaker package only loads
+// and validates it, so that it does not depend on Datadog.
+type DatadogConfig struct {
+	Enabled                bool     `toml:"enabled"`
+	APIKey                 string   `toml:"api_key"`                  // Events API key (empty = DD_API_KEY environment variable)
+	Site                   string   `toml:"site"`                     // Datadog site (empty = datadoghq.com)
+	EventsURL              string   `toml:"events_url"`               // Events API URL, e.g. for a proxy (empty = derived from site)
+	StatsdAddr             string   `toml:"statsd_addr"`              // DogStatsD host:port (empty = no metrics)
+	MetricsIntervalSeconds int      `toml:"metrics_interval_seconds"` // Seconds between metric reports (0 = 10)
+	Tags                   []string `toml:"tags"`                     // Tags added to every event and metric, e.g. "env:prod"
+}
+
+// PriorityEscalationStep is a step of the priority escalation ladder: once the breaker has
+// been open for AfterSeconds, an alert with Priority is sent
+type PriorityEscalationStep struct {
+	AfterSeconds int    `toml:"after_seconds"` // Seconds since the breaker opened
+	Priority     string `toml:"priority"`      // Priority of the alert (P1-P5)
+}
+
+// MagnitudePriority raises the priority of the alerts whose value is at least MinFactor
+// times its threshold, such as a latency of 1500ms against a threshold of 300ms (5x)
+type MagnitudePriority struct {
+	MinFactor float64 `toml:"min_factor"` // Multiple of the threshold (at least 1)
+	Priority  string  `toml:"priority"`   // Priority of the alert (P1-P5)
+}
+
 // Environment types for the application
 type Environment string
 
 // Config represents the main circuit breaker configuration
 type Config struct {
+	// Identity
+	Name string `toml:"name"` // Registers the breaker in DefaultRegistry under this name (empty = not registered)
+
 	// Core Circuit Breaker Settings
-	MemoryThreshold             float64 `toml:"memory_threshold"`                // Percentage of memory usage
-	LatencyThreshold            int64   `toml:"latency_threshold"`               // In milliseconds
-	LatencyWindowSize           int     `toml:"latency_window_size"`             // Number of latencies to keep
-	Percentile                  float64 `toml:"percentile"`                      // Percentile to use
-	WaitTime                    int     `toml:"wait_time"`                       // Time to wait before reset in seconds
-	TrendAnalysisEnabled        bool    `toml:"trend_analysis_enabled"`          // If true, breaker activates only if trend is positive
-	TrendAnalysisMinSampleCount int     `toml:"trend_analysis_min_sample_count"` // Minimum number of samples for trend analysis
+	MemoryThreshold              float64 `toml:"memory_threshold"`                // Percentage of memory usage
+	MemoryWarnThreshold          float64 `toml:"memory_warn_threshold"`           // Memory usage percentage, below memory_threshold, that sends a low-priority warning alert (0 = no warning)
+	MemoryCheckFailurePolicy     string  `toml:"memory_check_failure_policy"`     // What MemoryOK returns when the memory limit cannot be read: open (default, true) or closed (false)
+	LatencyThreshold             int64   `toml:"latency_threshold"`               // In milliseconds
+	LatencyWindowSize            int     `toml:"latency_window_size"`             // Number of latencies to keep
+	Percentile                   float64 `toml:"percentile"`                      // Percentile to use
+	PercentileMethod             string  `toml:"percentile_method"`               // nearest-rank (default), linear, lower or higher
+	WaitTime                     int     `toml:"wait_time"`                       // Time to wait before reset in seconds
+	RecoveryConsecutiveChecks    int     `toml:"recovery_consecutive_checks"`     // Trial requests after the wait time, or probes, that must find latency OK before the reset (0 = 1)
+	RecoveryCheckIntervalSeconds int     `toml:"recovery_check_interval_seconds"` // Seconds between the trial requests let through after the wait time or during a fail-closed warm-up (0 = 1)
+	ProbeIntervalSeconds         int     `toml:"probe_interval_seconds"`          // Seconds between probes while the breaker is open (see SetProbe; 0 = wait_time)
+	TrendAnalysisEnabled         bool    `toml:"trend_analysis_enabled"`          // If true, breaker activates only if trend is positive
+	TrendAnalysisMinSampleCount  int     `toml:"trend_analysis_min_sample_count"` // Minimum number of samples for trend analysis
+	TrendWindowSize              int     `toml:"trend_window_size"`               // Most recent samples used for trend regression (0 = whole window)
+	PlateauMinSamples            int     `toml:"plateau_min_samples"`             // Recent latencies needed to detect a plateau (0 = 5)
+	PlateauMinFraction           float64 `toml:"plateau_min_fraction"`            // Fraction of them above the threshold for a plateau (0 = all)
+	SparseTripFactor             float64 `toml:"sparse_trip_factor"`              // Multiple of the threshold that trips without enough samples for trend analysis (0 = 2)
+	SampleRate                   float64 `toml:"sample_rate"`                     // Fraction of latencies recorded by Done (0 or 1 = all)
+	LatencySeriesSize            int     `toml:"latency_series_size"`             // Per-second percentile samples kept for /breaker/latency-series (0 = 300)
+	MaxAcceptedLatencyMs         int64   `toml:"max_accepted_latency_ms"`         // Recorded latencies are capped to this value (0 = no cap)
+	MinSamplesAboveThreshold     int     `toml:"min_samples_above_threshold"`     // Recent latencies above the threshold needed to trip (0 or 1 = any)
+	BreachDurationSeconds        int     `toml:"breach_duration_seconds"`         // Seconds the latency must stay above the threshold before tripping (0 = at once)
+	WarmupMinSamples             int     `toml:"warmup_min_samples"`              // Recent latencies needed for the latency data to be sufficient (0 = 1)
+	WarmupPolicy                 string  `toml:"warmup_policy"`                   // What Allow does without sufficient latency data: fail-open (default) or fail-closed
+	TripFrequencyWindowSeconds   int     `toml:"trip_frequency_window_seconds"`   // Window of the recent trip count, for flapping detection (0 = 60)
+	ProtectionPercent            float64 `toml:"protection_percent"`              // Percentage of Allow calls the breaker decides; the rest pass through (0 or 100 = all)
+
+	// Health Score (see HealthScore)
+	HealthScoreThreshold float64 `toml:"health_score_threshold"` // Trip when the blended memory and latency score (0-100) reaches it, instead of on the independent thresholds (0 = disabled)
+	HealthMemoryWeight   float64 `toml:"health_memory_weight"`   // Weight of memory pressure in the health score (both weights 0 = equal weights)
+	HealthLatencyWeight  float64 `toml:"health_latency_weight"`  // Weight of the latency percentile in the health score
+
+	// Trip Scope (nil = true, so that both memory and latency open the breaker by default)
+	TripOnMemory  *bool `toml:"trip_on_memory"`  // If false, memory pressure neither opens the breaker nor blocks Allow
+	TripOnLatency *bool `toml:"trip_on_latency"` // If false, high latencies do not open the breaker
+
+	// Cross-replica Coordination (requires a StateStore, see SetStateStore)
+	HonorSharedTrips bool `toml:"honor_shared_trips"` // If true, the breaker opens when another replica trips
+
+	// Status Code Filtering (applies to DoneWithStatus)
+	ExcludedStatusCodes []string `toml:"excluded_status_codes"` // Codes kept out of the latency window: "404", "4xx" or "400-499"
 
 	// OpsGenie Integration
 	OpsGenie *OpsGenieConfig `toml:"opsgenie"` // OpsGenie configuration
+
+	// Datadog Integration (see the datadog package)
+	Datadog *DatadogConfig `toml:"datadog"` // Datadog configuration, nil if absent
+}
+
+// EffectiveBookmakerID returns bookmaker_id, or its alias project_id when bookmaker_id
+// is empty. Either one satisfies the mandatory bookmaker ID.
+func (c *OpsGenieConfig) EffectiveBookmakerID() string {
+	if c.BookmakerID != "" {
+		return c.BookmakerID
+	}
+	return c.ProjectID
+}
+
+// protectionPercent returns protection_percent, or 100 when it is not set
+func (c *Config) protectionPercent() float64 {
+	if c.ProtectionPercent <= 0 || c.ProtectionPercent > 100 {
+		return 100
+	}
+	return c.ProtectionPercent
+}
+
+// TripsOnMemory reports whether memory pressure opens the breaker (trip_on_memory, default true)
+func (c *Config) TripsOnMemory() bool {
+	return c.TripOnMemory == nil || *c.TripOnMemory
+}
+
+// TripsOnLatency reports whether high latencies open the breaker (trip_on_latency, default true)
+func (c *Config) TripsOnLatency() bool {
+	return c.TripOnLatency == nil || *c.TripOnLatency
+}
+
+// Warm-up policies, selecting what Allow does while the latency window holds fewer than
+// warmup_min_samples recent latencies, so that its percentile says nothing yet
+const (
+	WarmupFailOpen   = "fail-open"   // Requests are let through (the default)
+	WarmupFailClosed = "fail-closed" // Requests are rejected
+)
+
+// IsValidWarmupPolicy reports whether policy is one of the warm-up policies or empty
+func IsValidWarmupPolicy(policy string) bool {
+	return policy == "" || policy == WarmupFailOpen || policy == WarmupFailClosed
+}
+
+// warmupPolicy returns warmup_policy, or WarmupFailOpen when it is not set
+func (c *Config) warmupPolicy() string {
+	if c.WarmupPolicy == "" {
+		return WarmupFailOpen
+	}
+	return c.WarmupPolicy
+}
+
+// Memory check failure policies, selecting what MemoryOK returns when the memory limit
+// of the container cannot be read, so that memory usage cannot be verified
+const (
+	MemoryCheckFailOpen   = "open"   // Memory is assumed to be fine (the default)
+	MemoryCheckFailClosed = "closed" // Memory is assumed to be exhausted, which trips the breaker
+)
+
+// IsValidMemoryCheckFailurePolicy reports whether policy is one of the memory check
+// failure policies or empty
+func IsValidMemoryCheckFailurePolicy(policy string) bool {
+	return policy == "" || policy == MemoryCheckFailOpen || policy == MemoryCheckFailClosed
+}
+
+// memoryCheckFailurePolicy returns memory_check_failure_policy, or MemoryCheckFailOpen
+// when it is not set
+func (c *Config) memoryCheckFailurePolicy() string {
+	if c.MemoryCheckFailurePolicy == "" {
+		return MemoryCheckFailOpen
+	}
+	return c.MemoryCheckFailurePolicy
+}
+
+// warmupMinSamples returns warmup_min_samples, or 1 when it is not set
+func (c *Config) warmupMinSamples() int {
+	if c.WarmupMinSamples <= 0 {
+		return 1
+	}
+	return c.WarmupMinSamples
+}
+
+// recoveryConsecutiveChecks returns recovery_consecutive_checks, or 1 when it is not set
+func (c *Config) recoveryConsecutiveChecks() int {
+	if c.RecoveryConsecutiveChecks <= 0 {
+		return 1
+	}
+	return c.RecoveryConsecutiveChecks
+}
+
+// recoveryCheckInterval returns recovery_check_interval_seconds, or a second when it is
+// not set
+func (c *Config) recoveryCheckInterval() time.Duration {
+	if c.RecoveryCheckIntervalSeconds <= 0 {
+		return time.Second
+	}
+	return time.Duration(c.RecoveryCheckIntervalSeconds) * time.Second
+}
+
+// defaultPlateauMinSamples is the plateau_min_samples used when it is not set
+const defaultPlateauMinSamples = 5
+
+// plateauMinSamples returns plateau_min_samples, or its default when it is not set
+func (c *Config) plateauMinSamples() int {
+	if c.PlateauMinSamples <= 0 {
+		return defaultPlateauMinSamples
+	}
+	return c.PlateauMinSamples
+}
+
+// plateauMinFraction returns plateau_min_fraction, or 1 (every latency) when it is not set
+func (c *Config) plateauMinFraction() float64 {
+	if c.PlateauMinFraction <= 0 || c.PlateauMinFraction > 1 {
+		return 1
+	}
+	return c.PlateauMinFraction
+}
+
+// defaultSparseTripFactor is the multiple of the latency threshold that trips the breaker
+// when there are too few samples for trend analysis
+const defaultSparseTripFactor = 2.0
+
+// sparseTripFactor returns sparse_trip_factor, or its default when it is not set
+func (c *Config) sparseTripFactor() float64 {
+	if c.SparseTripFactor <= 1 {
+		return defaultSparseTripFactor
+	}
+	return c.SparseTripFactor
 }
 
 // TOMLValidationError represents a specific error with line information
@@ -123,6 +417,11 @@ type TOMLConfigLoader struct {
 	absolutePath string
 	rawContent   string
 	lines        []string
+
+	// Invalid values and unknown keys, which are errors in strict mode
+	strict           bool
+	undecodedKeys    []string
+	validationErrors []error
 }
 
 // NewTOMLConfigLoader create a new loader with the specified route
@@ -212,6 +511,18 @@ func (loader *TOMLConfigLoader) validateAndLog(fieldPath string, currentValue in
 	if !isValid {
 		log.Printf("⚠️  WARNING in %s:%d - %s = %v: %s",
 			loader.configPath, line, fieldPath, currentValue, message)
+
+		// Zero values mean "not set" and are replaced by defaults even in strict mode
+		if currentValue != nil && !reflect.ValueOf(currentValue).IsZero() {
+			loader.validationErrors = append(loader.validationErrors, &TOMLValidationError{
+				Field:      fieldPath,
+				Value:      currentValue,
+				Expected:   expectedType,
+				Line:       line,
+				ConfigPath: loader.configPath,
+				Message:    fmt.Sprintf("invalid value %v (expected %s)", currentValue, expectedType),
+			})
+		}
 	} else {
 		log.Printf("✅ %s:%d - %s = %v (valid)",
 			loader.configPath, line, fieldPath, currentValue)
@@ -249,12 +560,14 @@ func createDefaultConfig() *Config {
 		WaitTime:                    4,
 		TrendAnalysisEnabled:        true,
 		TrendAnalysisMinSampleCount: 10,
+		SampleRate:                  1.0,
+		LatencySeriesSize:           300,
 		OpsGenie: &OpsGenieConfig{
 			// Basic settings
 			Enabled:  false,
 			Region:   "us",
 			Priority: "P3",
-			Source:   "go-breaker",
+			Source:   defaultAlertSource,
 
 			Tags: []string{
 				"Environment:production",
@@ -301,22 +614,115 @@ func createDefaultConfig() *Config {
 	}
 }
 
-// LoadConfig loads configuration from a TOML file with enhanced error handling and validation
-func LoadConfig(path string) (*Config, error) {
+// EnvStrictConfig enables strict mode for every configuration load when set to a true
+// value (1, t, true), as StrictMode does for a single call
+const EnvStrictConfig = "BREAKER_STRICT_CONFIG"
+
+// LoadOption customizes LoadConfig
+type LoadOption func(options *loadOptions)
+
+type loadOptions struct {
+	strict bool
+}
+
+// StrictMode makes LoadConfig fail instead of replacing invalid values with defaults.
+// Unknown keys (usually typos) and values that fail validation are reported together,
+// with their line numbers; fields that are not set still get their defaults.
+func StrictMode() LoadOption {
+	return func(options *loadOptions) {
+		options.strict = true
+	}
+}
+
+func newLoadOptions(options []LoadOption) loadOptions {
+	var opts loadOptions
+	if strict, err := strconv.ParseBool(os.Getenv(EnvStrictConfig)); err == nil && strict {
+		opts.strict = true
+	}
+	for _, option := range options {
+		option(&opts)
+	}
+	return opts
+}
+
+// strictModeError returns the unknown keys and invalid values found in strict mode,
+// or nil
+func (loader *TOMLConfigLoader) strictModeError() error {
+	if !loader.strict {
+		return nil
+	}
+
+	var errs []error
+	for _, key := range loader.undecodedKeys {
+		errs = append(errs, &TOMLValidationError{
+			Field:      key,
+			Line:       loader.findFieldLine(key),
+			ConfigPath: loader.configPath,
+			Message:    "unknown key",
+		})
+	}
+	errs = append(errs, loader.validationErrors...)
+	if len(errs) == 0 {
+		return nil
+	}
+	return fmt.Errorf("invalid configuration (strict mode): %w", errors.Join(errs...))
+}
+
+// LoadConfig loads configuration from a TOML file with enhanced error handling and validation.
+// Invalid values are logged and replaced by defaults, unless StrictMode is given or
+// BREAKER_STRICT_CONFIG is set, in which case no configuration is returned.
+func LoadConfig(path string, options ...LoadOption) (*Config, error) {
+	config, _, err := loadConfigFile(path, newLoadOptions(options))
+	return config, err
+}
+
+// loadConfigFile implements LoadConfig, also returning the loader, which records the
+// unknown keys and the invalid values replaced by defaults. The loader is nil when
+// the file cannot be read.
+func loadConfigFile(path string, options loadOptions) (*Config, *TOMLConfigLoader, error) {
 	// Create Loader with detailed logging
 	loader, err := NewTOMLConfigLoader(path)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
+	loader.strict = options.strict
 
-	log.Printf("🔍 Parsing TOML configuration...")
+	config, err := decodeConfigFile(loader)
+	if err != nil {
+		if loader.strict {
+			return nil, loader, err
+		}
+		return createDefaultConfig(), loader, err
+	}
 
-	// Start with default config
-	defaultConfig := createDefaultConfig()
+	applyLoadedConfigDefaults(&config, loader)
+	if err := loader.strictModeError(); err != nil {
+		log.Printf("❌ ERROR: %v", err)
+		return nil, loader, err
+	}
+	return &config, loader, nil
+}
+
+// substitutedFields returns the fields whose invalid values were replaced by defaults
+func (loader *TOMLConfigLoader) substitutedFields() []string {
+	var fields []string
+	for _, err := range loader.validationErrors {
+		var validationErr *TOMLValidationError
+		if errors.As(err, &validationErr) {
+			fields = append(fields, validationErr.Field)
+		}
+	}
+	return fields
+}
+
+// decodeConfigFile parses the file of the loader, in the root-level or the
+// [circuit_breaker] section format, without applying defaults or validating
+func decodeConfigFile(loader *TOMLConfigLoader) (Config, error) {
+	log.Printf("🔍 Parsing TOML configuration...")
 
 	// Try to parse with the root-level structure
 	var config Config
-	_, err = toml.DecodeFile(loader.absolutePath, &config)
+	meta, err := toml.DecodeFile(loader.absolutePath, &config)
 
 	// If we failed to load or all values are zero, try the [circuit_breaker] format
 	if err != nil || (config.MemoryThreshold == 0 && config.LatencyThreshold == 0 &&
@@ -331,11 +737,14 @@ func LoadConfig(path string) (*Config, error) {
 		}
 
 		var sectionConfig ConfigWithSections
-		_, sectionErr := toml.DecodeFile(loader.absolutePath, &sectionConfig)
+		sectionMeta, sectionErr := toml.DecodeFile(loader.absolutePath, &sectionConfig)
 
-		if sectionErr == nil {
+		// A file without the section keeps its root-level values (e.g. an override
+		// file of LoadConfigMerged that only sets wait_time)
+		if sectionErr == nil && (err != nil || sectionMeta.IsDefined("circuit_breaker")) {
 			// Use values from the circuit_breaker section
 			config = sectionConfig.CircuitBreaker
+			meta, err = sectionMeta, nil
 
 			// Preserve OpsGenie config if it was loaded in the section format
 			if sectionConfig.OpsGenie != nil {
@@ -344,12 +753,24 @@ func LoadConfig(path string) (*Config, error) {
 			log.Printf("✅ Configuration loaded using [circuit_breaker] section format")
 		} else if err != nil {
 			log.Printf("❌ ERROR loading config from %s: %v. Using default values.", loader.absolutePath, err)
-			return defaultConfig, err
+			return config, err
 		}
 	} else {
 		log.Printf("✅ Configuration loaded using root-level format")
 	}
 
+	for _, key := range meta.Undecoded() {
+		log.Printf("⚠️  WARNING in %s - unknown key %s is ignored", loader.configPath, key)
+		loader.undecodedKeys = append(loader.undecodedKeys, key.String())
+	}
+	return config, nil
+}
+
+// applyLoadedConfigDefaults replaces the zero or invalid values of a decoded
+// configuration with defaults, logging each one with its line in the file of the loader
+func applyLoadedConfigDefaults(config *Config, loader *TOMLConfigLoader) {
+	defaultConfig := createDefaultConfig()
+
 	log.Printf("🔍 Validating configuration values...")
 
 	// Validate and set defaults for any zero or invalid values with line numbers
@@ -361,6 +782,18 @@ func LoadConfig(path string) (*Config, error) {
 		loader.validateAndLog("memory_threshold", config.MemoryThreshold, "float64", true, "")
 	}
 
+	if config.MemoryWarnThreshold < 0 || (config.MemoryWarnThreshold > 0 && config.MemoryWarnThreshold >= config.MemoryThreshold) {
+		loader.validateAndLog("memory_warn_threshold", config.MemoryWarnThreshold, "float64 (0-memory_threshold)", false,
+			"Invalid value. Memory warnings disabled")
+		config.MemoryWarnThreshold = 0
+	}
+
+	if !IsValidMemoryCheckFailurePolicy(config.MemoryCheckFailurePolicy) {
+		loader.validateAndLog("memory_check_failure_policy", config.MemoryCheckFailurePolicy, "string (open|closed)", false,
+			"Invalid policy. Using open")
+		config.MemoryCheckFailurePolicy = ""
+	}
+
 	if config.LatencyThreshold <= 0 {
 		loader.validateAndLog("latency_threshold", config.LatencyThreshold, "int64 (>0)", false,
 			fmt.Sprintf("Invalid value. Using default: %d", defaultConfig.LatencyThreshold))
@@ -385,6 +818,12 @@ func LoadConfig(path string) (*Config, error) {
 		loader.validateAndLog("percentile", config.Percentile, "float64", true, "")
 	}
 
+	if !IsValidPercentileMethod(config.PercentileMethod) {
+		loader.validateAndLog("percentile_method", config.PercentileMethod, "string (nearest-rank|linear|lower|higher)", false,
+			"Invalid method. Using nearest-rank")
+		config.PercentileMethod = ""
+	}
+
 	if config.WaitTime <= 0 {
 		loader.validateAndLog("wait_time", config.WaitTime, "int (>0)", false,
 			fmt.Sprintf("Invalid value. Using default: %d", defaultConfig.WaitTime))
@@ -397,138 +836,206 @@ func LoadConfig(path string) (*Config, error) {
 		config.TrendAnalysisMinSampleCount = defaultConfig.TrendAnalysisMinSampleCount
 	}
 
-	// Initialize OpsGenie config if nil
-	if config.OpsGenie == nil {
-		log.Printf("⚠️  No OpsGenie configuration found in %s, using defaults", loader.configPath)
-		config.OpsGenie = defaultConfig.OpsGenie
-	} else {
-		log.Printf("🔍 Validating OpsGenie configuration...")
-		validateOpsGenieConfigWithLineNumbers(config.OpsGenie, defaultConfig.OpsGenie, loader)
+	if config.TrendWindowSize < 0 {
+		loader.validateAndLog("trend_window_size", config.TrendWindowSize, "int (>=0)", false,
+			"Invalid value. Using the whole latency window for trend analysis")
+		config.TrendWindowSize = 0
 	}
 
-	log.Printf("✅ Configuration validation completed for %s", loader.absolutePath)
-	logConfigSummary(&config)
+	if config.PlateauMinSamples < 0 || (config.LatencyWindowSize > 0 && config.PlateauMinSamples > config.LatencyWindowSize) {
+		loader.validateAndLog("plateau_min_samples", config.PlateauMinSamples, "int (0 to latency_window_size)", false,
+			fmt.Sprintf("Invalid value. Using default value %d", defaultPlateauMinSamples))
+		config.PlateauMinSamples = 0
+	}
 
-	return &config, nil
-}
+	if config.PlateauMinFraction < 0 || config.PlateauMinFraction > 1 {
+		loader.validateAndLog("plateau_min_fraction", config.PlateauMinFraction, "float64 (0-1)", false,
+			"Invalid value. Every recent latency must be above the threshold for a plateau")
+		config.PlateauMinFraction = 0
+	}
 
-// findTagLines Look for the lines where tags are defined in the array
-func (loader *TOMLConfigLoader) findTagLines() []int {
-	var tagLines []int
-	inOpsGenieSection := false
-	inTagsArray := false
+	if config.SparseTripFactor != 0 && config.SparseTripFactor <= 1 {
+		loader.validateAndLog("sparse_trip_factor", config.SparseTripFactor, "float64 (> 1)", false,
+			fmt.Sprintf("Invalid value. Using default value %.1f", defaultSparseTripFactor))
+		config.SparseTripFactor = 0
+	}
 
-	for i, line := range loader.lines {
-		trimmed := strings.TrimSpace(line)
+	if config.SampleRate < 0 || config.SampleRate > 1 {
+		loader.validateAndLog("sample_rate", config.SampleRate, "float64 (0-1)", false,
+			"Invalid value. Recording every latency")
+		config.SampleRate = 0
+	}
 
-		// Detect section start [Opsgenie]
-		if trimmed == "[opsgenie]" {
-			inOpsGenieSection = true
-			continue
-		}
+	if config.ProtectionPercent < 0 || config.ProtectionPercent > 100 {
+		loader.validateAndLog("protection_percent", config.ProtectionPercent, "float64 (0-100)", false,
+			"Invalid value. Protecting every request")
+		config.ProtectionPercent = 0
+	}
 
-		// Detect new section (exit OPSGENIE)
-		if inOpsGenieSection && strings.HasPrefix(trimmed, "[") && trimmed != "[opsgenie]" {
-			inOpsGenieSection = false
-			inTagsArray = false
-			continue
-		}
+	if config.HealthScoreThreshold < 0 || config.HealthScoreThreshold > 100 {
+		loader.validateAndLog("health_score_threshold", config.HealthScoreThreshold, "float64 (0-100)", false,
+			"Invalid value. Tripping on the independent thresholds")
+		config.HealthScoreThreshold = 0
+	}
+	if config.HealthMemoryWeight < 0 {
+		loader.validateAndLog("health_memory_weight", config.HealthMemoryWeight, "float64 (>= 0)", false,
+			"Invalid value. Memory does not count in the health score")
+		config.HealthMemoryWeight = 0
+	}
+	if config.HealthLatencyWeight < 0 {
+		loader.validateAndLog("health_latency_weight", config.HealthLatencyWeight, "float64 (>= 0)", false,
+			"Invalid value. Latency does not count in the health score")
+		config.HealthLatencyWeight = 0
+	}
 
-		// Detect Tags Array
-		if inOpsGenieSection && (strings.HasPrefix(trimmed, "tags = [") || trimmed == "tags = [") {
-			inTagsArray = true
+	if config.LatencySeriesSize < 0 {
+		loader.validateAndLog("latency_series_size", config.LatencySeriesSize, "int (>= 0)", false,
+			fmt.Sprintf("Invalid value. Using default value %d", defaultLatencySeriesSize))
+		config.LatencySeriesSize = 0
+	}
 
-			// If the definition is in a single line
-			if strings.Contains(trimmed, "]") {
-				// Array in a single line: Tags = ["Tag1", "Tag2", "Tag3"]
-				tagLines = append(tagLines, parseTagsFromSingleLine(trimmed, i+1)...)
-				inTagsArray = false
-			}
-			continue
-		}
+	if config.MaxAcceptedLatencyMs < 0 || (config.MaxAcceptedLatencyMs > 0 && config.MaxAcceptedLatencyMs <= config.LatencyThreshold) {
+		loader.validateAndLog("max_accepted_latency_ms", config.MaxAcceptedLatencyMs, "int64 (0 or > latency_threshold)", false,
+			"Invalid value. Latencies will not be capped")
+		config.MaxAcceptedLatencyMs = 0
+	}
 
-		// If we are inside the tag array (multilinear)
-		if inTagsArray {
-			// Detect an end of array
-			if strings.Contains(trimmed, "]") {
-				// Process last line if you have tags
-				if len(strings.TrimSpace(strings.Replace(trimmed, "]", "", -1))) > 0 {
-					lineNumbers := parseTagsFromArrayLine(trimmed, i+1)
-					tagLines = append(tagLines, lineNumbers...)
-				}
-				inTagsArray = false
-			} else if trimmed != "" && !strings.HasPrefix(trimmed, "#") {
-				// Line inside the array with tags
-				lineNumbers := parseTagsFromArrayLine(trimmed, i+1)
-				tagLines = append(tagLines, lineNumbers...)
-			}
-		}
+	if config.MinSamplesAboveThreshold < 0 || (config.LatencyWindowSize > 0 && config.MinSamplesAboveThreshold > config.LatencyWindowSize) {
+		loader.validateAndLog("min_samples_above_threshold", config.MinSamplesAboveThreshold, "int (0 to latency_window_size)", false,
+			"Invalid value. A single latency above the threshold can trip the breaker")
+		config.MinSamplesAboveThreshold = 0
 	}
 
-	return tagLines
-}
+	if config.ProbeIntervalSeconds < 0 {
+		loader.validateAndLog("probe_interval_seconds", config.ProbeIntervalSeconds, "int (>=0)", false,
+			"Invalid value. Probes are sent every wait_time")
+		config.ProbeIntervalSeconds = 0
+	}
 
-// parseTagsFromSingleLine extract tags from a line like: tags = ["tag1", "tag2"]
-func parseTagsFromSingleLine(line string, lineNumber int) []int {
-	var lines []int
+	if config.RecoveryConsecutiveChecks < 0 {
+		loader.validateAndLog("recovery_consecutive_checks", config.RecoveryConsecutiveChecks, "int (>=0)", false,
+			"Invalid value. A single check with latency OK resets the breaker")
+		config.RecoveryConsecutiveChecks = 0
+	}
 
-	// Extract content between [Y]]
-	start := strings.Index(line, "[")
-	end := strings.LastIndex(line, "]")
+	if config.RecoveryCheckIntervalSeconds < 0 {
+		loader.validateAndLog("recovery_check_interval_seconds", config.RecoveryCheckIntervalSeconds, "int (>=0)", false,
+			"Invalid value. A trial request is let through every second")
+		config.RecoveryCheckIntervalSeconds = 0
+	}
 
-	if start != -1 && end != -1 && end > start {
-		content := line[start+1 : end]
-		tags := parseTagsFromContent(content)
+	if config.BreachDurationSeconds < 0 {
+		loader.validateAndLog("breach_duration_seconds", config.BreachDurationSeconds, "int (>=0)", false,
+			"Invalid value. The breaker trips as soon as the latency is above the threshold")
+		config.BreachDurationSeconds = 0
+	}
 
-		// All tags are on the same line
-		for range tags {
-			lines = append(lines, lineNumber)
-		}
+	if config.WarmupMinSamples < 0 || (config.LatencyWindowSize > 0 && config.WarmupMinSamples > config.LatencyWindowSize) {
+		loader.validateAndLog("warmup_min_samples", config.WarmupMinSamples, "int (0 to latency_window_size)", false,
+			"Invalid value. A single latency makes the latency data sufficient")
+		config.WarmupMinSamples = 0
 	}
 
-	return lines
-}
+	if !IsValidWarmupPolicy(config.WarmupPolicy) {
+		loader.validateAndLog("warmup_policy", config.WarmupPolicy, "string (fail-open|fail-closed)", false,
+			"Invalid policy. Using fail-open")
+		config.WarmupPolicy = ""
+	}
 
-// parseTagsFromArrayLine extract tags from a line inside a multiline
-func parseTagsFromArrayLine(line string, lineNumber int) []int {
-	var lines []int
+	if config.TripFrequencyWindowSeconds < 0 {
+		loader.validateAndLog("trip_frequency_window_seconds", config.TripFrequencyWindowSeconds, "int (>=0)", false,
+			"Invalid value. Using default: 60")
+		config.TripFrequencyWindowSeconds = 0
+	}
 
-	// Clean the bracket and commas line
-	cleaned := strings.ReplaceAll(line, "]", "")
-	cleaned = strings.TrimSpace(cleaned)
+	if _, err := ParseStatusCodeRanges(config.ExcludedStatusCodes); err != nil {
+		loader.validateAndLog("excluded_status_codes", config.ExcludedStatusCodes, "[]string (\"404\", \"4xx\", \"400-499\")", false,
+			fmt.Sprintf("%v. No status codes will be excluded", err))
+		config.ExcludedStatusCodes = nil
+	}
 
-	if cleaned != "" {
-		tags := parseTagsFromContent(cleaned)
+	// Initialize OpsGenie config if nil
+	if config.OpsGenie == nil {
+		log.Printf("⚠️  No OpsGenie configuration found in %s, using defaults", loader.configPath)
+		config.OpsGenie = defaultConfig.OpsGenie
+	} else {
+		log.Printf("🔍 Validating OpsGenie configuration...")
+		validateOpsGenieConfigWithLineNumbers(config.OpsGenie, defaultConfig.OpsGenie, loader)
+	}
 
-		// Each tag found in this line
-		for range tags {
-			lines = append(lines, lineNumber)
-		}
+	if config.Datadog != nil {
+		validateDatadogConfigWithLineNumbers(config.Datadog, loader)
 	}
 
-	return lines
+	log.Printf("✅ Configuration validation completed for %s", loader.absolutePath)
+	logConfigSummary(config)
 }
 
-// parseTagsFromContent Extract individual tags from content
-func parseTagsFromContent(content string) []string {
-	var tags []string
-
-	// Divide by commas and process each element
-	parts := strings.Split(content, ",")
+// LoadConfigMerged loads several configuration files and merges them in order of
+// precedence: every field set in a later file (that is, with a non-zero value)
+// overrides the value of the earlier files, and fields a later file leaves unset keep
+// their earlier value. The [opsgenie] section is merged field by field in the same way.
+// Lists and tables are replaced as a whole, not merged. Because unset means zero, a
+// later file cannot turn a boolean off or set a number back to zero.
+//
+// Defaults and validation are applied once, to the merged configuration, with line
+// numbers referring to the last file; BREAKER_STRICT_CONFIG enables strict mode (see
+// StrictMode). A typical use is a shared base file followed by a per-environment one:
+//
+//	config, err := breaker.LoadConfigMerged("breakers.toml", "breakers.prod.toml")
+func LoadConfigMerged(paths ...string) (*Config, error) {
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no configuration files to merge")
+	}
+
+	strict := newLoadOptions(nil).strict
+	var merged Config
+	var loader *TOMLConfigLoader
+	for _, path := range paths {
+		var err error
+		loader, err = NewTOMLConfigLoader(path)
+		if err != nil {
+			return nil, err
+		}
+		loader.strict = strict
 
-	for _, part := range parts {
-		cleaned := strings.TrimSpace(part)
+		config, err := decodeConfigFile(loader)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse config file %s: %v", path, err)
+		}
+		if err := loader.strictModeError(); err != nil {
+			return nil, err
+		}
+		mergeSetFields(reflect.ValueOf(&merged).Elem(), reflect.ValueOf(config))
+	}
 
-		// Remove quotes
-		cleaned = strings.Trim(cleaned, `"'`)
-		cleaned = strings.TrimSpace(cleaned)
+	log.Printf("🔍 Merged %d configuration files: %s", len(paths), strings.Join(paths, ", "))
+	applyLoadedConfigDefaults(&merged, loader)
+	if err := loader.strictModeError(); err != nil {
+		return nil, err
+	}
+	return &merged, nil
+}
 
-		if cleaned != "" {
-			tags = append(tags, cleaned)
+// mergeSetFields overlays the non-zero fields of src onto dst, two values of the same
+// struct type. Nested structs and pointers to structs are merged field by field; any
+// other non-zero value replaces the one in dst.
+func mergeSetFields(dst, src reflect.Value) {
+	for i := 0; i < src.NumField(); i++ {
+		from, to := src.Field(i), dst.Field(i)
+		switch {
+		case !to.CanSet() || from.IsZero():
+		case from.Kind() == reflect.Struct:
+			mergeSetFields(to, from)
+		case from.Kind() == reflect.Pointer && from.Elem().Kind() == reflect.Struct:
+			if to.IsNil() {
+				to.Set(reflect.New(from.Elem().Type()))
+			}
+			mergeSetFields(to.Elem(), from.Elem())
+		default:
+			to.Set(from)
 		}
 	}
-
-	return tags
 }
 
 // validateOpsGenieConfigWithLineNumbers Validate the OPSGENIE configuration with line numbers
@@ -566,6 +1073,24 @@ func validateOpsGenieConfigWithLineNumbers(config *OpsGenieConfig, defaults *Ops
 		loader.validateAndLog("opsgenie.team", config.Team, "string", true, "")
 	}
 
+	// Validate the bookmaker ID, which project_id may provide instead of bookmaker_id
+	switch {
+	case config.BookmakerID != "":
+		loader.validateAndLog("opsgenie.bookmaker_id", config.BookmakerID, "string", true, "")
+		if config.ProjectID != "" && config.ProjectID != config.BookmakerID {
+			log.Printf("⚠️  WARNING in %s:%d - opsgenie.project_id = %s: project_id is an alias of bookmaker_id. Using bookmaker_id: %s",
+				loader.configPath, loader.findFieldLine("opsgenie.project_id"), config.ProjectID, config.BookmakerID)
+		}
+	case config.ProjectID != "":
+		loader.validateAndLog("opsgenie.project_id", config.ProjectID, "string", true, "")
+	case config.Enabled:
+		loader.validateAndLog("opsgenie.bookmaker_id", config.BookmakerID, "string", false,
+			"Neither bookmaker_id nor its alias project_id is set. Using environment variables or api_name")
+	}
+	if config.Enabled {
+		warnSharedAlertIdentifier(config)
+	}
+
 	// Validate mandatory field defaults
 	if config.Business == "" {
 		config.Business = defaults.Business
@@ -593,6 +1118,140 @@ func validateOpsGenieConfigWithLineNumbers(config *OpsGenieConfig, defaults *Ops
 	if config.AlertCooldownSeconds <= 0 {
 		config.AlertCooldownSeconds = defaults.AlertCooldownSeconds
 	}
+
+	for key, seconds := range config.AlertCooldowns {
+		if !isCooldownAlertType(key) || seconds < 0 {
+			loader.validateAndLog("opsgenie.alert_cooldowns."+key, seconds, "int (>=0) keyed by open, reset, memory, memory-warning or latency", false,
+				"Invalid entry. Using alert_cooldown_seconds")
+			delete(config.AlertCooldowns, key)
+		}
+	}
+
+	if config.AlertAggregationSeconds < 0 {
+		loader.validateAndLog("opsgenie.alert_aggregation_seconds", config.AlertAggregationSeconds, "int (>=0)", false,
+			"Invalid value. Trips are not aggregated")
+		config.AlertAggregationSeconds = 0
+	}
+
+	if config.RedactPattern != "" {
+		if problem := redactPatternError(config.RedactPattern); problem != "" {
+			loader.validateAndLog("opsgenie.redact_pattern", config.RedactPattern, "regular expression", false,
+				fmt.Sprintf("%s. Only redact_keys are masked", problem))
+			config.RedactPattern = ""
+		}
+	}
+
+	if config.ConnectivityCheckSeconds < 0 {
+		loader.validateAndLog("opsgenie.connectivity_check_seconds", config.ConnectivityCheckSeconds, "int (>=0)", false,
+			"Invalid value. The connectivity check is disabled")
+		config.ConnectivityCheckSeconds = 0
+	}
+
+	if config.MaxPendingAlerts < 0 {
+		loader.validateAndLog("opsgenie.max_pending_alerts", config.MaxPendingAlerts, "int (>=0)", false,
+			fmt.Sprintf("Invalid value. Using default: %d", defaultMaxPendingAlerts))
+		config.MaxPendingAlerts = 0
+	}
+
+	// Validate the stuck-open alert
+	if config.MaxOpenDurationSeconds < 0 {
+		loader.validateAndLog("opsgenie.max_open_duration_seconds", config.MaxOpenDurationSeconds, "int (>=0)", false,
+			"Invalid value. The stuck-open alert is disabled")
+		config.MaxOpenDurationSeconds = 0
+	}
+	if config.StuckOpenAlertPriority != "" && !validPriorities[config.StuckOpenAlertPriority] {
+		loader.validateAndLog("opsgenie.stuck_open_alert_priority", config.StuckOpenAlertPriority, "string (P1-P5)", false,
+			fmt.Sprintf("Invalid priority. Using default: %s", config.Priority))
+		config.StuckOpenAlertPriority = ""
+	}
+
+	// Validate the escalation ladder: steps must be strictly increasing in time. A broken
+	// ladder is dropped as a whole, since its remaining steps would fire at the wrong times
+	for i, step := range config.PriorityEscalationLadder {
+		var problem string
+		switch {
+		case step.AfterSeconds <= 0:
+			problem = "after_seconds must be positive"
+		case i > 0 && step.AfterSeconds <= config.PriorityEscalationLadder[i-1].AfterSeconds:
+			problem = fmt.Sprintf("after_seconds must be greater than the previous step, %d",
+				config.PriorityEscalationLadder[i-1].AfterSeconds)
+		case !validPriorities[step.Priority]:
+			problem = "priority must be P1-P5"
+		}
+		if problem != "" {
+			loader.validateAndLog(fmt.Sprintf("opsgenie.priority_escalation_ladder[%d]", i), step,
+				"step (after_seconds increasing, priority P1-P5)", false,
+				fmt.Sprintf("%s. Ignoring the ladder: escalated_alert_priority is used", problem))
+			config.PriorityEscalationLadder = nil
+			break
+		}
+		if i > 0 && step.Priority > config.PriorityEscalationLadder[i-1].Priority {
+			log.Printf("⚠️  WARNING in %s - opsgenie.priority_escalation_ladder[%d] lowers the priority from %s to %s",
+				loader.configPath, i, config.PriorityEscalationLadder[i-1].Priority, step.Priority)
+		}
+	}
+
+	// Validate the magnitude priorities, dropping only the invalid steps
+	var magnitudePriorities []MagnitudePriority
+	for i, step := range config.PriorityByMagnitude {
+		if step.MinFactor < 1 || !validPriorities[step.Priority] {
+			loader.validateAndLog(fmt.Sprintf("opsgenie.priority_by_magnitude[%d]", i), step,
+				"step (min_factor >= 1, priority P1-P5)", false, "Invalid step. Ignoring it")
+			continue
+		}
+		magnitudePriorities = append(magnitudePriorities, step)
+	}
+	config.PriorityByMagnitude = magnitudePriorities
+
+	// Validate per-environment overrides
+	for env, settings := range config.EnvironmentSettings {
+		fieldPath := fmt.Sprintf("opsgenie.environment_settings.%s", env)
+
+		if !isKnownEnvironment(env) {
+			loader.validateAndLog(fieldPath, env, "known environment", false,
+				"Unknown environment. Ignoring its settings")
+			delete(config.EnvironmentSettings, env)
+			continue
+		}
+
+		if settings.Priority != "" && !validPriorities[settings.Priority] {
+			loader.validateAndLog(fieldPath+".priority", settings.Priority, "string (P1-P5)", false,
+				fmt.Sprintf("Invalid priority. Using default: %s", config.Priority))
+			settings.Priority = ""
+		}
+
+		if settings.MaxPriority != "" && !validPriorities[settings.MaxPriority] {
+			loader.validateAndLog(fieldPath+".max_priority", settings.MaxPriority, "string (P1-P5)", false,
+				"Invalid priority. Alerts will not be capped")
+			settings.MaxPriority = ""
+		}
+
+		if settings.CooldownSeconds < 0 {
+			loader.validateAndLog(fieldPath+".cooldown_seconds", settings.CooldownSeconds, "int (>=0)", false,
+				"Invalid value. Using alert_cooldown_seconds")
+			settings.CooldownSeconds = 0
+		}
+
+		config.EnvironmentSettings[env] = settings
+	}
+
+	// Validate message templates
+	for key, text := range config.MessageTemplates {
+		if problem := validateMessageTemplate(key, text); problem != "" {
+			loader.validateAndLog("opsgenie.message_templates."+key, text, "text/template", false,
+				fmt.Sprintf("%s. Using the default message", problem))
+			delete(config.MessageTemplates, key)
+		}
+	}
+
+	// Validate custom alert details
+	for key := range config.APICustomAttributes {
+		if problem := customAttributeError(key); problem != "" {
+			loader.validateAndLog("opsgenie.api_custom_attributes", key, "custom detail name", false,
+				fmt.Sprintf("%s. Ignoring the attribute", problem))
+			delete(config.APICustomAttributes, key)
+		}
+	}
 }
 
 // validateTagsWithLineNumbers Validate the tags with line numbers
@@ -601,36 +1260,17 @@ func validateTagsWithLineNumbers(tags []string, loader *TOMLConfigLoader) {
 
 	var validTags []string
 	var invalidTags []string
-	var tagValidationResults []TagValidationResult
-
-	// Find the lines where tags are defined
-	tagLines := loader.findTagLines()
 
-	for i, tag := range tags {
-		// Determine if the tag is valid
-		isValid := isValidKeyValueTag(tag)
-
-		// Obtain line number (if available)
-		lineNumber := 0
-		if i < len(tagLines) {
-			lineNumber = tagLines[i]
-		}
-
-		if isValid {
-			validTags = append(validTags, tag)
+	results := loader.ValidateTags(tags)
+	for _, result := range results {
+		if result.IsValid {
+			validTags = append(validTags, result.Tag)
 			log.Printf("✅ %s:%d - Tag[%d] = '%s' (valid key:value format)",
-				loader.configPath, lineNumber, i, tag)
+				loader.configPath, result.LineNumber, result.Index, result.Tag)
 		} else {
-			invalidTags = append(invalidTags, tag)
+			invalidTags = append(invalidTags, result.Tag)
 			log.Printf("⚠️  WARNING in %s:%d - Tag[%d] = '%s' (will be marked as **TAG_KEY_UNDEFINED**)",
-				loader.configPath, lineNumber, i, tag)
-
-			tagValidationResults = append(tagValidationResults, TagValidationResult{
-				Tag:        tag,
-				LineNumber: lineNumber,
-				IsValid:    false,
-				Index:      i,
-			})
+				loader.configPath, result.LineNumber, result.Index, result.Tag)
 		}
 	}
 
@@ -645,36 +1285,86 @@ func validateTagsWithLineNumbers(tags []string, loader *TOMLConfigLoader) {
 		log.Printf("💡 Consider using format like 'Component:circuit-breaker' instead of just 'circuit-breaker'")
 
 		// Show specific suggestions
-		for _, result := range tagValidationResults {
-			suggestedFormat := suggestTagFormat(result.Tag)
-			log.Printf("   💡 %s:%d - Suggestion: '%s' → '%s'",
-				loader.configPath, result.LineNumber, result.Tag, suggestedFormat)
+		for _, result := range results {
+			if !result.IsValid {
+				log.Printf("   💡 %s:%d - Suggestion: '%s' → '%s'",
+					loader.configPath, result.LineNumber, result.Tag, result.Suggestion)
+			}
 		}
 	}
 }
 
-// 🆕 Structure: Tag validation result
+// TagValidationResult is the validation of a tag against the key:value format
 type TagValidationResult struct {
-	Tag        string
-	LineNumber int
-	IsValid    bool
-	Index      int
+	Tag        string `json:"tag"`
+	LineNumber int    `json:"line_number"`          // Line of the tag in the config file, 0 if unknown
+	IsValid    bool   `json:"is_valid"`             // Whether the tag has key:value format
+	Index      int    `json:"index"`                // Position of the tag in the list
+	Suggestion string `json:"suggestion,omitempty"` // Suggested key:value form of an invalid tag
 }
 
-// 🆕 Verify if a tag has key format: valid value
-func isValidKeyValueTag(tag string) bool {
-	// same logic as in processtag () but only validation
-	if strings.Contains(tag, ":") {
-		parts := strings.SplitN(tag, ":", 2)
-		if len(parts) == 2 && strings.TrimSpace(parts[0]) != "" && strings.TrimSpace(parts[1]) != "" {
-			return true
+// ValidateTags checks every tag against the key:value format (see splitKeyValueTag)
+// and suggests a format for the invalid ones, without logging, so that tooling can show
+// the problems. Line numbers are unknown (0); use TOMLConfigLoader.ValidateTags for the
+// tags of a config file.
+func ValidateTags(tags []string) []TagValidationResult {
+	return validateTags(tags, nil)
+}
+
+// ValidateTags checks the tags like ValidateTags and adds the line where each tag is
+// defined in the loader's file, assuming the tags are those of the file in order
+func (loader *TOMLConfigLoader) ValidateTags(tags []string) []TagValidationResult {
+	return validateTags(tags, loader.findTagLines())
+}
+
+func validateTags(tags []string, tagLines []int) []TagValidationResult {
+	results := make([]TagValidationResult, len(tags))
+	for i, tag := range tags {
+		results[i] = TagValidationResult{Tag: tag, IsValid: isValidKeyValueTag(tag), Index: i}
+		if i < len(tagLines) {
+			results[i].LineNumber = tagLines[i]
+		}
+		if !results[i].IsValid {
+			results[i].Suggestion = suggestTagFormat(tag)
 		}
 	}
-	return false
+	return results
+}
+
+// splitKeyValueTag splits a tag in key:value format on its first colon, so the value may
+// hold more colons (e.g. "Service:https://api.example.com"). It fails if the key or the
+// value is empty, or if the tag is a bare URL such as "https://example.com", whose colon
+// separates the scheme rather than a key.
+func splitKeyValueTag(tag string) (key, value string, ok bool) {
+	key, value, found := strings.Cut(tag, ":")
+	key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+	if !found || key == "" || value == "" || strings.HasPrefix(value, "//") {
+		return key, value, false
+	}
+	return key, value, true
+}
+
+// 🆕 Verify if a tag has key format: valid value
+func isValidKeyValueTag(tag string) bool {
+	_, _, ok := splitKeyValueTag(tag)
+	return ok
 }
 
 // 🆕 Suggest correct format for a tag
 func suggestTagFormat(tag string) string {
+	// A key without value keeps its key, and a value without key is suggested a key
+	if key, value, _ := splitKeyValueTag(tag); strings.Contains(tag, ":") && !strings.Contains(tag, "://") {
+		if value == "" {
+			return fmt.Sprintf("%s:<value>", key)
+		}
+		tag = value
+	}
+
+	// A bare URL is kept whole, colons included
+	if strings.Contains(tag, "://") {
+		return fmt.Sprintf("URL:%s", tag)
+	}
+
 	// Intelligent suggestions based on the content of the tag
 	tagLower := strings.ToLower(tag)
 
@@ -729,12 +1419,71 @@ func suggestTagFormat(tag string) string {
 func logConfigSummary(config *Config) {
 	log.Printf("📋 Configuration Summary:")
 	log.Printf("   Circuit Breaker:")
+	if config.Name != "" {
+		log.Printf("     - Name: %s", config.Name)
+	}
 	log.Printf("     - Memory threshold: %.2f%%", config.MemoryThreshold)
+	if config.MemoryWarnThreshold > 0 {
+		log.Printf("     - Memory warning threshold: %.2f%%", config.MemoryWarnThreshold)
+	}
+	if config.MemoryCheckFailurePolicy != "" {
+		log.Printf("     - Memory check failure policy: %s", config.memoryCheckFailurePolicy())
+	}
 	log.Printf("     - Latency threshold: %dms", config.LatencyThreshold)
 	log.Printf("     - Latency window size: %d", config.LatencyWindowSize)
 	log.Printf("     - Percentile: %.2f", config.Percentile)
+	if config.PercentileMethod != "" {
+		log.Printf("     - Percentile method: %s", config.PercentileMethod)
+	}
 	log.Printf("     - Wait time: %ds", config.WaitTime)
 	log.Printf("     - Trend analysis: %t", config.TrendAnalysisEnabled)
+	if config.TrendWindowSize > 0 {
+		log.Printf("     - Trend window size: %d", config.TrendWindowSize)
+	}
+	if config.PlateauMinSamples > 0 || config.PlateauMinFraction > 0 {
+		log.Printf("     - Plateau: %d samples, %.2f above threshold", config.plateauMinSamples(), config.plateauMinFraction())
+	}
+	if config.SparseTripFactor > 0 {
+		log.Printf("     - Sparse trip factor: %.2fx threshold", config.sparseTripFactor())
+	}
+	if config.SampleRate > 0 && config.SampleRate < 1 {
+		log.Printf("     - Sample rate: %.2f", config.SampleRate)
+	}
+	if config.ProtectionPercent > 0 && config.ProtectionPercent < 100 {
+		log.Printf("     - Protection: %.2f%% of requests", config.ProtectionPercent)
+	}
+	if config.HealthScoreThreshold > 0 {
+		memoryWeight, latencyWeight := config.healthWeights()
+		log.Printf("     - Health score threshold: %.2f (memory weight %.2f, latency weight %.2f)",
+			config.HealthScoreThreshold, memoryWeight, latencyWeight)
+	}
+	if config.MaxAcceptedLatencyMs > 0 {
+		log.Printf("     - Max accepted latency: %dms", config.MaxAcceptedLatencyMs)
+	}
+	if config.MinSamplesAboveThreshold > 1 {
+		log.Printf("     - Min samples above threshold: %d", config.MinSamplesAboveThreshold)
+	}
+	if config.BreachDurationSeconds > 0 {
+		log.Printf("     - Breach duration: %ds", config.BreachDurationSeconds)
+	}
+	if config.RecoveryConsecutiveChecks > 1 {
+		log.Printf("     - Recovery consecutive checks: %d", config.RecoveryConsecutiveChecks)
+	}
+	if config.RecoveryCheckIntervalSeconds > 0 {
+		log.Printf("     - Recovery check interval: %ds", config.RecoveryCheckIntervalSeconds)
+	}
+	if config.WarmupMinSamples > 1 || config.WarmupPolicy != "" {
+		log.Printf("     - Warm-up: %d samples, %s", config.warmupMinSamples(), config.warmupPolicy())
+	}
+	if config.TripFrequencyWindowSeconds > 0 {
+		log.Printf("     - Trip frequency window: %ds", config.TripFrequencyWindowSeconds)
+	}
+	if !config.TripsOnMemory() || !config.TripsOnLatency() {
+		log.Printf("     - Trips on memory: %t, on latency: %t", config.TripsOnMemory(), config.TripsOnLatency())
+	}
+	if len(config.ExcludedStatusCodes) > 0 {
+		log.Printf("     - Excluded status codes: %v", config.ExcludedStatusCodes)
+	}
 
 	if config.OpsGenie != nil {
 		log.Printf("   OpsGenie:")
@@ -742,13 +1491,50 @@ func logConfigSummary(config *Config) {
 		if config.OpsGenie.Enabled {
 			log.Printf("     - Team: %s", config.OpsGenie.Team)
 			log.Printf("     - Environment: %s", config.OpsGenie.Environment)
-			log.Printf("     - BookmakerID: %s", config.OpsGenie.BookmakerID)
+			log.Printf("     - BookmakerID: %s", config.OpsGenie.EffectiveBookmakerID())
 			log.Printf("     - Business: %s", config.OpsGenie.Business)
 			log.Printf("     - Tags: %v", config.OpsGenie.Tags)
+			if len(config.OpsGenie.AlertCooldowns) > 0 {
+				log.Printf("     - Alert cooldowns: %v (default %ds)", config.OpsGenie.AlertCooldowns, config.OpsGenie.AlertCooldownSeconds)
+			}
+		}
+	}
+
+	if config.Datadog != nil {
+		log.Printf("   Datadog:")
+		log.Printf("     - Enabled: %t", config.Datadog.Enabled)
+		if config.Datadog.StatsdAddr != "" {
+			log.Printf("     - StatsD: %s", config.Datadog.StatsdAddr)
+		}
+		if len(config.Datadog.Tags) > 0 {
+			log.Printf("     - Tags: %v", config.Datadog.Tags)
 		}
 	}
 }
 
+// validateDatadogConfigWithLineNumbers replaces the invalid values of the [datadog]
+// section, reporting them with their line numbers
+func validateDatadogConfigWithLineNumbers(config *DatadogConfig, loader *TOMLConfigLoader) {
+	if config.StatsdAddr != "" {
+		if _, _, err := net.SplitHostPort(config.StatsdAddr); err != nil {
+			loader.validateAndLog("datadog.statsd_addr", config.StatsdAddr, "string (host:port)", false,
+				"Invalid address. Metrics will not be sent")
+			config.StatsdAddr = ""
+		}
+	}
+
+	if config.MetricsIntervalSeconds < 0 {
+		loader.validateAndLog("datadog.metrics_interval_seconds", config.MetricsIntervalSeconds, "int (>=0)", false,
+			fmt.Sprintf("Invalid value. Using default: %d", DefaultDatadogMetricsIntervalSeconds))
+		config.MetricsIntervalSeconds = 0
+	}
+
+	if config.Enabled && config.APIKey == "" && os.Getenv(EnvDatadogAPIKey) == "" {
+		loader.validateAndLog("datadog.api_key", config.APIKey, "string", false,
+			fmt.Sprintf("No API key and %s is not set. Events will be rejected by Datadog", EnvDatadogAPIKey))
+	}
+}
+
 // validateAndSetOpsGenieDefaults validates OpsGenie configuration and sets defaults
 func validateAndSetOpsGenieDefaults(config *OpsGenieConfig, defaults *OpsGenieConfig) {
 	if config.Region == "" {
@@ -815,7 +1601,7 @@ func LoadFullConfig(mainPath, opsGeniePath string) (*Config, error) {
 	}
 
 	if config.OpsGenie == nil || (!config.OpsGenie.Enabled && config.OpsGenie.APIKey == "" &&
-		config.OpsGenie.Region == "" && len(config.OpsGenie.Tags) == 0) {
+		config.OpsGenie.APIKeyFile == "" && config.OpsGenie.Region == "" && len(config.OpsGenie.Tags) == 0) {
 		log.Printf("OpsGenie configuration not found in main config, checking separate file...")
 
 		// Try to load OpsGenie config from separate file, but don't fail if it doesn't exist
@@ -836,7 +1622,9 @@ func LoadFullConfig(mainPath, opsGeniePath string) (*Config, error) {
 	return config, nil
 }
 
-// SaveConfig saves the configuration to a TOML file with enhanced validation
+// SaveConfig saves the configuration to a TOML file with enhanced validation. An existing
+// file is updated in place, keeping its comments and layout; when that is not possible
+// (see updateTOMLInPlace), it is rewritten.
 func SaveConfig(path string, config *Config) error {
 	if config == nil {
 		return fmt.Errorf("config cannot be nil")
@@ -848,6 +1636,20 @@ func SaveConfig(path string, config *Config) error {
 		// Continue saving but log warnings
 	}
 
+	var encoded bytes.Buffer
+	if err := toml.NewEncoder(&encoded).Encode(config); err != nil {
+		return fmt.Errorf("failed to encode config: %v", err)
+	}
+	content := encoded.Bytes()
+	if original, err := os.ReadFile(path); err == nil && len(bytes.TrimSpace(original)) > 0 {
+		edited, err := updateTOMLInPlace(original, content, tomlFieldPaths(reflect.TypeOf(Config{})))
+		if err != nil {
+			log.Printf("Warning: %s cannot be updated in place, rewriting it without its comments: %v", path, err)
+		} else {
+			content = edited
+		}
+	}
+
 	file, err := os.Create(path)
 	if err != nil {
 		return fmt.Errorf("failed to create config file: %v", err)
@@ -856,10 +1658,8 @@ func SaveConfig(path string, config *Config) error {
 
 	log.Printf("Saving config to %s", path)
 
-	encoder := toml.NewEncoder(file)
-	err = encoder.Encode(config)
-	if err != nil {
-		return fmt.Errorf("failed to encode config: %v", err)
+	if _, err := file.Write(content); err != nil {
+		return fmt.Errorf("failed to write config file: %v", err)
 	}
 
 	log.Printf("Config saved successfully:")
@@ -890,6 +1690,15 @@ func ValidateConfig(config *Config) error {
 		errors = append(errors, fmt.Sprintf("invalid memory_threshold: %.2f (must be between 0 and 100)", config.MemoryThreshold))
 	}
 
+	if config.MemoryWarnThreshold < 0 || (config.MemoryWarnThreshold > 0 && config.MemoryWarnThreshold >= config.MemoryThreshold) {
+		errors = append(errors, fmt.Sprintf("invalid memory_warn_threshold: %.2f (must be non-negative and below memory_threshold %.2f)",
+			config.MemoryWarnThreshold, config.MemoryThreshold))
+	}
+
+	if !IsValidMemoryCheckFailurePolicy(config.MemoryCheckFailurePolicy) {
+		errors = append(errors, fmt.Sprintf("invalid memory_check_failure_policy: %q (must be open or closed)", config.MemoryCheckFailurePolicy))
+	}
+
 	if config.LatencyThreshold <= 0 {
 		errors = append(errors, fmt.Sprintf("invalid latency_threshold: %d (must be positive)", config.LatencyThreshold))
 	}
@@ -902,10 +1711,100 @@ func ValidateConfig(config *Config) error {
 		errors = append(errors, fmt.Sprintf("invalid percentile: %.2f (must be between 0 and 1)", config.Percentile))
 	}
 
+	if !IsValidPercentileMethod(config.PercentileMethod) {
+		errors = append(errors, fmt.Sprintf("invalid percentile_method: %q (must be nearest-rank, linear, lower or higher)", config.PercentileMethod))
+	}
+
 	if config.WaitTime < 0 {
 		errors = append(errors, fmt.Sprintf("invalid wait_time: %d (must be non-negative)", config.WaitTime))
 	}
 
+	if config.TrendWindowSize < 0 {
+		errors = append(errors, fmt.Sprintf("invalid trend_window_size: %d (must be non-negative)", config.TrendWindowSize))
+	}
+
+	// More samples than the window holds would keep a plateau from ever being detected
+	if config.PlateauMinSamples < 0 || (config.LatencyWindowSize > 0 && config.PlateauMinSamples > config.LatencyWindowSize) {
+		errors = append(errors, fmt.Sprintf("invalid plateau_min_samples: %d (must be between 0 and latency_window_size %d)",
+			config.PlateauMinSamples, config.LatencyWindowSize))
+	}
+
+	if config.PlateauMinFraction < 0 || config.PlateauMinFraction > 1 {
+		errors = append(errors, fmt.Sprintf("invalid plateau_min_fraction: %.2f (must be between 0 and 1)", config.PlateauMinFraction))
+	}
+
+	if config.SparseTripFactor != 0 && config.SparseTripFactor <= 1 {
+		errors = append(errors, fmt.Sprintf("invalid sparse_trip_factor: %.2f (must be 0 or greater than 1)", config.SparseTripFactor))
+	}
+
+	if config.SampleRate < 0 || config.SampleRate > 1 {
+		errors = append(errors, fmt.Sprintf("invalid sample_rate: %.2f (must be between 0 and 1)", config.SampleRate))
+	}
+
+	if config.ProtectionPercent < 0 || config.ProtectionPercent > 100 {
+		errors = append(errors, fmt.Sprintf("invalid protection_percent: %.2f (must be between 0 and 100)", config.ProtectionPercent))
+	}
+
+	if config.HealthScoreThreshold < 0 || config.HealthScoreThreshold > 100 {
+		errors = append(errors, fmt.Sprintf("invalid health_score_threshold: %.2f (must be between 0 and 100)", config.HealthScoreThreshold))
+	}
+	if config.HealthMemoryWeight < 0 {
+		errors = append(errors, fmt.Sprintf("invalid health_memory_weight: %.2f (must be non-negative)", config.HealthMemoryWeight))
+	}
+	if config.HealthLatencyWeight < 0 {
+		errors = append(errors, fmt.Sprintf("invalid health_latency_weight: %.2f (must be non-negative)", config.HealthLatencyWeight))
+	}
+
+	if config.LatencySeriesSize < 0 {
+		errors = append(errors, fmt.Sprintf("invalid latency_series_size: %d (must be non-negative)", config.LatencySeriesSize))
+	}
+
+	// A cap at or below the threshold would keep the percentile from ever exceeding it
+	if config.MaxAcceptedLatencyMs < 0 || (config.MaxAcceptedLatencyMs > 0 && config.MaxAcceptedLatencyMs <= config.LatencyThreshold) {
+		errors = append(errors, fmt.Sprintf("invalid max_accepted_latency_ms: %d (must be 0 or greater than latency_threshold %d)",
+			config.MaxAcceptedLatencyMs, config.LatencyThreshold))
+	}
+
+	// More samples than the window holds would keep the breaker from ever tripping on latency
+	if config.MinSamplesAboveThreshold < 0 || (config.LatencyWindowSize > 0 && config.MinSamplesAboveThreshold > config.LatencyWindowSize) {
+		errors = append(errors, fmt.Sprintf("invalid min_samples_above_threshold: %d (must be between 0 and latency_window_size %d)",
+			config.MinSamplesAboveThreshold, config.LatencyWindowSize))
+	}
+
+	if config.BreachDurationSeconds < 0 {
+		errors = append(errors, fmt.Sprintf("invalid breach_duration_seconds: %d (must be non-negative)", config.BreachDurationSeconds))
+	}
+
+	if config.ProbeIntervalSeconds < 0 {
+		errors = append(errors, fmt.Sprintf("invalid probe_interval_seconds: %d (must be non-negative)", config.ProbeIntervalSeconds))
+	}
+
+	if config.RecoveryConsecutiveChecks < 0 {
+		errors = append(errors, fmt.Sprintf("invalid recovery_consecutive_checks: %d (must be non-negative)", config.RecoveryConsecutiveChecks))
+	}
+
+	if config.RecoveryCheckIntervalSeconds < 0 {
+		errors = append(errors, fmt.Sprintf("invalid recovery_check_interval_seconds: %d (must be non-negative)", config.RecoveryCheckIntervalSeconds))
+	}
+
+	// A window that cannot hold warmup_min_samples would never have sufficient data
+	if config.WarmupMinSamples < 0 || (config.LatencyWindowSize > 0 && config.WarmupMinSamples > config.LatencyWindowSize) {
+		errors = append(errors, fmt.Sprintf("invalid warmup_min_samples: %d (must be between 0 and latency_window_size %d)",
+			config.WarmupMinSamples, config.LatencyWindowSize))
+	}
+
+	if !IsValidWarmupPolicy(config.WarmupPolicy) {
+		errors = append(errors, fmt.Sprintf("invalid warmup_policy: %q (must be fail-open or fail-closed)", config.WarmupPolicy))
+	}
+
+	if config.TripFrequencyWindowSeconds < 0 {
+		errors = append(errors, fmt.Sprintf("invalid trip_frequency_window_seconds: %d (must be non-negative)", config.TripFrequencyWindowSeconds))
+	}
+
+	if _, err := ParseStatusCodeRanges(config.ExcludedStatusCodes); err != nil {
+		errors = append(errors, fmt.Sprintf("invalid excluded_status_codes: %v", err))
+	}
+
 	// Validate OpsGenie config if present
 	if config.OpsGenie != nil {
 		if err := ValidateOpsGenieConfig(config.OpsGenie); err != nil {
@@ -913,6 +1812,10 @@ func ValidateConfig(config *Config) error {
 		}
 	}
 
+	if err := ValidateDatadogConfig(config.Datadog); err != nil {
+		errors = append(errors, fmt.Sprintf("Datadog config validation failed: %v", err))
+	}
+
 	if len(errors) > 0 {
 		return fmt.Errorf("configuration validation errors: %v", errors)
 	}
@@ -920,6 +1823,40 @@ func ValidateConfig(config *Config) error {
 	return nil
 }
 
+// EnvDatadogAPIKey is the environment variable holding the Datadog API key when the
+// [datadog] section has no api_key
+const EnvDatadogAPIKey = "DD_API_KEY"
+
+// DefaultDatadogMetricsIntervalSeconds is the metrics_interval_seconds used when it is not set
+const DefaultDatadogMetricsIntervalSeconds = 10
+
+// ValidateDatadogConfig validates the [datadog] section, which is optional
+func ValidateDatadogConfig(config *DatadogConfig) error {
+	if config == nil {
+		return nil
+	}
+
+	var errors []string
+	if config.StatsdAddr != "" {
+		if _, _, err := net.SplitHostPort(config.StatsdAddr); err != nil {
+			errors = append(errors, fmt.Sprintf("invalid statsd_addr: %q (must be host:port)", config.StatsdAddr))
+		}
+	}
+	if config.MetricsIntervalSeconds < 0 {
+		errors = append(errors, fmt.Sprintf("invalid metrics_interval_seconds: %d (must be 0 or greater)", config.MetricsIntervalSeconds))
+	}
+	if config.EventsURL != "" {
+		if parsed, err := url.Parse(config.EventsURL); err != nil || parsed.Scheme == "" || parsed.Host == "" {
+			errors = append(errors, fmt.Sprintf("invalid events_url: %q (must be an absolute URL)", config.EventsURL))
+		}
+	}
+
+	if len(errors) > 0 {
+		return fmt.Errorf("validation errors: %v", errors)
+	}
+	return nil
+}
+
 // ValidateOpsGenieConfig validates the OpsGenie configuration
 func ValidateOpsGenieConfig(config *OpsGenieConfig) error {
 	if config == nil {
@@ -944,14 +1881,125 @@ func ValidateOpsGenieConfig(config *OpsGenieConfig) error {
 	if config.AlertCooldownSeconds < 0 {
 		errors = append(errors, fmt.Sprintf("invalid alert_cooldown_seconds: %d (must be non-negative)", config.AlertCooldownSeconds))
 	}
+	for _, key := range sortedKeys(config.AlertCooldowns) {
+		if !isCooldownAlertType(key) {
+			errors = append(errors, fmt.Sprintf("invalid alert_cooldowns key: %q (must be open, reset, memory, memory-warning or latency)", key))
+		} else if config.AlertCooldowns[key] < 0 {
+			errors = append(errors, fmt.Sprintf("invalid alert_cooldowns.%s: %d (must be non-negative)", key, config.AlertCooldowns[key]))
+		}
+	}
+
+	if config.RedactPattern != "" {
+		if problem := redactPatternError(config.RedactPattern); problem != "" {
+			errors = append(errors, fmt.Sprintf("invalid redact_pattern: %s", problem))
+		}
+	}
+
+	if config.AlertAggregationSeconds < 0 {
+		errors = append(errors, fmt.Sprintf("invalid alert_aggregation_seconds: %d (must be non-negative)", config.AlertAggregationSeconds))
+	}
+
+	if config.ConnectivityCheckSeconds < 0 {
+		errors = append(errors, fmt.Sprintf("invalid connectivity_check_seconds: %d (must be non-negative)", config.ConnectivityCheckSeconds))
+	}
+
+	// Validate staged alert priorities
+	if config.InitialAlertPriority != "" && !validPriorities[config.InitialAlertPriority] {
+		errors = append(errors, fmt.Sprintf("invalid initial_alert_priority: %s (must be P1-P5)", config.InitialAlertPriority))
+	}
+	if config.EscalatedAlertPriority != "" && !validPriorities[config.EscalatedAlertPriority] {
+		errors = append(errors, fmt.Sprintf("invalid escalated_alert_priority: %s (must be P1-P5)", config.EscalatedAlertPriority))
+	}
+	if validPriorities[config.InitialAlertPriority] && validPriorities[config.EscalatedAlertPriority] &&
+		config.EscalatedAlertPriority >= config.InitialAlertPriority {
+		// P1 is the highest severity, so the escalated priority must have a lower number
+		log.Printf("Warning: escalated_alert_priority %s is not more severe than initial_alert_priority %s; escalation will not raise the alert priority",
+			config.EscalatedAlertPriority, config.InitialAlertPriority)
+	}
+
+	// Validate the escalation ladder: steps must be strictly increasing in time
+	for i, step := range config.PriorityEscalationLadder {
+		if step.AfterSeconds <= 0 {
+			errors = append(errors, fmt.Sprintf("invalid priority_escalation_ladder[%d].after_seconds: %d (must be positive)", i, step.AfterSeconds))
+		} else if i > 0 && step.AfterSeconds <= config.PriorityEscalationLadder[i-1].AfterSeconds {
+			errors = append(errors, fmt.Sprintf("invalid priority_escalation_ladder[%d].after_seconds: %d (must be greater than the previous step, %d)",
+				i, step.AfterSeconds, config.PriorityEscalationLadder[i-1].AfterSeconds))
+		}
+		if !validPriorities[step.Priority] {
+			errors = append(errors, fmt.Sprintf("invalid priority_escalation_ladder[%d].priority: %s (must be P1-P5)", i, step.Priority))
+		} else if i > 0 && validPriorities[config.PriorityEscalationLadder[i-1].Priority] &&
+			step.Priority > config.PriorityEscalationLadder[i-1].Priority {
+			log.Printf("Warning: priority_escalation_ladder[%d] lowers the priority from %s to %s",
+				i, config.PriorityEscalationLadder[i-1].Priority, step.Priority)
+		}
+	}
+
+	for i, step := range config.PriorityByMagnitude {
+		if step.MinFactor < 1 {
+			errors = append(errors, fmt.Sprintf("invalid priority_by_magnitude[%d].min_factor: %.2f (must be at least 1)", i, step.MinFactor))
+		}
+		if !validPriorities[step.Priority] {
+			errors = append(errors, fmt.Sprintf("invalid priority_by_magnitude[%d].priority: %s (must be P1-P5)", i, step.Priority))
+		}
+	}
+
+	if config.MaxPendingAlerts < 0 {
+		errors = append(errors, fmt.Sprintf("invalid max_pending_alerts: %d (must be non-negative)", config.MaxPendingAlerts))
+	}
+
+	// Validate the stuck-open alert
+	if config.MaxOpenDurationSeconds < 0 {
+		errors = append(errors, fmt.Sprintf("invalid max_open_duration_seconds: %d (must be non-negative)", config.MaxOpenDurationSeconds))
+	}
+	if config.StuckOpenAlertPriority != "" && !validPriorities[config.StuckOpenAlertPriority] {
+		errors = append(errors, fmt.Sprintf("invalid stuck_open_alert_priority: %s (must be P1-P5)", config.StuckOpenAlertPriority))
+	}
+
+	// Validate per-environment overrides
+	for env, settings := range config.EnvironmentSettings {
+		if !isKnownEnvironment(env) {
+			errors = append(errors, fmt.Sprintf("unknown environment in environment_settings: %s", env))
+			continue
+		}
+		if settings.Priority != "" && !validPriorities[settings.Priority] {
+			errors = append(errors, fmt.Sprintf("invalid environment_settings.%s.priority: %s (must be P1-P5)", env, settings.Priority))
+		}
+		if settings.MaxPriority != "" && !validPriorities[settings.MaxPriority] {
+			errors = append(errors, fmt.Sprintf("invalid environment_settings.%s.max_priority: %s (must be P1-P5)", env, settings.MaxPriority))
+		}
+		if settings.CooldownSeconds < 0 {
+			errors = append(errors, fmt.Sprintf("invalid environment_settings.%s.cooldown_seconds: %d (must be non-negative)", env, settings.CooldownSeconds))
+		}
+	}
+
+	// Validate message templates
+	for _, key := range sortedKeys(config.MessageTemplates) {
+		if problem := validateMessageTemplate(key, config.MessageTemplates[key]); problem != "" {
+			errors = append(errors, fmt.Sprintf("invalid message_templates: %s", problem))
+		}
+	}
+
+	// Validate custom alert details (in key order, so errors are stable)
+	seenCustomKeys := make(map[string]string)
+	for _, key := range sortedKeys(config.APICustomAttributes) {
+		if problem := customAttributeError(key); problem != "" {
+			errors = append(errors, fmt.Sprintf("invalid api_custom_attributes key: %s", problem))
+			continue
+		}
+		name := strings.ToLower(strings.TrimSpace(key))
+		if other, exists := seenCustomKeys[name]; exists {
+			errors = append(errors, fmt.Sprintf("duplicate api_custom_attributes keys: %q and %q", other, key))
+		}
+		seenCustomKeys[name] = key
+	}
 
 	// Validate mandatory fields if OpsGenie is enabled
 	if config.Enabled {
 		if config.Team == "" {
 			errors = append(errors, "team is required when OpsGenie is enabled")
 		}
-		// Note: Other mandatory fields (Environment, BookmakerID, etc.) are validated at runtime
-		// because they can use environment variables and auto-detection
+		// Note: Other mandatory fields (Environment, BookmakerID or its alias ProjectID, etc.)
+		// are validated at runtime because they can use environment variables and auto-detection
 	}
 
 	if len(errors) > 0 {
@@ -989,30 +2037,76 @@ func GetConfigSummary(config *Config) map[string]interface{} {
 		return map[string]interface{}{"error": "config is nil"}
 	}
 
+	healthMemoryWeight, healthLatencyWeight := config.healthWeights()
 	summary := map[string]interface{}{
+		"name":                            config.Name,
 		"memory_threshold":                config.MemoryThreshold,
+		"memory_warn_threshold":           config.MemoryWarnThreshold,
+		"memory_check_failure_policy":     config.memoryCheckFailurePolicy(),
 		"latency_threshold":               config.LatencyThreshold,
 		"latency_window_size":             config.LatencyWindowSize,
 		"percentile":                      config.Percentile,
+		"percentile_method":               config.PercentileMethod,
 		"wait_time":                       config.WaitTime,
 		"trend_analysis_enabled":          config.TrendAnalysisEnabled,
 		"trend_analysis_min_sample_count": config.TrendAnalysisMinSampleCount,
+		"trend_window_size":               config.TrendWindowSize,
+		"plateau_min_samples":             config.plateauMinSamples(),
+		"plateau_min_fraction":            config.plateauMinFraction(),
+		"sparse_trip_factor":              config.sparseTripFactor(),
+		"sample_rate":                     config.SampleRate,
+		"protection_percent":              config.protectionPercent(),
+		"health_score_threshold":          config.HealthScoreThreshold,
+		"health_memory_weight":            healthMemoryWeight,
+		"health_latency_weight":           healthLatencyWeight,
+		"latency_series_size":             config.LatencySeriesSize,
+		"max_accepted_latency_ms":         config.MaxAcceptedLatencyMs,
+		"min_samples_above_threshold":     config.MinSamplesAboveThreshold,
+		"breach_duration_seconds":         config.BreachDurationSeconds,
+		"recovery_consecutive_checks":     config.recoveryConsecutiveChecks(),
+		"recovery_check_interval_seconds": int(config.recoveryCheckInterval() / time.Second),
+		"probe_interval_seconds":          int(config.probeInterval().Seconds()),
+		"warmup_min_samples":              config.warmupMinSamples(),
+		"warmup_policy":                   config.warmupPolicy(),
+		"trip_frequency_window_seconds":   int(config.tripFrequencyWindow().Seconds()),
+		"trip_on_memory":                  config.TripsOnMemory(),
+		"trip_on_latency":                 config.TripsOnLatency(),
+		"honor_shared_trips":              config.HonorSharedTrips,
+		"excluded_status_codes":           config.ExcludedStatusCodes,
 	}
 
 	if config.OpsGenie != nil {
 		opsGenieSummary := map[string]interface{}{
-			"enabled":                config.OpsGenie.Enabled,
-			"region":                 config.OpsGenie.Region,
-			"priority":               config.OpsGenie.Priority,
-			"team":                   config.OpsGenie.Team,
-			"environment":            config.OpsGenie.Environment,
-			"bookmaker_id":           config.OpsGenie.BookmakerID,
-			"business":               config.OpsGenie.Business,
-			"additional_context":     config.OpsGenie.AdditionalContext,
-			"alert_cooldown_seconds": config.OpsGenie.AlertCooldownSeconds,
+			"enabled":                    config.OpsGenie.Enabled,
+			"region":                     config.OpsGenie.Region,
+			"priority":                   config.OpsGenie.Priority,
+			"team":                       config.OpsGenie.Team,
+			"environment":                config.OpsGenie.Environment,
+			"bookmaker_id":               config.OpsGenie.EffectiveBookmakerID(),
+			"business":                   config.OpsGenie.Business,
+			"additional_context":         config.OpsGenie.AdditionalContext,
+			"alert_cooldown_seconds":     config.OpsGenie.AlertCooldownSeconds,
+			"alert_cooldowns":            config.OpsGenie.AlertCooldowns,
+			"alert_aggregation_seconds":  config.OpsGenie.AlertAggregationSeconds,
+			"use_environments":           config.OpsGenie.UseEnvironments,
+			"max_pending_alerts":         config.OpsGenie.MaxPendingAlerts,
+			"connectivity_check_seconds": config.OpsGenie.ConnectivityCheckSeconds,
+			"redact_keys":                config.OpsGenie.RedactKeys,
+			"redact_pattern":             config.OpsGenie.RedactPattern,
+			"alert_identifier":           config.OpsGenie.alertIdentifier(),
 		}
 		summary["opsgenie"] = opsGenieSummary
 	}
 
+	if config.Datadog != nil {
+		summary["datadog"] = map[string]interface{}{
+			"enabled":                  config.Datadog.Enabled,
+			"site":                     config.Datadog.Site,
+			"statsd_addr":              config.Datadog.StatsdAddr,
+			"metrics_interval_seconds": config.Datadog.MetricsIntervalSeconds,
+			"tags":                     config.Datadog.Tags,
+		}
+	}
+
 	return summary
 }
@@ -0,0 +1,495 @@
+package breaker
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// tomlPathSeparator joins the parts of a TOML key path; unlike '.', it cannot appear in
+// a key
+const tomlPathSeparator = "\x00"
+
+// encodedTOMLTable is a table of the TOML encoding of a configuration
+type encodedTOMLTable struct {
+	path   string
+	header string            // Header line, empty for the root table
+	array  bool              // Element of an array of tables, or a table within one
+	lines  []string          // Key lines, trimmed
+	keys   []string          // Full paths of the keys of lines
+	values map[string]string // Values of the keys, by full path
+}
+
+// updateTOMLInPlace returns original, a TOML document, edited to hold the values of
+// encoded, the TOML encoding of the new configuration, while keeping its comments,
+// order and layout: changed values are replaced in their lines, keys that are no
+// longer encoded are removed, and the keys that are missing are added to their tables,
+// unless they are fields (see tomlFieldPaths) with a zero value, which is what a missing
+// field decodes to. Arrays of tables are kept as written. It fails when original uses
+// constructs it cannot edit, such as multi-line values, or when the result would not
+// decode to the same configuration as encoded.
+func updateTOMLInPlace(original, encoded []byte, fields map[string]bool) ([]byte, error) {
+	tables, err := parseEncodedTOML(string(encoded))
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[string]string)
+	for _, table := range tables {
+		if !table.array {
+			for path, value := range table.values {
+				values[path] = value
+			}
+		}
+	}
+
+	text := string(original)
+	endsWithNewline := strings.HasSuffix(text, "\n")
+	lines := strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+	removed := make(map[int]bool)
+	seen := make(map[string]bool)    // Key paths found in original
+	lastLine := make(map[string]int) // Last key line, or the header, of each table of original
+	arrays := make(map[string]bool)  // Arrays of tables of original
+	firstHeader := len(lines)
+
+	table, inArray := "", false
+	for i, line := range lines {
+		content, _ := splitTOMLComment(line)
+		trimmed := strings.TrimSpace(content)
+		switch {
+		case trimmed == "":
+			continue
+
+		case strings.HasPrefix(trimmed, "["):
+			array := strings.HasPrefix(trimmed, "[[")
+			name := strings.TrimSuffix(strings.TrimPrefix(trimmed, "["), "]")
+			if array {
+				name = strings.TrimSuffix(strings.TrimPrefix(name, "["), "]")
+			}
+			parts, err := parseTOMLKey(name)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", i+1, err)
+			}
+			table = strings.Join(parts, tomlPathSeparator)
+			inArray = array || withinTOMLArray(table, arrays)
+			if array {
+				arrays[table] = true
+			} else if !inArray {
+				lastLine[table] = i
+			}
+			firstHeader = min(firstHeader, i)
+
+		default:
+			keyText, value, valueStart, ok := splitTOMLKeyValue(content)
+			if !ok {
+				return nil, fmt.Errorf("line %d is not a key = value pair", i+1)
+			}
+			if !tomlValueIsComplete(value) {
+				return nil, fmt.Errorf("line %d: multi-line values are not supported", i+1)
+			}
+			if inArray {
+				continue // Arrays of tables are kept as written
+			}
+			parts, err := parseTOMLKey(keyText)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", i+1, err)
+			}
+			path := strings.Join(parts, tomlPathSeparator)
+			if table != "" {
+				path = table + tomlPathSeparator + path
+			}
+
+			seen[path] = true
+			newValue, exists := values[path]
+			if !exists {
+				removed[i] = true
+				continue
+			}
+			lastLine[table] = i
+			if !sameTOMLValue(value, newValue) {
+				lines[i] = replaceTOMLValue(line, valueStart, value, newValue)
+			}
+		}
+	}
+
+	// Add the missing keys to their tables, and the missing tables at the end
+	insertions := make(map[int][]string) // Lines to insert after each line; -1 is the top
+	var appended []string
+	for _, table := range tables {
+		if table.array {
+			if !withinTOMLArray(table.path, arrays) && !arrays[table.path] {
+				appended = append(appended, "", table.header)
+				appended = append(appended, table.lines...)
+			}
+			continue
+		}
+
+		var missing []string
+		for i, path := range table.keys {
+			if !seen[path] && !(fields[path] && isZeroTOMLValue(table.values[path])) {
+				missing = append(missing, table.lines[i])
+			}
+		}
+		if len(missing) == 0 {
+			continue
+		}
+
+		if at, exists := lastLine[table.path]; exists {
+			indent := ""
+			if !strings.HasPrefix(strings.TrimSpace(lines[at]), "[") {
+				indent = lines[at][:len(lines[at])-len(strings.TrimLeft(lines[at], " \t"))]
+			}
+			for _, line := range missing {
+				insertions[at] = append(insertions[at], indent+line)
+			}
+		} else if table.path == "" {
+			insertions[firstHeader-1] = append(insertions[firstHeader-1], missing...)
+		} else {
+			appended = append(appended, "", table.header)
+			appended = append(appended, missing...)
+		}
+	}
+
+	result := append([]string(nil), insertions[-1]...)
+	for i, line := range lines {
+		if !removed[i] {
+			result = append(result, line)
+		}
+		result = append(result, insertions[i]...)
+	}
+	result = append(result, appended...)
+
+	edited := strings.Join(result, "\n")
+	if endsWithNewline || len(appended) > 0 {
+		edited += "\n"
+	}
+	if !sameTOMLDocument(edited, string(encoded)) {
+		return nil, fmt.Errorf("the edited file would not hold the new configuration")
+	}
+	return []byte(edited), nil
+}
+
+// parseEncodedTOML splits a document written by the TOML encoder into its tables, in
+// order
+func parseEncodedTOML(encoded string) ([]*encodedTOMLTable, error) {
+	current := &encodedTOMLTable{values: make(map[string]string)}
+	tables := []*encodedTOMLTable{current}
+	arrays := make(map[string]bool)
+
+	for _, line := range strings.Split(encoded, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" {
+			continue
+		}
+
+		if strings.HasPrefix(trimmed, "[") {
+			array := strings.HasPrefix(trimmed, "[[")
+			name := strings.Trim(trimmed, "[]")
+			parts, err := parseTOMLKey(name)
+			if err != nil {
+				return nil, err
+			}
+			path := strings.Join(parts, tomlPathSeparator)
+			if array {
+				arrays[path] = true
+			}
+			current = &encodedTOMLTable{
+				path:   path,
+				header: trimmed,
+				array:  array || withinTOMLArray(path, arrays),
+				values: make(map[string]string),
+			}
+			tables = append(tables, current)
+			continue
+		}
+
+		keyText, value, _, ok := splitTOMLKeyValue(trimmed)
+		if !ok {
+			return nil, fmt.Errorf("unexpected encoded line %q", trimmed)
+		}
+		parts, err := parseTOMLKey(keyText)
+		if err != nil {
+			return nil, err
+		}
+		path := strings.Join(parts, tomlPathSeparator)
+		if current.path != "" {
+			path = current.path + tomlPathSeparator + path
+		}
+		current.lines = append(current.lines, trimmed)
+		current.keys = append(current.keys, path)
+		current.values[path] = value
+	}
+	return tables, nil
+}
+
+// tomlFieldPaths returns the key paths of the fields of t, a struct type, and of its
+// nested tables, whose zero value means the same as a missing key. Pointers are left
+// out, since only nil means unset, and so are the entries of maps, since an empty string
+// in a map is a value.
+func tomlFieldPaths(t reflect.Type) map[string]bool {
+	paths := make(map[string]bool)
+	addTOMLFieldPaths(t, "", paths)
+	return paths
+}
+
+// addTOMLFieldPaths adds the key paths of the fields of t under prefix to paths
+func addTOMLFieldPaths(t reflect.Type, prefix string, paths map[string]bool) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("toml"), ",")
+		if !field.IsExported() || name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		path := name
+		if prefix != "" {
+			path = prefix + tomlPathSeparator + name
+		}
+		if field.Type.Kind() != reflect.Pointer {
+			paths[path] = true
+		}
+		addTOMLFieldPaths(field.Type, path, paths)
+	}
+}
+
+// withinTOMLArray reports whether the table path is inside one of arrays
+func withinTOMLArray(path string, arrays map[string]bool) bool {
+	for array := range arrays {
+		if strings.HasPrefix(path, array+tomlPathSeparator) {
+			return true
+		}
+	}
+	return false
+}
+
+// splitTOMLComment splits a line into its content and the index of its comment, or -1
+// when it has none
+func splitTOMLComment(line string) (string, int) {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote == '"' && c == '\\':
+			i++ // Escaped character
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#':
+			return line[:i], i
+		}
+	}
+	return line, -1
+}
+
+// splitTOMLKeyValue splits the content of a key = value line into the key, the trimmed
+// value and the index where the text after '=' starts
+func splitTOMLKeyValue(content string) (string, string, int, bool) {
+	var quote byte
+	for i := 0; i < len(content); i++ {
+		c := content[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '=':
+			key := strings.TrimSpace(content[:i])
+			value := strings.TrimSpace(content[i+1:])
+			return key, value, i + 1, key != "" && value != ""
+		}
+	}
+	return "", "", 0, false
+}
+
+// parseTOMLKey splits a possibly dotted and quoted TOML key into its parts
+func parseTOMLKey(key string) ([]string, error) {
+	var parts []string
+	var quote byte
+	start := 0
+	for i := 0; i <= len(key); i++ {
+		if i < len(key) {
+			c := key[i]
+			if quote != 0 {
+				if c == '\\' && quote == '"' {
+					i++
+				} else if c == quote {
+					quote = 0
+				}
+				continue
+			}
+			if c == '"' || c == '\'' {
+				quote = c
+				continue
+			}
+			if c != '.' {
+				continue
+			}
+		}
+
+		part := strings.TrimSpace(key[start:i])
+		switch {
+		case part == "":
+			return nil, fmt.Errorf("invalid key %q", key)
+		case part[0] == '"':
+			unquoted, err := strconv.Unquote(part)
+			if err != nil {
+				return nil, fmt.Errorf("invalid key %q: %v", key, err)
+			}
+			part = unquoted
+		case part[0] == '\'':
+			part = strings.Trim(part, "'")
+		}
+		parts = append(parts, part)
+		start = i + 1
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated quote in key %q", key)
+	}
+	return parts, nil
+}
+
+// tomlValueIsComplete reports whether value is whole, rather than the first line of a
+// multi-line string or array
+func tomlValueIsComplete(value string) bool {
+	if strings.HasPrefix(value, `"""`) || strings.HasPrefix(value, "'''") {
+		return false
+	}
+
+	depth := 0
+	var quote byte
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		switch {
+		case quote == '"' && c == '\\':
+			i++
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '[' || c == '{':
+			depth++
+		case c == ']' || c == '}':
+			depth--
+		}
+	}
+	return depth == 0 && quote == 0
+}
+
+// replaceTOMLValue replaces the value of a key = value line, keeping its comment at the
+// same column when it fits
+func replaceTOMLValue(line string, valueStart int, value, newValue string) string {
+	begin := valueStart + strings.Index(line[valueStart:], value)
+	edited := line[:begin] + newValue
+
+	_, comment := splitTOMLComment(line)
+	if comment < 0 {
+		if strings.HasSuffix(line, "\r") {
+			edited += "\r"
+		}
+		return edited
+	}
+	padding := max(comment-len(edited), 1)
+	return edited + strings.Repeat(" ", padding) + line[comment:]
+}
+
+// isZeroTOMLValue reports whether an encoded value is the zero value of its type, which
+// is what a missing key decodes to
+func isZeroTOMLValue(value string) bool {
+	switch value {
+	case `""`, "0", "0.0", "false", "[]":
+		return true
+	}
+	return false
+}
+
+// sameTOMLValue reports whether two TOML values are equal, numbers compared by value
+func sameTOMLValue(a, b string) bool {
+	var first, second map[string]interface{}
+	if _, err := toml.Decode("v = "+a, &first); err != nil {
+		return false
+	}
+	if _, err := toml.Decode("v = "+b, &second); err != nil {
+		return false
+	}
+	return reflect.DeepEqual(normalizeTOML(first), normalizeTOML(second))
+}
+
+// sameTOMLDocument reports whether two TOML documents hold the same values, ignoring
+// zero values, which decode the same as missing keys
+func sameTOMLDocument(a, b string) bool {
+	var first, second map[string]interface{}
+	if _, err := toml.Decode(a, &first); err != nil {
+		return false
+	}
+	if _, err := toml.Decode(b, &second); err != nil {
+		return false
+	}
+	return reflect.DeepEqual(normalizeTOML(first), normalizeTOML(second))
+}
+
+// normalizeTOML returns a decoded TOML value with its integers as floats and without
+// its zero values, so that equivalent documents compare equal
+func normalizeTOML(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		normalized := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			if item = normalizeTOML(item); item != nil {
+				normalized[key] = item
+			}
+		}
+		if len(normalized) == 0 {
+			return nil
+		}
+		return normalized
+	case []map[string]interface{}:
+		items := make([]interface{}, len(v))
+		for i, item := range v {
+			items[i] = normalizeTOML(item)
+		}
+		return normalizeTOML(items)
+	case []interface{}:
+		if len(v) == 0 {
+			return nil
+		}
+		items := make([]interface{}, len(v))
+		for i, item := range v {
+			items[i] = normalizeTOML(item)
+		}
+		return items
+	case int64:
+		return normalizeTOML(float64(v))
+	case float64:
+		if v == 0 {
+			return nil
+		}
+	case string:
+		if v == "" {
+			return nil
+		}
+	case bool:
+		if !v {
+			return nil
+		}
+	}
+	return value
+}
@@ -0,0 +1,81 @@
+package breaker
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ConfigSource describes where the configuration of a BreakerAPI came from, to
+// diagnose configuration changes that do not take effect
+type ConfigSource struct {
+	Path                string    `json:"path"`                         // Absolute path of the config file
+	Loaded              bool      `json:"loaded"`                       // Whether the configuration was loaded from the file
+	DefaultsSubstituted bool      `json:"defaults_substituted"`         // Whether the default configuration was used instead of the file
+	SubstitutedFields   []string  `json:"substituted_fields,omitempty"` // Fields of the file whose invalid values were replaced by defaults
+	UnknownKeys         []string  `json:"unknown_keys,omitempty"`       // Keys of the file that were ignored (often typos)
+	ModTime             time.Time `json:"mod_time,omitempty"`           // Modification time of the file when it was loaded or written
+	LoadError           string    `json:"load_error,omitempty"`         // Why the file could not be loaded or written
+	LoadedAt            time.Time `json:"loaded_at,omitempty"`          // When the configuration was determined
+	CurrentModTime      time.Time `json:"current_mod_time,omitempty"`   // Modification time of the file now
+	ModifiedSinceLoad   bool      `json:"modified_since_load"`          // Whether the file changed after it was loaded
+	FileExists          bool      `json:"file_exists"`                  // Whether the file exists now
+}
+
+// newConfigSource describes a configuration determined now for the given file
+func newConfigSource(path string, loaded, defaultsSubstituted bool, loader *TOMLConfigLoader, err error) *ConfigSource {
+	source := &ConfigSource{
+		Path:                absoluteConfigPath(path),
+		Loaded:              loaded,
+		DefaultsSubstituted: defaultsSubstituted,
+		LoadedAt:            time.Now(),
+	}
+	if info, statErr := os.Stat(path); statErr == nil {
+		source.ModTime = info.ModTime()
+	}
+	if loader != nil {
+		source.SubstitutedFields = loader.substitutedFields()
+		source.UnknownKeys = loader.undecodedKeys
+	}
+	if err != nil {
+		source.LoadError = err.Error()
+	}
+	return source
+}
+
+func absoluteConfigPath(path string) string {
+	if absPath, err := filepath.Abs(path); err == nil {
+		return absPath
+	}
+	return path
+}
+
+// ConfigSource returns where the configuration of the API came from, with the current
+// state of the file. APIs not created by InitBreaker or NewBreakerAPIFromFile report
+// the driver's config file as not loaded.
+func (b *BreakerAPI) ConfigSource() ConfigSource {
+	b.lock.Lock()
+	var source ConfigSource
+	if b.configSource != nil {
+		source = *b.configSource
+	} else if b.Driver != nil {
+		source.Path = absoluteConfigPath(b.Driver.GetConfigFile())
+	}
+	b.lock.Unlock()
+
+	if info, err := os.Stat(source.Path); err == nil {
+		source.FileExists = true
+		source.CurrentModTime = info.ModTime()
+		source.ModifiedSinceLoad = !source.ModTime.IsZero() && !info.ModTime().Equal(source.ModTime)
+	}
+	return source
+}
+
+// GetConfigSource returns the absolute path of the config file, whether it was loaded
+// or replaced by defaults, and whether it changed since (see ConfigSource)
+func (b *BreakerAPI) GetConfigSource(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, b.ConfigSource())
+}
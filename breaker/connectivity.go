@@ -0,0 +1,157 @@
+package breaker
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+// Alert types given to the connectivity notifier (see SetConnectivityNotifier)
+const (
+	AlertTypeOpsGenieUnreachable = "opsgenie-unreachable"
+	AlertTypeOpsGenieRestored    = "opsgenie-restored"
+)
+
+// SetConnectivityNotifier sets the notifier, typically Slack, told when a connectivity
+// check finds OpsGenie unreachable and when it is reachable again, so that losing the
+// primary alerting does not go unnoticed. A nil notifier only logs the changes.
+func (o *OpsGenieClient) SetConnectivityNotifier(notifier Notifier) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	o.connectivityNotifier = notifier
+}
+
+// Reachable reports whether OpsGenie answered the last connectivity check. It is true
+// until a check fails.
+func (o *OpsGenieClient) Reachable() bool {
+	if o == nil {
+		return false
+	}
+	o.mutex.RLock()
+	defer o.mutex.RUnlock()
+	return !o.unreachable
+}
+
+// CheckConnectivity tests the connection to OpsGenie and returns the error, if any. When
+// OpsGenie goes from reachable to unreachable, or back, it logs the change and tells the
+// connectivity notifier; repeated failures are reported once. Clients that are not
+// initialized, or deliver their alerts to a notifier, are not checked.
+func (o *OpsGenieClient) CheckConnectivity() error {
+	if o == nil || o.currentAlertClient() == nil || o.activeNotifier() != nil {
+		return nil
+	}
+
+	err := o.TestConnection()
+
+	o.mutex.Lock()
+	changed := o.unreachable != (err != nil)
+	o.unreachable = err != nil
+	notifier := o.connectivityNotifier
+	o.mutex.Unlock()
+	if !changed {
+		return err
+	}
+
+	alertType := AlertTypeOpsGenieRestored
+	message := fmt.Sprintf("OpsGenie reachable again - %s", o.getAPIIdentifier())
+	specificDetails := map[string]string{"Alert Type": alertType}
+	if err != nil {
+		alertType = AlertTypeOpsGenieUnreachable
+		message = fmt.Sprintf("OpsGenie unreachable, circuit breaker alerts are not delivered - %s", o.getAPIIdentifier())
+		specificDetails = map[string]string{"Alert Type": alertType, "Error": err.Error()}
+		log.Printf("🚨 ERROR: OpsGenie is unreachable, circuit breaker alerts will not be delivered until it recovers: %v", err)
+	} else {
+		log.Printf("✅ OpsGenie is reachable again")
+	}
+
+	if notifier == nil {
+		return err
+	}
+	req, reqErr := o.createValidatedAlertRequest(alertType, message, o.buildEnhancedDescription(), specificDetails)
+	if reqErr != nil {
+		log.Printf("Failed to create validated alert request: %v", reqErr)
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), opsGenieRequestTimeout)
+	defer cancel()
+	if notifyErr := notifier.Notify(ctx, newAlert(alertType, req)); notifyErr != nil {
+		log.Printf("Error sending %s alert to the connectivity notifier: %v", alertType, notifyErr)
+	}
+	return err
+}
+
+// startConnectivityMonitor starts the background check of the connection to OpsGenie
+// every connectivity_check_seconds. It runs only when the check is configured at
+// creation; Close stops it. Breakers sharing the client share its check.
+func (b *BreakerDriver) startConnectivityMonitor() {
+	if b.opsGenieClient == nil || b.config.OpsGenie == nil || !b.config.OpsGenie.Enabled ||
+		b.config.OpsGenie.ConnectivityCheckSeconds <= 0 {
+		return
+	}
+
+	b.opsGenieClient.acquireConnectivityCheck(time.Duration(b.config.OpsGenie.ConnectivityCheckSeconds) * time.Second)
+	b.checksConnectivity = true
+}
+
+// stopConnectivityMonitor releases the connectivity check of the breaker's client
+func (b *BreakerDriver) stopConnectivityMonitor() {
+	b.mu.Lock()
+	checks := b.checksConnectivity
+	b.checksConnectivity = false
+	b.mu.Unlock()
+
+	if checks {
+		b.opsGenieClient.releaseConnectivityCheck()
+	}
+}
+
+// acquireConnectivityCheck starts the check of the connection every interval, unless it
+// is already running for another breaker, in which case it keeps its interval. Each call
+// must be paired with releaseConnectivityCheck.
+func (o *OpsGenieClient) acquireConnectivityCheck(interval time.Duration) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	o.connectivityUsers++
+	if o.connectivityUsers > 1 {
+		return
+	}
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	o.stopConnectivity = stop
+	o.connectivityDone = done
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				_ = o.CheckConnectivity() // Logged when it changes
+			}
+		}
+	}()
+}
+
+// releaseConnectivityCheck stops the connectivity check, and waits for it to return,
+// once no breaker uses it
+func (o *OpsGenieClient) releaseConnectivityCheck() {
+	o.mutex.Lock()
+	o.connectivityUsers--
+	if o.connectivityUsers > 0 {
+		o.mutex.Unlock()
+		return
+	}
+	stop, done := o.stopConnectivity, o.connectivityDone
+	o.stopConnectivity, o.connectivityDone = nil, nil
+	o.mutex.Unlock()
+
+	// The check takes the mutex, so it is waited for without holding it
+	close(stop)
+	<-done
+}
@@ -0,0 +1,24 @@
+package breaker
+
+import "context"
+
+// correlationIDKey is the context key of the correlation ID
+type correlationIDKey struct{}
+
+// WithCorrelationID returns a context carrying a correlation (or trace) ID. A latency
+// reported through DoneCtx with that context remembers the ID when it is above the
+// threshold, and the open alert of a trip caused by latency carries the ID of the latest
+// such request, so that the operator can go from the alert to the trace.
+func WithCorrelationID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, correlationIDKey{}, id)
+}
+
+// CorrelationIDFromContext returns the correlation ID set by WithCorrelationID, or an
+// empty string
+func CorrelationIDFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(correlationIDKey{}).(string)
+	return id
+}
@@ -0,0 +1,289 @@
+// Package datadog sends circuit breaker alerts as Datadog events and reports breaker
+// metrics through DogStatsD.
+//
+// It lives in its own package so that the core breaker package does not depend on
+// Datadog, and it talks to Datadog over plain HTTP and UDP, without its client
+// libraries. It is configured by the [datadog] section of the config file:
+//
+//	[datadog]
+//	enabled = true
+//	api_key = "..."                 # Or the DD_API_KEY environment variable
+//	statsd_addr = "localhost:8125"  # Optional; enables the metrics
+//	tags = ["env:prod", "service:payments"]
+//
+// The notifier takes the place of OpsGenie, so alerts are still built, throttled and
+// filtered according to the [opsgenie] section:
+//
+//	notifier, err := datadog.New(config.Datadog)
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	defer notifier.Close()
+//	breaker.GetOpsGenieClient(config.OpsGenie).SetNotifier(notifier)
+//
+//	driver := breaker.NewBreaker(config, "breakers.toml").(*breaker.BreakerDriver)
+//	stop := notifier.Watch(driver)
+//	defer stop()
+package datadog
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lrleon/go-breaker/breaker"
+)
+
+// Metric names reported by Watch
+const (
+	MetricState      = "breaker.state"       // Gauge: 1 while the breaker is open, 0 while it is closed
+	MetricLatencyP95 = "breaker.latency_p95" // Gauge: 95th percentile of the recent latencies, in milliseconds
+	MetricTrips      = "breaker.trips"       // Count: trips since the previous report
+)
+
+// defaultSite is the Datadog site used when the configuration has none
+const defaultSite = "datadoghq.com"
+
+// requestTimeout bounds each call to the Events API
+const requestTimeout = 10 * time.Second
+
+// Notifier is a breaker.Notifier (the DatadogNotifier) that submits every alert as a
+// Datadog event and, with Watch, reports breaker metrics to DogStatsD. It is safe for
+// concurrent use.
+type Notifier struct {
+	apiKey    string
+	eventsURL string
+	tags      []string
+	interval  time.Duration
+	client    *http.Client
+
+	mu     sync.Mutex
+	statsd net.Conn // nil without statsd_addr
+}
+
+var _ breaker.Notifier = (*Notifier)(nil)
+
+// New returns a notifier configured by the [datadog] section. The API key falls back to
+// the DD_API_KEY environment variable. A statsd_addr opens a UDP socket, released by
+// Close.
+func New(config *breaker.DatadogConfig) (*Notifier, error) {
+	if config == nil {
+		return nil, fmt.Errorf("datadog: config is nil")
+	}
+	if err := breaker.ValidateDatadogConfig(config); err != nil {
+		return nil, fmt.Errorf("datadog: %w", err)
+	}
+
+	notifier := &Notifier{
+		apiKey:    config.APIKey,
+		eventsURL: config.EventsURL,
+		tags:      append([]string(nil), config.Tags...),
+		interval:  time.Duration(config.MetricsIntervalSeconds) * time.Second,
+		client:    &http.Client{Timeout: requestTimeout},
+	}
+	if notifier.apiKey == "" {
+		notifier.apiKey = os.Getenv(breaker.EnvDatadogAPIKey)
+	}
+	if notifier.eventsURL == "" {
+		site := config.Site
+		if site == "" {
+			site = defaultSite
+		}
+		notifier.eventsURL = fmt.Sprintf("https://api.%s/api/v1/events", site)
+	}
+	if notifier.interval <= 0 {
+		notifier.interval = breaker.DefaultDatadogMetricsIntervalSeconds * time.Second
+	}
+
+	if config.StatsdAddr != "" {
+		conn, err := net.Dial("udp", config.StatsdAddr)
+		if err != nil {
+			return nil, fmt.Errorf("datadog: connecting to statsd at %s: %w", config.StatsdAddr, err)
+		}
+		notifier.statsd = conn
+	}
+	return notifier, nil
+}
+
+// event is the body of a request to the Events API
+type event struct {
+	Title          string   `json:"title"`
+	Text           string   `json:"text"`
+	AlertType      string   `json:"alert_type"`
+	Priority       string   `json:"priority"`
+	AggregationKey string   `json:"aggregation_key,omitempty"`
+	SourceTypeName string   `json:"source_type_name,omitempty"`
+	DateHappened   int64    `json:"date_happened"`
+	Tags           []string `json:"tags,omitempty"`
+}
+
+// Notify submits the alert as a Datadog event. Resets are success events, alerts of the
+// open breaker errors and the others warnings; P1 and P2 alerts have normal priority and
+// the others low priority.
+func (n *Notifier) Notify(ctx context.Context, alert breaker.Alert) error {
+	body, err := json.Marshal(event{
+		Title:          alert.Message,
+		Text:           alert.Description,
+		AlertType:      alertType(alert.Type),
+		Priority:       eventPriority(alert.Priority),
+		AggregationKey: alert.Alias,
+		SourceTypeName: alert.Source,
+		DateHappened:   alert.Time.Unix(),
+		Tags:           n.eventTags(alert),
+	})
+	if err != nil {
+		return fmt.Errorf("datadog: encoding event: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.eventsURL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("datadog: creating request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("DD-API-KEY", n.apiKey)
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("datadog: submitting event: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("datadog: submitting event: %s: %s", resp.Status, strings.TrimSpace(string(message)))
+	}
+	return nil
+}
+
+// eventTags returns the configured tags followed by the tags of the alert and its type
+// and priority
+func (n *Notifier) eventTags(alert breaker.Alert) []string {
+	tags := append([]string(nil), n.tags...)
+	tags = append(tags, alert.Tags...)
+	if alert.Type != "" {
+		tags = append(tags, "alert_type:"+alert.Type)
+	}
+	if alert.Priority != "" {
+		tags = append(tags, "priority:"+alert.Priority)
+	}
+	return tags
+}
+
+func alertType(breakerAlertType string) string {
+	switch breakerAlertType {
+	case "circuit-reset":
+		return "success"
+	case "circuit-open", "circuit-stuck-open":
+		return "error"
+	default:
+		return "warning"
+	}
+}
+
+func eventPriority(priority string) string {
+	if priority == "P1" || priority == "P2" {
+		return "normal"
+	}
+	return "low"
+}
+
+// Watch reports the metrics of driver to DogStatsD every metrics_interval_seconds until
+// the returned function is called: MetricState, MetricLatencyP95 and MetricTrips, with
+// the configured tags and, for a named breaker, "breaker:<name>". Without statsd_addr it
+// does nothing.
+func (n *Notifier) Watch(driver *breaker.BreakerDriver) (stop func()) {
+	n.mu.Lock()
+	hasStatsd := n.statsd != nil
+	n.mu.Unlock()
+	if !hasStatsd || driver == nil {
+		return func() {}
+	}
+
+	// Trips before the call are not reported
+	reportedTrips := driver.TripCount()
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(n.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				reportedTrips = n.reportMetrics(driver, reportedTrips)
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(done)
+			wg.Wait()
+		})
+	}
+}
+
+// reportMetrics sends the metrics of driver and returns its trip count, from which the
+// next report counts the new trips
+func (n *Notifier) reportMetrics(driver *breaker.BreakerDriver, reportedTrips uint64) uint64 {
+	tags := append([]string(nil), n.tags...)
+	config := driver.Config()
+	if config.Name != "" {
+		tags = append(tags, "breaker:"+config.Name)
+	}
+
+	state := 0
+	if driver.Triggered() {
+		state = 1
+	}
+	trips := driver.TripCount()
+
+	n.send(MetricState, fmt.Sprint(state), "g", tags)
+	n.send(MetricLatencyP95, fmt.Sprint(driver.LatencyPercentile(0.95)), "g", tags)
+	n.send(MetricTrips, fmt.Sprint(trips-reportedTrips), "c", tags)
+	return trips
+}
+
+// send writes a metric in the DogStatsD datagram format. Failures are only logged, as
+// metrics must never get in the way of the breaker.
+func (n *Notifier) send(name, value, metricType string, tags []string) {
+	datagram := fmt.Sprintf("%s:%s|%s", name, value, metricType)
+	if len(tags) > 0 {
+		datagram += "|#" + strings.Join(tags, ",")
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.statsd == nil {
+		return
+	}
+	if _, err := n.statsd.Write([]byte(datagram)); err != nil {
+		log.Printf("datadog: sending %s to statsd: %v", name, err)
+	}
+}
+
+// Close releases the DogStatsD socket. Metrics reported after Close are dropped.
+func (n *Notifier) Close() error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.statsd == nil {
+		return nil
+	}
+	err := n.statsd.Close()
+	n.statsd = nil
+	return err
+}
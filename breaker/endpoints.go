@@ -1,9 +1,12 @@
 package breaker
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"os"
 	"runtime"
 	"strconv"
 	"sync"
@@ -37,6 +40,8 @@ type BreakerAPI struct {
 	Config Config
 	Driver Breaker
 	lock   sync.Mutex
+
+	configSource *ConfigSource // Where Config came from (see GetConfigSource)
 }
 
 func NewBreakerAPI(config *Config) *BreakerAPI {
@@ -47,11 +52,53 @@ func NewBreakerAPI(config *Config) *BreakerAPI {
 }
 
 func NewBreakerAPIFromFile(pathToConfig string) (*BreakerAPI, error) {
-	config, err := LoadConfig(pathToConfig)
+	config, loader, err := loadConfigFile(pathToConfig, newLoadOptions(nil))
 	if err != nil {
 		return nil, fmt.Errorf("failed to load config from file: %w", err)
 	}
-	return NewBreakerAPI(config), nil
+	return &BreakerAPI{
+		Config:       *config,
+		Driver:       NewBreaker(config, pathToConfig),
+		configSource: newConfigSource(pathToConfig, true, false, loader, nil),
+	}, nil
+}
+
+// applyConfig applies a change of the API's config to the running breaker and saves
+// it to the config file, answering the request if it fails. It must be called with the
+// lock held.
+func (b *BreakerAPI) applyConfig(ctx *gin.Context, change func(config *Config)) bool {
+	config := b.Config
+	if config.OpsGenie != nil {
+		// The change must not reach the shared OpsGenie section before it is validated
+		opsGenie := *config.OpsGenie
+		config.OpsGenie = &opsGenie
+	}
+	change(&config)
+
+	if driver, ok := b.Driver.(*BreakerDriver); ok {
+		if err := driver.UpdateConfig(&config); err != nil {
+			log.Printf("Rejected config change: %v", err)
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid configuration", "details": err.Error()})
+			return false
+		}
+		// The driver runs with its own copy of the OpsGenie section, which the API must share
+		config = driver.Config()
+	}
+	b.Config = config
+
+	if err := SaveConfig(b.Driver.GetConfigFile(), &b.Config); err != nil {
+		log.Printf("Failed to save Config: %v", err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save Config"})
+		return false
+	}
+
+	// The file now holds the configuration in use
+	if b.configSource != nil {
+		if info, err := os.Stat(b.Driver.GetConfigFile()); err == nil {
+			b.configSource.ModTime = info.ModTime()
+		}
+	}
+	return true
 }
 
 func (b *BreakerAPI) SetEnabled(ctx *gin.Context) {
@@ -94,12 +141,7 @@ func (b *BreakerAPI) SetMemory(ctx *gin.Context) {
 	b.lock.Lock()
 	defer b.lock.Unlock()
 
-	b.Config.MemoryThreshold = float64(threshold)
-	configFile := b.Driver.GetConfigFile()
-	err := SaveConfig(configFile, &b.Config)
-	if err != nil {
-		log.Printf("Failed to save Config: %v", err)
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save Config"})
+	if !b.applyConfig(ctx, func(config *Config) { config.MemoryThreshold = float64(threshold) }) {
 		return
 	}
 
@@ -134,12 +176,7 @@ func (b *BreakerAPI) SetLatency(ctx *gin.Context) {
 	b.lock.Lock()
 	defer b.lock.Unlock()
 
-	b.Config.LatencyThreshold = int64(threshold)
-	configFile := b.Driver.GetConfigFile()
-	err := SaveConfig(configFile, &b.Config)
-	if err != nil {
-		log.Printf("Failed to save Config: %v", err)
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save Config"})
+	if !b.applyConfig(ctx, func(config *Config) { config.LatencyThreshold = int64(threshold) }) {
 		return
 	}
 
@@ -173,12 +210,7 @@ func (b *BreakerAPI) SetLatencyWindowSize(ctx *gin.Context) {
 	b.lock.Lock()
 	defer b.lock.Unlock()
 
-	b.Config.LatencyWindowSize = size
-	configFile := b.Driver.GetConfigFile()
-	err := SaveConfig(configFile, &b.Config)
-	if err != nil {
-		log.Printf("Failed to save Config: %v", err)
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save Config"})
+	if !b.applyConfig(ctx, func(config *Config) { config.LatencyWindowSize = size }) {
 		return
 	}
 
@@ -219,12 +251,7 @@ func (b *BreakerAPI) SetPercentile(ctx *gin.Context) {
 	b.lock.Lock()
 	defer b.lock.Unlock()
 
-	b.Config.Percentile = percentile / 100.0
-	configFile := b.Driver.GetConfigFile()
-	err := SaveConfig(configFile, &b.Config)
-	if err != nil {
-		log.Printf("Failed to save Config: %v", err)
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save Config"})
+	if !b.applyConfig(ctx, func(config *Config) { config.Percentile = percentile / 100.0 }) {
 		return
 	}
 
@@ -258,12 +285,7 @@ func (b *BreakerAPI) SetWait(ctx *gin.Context) {
 	b.lock.Lock()
 	defer b.lock.Unlock()
 
-	b.Config.WaitTime = wait
-	configFile := b.Driver.GetConfigFile()
-	err := SaveConfig(configFile, &b.Config)
-	if err != nil {
-		log.Printf("Failed to save Config: %v", err)
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save Config"})
+	if !b.applyConfig(ctx, func(config *Config) { config.WaitTime = wait }) {
 		return
 	}
 
@@ -309,32 +331,155 @@ func (b *BreakerAPI) SetTrendAnalysis(ctx *gin.Context) {
 	b.lock.Lock()
 	defer b.lock.Unlock()
 
-	b.Config.TrendAnalysisEnabled = enabled
-	configFile := b.Driver.GetConfigFile()
-	err := SaveConfig(configFile, &b.Config)
-	if err != nil {
-		log.Printf("Failed to save Config: %v", err)
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save Config"})
+	if !b.applyConfig(ctx, func(config *Config) { config.TrendAnalysisEnabled = enabled }) {
 		return
 	}
 
 	ctx.JSON(http.StatusOK, gin.H{"message": "Trend analysis set to " + strconv.FormatBool(enabled)})
 }
 
-func (b *BreakerAPI) LatenciesAboveThreshold(ctx *gin.Context) {
-	thresholdStr := ctx.Param("threshold")
-	threshold, err := strconv.Atoi(thresholdStr)
-	if err != nil {
-		log.Printf("Invalid threshold: %v", thresholdStr)
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid threshold"})
+// TripTriggersRequest represents a request to change what can trip the breaker. Omitted
+// fields keep their value.
+type TripTriggersRequest struct {
+	TripOnMemory  *bool `json:"trip_on_memory,omitempty"`
+	TripOnLatency *bool `json:"trip_on_latency,omitempty"`
+}
+
+// GetTripTriggers reports whether memory pressure and high latencies can trip the breaker
+func (b *BreakerAPI) GetTripTriggers(ctx *gin.Context) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"trip_on_memory":  b.Config.TripsOnMemory(),
+		"trip_on_latency": b.Config.TripsOnLatency(),
+	})
+}
+
+// SetTripTriggers enables or disables memory and latency trips on the running breaker,
+// e.g. to stop memory trips during a false-positive incident without a redeploy. An
+// open breaker stays open until its wait time elapses or it is reset.
+func (b *BreakerAPI) SetTripTriggers(ctx *gin.Context) {
+	var request TripTriggersRequest
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
 	b.lock.Lock()
 	defer b.lock.Unlock()
 
-	latencies := b.Driver.LatenciesAboveThreshold(int64(threshold))
-	ctx.JSON(http.StatusOK, gin.H{"latencies": latencies})
+	changed := b.applyConfig(ctx, func(config *Config) {
+		if request.TripOnMemory != nil {
+			tripOnMemory := *request.TripOnMemory
+			config.TripOnMemory = &tripOnMemory
+		}
+		if request.TripOnLatency != nil {
+			tripOnLatency := *request.TripOnLatency
+			config.TripOnLatency = &tripOnLatency
+		}
+	})
+	if !changed {
+		return
+	}
+
+	if !b.Config.TripsOnMemory() && !b.Config.TripsOnLatency() {
+		log.Printf("Warning: trip_on_memory and trip_on_latency are both false; the breaker will never open")
+	}
+	ctx.JSON(http.StatusOK, gin.H{
+		"trip_on_memory":  b.Config.TripsOnMemory(),
+		"trip_on_latency": b.Config.TripsOnLatency(),
+		"message":         "Trip triggers updated",
+	})
+}
+
+// LatenciesAboveThreshold returns the recent latencies above the threshold query
+// parameter (in milliseconds; the latency threshold by default). For a LabeledBreaker it
+// also returns their records, with the labels, and the label query parameter keeps only
+// the latencies of that label.
+func (b *BreakerAPI) LatenciesAboveThreshold(ctx *gin.Context) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	threshold := b.Config.LatencyThreshold
+	if thresholdStr := ctx.Query("threshold"); thresholdStr != "" {
+		value, err := strconv.ParseInt(thresholdStr, 10, 64)
+		if err != nil || value < 0 {
+			log.Printf("Invalid threshold: %v", thresholdStr)
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid threshold"})
+			return
+		}
+		threshold = value
+	}
+
+	label, filtered := ctx.GetQuery("label")
+	labeled, ok := b.Driver.(LabeledBreaker)
+	if !ok {
+		if filtered {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "The breaker does not record labels"})
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{"threshold": threshold, "latencies": b.Driver.LatenciesAboveThreshold(threshold)})
+		return
+	}
+
+	records := []LatencyRecord{}
+	latencies := []int64{}
+	for _, record := range labeled.LatencyRecordsAboveThreshold(threshold) {
+		if filtered && record.Label != label {
+			continue
+		}
+		records = append(records, record)
+		latencies = append(latencies, record.Milliseconds())
+	}
+	ctx.JSON(http.StatusOK, gin.H{"threshold": threshold, "latencies": latencies, "records": records})
+}
+
+// GetLatenciesSince returns the latencies recorded within the duration given by the
+// since query parameter (e.g. ?since=30s), oldest first, in milliseconds and as records
+// with their timestamps. It ignores the maximum age of the latency window.
+func (b *BreakerAPI) GetLatenciesSince(ctx *gin.Context) {
+	since, err := time.ParseDuration(ctx.Query("since"))
+	if err != nil || since <= 0 {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid since", "message": "since must be a positive duration, such as 30s or 5m"})
+		return
+	}
+
+	driver, ok := b.Driver.(*BreakerDriver)
+	if !ok {
+		ctx.JSON(http.StatusServiceUnavailable, gin.H{"error": "Latency records not available"})
+		return
+	}
+
+	records := driver.LatencyRecordsSince(since)
+	latencies := make([]int64, len(records))
+	for i, record := range records {
+		latencies[i] = record.Milliseconds()
+	}
+	ctx.JSON(http.StatusOK, gin.H{
+		"since_seconds": since.Seconds(),
+		"count":         len(records),
+		"latencies":     latencies,
+		"records":       records,
+	})
+}
+
+// GetLatencySeries returns the recent history of the latency percentile, one sample per
+// second, oldest first
+func (b *BreakerAPI) GetLatencySeries(ctx *gin.Context) {
+	driver, ok := b.Driver.(*BreakerDriver)
+	if !ok {
+		ctx.JSON(http.StatusServiceUnavailable, gin.H{"error": "Latency series not available"})
+		return
+	}
+
+	// The copy of the configuration gives a percentile and threshold of the same version
+	config := driver.Config()
+	ctx.JSON(http.StatusOK, gin.H{
+		"percentile": config.Percentile,
+		"threshold":  config.LatencyThreshold,
+		"series":     driver.LatencySeries(),
+	})
 }
 
 func (b *BreakerAPI) GetMemoryLimit(ctx *gin.Context) {
@@ -342,7 +487,8 @@ func (b *BreakerAPI) GetMemoryLimit(ctx *gin.Context) {
 }
 
 type ResetRequest struct {
-	Confirm bool `json:"confirm" binding:"required"`
+	Confirm      bool  `json:"confirm" binding:"required"`
+	ClearHistory *bool `json:"clear_history,omitempty"` // Defaults to true; false keeps the latency history
 }
 
 func (b *BreakerAPI) Reset(ctx *gin.Context) {
@@ -357,42 +503,120 @@ func (b *BreakerAPI) Reset(ctx *gin.Context) {
 		return
 	}
 
+	if req.ClearHistory != nil && !*req.ClearHistory {
+		b.Driver.ResetState()
+		ctx.JSON(http.StatusOK, gin.H{"message": "Breaker reset", "clear_history": false})
+		return
+	}
+
 	b.Driver.Reset()
-	ctx.JSON(http.StatusOK, gin.H{"message": "Breaker reset"})
+	ctx.JSON(http.StatusOK, gin.H{"message": "Breaker reset", "clear_history": true})
+}
+
+// GlobalDisableRequest turns circuit breaking off or on for every breaker in the process
+type GlobalDisableRequest struct {
+	Disabled *bool `json:"disabled" binding:"required"`
+}
+
+// GetGlobalDisable reports whether circuit breaking is globally disabled
+func (b *BreakerAPI) GetGlobalDisable(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, gin.H{"globally_disabled": IsGloballyDisabled()})
+}
+
+// SetGlobalDisable is the emergency switch that makes Allow return true in every breaker
+func (b *BreakerAPI) SetGlobalDisable(ctx *gin.Context) {
+	var req GlobalDisableRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format", "details": err.Error()})
+		return
+	}
+
+	SetGloballyDisabled(*req.Disabled)
+
+	message := "Circuit breaking enabled for all breakers"
+	if *req.Disabled {
+		message = "Circuit breaking disabled for all breakers"
+	}
+	ctx.JSON(http.StatusOK, gin.H{"message": message, "globally_disabled": *req.Disabled})
 }
 
 // BreakerStatus represents the complete status of the circuit breaker
 type BreakerStatus struct {
 	// Overall breaker state
-	Enabled      bool      `json:"enabled"`
-	Triggered    bool      `json:"triggered"`
-	LastTripTime time.Time `json:"last_trip_time,omitempty"`
+	Enabled          bool      `json:"enabled"`
+	GloballyDisabled bool      `json:"globally_disabled"` // Allow returns true regardless of the state (see SetGloballyDisabled)
+	Triggered        bool      `json:"triggered"`
+	LastTripTime     time.Time `json:"last_trip_time,omitempty"`
+	TripReason       string    `json:"trip_reason,omitempty"`       // Why the breaker is open (see the TripReason constants)
+	RemoteTrip       bool      `json:"remote_trip,omitempty"`       // Open because another replica tripped (see honor_shared_trips)
+	RetryAfterUntil  time.Time `json:"retry_after_until,omitempty"` // Set while a downstream Retry-After keeps the breaker open
+
+	// Counters since the breaker was created
+	TripsTotal    uint64 `json:"trips_total"`    // Times the breaker went from closed to open (see TripCount)
+	RejectedTotal uint64 `json:"rejected_total"` // Requests denied by Allow (see RejectedCount)
+
+	// Trip frequency, for flapping detection
+	RecentTripCount            int `json:"recent_trip_count"`             // Trips within trip_frequency_window_seconds
+	TripFrequencyWindowSeconds int `json:"trip_frequency_window_seconds"` // Window of recent_trip_count
 
 	// Memory metrics
+	MemoryCheckEnabled bool    `json:"memory_check_enabled"` // False when no memory limit is known; MemoryOK is then true, or follows memory_check_failure_policy if the limit could not be read
 	MemoryOK           bool    `json:"memory_ok"`
 	CurrentMemoryUsage int64   `json:"current_memory_usage_mb"`
+	CurrentMemoryBytes int64   `json:"current_memory_usage_bytes"`
 	MemoryThreshold    float64 `json:"memory_threshold_percent"`
 	TotalMemoryMB      int64   `json:"total_memory_mb"`
-	MemoryUsagePercent float64 `json:"memory_usage_percent"`
+	TotalMemoryBytes   int64   `json:"total_memory_bytes"`
+	MemoryUsagePercent float64 `json:"memory_usage_percent"`      // From the bytes, so that it is accurate for small usages
+	MemoryOverride     *bool   `json:"memory_override,omitempty"` // Forced memory check result, if any (see SetMemoryOverride)
+
+	// Memory values in the units asked with ?units=bytes or ?units=human (the *_mb fields
+	// are always reported)
+	MemoryUnits         string      `json:"memory_units,omitempty"`
+	CurrentMemory       interface{} `json:"current_memory,omitempty"`
+	TotalMemory         interface{} `json:"total_memory,omitempty"`
+	MemoryThresholdSize interface{} `json:"memory_threshold,omitempty"`
 
 	// Latency metrics
 	LatencyOK             bool    `json:"latency_ok"`
+	DataSufficient        bool    `json:"data_sufficient"`    // Whether latency_ok is based on warmup_min_samples latencies; false means no data, not healthy
+	WarmupMinSamples      int     `json:"warmup_min_samples"` // Recent latencies needed for the data to be sufficient
 	CurrentPercentile     int64   `json:"current_percentile_ms"`
+	CurrentPercentileNs   int64   `json:"current_percentile_ns"`
 	LatencyThreshold      int64   `json:"latency_threshold_ms"`
 	LatencyPercentOfLimit float64 `json:"latency_percent_of_threshold"`
 	PercentileValue       float64 `json:"percentile_value"`
 
 	// Configuration
-	LatencyWindowSize int `json:"latency_window_size"`
-	WaitTime          int `json:"wait_time_seconds"`
+	LatencyWindowSize int  `json:"latency_window_size"`
+	WaitTime          int  `json:"wait_time_seconds"`
+	TripOnMemory      bool `json:"trip_on_memory"`
+	TripOnLatency     bool `json:"trip_on_latency"`
+
+	// Blend of memory pressure and latency, from 0 to 100 (see HealthScore)
+	HealthScore          float64 `json:"health_score"`
+	HealthScoreThreshold float64 `json:"health_score_threshold,omitempty"` // The score trips the breaker when set
 
 	// Recent latencies
-	RecentLatencies []int64 `json:"recent_latencies_ms"`
+	RecentLatencies   []int64    `json:"recent_latencies_ms"`
+	OldestSampleTime  *time.Time `json:"oldest_sample_time,omitempty"` // Oldest latency used for the percentile, nil without any
+	NewestSampleTime  *time.Time `json:"newest_sample_time,omitempty"` // Newest latency used for the percentile, nil without any
+	WindowSpanSeconds float64    `json:"window_span_seconds"`          // Time between them; short spans mean a burst
+	WindowMaxAge      int        `json:"window_max_age_seconds"`       // Latencies older than this are not used
+	ApproxMemoryBytes int64      `json:"approx_memory_bytes"`          // Memory held by the latency history (see ApproxMemoryBytes)
 
 	// Trend analysis
 	TrendAnalysisEnabled        bool `json:"trend_analysis_enabled"`
 	TrendAnalysisMinSampleCount int  `json:"trend_analysis_min_sample_count"`
 	HasPositiveTrend            bool `json:"has_positive_trend"`
+
+	// Downstream dependencies (reported through DoneDependency)
+	DependencyLatencies      map[string]int64 `json:"dependency_latencies_ms,omitempty"`
+	SlowestDependency        string           `json:"slowest_dependency,omitempty"`
+	SlowestDependencyLatency int64            `json:"slowest_dependency_latency_ms,omitempty"`
+
+	// Labeled operations (reported through DoneLabeled), slowest first
+	SlowestByLabel []LabelLatencySummary `json:"slowest_by_label,omitempty"`
 }
 
 // StagedAlertInfo Represents information about the stepped alert system
@@ -407,6 +631,12 @@ type StagedAlertInfo struct {
 
 // GetBreakerStatus returns detailed information about the current state of the circuit breaker
 func (b *BreakerAPI) GetBreakerStatus(ctx *gin.Context) {
+	units := ctx.DefaultQuery("units", MemoryUnitsMB)
+	if !IsValidMemoryUnits(units) {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid units. Must be bytes, mb or human"})
+		return
+	}
+
 	b.lock.Lock()
 	defer b.lock.Unlock()
 
@@ -417,7 +647,7 @@ func (b *BreakerAPI) GetBreakerStatus(ctx *gin.Context) {
 		// If the driver is not a BreakerDriver, return a minimal status
 		ctx.JSON(http.StatusOK, gin.H{
 			"enabled":    b.Driver.IsEnabled(),
-			"triggered":  b.Driver.TriggeredByLatencies(),
+			"triggered":  b.Driver.Triggered(),
 			"memory_ok":  b.Driver.MemoryOK(),
 			"latency_ok": b.Driver.LatencyOK(),
 		})
@@ -428,24 +658,45 @@ func (b *BreakerAPI) GetBreakerStatus(ctx *gin.Context) {
 	driver.mu.Lock()
 	defer driver.mu.Unlock()
 
-	// Get current memory usage
-	currentMemoryUsageMB := MemoryUsage()
+	ctx.JSON(http.StatusOK, driver.breakerStatus(units))
+}
+
+// optionalTime returns a pointer to t, or nil when t is zero, so that omitempty leaves
+// it out of the JSON
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+// breakerStatus returns the status reported by /breaker/status, with the memory values
+// in units. It must run in a critical section.
+func (b *BreakerDriver) breakerStatus(units string) BreakerStatus {
+	// Get current memory usage; every memory value is derived from this one reading
+	currentMemoryBytes := MemoryUsageBytes()
+	totalBytes := totalMemoryBytes()
+	memoryUsagePercent := 0.0
+	if MemoryCheckEnabled() {
+		memoryUsagePercent = MemoryPercent(currentMemoryBytes, MemoryLimit)
+	}
 
 	// Get current latency percentile
-	latencyPercentile := driver.latencyWindow.Percentile(driver.config.Percentile)
+	percentileNs := b.latencyWindow.PercentileNs(b.config.Percentile)
+	latencyPercentile := nanosToMillis(percentileNs)
 
 	// Get recent latencies
-	recentLatencies := driver.latencyWindow.GetRecentLatencies()
+	recentLatencies := b.latencyWindow.GetRecentLatencies()
 
 	// Check if there's a positive trend in latencies
 	hasPositiveTrend := false
-	if len(recentLatencies) >= driver.config.TrendAnalysisMinSampleCount {
-		hasPositiveTrend = driver.latencyWindow.HasPositiveTrend(driver.config.TrendAnalysisMinSampleCount)
+	if len(recentLatencies) >= b.config.TrendAnalysisMinSampleCount {
+		hasPositiveTrend = b.latencyWindow.HasPositiveTrend(b.config.TrendAnalysisMinSampleCount)
 	}
 
 	// Get staged alert information
 	stagedAlertInfo := StagedAlertInfo{
-		Enabled:            driver.stagedAlertManager != nil,
+		Enabled:            b.stagedAlertManager != nil,
 		TimeBeforeAlert:    0,
 		InitialPriority:    "",
 		EscalatedPriority:  "",
@@ -453,46 +704,86 @@ func (b *BreakerAPI) GetBreakerStatus(ctx *gin.Context) {
 		PendingAlerts:      make(map[string]map[string]interface{}),
 	}
 
-	if driver.stagedAlertManager != nil && driver.config.OpsGenie != nil {
-		stagedAlertInfo.TimeBeforeAlert = driver.config.OpsGenie.TimeBeforeSendAlert
-		stagedAlertInfo.InitialPriority = driver.config.OpsGenie.InitialAlertPriority
-		stagedAlertInfo.EscalatedPriority = driver.config.OpsGenie.EscalatedAlertPriority
-		stagedAlertInfo.PendingAlertsCount = driver.stagedAlertManager.GetPendingAlertsCount()
+	if b.stagedAlertManager != nil && b.config.OpsGenie != nil {
+		stagedAlertInfo.TimeBeforeAlert = b.config.OpsGenie.TimeBeforeSendAlert
+		stagedAlertInfo.InitialPriority = b.config.OpsGenie.InitialAlertPriority
+		stagedAlertInfo.EscalatedPriority = b.config.OpsGenie.EscalatedAlertPriority
+		stagedAlertInfo.PendingAlertsCount = b.stagedAlertManager.GetPendingAlertsCount()
 
 		// Just include outstanding alert details if any
 		if stagedAlertInfo.PendingAlertsCount > 0 {
-			stagedAlertInfo.PendingAlerts = driver.stagedAlertManager.GetPendingAlertsInfo()
+			stagedAlertInfo.PendingAlerts = b.stagedAlertManager.GetPendingAlertsInfo()
 		}
 	}
 
 	// Prepare the status object
 	status := BreakerStatus{
-		Enabled:                     driver.enabled,
-		Triggered:                   driver.triggered,
-		MemoryOK:                    driver.MemoryOK(),
-		CurrentMemoryUsage:          currentMemoryUsageMB,
-		MemoryThreshold:             driver.config.MemoryThreshold,
-		TotalMemoryMB:               TotalMemoryMB(),
-		MemoryUsagePercent:          float64(currentMemoryUsageMB) / float64(TotalMemoryMB()) * 100,
-		LatencyOK:                   driver.LatencyOK(),
+		Enabled:                     b.enabled.Load(),
+		GloballyDisabled:            IsGloballyDisabled(),
+		Triggered:                   b.triggered,
+		TripsTotal:                  b.tripCount.Load(),
+		RejectedTotal:               b.rejectedCount.Load(),
+		RecentTripCount:             b.tripsWithin(b.config.tripFrequencyWindow(), b.now()),
+		TripFrequencyWindowSeconds:  int(b.config.tripFrequencyWindow().Seconds()),
+		MemoryCheckEnabled:          MemoryCheckEnabled(),
+		MemoryOK:                    b.MemoryOK(),
+		CurrentMemoryUsage:          currentMemoryBytes / (1024 * 1024),
+		CurrentMemoryBytes:          currentMemoryBytes,
+		MemoryThreshold:             b.config.MemoryThreshold,
+		TotalMemoryMB:               totalBytes / (1024 * 1024),
+		TotalMemoryBytes:            totalBytes,
+		MemoryUsagePercent:          memoryUsagePercent,
+		MemoryOverride:              b.MemoryOverride(),
+		LatencyOK:                   b.latencyOK(),
+		HealthScore:                 b.healthScore(percentileNs, b.MemoryOK()),
+		HealthScoreThreshold:        b.config.HealthScoreThreshold,
+		DataSufficient:              b.hasSufficientData(),
+		WarmupMinSamples:            b.config.warmupMinSamples(),
 		CurrentPercentile:           latencyPercentile,
-		LatencyThreshold:            driver.config.LatencyThreshold,
-		LatencyPercentOfLimit:       float64(latencyPercentile) / float64(driver.config.LatencyThreshold) * 100,
-		PercentileValue:             driver.config.Percentile,
-		LatencyWindowSize:           driver.config.LatencyWindowSize,
-		WaitTime:                    driver.config.WaitTime,
+		CurrentPercentileNs:         percentileNs,
+		LatencyThreshold:            b.config.LatencyThreshold,
+		LatencyPercentOfLimit:       float64(percentileNs) / float64(millisToNanos(b.config.LatencyThreshold)) * 100,
+		PercentileValue:             b.config.Percentile,
+		LatencyWindowSize:           b.config.LatencyWindowSize,
+		WaitTime:                    b.config.WaitTime,
+		TripOnMemory:                b.config.TripsOnMemory(),
+		TripOnLatency:               b.config.TripsOnLatency(),
 		RecentLatencies:             recentLatencies,
-		TrendAnalysisEnabled:        driver.config.TrendAnalysisEnabled,
-		TrendAnalysisMinSampleCount: driver.config.TrendAnalysisMinSampleCount,
+		OldestSampleTime:            optionalTime(b.latencyWindow.OldestSampleTime()),
+		NewestSampleTime:            optionalTime(b.latencyWindow.NewestSampleTime()),
+		WindowSpanSeconds:           b.latencyWindow.WindowSpan().Seconds(),
+		WindowMaxAge:                b.latencyWindow.MaxAgeSeconds,
+		ApproxMemoryBytes:           b.approxMemoryBytes(),
+		TrendAnalysisEnabled:        b.config.TrendAnalysisEnabled,
+		TrendAnalysisMinSampleCount: b.config.TrendAnalysisMinSampleCount,
 		HasPositiveTrend:            hasPositiveTrend,
 	}
 
 	// Only include last trip time if the breaker is triggered
-	if driver.triggered {
-		status.LastTripTime = driver.lastTripTime
+	if b.triggered {
+		status.LastTripTime = b.lastTripTime
+		status.TripReason = b.tripReason
+		status.RemoteTrip = b.remoteTrip
+		if b.now().Before(b.retryAfterUntil) {
+			status.RetryAfterUntil = b.retryAfterUntil
+		}
 	}
 
-	ctx.JSON(http.StatusOK, status)
+	if units != MemoryUnitsMB {
+		status.MemoryUnits = units
+		status.CurrentMemory = FormatMemory(currentMemoryBytes, units)
+		status.TotalMemory = FormatMemory(totalBytes, units)
+		status.MemoryThresholdSize = FormatMemory(int64(float64(totalBytes)*b.config.MemoryThreshold/100), units)
+	}
+
+	// Report which downstream dependency is the slowest, if any are tracked
+	if dependencyLatencies := b.dependencyPercentiles(); len(dependencyLatencies) > 0 {
+		status.DependencyLatencies = dependencyLatencies
+		status.SlowestDependency, status.SlowestDependencyLatency = slowestDependency(dependencyLatencies)
+	}
+	status.SlowestByLabel = b.latencyWindow.SlowestByLabel(b.config.LatencyThreshold)
+
+	return status
 }
 
 // OpsGenieStatusResponse represents the current configuration and status of OpsGenie integration
@@ -545,6 +836,26 @@ type OpsGenieCooldownRequest struct {
 	CooldownSeconds int `json:"cooldown_seconds" binding:"required"`
 }
 
+// OpsGenieAckRequest represents a request to acknowledge an active OpsGenie alert
+type OpsGenieAckRequest struct {
+	AlertType string `json:"alert_type" binding:"required"`
+	Note      string `json:"note"`
+}
+
+// ResolvePendingRequest selects the pending staged alert to resolve; an empty body or
+// alert ID resolves all of them
+type ResolvePendingRequest struct {
+	AlertID string `json:"alert_id"`
+}
+
+// validAlertTypes are the alert types the breaker sends to OpsGenie
+var validAlertTypes = map[string]bool{
+	"circuit-open":      true,
+	"circuit-reset":     true,
+	"memory-threshold":  true,
+	"latency-threshold": true,
+}
+
 // GetOpsGenieStatus returns the current configuration and status of OpsGenie integration
 func (b *BreakerAPI) GetOpsGenieStatus(ctx *gin.Context) {
 	b.lock.Lock()
@@ -569,9 +880,14 @@ func (b *BreakerAPI) GetOpsGenieStatus(ctx *gin.Context) {
 		IncludeMemoryMetrics:  b.Config.OpsGenie.IncludeMemoryMetrics,
 		IncludeSystemInfo:     b.Config.OpsGenie.IncludeSystemInfo,
 		AlertCooldownSeconds:  b.Config.OpsGenie.AlertCooldownSeconds,
+		UseEnvironments:       b.Config.OpsGenie.UseEnvironments,
 		Initialized:           opsgenieClient.IsInitialized(),
 	}
 
+	if b.Config.OpsGenie.UseEnvironments {
+		response.CurrentEnvironment = opsgenieClient.getEnvironmentWithFallback()
+	}
+
 	// Only include API key hint if it's set (don't show the actual key for security)
 	if b.Config.OpsGenie.APIKey != "" {
 		response.APIKey = "********" // Mask the actual key
@@ -591,21 +907,14 @@ func (b *BreakerAPI) ToggleOpsGenie(ctx *gin.Context) {
 		return
 	}
 
-	// Update the configuration
-	b.Config.OpsGenie.Enabled = request.Enabled
-
-	// Save the changes
-	configFile := b.Driver.GetConfigFile()
-	err := SaveConfig(configFile, &b.Config)
-	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to save config: %v", err)})
+	if !b.applyConfig(ctx, func(config *Config) { config.OpsGenie.Enabled = request.Enabled }) {
 		return
 	}
 
 	// Reinitialize the client if enabling
 	if request.Enabled {
 		opsgenieClient := GetOpsGenieClient(b.Config.OpsGenie)
-		err = opsgenieClient.Initialize()
+		err := opsgenieClient.Initialize()
 		if err != nil {
 			ctx.JSON(http.StatusInternalServerError, gin.H{
 				"error": fmt.Sprintf("OpsGenie enabled but initialization failed: %v", err),
@@ -637,14 +946,7 @@ func (b *BreakerAPI) UpdateOpsGeniePriority(ctx *gin.Context) {
 		return
 	}
 
-	// Update the configuration
-	b.Config.OpsGenie.Priority = request.Priority
-
-	// Save the changes
-	configFile := b.Driver.GetConfigFile()
-	err := SaveConfig(configFile, &b.Config)
-	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to save config: %v", err)})
+	if !b.applyConfig(ctx, func(config *Config) { config.OpsGenie.Priority = request.Priority }) {
 		return
 	}
 
@@ -666,24 +968,21 @@ func (b *BreakerAPI) UpdateOpsGenieTriggers(ctx *gin.Context) {
 	}
 
 	// Update only the fields that were provided
-	if request.TriggerOnOpen != nil {
-		b.Config.OpsGenie.TriggerOnOpen = *request.TriggerOnOpen
-	}
-	if request.TriggerOnReset != nil {
-		b.Config.OpsGenie.TriggerOnReset = *request.TriggerOnReset
-	}
-	if request.TriggerOnMemory != nil {
-		b.Config.OpsGenie.TriggerOnMemory = *request.TriggerOnMemory
-	}
-	if request.TriggerOnLatency != nil {
-		b.Config.OpsGenie.TriggerOnLatency = *request.TriggerOnLatency
-	}
-
-	// Save the changes
-	configFile := b.Driver.GetConfigFile()
-	err := SaveConfig(configFile, &b.Config)
-	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to save config: %v", err)})
+	changed := b.applyConfig(ctx, func(config *Config) {
+		if request.TriggerOnOpen != nil {
+			config.OpsGenie.TriggerOnOpen = *request.TriggerOnOpen
+		}
+		if request.TriggerOnReset != nil {
+			config.OpsGenie.TriggerOnReset = *request.TriggerOnReset
+		}
+		if request.TriggerOnMemory != nil {
+			config.OpsGenie.TriggerOnMemory = *request.TriggerOnMemory
+		}
+		if request.TriggerOnLatency != nil {
+			config.OpsGenie.TriggerOnLatency = *request.TriggerOnLatency
+		}
+	})
+	if !changed {
 		return
 	}
 
@@ -709,14 +1008,7 @@ func (b *BreakerAPI) UpdateOpsGenieTags(ctx *gin.Context) {
 		return
 	}
 
-	// Update the configuration
-	b.Config.OpsGenie.Tags = request.Tags
-
-	// Save the changes
-	configFile := b.Driver.GetConfigFile()
-	err := SaveConfig(configFile, &b.Config)
-	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to save config: %v", err)})
+	if !b.applyConfig(ctx, func(config *Config) { config.OpsGenie.Tags = request.Tags }) {
 		return
 	}
 
@@ -743,14 +1035,7 @@ func (b *BreakerAPI) UpdateOpsGenieCooldown(ctx *gin.Context) {
 		return
 	}
 
-	// Update the configuration
-	b.Config.OpsGenie.AlertCooldownSeconds = request.CooldownSeconds
-
-	// Save the changes
-	configFile := b.Driver.GetConfigFile()
-	err := SaveConfig(configFile, &b.Config)
-	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to save config: %v", err)})
+	if !b.applyConfig(ctx, func(config *Config) { config.OpsGenie.AlertCooldownSeconds = request.CooldownSeconds }) {
 		return
 	}
 
@@ -760,6 +1045,143 @@ func (b *BreakerAPI) UpdateOpsGenieCooldown(ctx *gin.Context) {
 	})
 }
 
+// AckOpsGenieAlert acknowledges the active OpsGenie alert of the given type
+func (b *BreakerAPI) AckOpsGenieAlert(ctx *gin.Context) {
+	var request OpsGenieAckRequest
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !validAlertTypes[request.AlertType] {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid alert type. Must be circuit-open, circuit-reset, memory-threshold or latency-threshold",
+		})
+		return
+	}
+
+	// As in TestOpsGenieConnection, the lock only guards the configuration, so that the
+	// request to OpsGenie does not block the other endpoints
+	b.lock.Lock()
+	opsGenieConfig := b.Config.OpsGenie
+	b.lock.Unlock()
+
+	if opsGenieConfig == nil || !opsGenieConfig.Enabled {
+		ctx.JSON(http.StatusServiceUnavailable, gin.H{"error": "OpsGenie is not enabled"})
+		return
+	}
+
+	note := request.Note
+	if note == "" {
+		note = "Acknowledged via breaker API"
+	}
+
+	opsgenieClient := GetOpsGenieClient(opsGenieConfig)
+	alias := opsgenieClient.aliasForAlertType(request.AlertType)
+	if err := opsgenieClient.AckAlert(alias, note); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to acknowledge alert: %v", err)})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"alert_type": request.AlertType,
+		"alias":      alias,
+		"message":    fmt.Sprintf("OpsGenie alert %s acknowledged", alias),
+	})
+}
+
+// ResolvePendingAlerts resolves the pending staged alerts, or the one given by alert_id,
+// so that the escalation of an incident already handled out-of-band does not fire
+func (b *BreakerAPI) ResolvePendingAlerts(ctx *gin.Context) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	var request ResolvePendingRequest
+	if err := ctx.ShouldBindJSON(&request); err != nil && !errors.Is(err, io.EOF) {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	driver, ok := b.Driver.(*BreakerDriver)
+	if !ok || driver.stagedAlertManager == nil {
+		ctx.JSON(http.StatusServiceUnavailable, gin.H{"error": "Staged alerting is not configured"})
+		return
+	}
+
+	resolved := driver.stagedAlertManager.ResolvePendingAlerts(request.AlertID)
+	if request.AlertID != "" && resolved == 0 {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("No pending alert %s", request.AlertID)})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"resolved": resolved,
+		"message":  fmt.Sprintf("%d pending alerts resolved", resolved),
+	})
+}
+
+// TestOpsGenieConnection checks that the OpsGenie API can be reached with the current configuration
+func (b *BreakerAPI) TestOpsGenieConnection(ctx *gin.Context) {
+	// The lock only guards the configuration; the request to OpsGenie can take as long
+	// as its timeout and must not block the other endpoints
+	b.lock.Lock()
+	opsGenieConfig := b.Config.OpsGenie
+	b.lock.Unlock()
+
+	if opsGenieConfig == nil || !opsGenieConfig.Enabled {
+		ctx.JSON(http.StatusServiceUnavailable, gin.H{"error": "OpsGenie is not enabled"})
+		return
+	}
+
+	opsgenieClient := GetOpsGenieClient(opsGenieConfig)
+	if !opsgenieClient.IsInitialized() {
+		if err := opsgenieClient.Initialize(); err != nil {
+			ctx.JSON(http.StatusServiceUnavailable, gin.H{"error": fmt.Sprintf("Failed to initialize OpsGenie client: %v", err)})
+			return
+		}
+	}
+
+	if err := opsgenieClient.TestConnection(); err != nil {
+		ctx.JSON(http.StatusBadGateway, gin.H{"error": fmt.Sprintf("Failed to connect to OpsGenie: %v", err)})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "Successfully connected to OpsGenie API"})
+}
+
+// ReinitializeOpsGenie initializes the OpsGenie client again, so that an integration that
+// could not connect at startup can be recovered without restarting the process
+func (b *BreakerAPI) ReinitializeOpsGenie(ctx *gin.Context) {
+	// As in TestOpsGenieConnection, Initialize tests the connection and must not block the
+	// other endpoints, so it runs without the lock
+	b.lock.Lock()
+	opsGenieConfig := b.Config.OpsGenie
+	b.lock.Unlock()
+
+	if opsGenieConfig == nil || !opsGenieConfig.Enabled {
+		ctx.JSON(http.StatusServiceUnavailable, gin.H{"error": "OpsGenie is not enabled"})
+		return
+	}
+
+	opsgenieClient := GetOpsGenieClient(opsGenieConfig)
+	err := opsgenieClient.Initialize()
+	if err == nil && !opsgenieClient.IsInitialized() {
+		err = fmt.Errorf("the OpsGenie client is disabled")
+	}
+	if err != nil {
+		ctx.JSON(http.StatusServiceUnavailable, gin.H{
+			"initialized": opsgenieClient.IsInitialized(),
+			"error":       fmt.Sprintf("Failed to initialize OpsGenie client: %v", err),
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"initialized": opsgenieClient.IsInitialized(),
+		"message":     "OpsGenie client initialized",
+	})
+}
+
 // Helper function to determine if a priority is valid
 func isValidPriority(priority string) bool {
 	validPriorities := map[string]bool{
@@ -780,61 +1202,127 @@ func statusText(enabled bool) string {
 	return "disabled"
 }
 
-// AddEndpointToRouter adds all the breaker endpoints to the provided router
-func AddEndpointToRouter(router *gin.Engine, breakerAPI *BreakerAPI) {
-	// Create a router group for the breaker
-	breakerGroup := router.Group("/breaker")
-	{
-		breakerGroup.GET("/status", breakerAPI.GetBreakerStatus)
-		breakerGroup.GET("/enabled", breakerAPI.GetEnabled)
-		breakerGroup.POST("/enabled", breakerAPI.SetEnabled)
-		breakerGroup.POST("/disabled", breakerAPI.SetDisabled)
-		breakerGroup.GET("/memory", breakerAPI.GetMemory)
-		breakerGroup.POST("/memory", breakerAPI.SetMemory)
-		breakerGroup.GET("/latency", breakerAPI.GetLatency)
-		breakerGroup.POST("/latency", breakerAPI.SetLatency)
-		breakerGroup.GET("/latency-window-size", breakerAPI.GetLatencyWindowSize)
-		breakerGroup.POST("/latency-window-size", breakerAPI.SetLatencyWindowSize)
-		breakerGroup.GET("/percentile", breakerAPI.GetPercentile)
-		breakerGroup.POST("/percentile", breakerAPI.SetPercentile)
-		breakerGroup.GET("/wait", breakerAPI.GetWait)
-		breakerGroup.POST("/wait", breakerAPI.SetWait)
-		breakerGroup.GET("/memory-usage", breakerAPI.GetMemoryUsage)
-		breakerGroup.GET("/trend-analysis", breakerAPI.GetTrendAnalysis)
-		breakerGroup.POST("/trend-analysis", breakerAPI.SetTrendAnalysis)
-		breakerGroup.GET("/latencies-above-threshold", breakerAPI.LatenciesAboveThreshold)
-		breakerGroup.GET("/memory-limit", breakerAPI.GetMemoryLimit)
-		breakerGroup.POST("/reset", breakerAPI.Reset)
-
-		breakerGroup.GET("/trigger-by-memory", breakerAPI.TriggerBreakerByMemory)
-		breakerGroup.GET("/trigger-by-latency", breakerAPI.TriggerBreakerByLatency)
-		breakerGroup.GET("/restore-memory-check", breakerAPI.RestoreMemoryCheck)
-
-		breakerGroup.GET("/staged-alerts", breakerAPI.GetStagedAlertStatus)
-
-		// New OpsGenie endpoints
-		opsgenieGroup := breakerGroup.Group("/opsgenie")
-		{
-			opsgenieGroup.GET("/status", breakerAPI.GetOpsGenieStatus)
-			opsgenieGroup.POST("/toggle", breakerAPI.ToggleOpsGenie)
-			opsgenieGroup.POST("/priority", breakerAPI.UpdateOpsGeniePriority)
-			opsgenieGroup.POST("/triggers", breakerAPI.UpdateOpsGenieTriggers)
-			opsgenieGroup.POST("/tags", breakerAPI.UpdateOpsGenieTags)
-			opsgenieGroup.POST("/cooldown", breakerAPI.UpdateOpsGenieCooldown)
-		}
+// EndpointOption customizes AddEndpointToRouter
+type EndpointOption func(options *endpointOptions)
+
+type endpointOptions struct {
+	readOnly bool
+}
+
+// ReadOnly makes AddEndpointToRouter register only the endpoints that cannot change the
+// breaker or send alerts (see AddReadOnlyEndpoints)
+func ReadOnly() EndpointOption {
+	return func(options *endpointOptions) {
+		options.readOnly = true
 	}
 }
 
+// AddEndpointToRouter adds all the breaker endpoints to the provided router, or only the
+// read-only ones with the ReadOnly option
+func AddEndpointToRouter(router *gin.Engine, breakerAPI *BreakerAPI, options ...EndpointOption) {
+	var opts endpointOptions
+	for _, option := range options {
+		option(&opts)
+	}
+
+	if opts.readOnly {
+		AddReadOnlyEndpoints(router, breakerAPI)
+		return
+	}
+	AddAdminEndpoints(router, breakerAPI)
+}
+
+// AddReadOnlyEndpoints adds the GET endpoints that only report the state and the
+// configuration of the breaker, for a mount that dashboards and a broad monitoring
+// audience can use safely. The setters, the reset, the manual triggers and the OpsGenie
+// test and acknowledgement are left out.
+func AddReadOnlyEndpoints(router gin.IRouter, breakerAPI *BreakerAPI) {
+	breakerGroup := router.Group("/breaker")
+	addReadOnlyEndpoints(breakerGroup, breakerGroup.Group("/opsgenie"), breakerAPI)
+}
+
+// AddAdminEndpoints adds every breaker endpoint, including those that change the breaker.
+// The router can be a group behind authentication, e.g.
+// AddAdminEndpoints(router.Group("/", auth), breakerAPI).
+func AddAdminEndpoints(router gin.IRouter, breakerAPI *BreakerAPI) {
+	breakerGroup := router.Group("/breaker")
+	opsgenieGroup := breakerGroup.Group("/opsgenie")
+	addReadOnlyEndpoints(breakerGroup, opsgenieGroup, breakerAPI)
+
+	breakerGroup.POST("/enabled", breakerAPI.SetEnabled)
+	breakerGroup.POST("/disabled", breakerAPI.SetDisabled)
+	breakerGroup.POST("/memory", breakerAPI.SetMemory)
+	breakerGroup.POST("/latency", breakerAPI.SetLatency)
+	breakerGroup.POST("/latency-window-size", breakerAPI.SetLatencyWindowSize)
+	breakerGroup.POST("/percentile", breakerAPI.SetPercentile)
+	breakerGroup.POST("/wait", breakerAPI.SetWait)
+	breakerGroup.POST("/trend-analysis", breakerAPI.SetTrendAnalysis)
+	breakerGroup.POST("/triggers", breakerAPI.SetTripTriggers)
+	breakerGroup.POST("/reset", breakerAPI.Reset)
+	breakerGroup.POST("/global-disable", breakerAPI.SetGlobalDisable)
+
+	// GET for historical reasons, but they change the state of the breaker
+	breakerGroup.GET("/trigger-by-memory", breakerAPI.TriggerBreakerByMemory)
+	breakerGroup.GET("/trigger-by-latency", breakerAPI.TriggerBreakerByLatency)
+	breakerGroup.GET("/restore-memory-check", breakerAPI.RestoreMemoryCheck)
+
+	opsgenieGroup.POST("/toggle", breakerAPI.ToggleOpsGenie)
+	opsgenieGroup.POST("/priority", breakerAPI.UpdateOpsGeniePriority)
+	opsgenieGroup.POST("/triggers", breakerAPI.UpdateOpsGenieTriggers)
+	opsgenieGroup.POST("/tags", breakerAPI.UpdateOpsGenieTags)
+	opsgenieGroup.POST("/cooldown", breakerAPI.UpdateOpsGenieCooldown)
+	opsgenieGroup.POST("/ack", breakerAPI.AckOpsGenieAlert)
+	opsgenieGroup.POST("/resolve-pending", breakerAPI.ResolvePendingAlerts)
+	opsgenieGroup.GET("/test", breakerAPI.TestOpsGenieConnection) // Initializes the client and calls OpsGenie
+	opsgenieGroup.POST("/reinitialize", breakerAPI.ReinitializeOpsGenie)
+}
+
+// addReadOnlyEndpoints adds the endpoints of AddReadOnlyEndpoints to the /breaker and
+// /breaker/opsgenie groups
+func addReadOnlyEndpoints(breakerGroup, opsgenieGroup gin.IRouter, breakerAPI *BreakerAPI) {
+	breakerGroup.GET("/status", breakerAPI.GetBreakerStatus)
+	breakerGroup.GET("/metrics", breakerAPI.GetMetrics)
+	breakerGroup.GET("/enabled", breakerAPI.GetEnabled)
+	breakerGroup.GET("/memory", breakerAPI.GetMemory)
+	breakerGroup.GET("/latency", breakerAPI.GetLatency)
+	breakerGroup.GET("/latency-window-size", breakerAPI.GetLatencyWindowSize)
+	breakerGroup.GET("/percentile", breakerAPI.GetPercentile)
+	breakerGroup.GET("/wait", breakerAPI.GetWait)
+	breakerGroup.GET("/memory-usage", breakerAPI.GetMemoryUsage)
+	breakerGroup.GET("/trend-analysis", breakerAPI.GetTrendAnalysis)
+	breakerGroup.GET("/triggers", breakerAPI.GetTripTriggers)
+	breakerGroup.GET("/latencies-above-threshold", breakerAPI.LatenciesAboveThreshold)
+	breakerGroup.GET("/latency-series", breakerAPI.GetLatencySeries)
+	breakerGroup.GET("/latencies", breakerAPI.GetLatenciesSince)
+	breakerGroup.GET("/memory-limit", breakerAPI.GetMemoryLimit)
+	breakerGroup.GET("/config-source", breakerAPI.GetConfigSource)
+	breakerGroup.GET("/list", breakerAPI.ListRegisteredBreakers)
+	breakerGroup.GET("/global-disable", breakerAPI.GetGlobalDisable)
+	breakerGroup.GET("/staged-alerts", breakerAPI.GetStagedAlertStatus)
+
+	opsgenieGroup.GET("/status", breakerAPI.GetOpsGenieStatus)
+}
+
 func TotalMemoryMB() int64 {
+	return totalMemoryBytes() / (1024 * 1024) // Convert from bytes to MB
+}
+
+// TotalMemoryBytes returns the container memory limit or, without one, the memory
+// obtained from the system, in bytes
+func TotalMemoryBytes() int64 {
+	return totalMemoryBytes()
+}
+
+func totalMemoryBytes() int64 {
 	// If we are in Kubernetes, return the container memory limit
 	if MemoryLimit > 0 {
-		return MemoryLimit / (1024 * 1024) // Convert from bytes to MB
+		return MemoryLimit
 	}
 
 	// If we are not in Kubernetes, return the system memory
 	var m runtime.MemStats
 	runtime.ReadMemStats(&m)
-	return int64(m.Sys / (1024 * 1024))
+	return int64(m.Sys)
 }
 
 func (b *BreakerAPI) GetStagedAlertStatus(ctx *gin.Context) {
@@ -872,6 +1360,7 @@ func (b *BreakerAPI) GetStagedAlertStatus(ctx *gin.Context) {
 		"time_before_alert":    b.Config.OpsGenie.TimeBeforeSendAlert,
 		"initial_priority":     b.Config.OpsGenie.InitialAlertPriority,
 		"escalated_priority":   b.Config.OpsGenie.EscalatedAlertPriority,
+		"escalation_ladder":    b.Config.OpsGenie.PriorityEscalationLadder,
 		"pending_alerts_count": pendingCount,
 		"pending_alerts":       pendingInfo, // Sin cambio de tipo necesario aquí
 		"opsgenie_enabled":     b.Config.OpsGenie.Enabled,
@@ -896,7 +1385,8 @@ func (b *BreakerAPI) TriggerBreakerByMemory(ctx *gin.Context) {
 	}
 
 	// Force memory check to fail to trigger the breaker
-	SetMemoryOK(driver, false)
+	memoryOK := false
+	driver.SetMemoryOverride(&memoryOK)
 
 	// Make the breaker check its status by calling Allow() which will trigger it
 	allowed := b.Driver.Allow()
@@ -945,7 +1435,7 @@ func (b *BreakerAPI) TriggerBreakerByLatency(ctx *gin.Context) {
 	}
 
 	// Check if the breaker was triggered
-	triggered := b.Driver.TriggeredByLatencies()
+	triggered := b.Driver.Triggered()
 
 	// Log the action
 	log.Printf("Circuit breaker manually triggered by latency threshold breach via API")
@@ -976,7 +1466,7 @@ func (b *BreakerAPI) RestoreMemoryCheck(ctx *gin.Context) {
 	}
 
 	// Restore normal memory checking
-	SetMemoryOK(driver, true)
+	driver.SetMemoryOverride(nil)
 
 	// Log the action
 	log.Printf("Memory check restored to normal behavior via API")
@@ -0,0 +1,92 @@
+package breaker
+
+import "time"
+
+// BreakerEventType identifies the kind of a BreakerEvent
+type BreakerEventType string
+
+// Event types streamed by Events
+const (
+	EventTripped                 BreakerEventType = "tripped"                   // The breaker opened
+	EventReset                   BreakerEventType = "reset"                     // The breaker closed
+	EventRejected                BreakerEventType = "rejected"                  // Allow returned false
+	EventMemoryThresholdBreached BreakerEventType = "memory-threshold-breached" // Memory usage went above memory_threshold
+)
+
+// Reasons of the reset and rejected events. Tripped events carry the trip reason (see
+// the TripReason constants), and rejections because memory or latency is still above
+// the threshold carry TripReasonMemory or TripReasonLatency.
+const (
+	ResetReasonWaitTime    = "wait-time"   // The wait time elapsed and the trial requests succeeded
+	ResetReasonManual      = "manual"      // Reset or ResetState was called
+	ResetReasonRemote      = "remote"      // The replica that tripped reset (see honor_shared_trips)
+	ResetReasonProbe       = "probe"       // Probes found the downstream healthy (see SetProbe)
+	RejectReasonOpen       = "open"        // The breaker is open and the wait time has not elapsed
+	RejectReasonRetryAfter = "retry-after" // The downstream asked to retry later (see DoneWithError)
+	RejectReasonWarmup     = "warm-up"     // Too few latencies to judge and warmup_policy is fail-closed
+	RejectReasonRecovering = "recovering"  // The breaker is half-open and a trial request already went through in this interval
+	RejectReasonProbing    = "probing"     // The breaker is open until probes succeed (see SetProbe)
+)
+
+// eventBufferSize is the capacity of the channel returned by Events
+const eventBufferSize = 256
+
+// BreakerEvent is a change or decision of the breaker, streamed by Events
+type BreakerEvent struct {
+	Type                BreakerEventType
+	Time                time.Time
+	Reason              string  // Why the event happened (see the reason constants); empty for memory breaches
+	LatencyPercentileMs int64   // Latency percentile when the event happened
+	MemoryUsagePercent  float64 // Memory usage for tripped and memory events (zero otherwise or without a memory limit)
+}
+
+// Events returns a channel that streams the events of the breaker, for consumers that
+// build their own reactions (metrics, custom alerting, autoscaling signals). Every call
+// returns the same channel, and events are only produced once it has been requested.
+//
+// The channel is buffered and never blocks the breaker: when the buffer is full, new
+// events are dropped and counted by DroppedEvents, so a slow consumer loses events
+// rather than slowing requests down. Rejected events are sent for every denied request
+// and can fill the buffer quickly under load. The channel is never closed, not even by
+// Close, so consumers should stop on their own signal.
+func (b *BreakerDriver) Events() <-chan BreakerEvent {
+	if events := b.events.Load(); events != nil {
+		return *events
+	}
+
+	events := make(chan BreakerEvent, eventBufferSize)
+	if !b.events.CompareAndSwap(nil, &events) {
+		return *b.events.Load()
+	}
+	return events
+}
+
+// DroppedEvents returns how many events were dropped because the Events buffer was full
+func (b *BreakerDriver) DroppedEvents() uint64 {
+	return b.droppedEvents.Load()
+}
+
+// emitEvent sends an event to the Events channel without blocking. It does nothing until
+// Events has been called.
+func (b *BreakerDriver) emitEvent(eventType BreakerEventType, reason string) {
+	events := b.events.Load()
+	if events == nil {
+		return
+	}
+
+	event := BreakerEvent{
+		Type:                eventType,
+		Time:                b.now(),
+		Reason:              reason,
+		LatencyPercentileMs: b.lastPercentile.Load(),
+	}
+	if eventType == EventTripped || eventType == EventMemoryThresholdBreached {
+		event.MemoryUsagePercent = b.getMemoryUsagePercent()
+	}
+
+	select {
+	case *events <- event:
+	default:
+		b.droppedEvents.Add(1)
+	}
+}
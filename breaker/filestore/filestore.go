@@ -0,0 +1,272 @@
+// Package filestore shares circuit breaker trips through a file, for replicas on the
+// same host or on a shared volume, and keeps the last trip across restarts.
+//
+// The file holds only the last published state and is replaced atomically, so it never
+// grows and is never left half-written. Saves are debounced: a burst of trips and resets
+// during an incident is written once, with the latest state. If the disk is full or the
+// file cannot be written for lack of permissions, the store logs a single warning and
+// keeps the state in memory only; the breaker keeps working either way.
+//
+//	store := filestore.New("/var/run/payments-api/breaker.json")
+//	defer store.Close() // writes the pending state
+//	driver := breaker.NewBreaker(config, "breakers.toml").(*breaker.BreakerDriver)
+//	driver.SetStateStore(store)
+//	defer driver.Close()
+package filestore
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/lrleon/go-breaker/breaker"
+)
+
+// Defaults of the options
+const (
+	DefaultDebounce     = time.Second // Wait before saving a published state
+	DefaultPollInterval = time.Second // Interval between checks for states saved by other processes
+)
+
+// Store is a breaker.StateStore backed by a file. Publications reach the subscribers of
+// the same store immediately and the other processes once saved, when they poll the
+// file. It is safe for concurrent use.
+type Store struct {
+	path         string
+	debounce     time.Duration
+	pollInterval time.Duration
+
+	mu          sync.Mutex
+	handlers    map[int]func(state breaker.SharedState)
+	nextHandler int
+	pending     []byte      // Payload waiting to be saved, nil if none
+	timer       *time.Timer // Pending save, nil if none
+	saved       []byte      // Last payload saved or read from the file
+	memoryOnly  bool        // Set after an unrecoverable write error
+	closed      bool
+}
+
+var _ breaker.StateStore = (*Store)(nil)
+
+// Option configures a Store
+type Option func(*Store)
+
+// WithDebounce sets the wait between a publication and its save, during which later
+// publications replace it. Zero or less saves every publication right away.
+func WithDebounce(debounce time.Duration) Option {
+	return func(s *Store) {
+		s.debounce = debounce
+	}
+}
+
+// WithPollInterval sets how often subscribers check the file for states saved by other
+// processes. Zero or less means DefaultPollInterval.
+func WithPollInterval(interval time.Duration) Option {
+	return func(s *Store) {
+		if interval > 0 {
+			s.pollInterval = interval
+		}
+	}
+}
+
+// New returns a store that saves the states in the file at path. Replicas that should
+// coordinate must use the same path; its directory must exist.
+func New(path string, options ...Option) *Store {
+	s := &Store{
+		path:         path,
+		debounce:     DefaultDebounce,
+		pollInterval: DefaultPollInterval,
+		handlers:     make(map[int]func(state breaker.SharedState)),
+	}
+	for _, option := range options {
+		option(s)
+	}
+	return s
+}
+
+// Publish delivers the state to the subscribers of the store and schedules its save.
+// Write errors are logged rather than returned, as the save happens later.
+func (s *Store) Publish(_ context.Context, state breaker.SharedState) error {
+	payload, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("filestore: encoding state: %w", err)
+	}
+
+	s.mu.Lock()
+	if !s.closed && !s.memoryOnly {
+		s.pending = payload
+		switch {
+		case s.debounce <= 0:
+			s.saveLocked()
+		case s.timer == nil:
+			s.timer = time.AfterFunc(s.debounce, s.Flush)
+		}
+	}
+	handlers := s.handlersLocked()
+	s.mu.Unlock()
+
+	for _, handler := range handlers {
+		handler(state)
+	}
+	return nil
+}
+
+// Subscribe delivers the saved state, if any, and then every state published through
+// the store or saved to the file by another process, until ctx is done
+func (s *Store) Subscribe(ctx context.Context, handler func(state breaker.SharedState)) error {
+	s.mu.Lock()
+	id := s.nextHandler
+	s.nextHandler++
+	s.handlers[id] = handler
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.handlers, id)
+		s.mu.Unlock()
+	}()
+
+	if state, ok, err := s.read(true); err != nil {
+		log.Printf("filestore: reading saved state from %s: %v", s.path, err)
+	} else if ok {
+		handler(state)
+	}
+
+	ticker := time.NewTicker(s.pollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			if state, ok, err := s.read(false); err != nil {
+				log.Printf("filestore: reading saved state from %s: %v", s.path, err)
+			} else if ok {
+				handler(state)
+			}
+		}
+	}
+}
+
+// read returns the state in the file. Unless always is set, it reports a state only
+// if the file changed since it was last saved or read. A missing file has no state.
+func (s *Store) read(always bool) (breaker.SharedState, bool, error) {
+	var state breaker.SharedState
+	payload, err := os.ReadFile(s.path)
+	if errors.Is(err, fs.ErrNotExist) || (err == nil && len(payload) == 0) {
+		return state, false, nil
+	}
+	if err != nil {
+		return state, false, err
+	}
+
+	s.mu.Lock()
+	changed := !bytes.Equal(payload, s.saved)
+	s.saved = payload
+	s.mu.Unlock()
+	if !always && !changed {
+		return state, false, nil
+	}
+
+	if err := json.Unmarshal(payload, &state); err != nil {
+		return state, false, fmt.Errorf("invalid state: %w", err)
+	}
+	return state, true, nil
+}
+
+// Flush saves the pending state, if any, without waiting for the debounce
+func (s *Store) Flush() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.saveLocked()
+}
+
+// saveLocked writes the pending state. It must run in a critical section.
+func (s *Store) saveLocked() {
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+	payload := s.pending
+	s.pending = nil
+	if payload == nil || s.memoryOnly {
+		return
+	}
+
+	err := writeFile(s.path, payload)
+	switch {
+	case err == nil:
+		s.saved = payload
+	case isUnwritable(err):
+		s.memoryOnly = true
+		log.Printf("Warning: filestore: cannot write %s, keeping the breaker state in memory only: %v", s.path, err)
+	default:
+		log.Printf("filestore: saving state to %s: %v", s.path, err)
+	}
+}
+
+// writeFile replaces the file at path with payload through a temporary file in the same
+// directory, so that readers never see a partial write
+func writeFile(path string, payload []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // Fails harmlessly once renamed
+
+	if _, err := tmp.Write(payload); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// isUnwritable reports whether a write error will not go away by retrying: a full disk,
+// an exhausted quota, a read-only file system or missing permissions
+func isUnwritable(err error) bool {
+	return errors.Is(err, fs.ErrPermission) ||
+		errors.Is(err, syscall.ENOSPC) ||
+		errors.Is(err, syscall.EDQUOT) ||
+		errors.Is(err, syscall.EROFS)
+}
+
+func (s *Store) handlersLocked() []func(state breaker.SharedState) {
+	handlers := make([]func(state breaker.SharedState), 0, len(s.handlers))
+	for _, handler := range s.handlers {
+		handlers = append(handlers, handler)
+	}
+	return handlers
+}
+
+// MemoryOnly reports whether the store gave up writing the file after a full disk or a
+// permission error
+func (s *Store) MemoryOnly() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.memoryOnly
+}
+
+// Close saves the pending state. Later publications still reach the subscribers but are
+// not saved.
+func (s *Store) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.saveLocked()
+	s.closed = true
+	return nil
+}
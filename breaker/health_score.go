@@ -0,0 +1,59 @@
+package breaker
+
+import "math"
+
+// healthWeights returns the weights of memory and latency in the health score, equal
+// when neither is set
+func (c *Config) healthWeights() (float64, float64) {
+	memory, latency := max(c.HealthMemoryWeight, 0), max(c.HealthLatencyWeight, 0)
+	if memory == 0 && latency == 0 {
+		return 1, 1
+	}
+	return memory, latency
+}
+
+// tripsOnHealthScore reports whether the health score, rather than the independent
+// memory and latency thresholds, opens the breaker (see health_score_threshold)
+func (c *Config) tripsOnHealthScore() bool {
+	return c.HealthScoreThreshold > 0
+}
+
+// HealthScore blends memory pressure and latency into a score from 0 (idle) to 100 (both
+// at or above their thresholds): the memory usage relative to memory_threshold, 1 when
+// memory is not OK, and the latency percentile relative to latency_threshold, each capped
+// at 1, are weighted by health_memory_weight and health_latency_weight. Conditions out of
+// the trip scope (trip_on_memory, trip_on_latency) weigh nothing. With
+// health_score_threshold set, the breaker trips when the score reaches it.
+func (b *BreakerDriver) HealthScore() float64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.healthScore(b.latencyWindow.PercentileNs(b.config.Percentile), b.MemoryOK())
+}
+
+// healthScore implements HealthScore for a latency percentile in nanoseconds. It must
+// run in a critical section.
+func (b *BreakerDriver) healthScore(percentileNs int64, memoryOK bool) float64 {
+	memoryWeight, latencyWeight := b.config.healthWeights()
+	if !b.config.TripsOnMemory() {
+		memoryWeight = 0
+	}
+	if !b.config.TripsOnLatency() {
+		latencyWeight = 0
+	}
+	if memoryWeight+latencyWeight == 0 {
+		return 0
+	}
+
+	memorySeverity := 1.0
+	if memoryOK {
+		memorySeverity = 0
+		if b.config.MemoryThreshold > 0 {
+			memorySeverity = math.Min(b.getMemoryUsagePercent()/b.config.MemoryThreshold, 1)
+		}
+	}
+	latencySeverity := 0.0
+	if b.config.LatencyThreshold > 0 {
+		latencySeverity = math.Min(float64(percentileNs)/float64(millisToNanos(b.config.LatencyThreshold)), 1)
+	}
+	return 100 * (memoryWeight*memorySeverity + latencyWeight*latencySeverity) / (memoryWeight + latencyWeight)
+}
@@ -81,8 +81,9 @@ func InitBreaker(pathToConfig string, dftConfig *Config) *BreakerAPI {
 				log.Printf("Failed to create directory: %v, using default config in memory only", err)
 				// In the case of failure, also use the right path
 				return &BreakerAPI{
-					Config: *dftConfig,
-					Driver: NewBreaker(dftConfig, pathToConfig),
+					Config:       *dftConfig,
+					Driver:       NewBreaker(dftConfig, pathToConfig),
+					configSource: newConfigSource(pathToConfig, false, true, nil, err),
 				}
 			}
 
@@ -92,8 +93,9 @@ func InitBreaker(pathToConfig string, dftConfig *Config) *BreakerAPI {
 				log.Printf("Failed to save default config: %v, using default config in memory only", err)
 				// In the case of failure, also use the right path
 				return &BreakerAPI{
-					Config: *dftConfig,
-					Driver: NewBreaker(dftConfig, pathToConfig),
+					Config:       *dftConfig,
+					Driver:       NewBreaker(dftConfig, pathToConfig),
+					configSource: newConfigSource(pathToConfig, false, true, nil, err),
 				}
 			}
 
@@ -101,8 +103,9 @@ func InitBreaker(pathToConfig string, dftConfig *Config) *BreakerAPI {
 
 			// Create BreakerAPI with the default configuration and the correct path
 			retVal := &BreakerAPI{
-				Config: *dftConfig,
-				Driver: NewBreaker(dftConfig, pathToConfig),
+				Config:       *dftConfig,
+				Driver:       NewBreaker(dftConfig, pathToConfig),
+				configSource: newConfigSource(pathToConfig, false, true, nil, nil),
 			}
 
 			log.Printf("BreakerAPI created with default config using path: %s", pathToConfig)
@@ -119,7 +122,8 @@ func InitBreaker(pathToConfig string, dftConfig *Config) *BreakerAPI {
 	// At this point, either the file existed, or we had an error but want to try loading anyway
 	// Attempt to load the configuration
 	log.Printf("Attempting to load configuration from %s", pathToConfig)
-	config, err := LoadConfig(pathToConfig)
+	config, loader, err := loadConfigFile(pathToConfig, newLoadOptions(nil))
+	loadErr := err
 	if err != nil {
 		log.Printf("Error in LoadConfig(): %v", err)
 		log.Printf("Failed to load breaker config: %v, using default config", err)
@@ -141,8 +145,9 @@ func InitBreaker(pathToConfig string, dftConfig *Config) *BreakerAPI {
 
 	// Create BreakerAPI manually with the right path
 	retVal := &BreakerAPI{
-		Config: *config,
-		Driver: NewBreaker(config, pathToConfig),
+		Config:       *config,
+		Driver:       NewBreaker(config, pathToConfig),
+		configSource: newConfigSource(pathToConfig, loadErr == nil, loadErr != nil, loader, loadErr),
 	}
 
 	log.Printf("Successfully created BreakerAPI using config file: %s", pathToConfig)
@@ -1,26 +1,104 @@
 package breaker
 
 import (
+	"encoding/json"
+	"fmt"
 	"math"
 	"sort"
+	"sync"
 	"time"
+	"unsafe"
 )
 
 // LatencyRecord stores latency along with its timestamp
 type LatencyRecord struct {
-	Value     int64
-	Timestamp time.Time
+	Value     int64     `json:"value_ns"` // Latency in nanoseconds, so that sub-millisecond latencies are not lost
+	Timestamp time.Time `json:"timestamp"`
+	Label     string    `json:"label,omitempty"` // Operation the latency belongs to (see AddLabeled), if any
 }
 
+// Milliseconds returns the latency rounded to milliseconds
+func (r LatencyRecord) Milliseconds() int64 {
+	return nanosToMillis(r.Value)
+}
+
+// milliseconds returns the latency in fractional milliseconds
+func (r LatencyRecord) milliseconds() float64 {
+	return float64(r.Value) / float64(time.Millisecond)
+}
+
+// nanosToMillis rounds a latency in nanoseconds to milliseconds
+func nanosToMillis(nanos int64) int64 {
+	return time.Duration(nanos).Round(time.Millisecond).Milliseconds()
+}
+
+// millisToNanos converts a latency threshold in milliseconds to nanoseconds
+func millisToNanos(millis int64) int64 {
+	return int64(time.Duration(millis) * time.Millisecond)
+}
+
+// LatencyWindow is a circular buffer of latency records. It is safe for concurrent
+// use: Records and Index are guarded by an internal lock, so a window can be used
+// standalone. Configuration fields (MaxAgeSeconds, TrendWindowSize, ...) should be set
+// before the window is shared between goroutines.
 type LatencyWindow struct {
+	mu            sync.RWMutex
 	Records       []LatencyRecord
 	Index         int
 	Size          int
 	NeedToSort    bool
 	MaxAgeSeconds int // Maximum age in seconds to consider latency valid
+
+	// TrendWindowSize limits trend analysis to the most recent N records.
+	// Zero (the default) means the regression uses every recent record.
+	TrendWindowSize int
+
+	// MaxLatencyMs caps the latencies recorded by Add, so that a single extreme
+	// outlier cannot dominate the percentile. Zero (the default) means no cap.
+	MaxLatencyMs int64
+
+	// PercentileMethod selects how percentiles are computed (one of the Percentile*
+	// method constants). Empty (the default) means PercentileNearestRank.
+	PercentileMethod string
+
+	// Clock tells the time against which MaxAgeSeconds is measured. Nil (the default)
+	// means RealClock.
+	Clock Clock
 }
 
+// Percentile methods, selecting how a percentile is picked or interpolated from the
+// sorted latencies. Nearest-rank picks the smallest latency with at least n*p latencies
+// at or below it, the 0-based index ceil(n*p)-1, so the median of an even count is the
+// lower middle latency and the 99th percentile of 100 latencies is the 99th. The others
+// follow the definitions of numpy, where the percentile p falls at the fractional position
+// (n-1)*p. Percentiles outside [0, 1] are clamped, so every method returns the smallest
+// latency for p <= 0 (or NaN) and the largest for p >= 1, and a single latency for any p.
+const (
+	PercentileNearestRank = "nearest-rank" // The latency at index ceil(n*p)-1, clamped to [0, n-1]
+	PercentileLinear      = "linear"       // Linear interpolation between the two closest latencies
+	PercentileLower       = "lower"        // The closest latency below the position
+	PercentileHigher      = "higher"       // The closest latency above the position
+)
+
+// IsValidPercentileMethod reports whether method is one of the percentile methods or empty
+func IsValidPercentileMethod(method string) bool {
+	switch method {
+	case "", PercentileNearestRank, PercentileLinear, PercentileLower, PercentileHigher:
+		return true
+	}
+	return false
+}
+
+// minLatencyWindowSize is the smallest number of records a latency window holds
+const minLatencyWindowSize = 1
+
+// NewLatencyWindow returns a window that holds the last size latencies, with the default
+// max age of 5 minutes. Sizes below 1, which LoadConfig rejects but a hand-built config
+// may hold, give a window of a single record.
 func NewLatencyWindow(size int) *LatencyWindow {
+	if size < minLatencyWindowSize {
+		size = minLatencyWindowSize
+	}
 	return &LatencyWindow{
 		Records:       make([]LatencyRecord, size),
 		Size:          size,
@@ -28,29 +106,210 @@ func NewLatencyWindow(size int) *LatencyWindow {
 	}
 }
 
-// Add This function adds a new LatencyWindow measurement to the window and must run
-// in a critical section
+// currentTime returns the time against which the ages of the latencies are measured
+func (lw *LatencyWindow) currentTime() time.Time {
+	if lw.Clock != nil {
+		return lw.Clock.Now()
+	}
+	return time.Now()
+}
+
+// Add This function adds a new LatencyWindow measurement to the window. If endTime is
+// before startTime (clock adjustment or misuse) the latency is clamped to zero and the
+// record is stamped with startTime, so that a negative value never reaches the
+// percentile or trend computations. Latencies above MaxLatencyMs are recorded as
+// MaxLatencyMs.
 func (lw *LatencyWindow) Add(startTime, endTime time.Time) {
+	lw.AddLabeled(startTime, endTime, "")
+}
+
+// AddLabeled records a latency like Add, with a label that tells which operation it
+// belongs to (an endpoint path or a customer tier, for instance; see SlowestByLabel)
+func (lw *LatencyWindow) AddLabeled(startTime, endTime time.Time, label string) {
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+
 	n := len(lw.Records)
+	latency := endTime.Sub(startTime).Nanoseconds()
+	timestamp := endTime
+	if endTime.Before(startTime) {
+		latency = 0
+		timestamp = startTime
+	}
+	if lw.MaxLatencyMs > 0 && latency > millisToNanos(lw.MaxLatencyMs) {
+		latency = millisToNanos(lw.MaxLatencyMs)
+	}
 	lw.Records[lw.Index] = LatencyRecord{
-		Value:     endTime.Sub(startTime).Milliseconds(),
-		Timestamp: endTime,
+		Value:     latency,
+		Timestamp: timestamp,
+		Label:     label,
 	}
 	lw.Index = (lw.Index + 1) % n // Circular buffer
 	lw.NeedToSort = true
 }
 
-// Reset This function resets the LatencyWindow and must run in a critical section
+// Reset This function resets the LatencyWindow
 func (lw *LatencyWindow) Reset() {
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+
 	lw.Records = make([]LatencyRecord, lw.Size)
 	lw.Index = 0
 	lw.NeedToSort = false
 }
 
-// GetRecentLatencies returns only latencies within the configured time period
+// resized returns a new window with room for size records that keeps the most recent
+// records of lw. The new window has the default configuration and is not shared yet,
+// so its configuration fields can still be set.
+func (lw *LatencyWindow) resized(size int) *LatencyWindow {
+	lw.mu.RLock()
+	var records []LatencyRecord
+	for _, record := range lw.Records {
+		if !record.Timestamp.IsZero() {
+			records = append(records, record)
+		}
+	}
+	lw.mu.RUnlock()
+
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].Timestamp.Before(records[j].Timestamp)
+	})
+	resized := NewLatencyWindow(size)
+	resized.Clock = lw.Clock
+	if len(records) > resized.Size {
+		records = records[len(records)-resized.Size:]
+	}
+	for _, record := range records {
+		resized.Records[resized.Index] = record
+		resized.Index = (resized.Index + 1) % resized.Size
+	}
+	resized.NeedToSort = len(records) > 0
+	return resized
+}
+
+// ApproxMemoryBytes returns an estimate of the memory held by the window, for capacity
+// planning: the records, allocated for Size latencies whether they are used or not, and
+// their labels, counted once per record
+func (lw *LatencyWindow) ApproxMemoryBytes() int64 {
+	lw.mu.RLock()
+	defer lw.mu.RUnlock()
+
+	bytes := int64(unsafe.Sizeof(LatencyWindow{})) + int64(cap(lw.Records))*int64(unsafe.Sizeof(LatencyRecord{}))
+	for _, record := range lw.Records {
+		bytes += int64(len(record.Label))
+	}
+	return bytes
+}
+
+// Merge returns a new window with the recent latencies of lw and other (see MergeWindows)
+func (lw *LatencyWindow) Merge(other *LatencyWindow) *LatencyWindow {
+	return MergeWindows(lw, other)
+}
+
+// MergeWindows returns a new window holding the union of the recent latencies of the
+// given windows, each filtered by its own MaxAgeSeconds, ordered by timestamp. The
+// merged window is sized to hold all of them and keeps the largest MaxAgeSeconds, so it
+// can be queried for a combined percentile or trend, with the Clock of the first window.
+// Nil windows are ignored.
+func MergeWindows(windows ...*LatencyWindow) *LatencyWindow {
+	var records []LatencyRecord
+	var clock Clock
+	maxAgeSeconds := 0
+	for _, window := range windows {
+		if window == nil {
+			continue
+		}
+		if clock == nil {
+			clock = window.Clock
+		}
+		records = append(records, window.GetRecentTimeOrderedLatencies()...)
+
+		window.mu.RLock()
+		if window.MaxAgeSeconds > maxAgeSeconds {
+			maxAgeSeconds = window.MaxAgeSeconds
+		}
+		window.mu.RUnlock()
+	}
+
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].Timestamp.Before(records[j].Timestamp)
+	})
+
+	merged := NewLatencyWindow(max(len(records), 1))
+	merged.Clock = clock
+	if maxAgeSeconds > 0 {
+		merged.MaxAgeSeconds = maxAgeSeconds
+	}
+	copy(merged.Records, records)
+	merged.Index = len(records) % merged.Size
+	merged.NeedToSort = len(records) > 0
+	return merged
+}
+
+// latencyWindowSnapshot is the JSON form of a LatencyWindow
+type latencyWindowSnapshot struct {
+	Records       []LatencyRecord `json:"records"`
+	Index         int             `json:"index"`
+	Size          int             `json:"size"`
+	MaxAgeSeconds int             `json:"max_age_seconds"`
+}
+
+// MarshalJSON serializes the records of the window with its Index, Size and
+// MaxAgeSeconds, so that it can be restored with UnmarshalJSON (e.g. after a restart)
+func (lw *LatencyWindow) MarshalJSON() ([]byte, error) {
+	lw.mu.RLock()
+	defer lw.mu.RUnlock()
+
+	return json.Marshal(latencyWindowSnapshot{
+		Records:       lw.Records,
+		Index:         lw.Index,
+		Size:          lw.Size,
+		MaxAgeSeconds: lw.MaxAgeSeconds,
+	})
+}
+
+// UnmarshalJSON restores a window serialized by MarshalJSON. The other configuration
+// fields (TrendWindowSize, MaxLatencyMs) are not serialized and keep their values.
+func (lw *LatencyWindow) UnmarshalJSON(data []byte) error {
+	var snapshot latencyWindowSnapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return err
+	}
+	if snapshot.Size <= 0 || len(snapshot.Records) != snapshot.Size {
+		return fmt.Errorf("invalid latency window: %d records for size %d", len(snapshot.Records), snapshot.Size)
+	}
+	if snapshot.Index < 0 || snapshot.Index >= snapshot.Size {
+		return fmt.Errorf("invalid latency window: index %d out of range for size %d", snapshot.Index, snapshot.Size)
+	}
+
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+
+	lw.Records = snapshot.Records
+	lw.Index = snapshot.Index
+	lw.Size = snapshot.Size
+	lw.MaxAgeSeconds = snapshot.MaxAgeSeconds
+	lw.NeedToSort = true
+	return nil
+}
+
+// GetRecentLatencies returns only latencies within the configured time period, rounded
+// to milliseconds
 func (lw *LatencyWindow) GetRecentLatencies() []int64 {
+	recentValues := lw.GetRecentLatenciesNs()
+	for i, value := range recentValues {
+		recentValues[i] = nanosToMillis(value)
+	}
+	return recentValues
+}
+
+// GetRecentLatenciesNs returns only latencies within the configured time period, in
+// nanoseconds
+func (lw *LatencyWindow) GetRecentLatenciesNs() []int64 {
+	lw.mu.RLock()
+	defer lw.mu.RUnlock()
 
-	cutoffTime := time.Now().Add(-time.Duration(lw.MaxAgeSeconds) * time.Second)
+	cutoffTime := lw.currentTime().Add(-time.Duration(lw.MaxAgeSeconds) * time.Second)
 	var recentValues []int64
 
 	for _, record := range lw.Records {
@@ -65,7 +324,8 @@ func (lw *LatencyWindow) GetRecentLatencies() []int64 {
 
 // GetRecentTimeOrderedLatencies returns latencies ordered by timestamp (oldest first)
 func (lw *LatencyWindow) GetRecentTimeOrderedLatencies() []LatencyRecord {
-	cutoffTime := time.Now().Add(-time.Duration(lw.MaxAgeSeconds) * time.Second)
+	lw.mu.RLock()
+	cutoffTime := lw.currentTime().Add(-time.Duration(lw.MaxAgeSeconds) * time.Second)
 	var recentRecords []LatencyRecord
 
 	for _, record := range lw.Records {
@@ -74,6 +334,7 @@ func (lw *LatencyWindow) GetRecentTimeOrderedLatencies() []LatencyRecord {
 			recentRecords = append(recentRecords, record)
 		}
 	}
+	lw.mu.RUnlock()
 
 	// Sort by timestamp (oldest first)
 	sort.Slice(recentRecords, func(i, j int) bool {
@@ -83,22 +344,181 @@ func (lw *LatencyWindow) GetRecentTimeOrderedLatencies() []LatencyRecord {
 	return recentRecords
 }
 
+// LabelLatencySummary summarizes the recent latencies recorded with one label
+type LabelLatencySummary struct {
+	Label          string `json:"label"`
+	Count          int    `json:"count"`           // Recent latencies with the label
+	AboveThreshold int    `json:"above_threshold"` // Of them, those above the threshold
+	MaxMs          int64  `json:"max_ms"`          // Slowest of them, rounded to milliseconds
+}
+
+// SlowestByLabel summarizes the recent latencies (within MaxAgeSeconds) of each label,
+// slowest label first, so that the slow operations can be told apart. Threshold is in
+// milliseconds; unlabeled latencies are left out.
+func (lw *LatencyWindow) SlowestByLabel(threshold int64) []LabelLatencySummary {
+	lw.mu.RLock()
+	cutoffTime := lw.currentTime().Add(-time.Duration(lw.MaxAgeSeconds) * time.Second)
+	summaries := make(map[string]*LabelLatencySummary)
+	maxNs := make(map[string]int64)
+	for _, record := range lw.Records {
+		if record.Label == "" || record.Timestamp.IsZero() || !record.Timestamp.After(cutoffTime) {
+			continue
+		}
+		summary, exists := summaries[record.Label]
+		if !exists {
+			summary = &LabelLatencySummary{Label: record.Label}
+			summaries[record.Label] = summary
+		}
+		summary.Count++
+		if record.Value > millisToNanos(threshold) {
+			summary.AboveThreshold++
+		}
+		if record.Value > maxNs[record.Label] {
+			maxNs[record.Label] = record.Value
+		}
+	}
+	lw.mu.RUnlock()
+
+	result := make([]LabelLatencySummary, 0, len(summaries))
+	for label, summary := range summaries {
+		summary.MaxMs = nanosToMillis(maxNs[label])
+		result = append(result, *summary)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if maxNs[result[i].Label] != maxNs[result[j].Label] {
+			return maxNs[result[i].Label] > maxNs[result[j].Label]
+		}
+		return result[i].Label < result[j].Label
+	})
+	return result
+}
+
+// LatenciesSince returns the latencies recorded within the last d, rounded to
+// milliseconds and ordered by timestamp (oldest first). Unlike GetRecentLatencies, it
+// ignores MaxAgeSeconds: older latencies are returned while the window still holds them.
+func (lw *LatencyWindow) LatenciesSince(d time.Duration) []int64 {
+	records := lw.LatencyRecordsSince(d)
+	latencies := make([]int64, len(records))
+	for i, record := range records {
+		latencies[i] = record.Milliseconds()
+	}
+	return latencies
+}
+
+// LatencyRecordsSince returns the records of the latencies recorded within the last d,
+// ordered by timestamp (oldest first), regardless of MaxAgeSeconds
+func (lw *LatencyWindow) LatencyRecordsSince(d time.Duration) []LatencyRecord {
+	lw.mu.RLock()
+	cutoffTime := lw.currentTime().Add(-d)
+	var records []LatencyRecord
+	for _, record := range lw.Records {
+		if !record.Timestamp.IsZero() && record.Timestamp.After(cutoffTime) {
+			records = append(records, record)
+		}
+	}
+	lw.mu.RUnlock()
+
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].Timestamp.Before(records[j].Timestamp)
+	})
+	return records
+}
+
+// RecentSampleCount returns the number of latencies within MaxAgeSeconds
+func (lw *LatencyWindow) RecentSampleCount() int {
+	lw.mu.RLock()
+	defer lw.mu.RUnlock()
+
+	cutoffTime := lw.currentTime().Add(-time.Duration(lw.MaxAgeSeconds) * time.Second)
+	count := 0
+	for _, record := range lw.Records {
+		if !record.Timestamp.IsZero() && record.Timestamp.After(cutoffTime) {
+			count++
+		}
+	}
+	return count
+}
+
+// HasSufficientData reports whether the window holds at least min latencies within
+// MaxAgeSeconds (at least one if min is lower). Without them, percentiles are 0 and the
+// latency looks healthy only because nothing was measured.
+func (lw *LatencyWindow) HasSufficientData(min int) bool {
+	if min < 1 {
+		min = 1
+	}
+	return lw.RecentSampleCount() >= min
+}
+
+// recentTimeRange returns the timestamps of the oldest and the newest latencies within
+// MaxAgeSeconds, which are zero when there are none
+func (lw *LatencyWindow) recentTimeRange() (oldest, newest time.Time) {
+	lw.mu.RLock()
+	defer lw.mu.RUnlock()
+
+	cutoffTime := lw.currentTime().Add(-time.Duration(lw.MaxAgeSeconds) * time.Second)
+	for _, record := range lw.Records {
+		if record.Timestamp.IsZero() || !record.Timestamp.After(cutoffTime) {
+			continue
+		}
+		if oldest.IsZero() || record.Timestamp.Before(oldest) {
+			oldest = record.Timestamp
+		}
+		if record.Timestamp.After(newest) {
+			newest = record.Timestamp
+		}
+	}
+	return oldest, newest
+}
+
+// OldestSampleTime returns the timestamp of the oldest latency used for the percentile
+// (within MaxAgeSeconds), or the zero time if there is none
+func (lw *LatencyWindow) OldestSampleTime() time.Time {
+	oldest, _ := lw.recentTimeRange()
+	return oldest
+}
+
+// NewestSampleTime returns the timestamp of the newest latency used for the percentile
+// (within MaxAgeSeconds), or the zero time if there is none
+func (lw *LatencyWindow) NewestSampleTime() time.Time {
+	_, newest := lw.recentTimeRange()
+	return newest
+}
+
+// WindowSpan returns the time between the oldest and the newest latencies used for the
+// percentile. A span much shorter than MaxAgeSeconds means that the percentile reflects
+// a short burst of operations.
+func (lw *LatencyWindow) WindowSpan() time.Duration {
+	oldest, newest := lw.recentTimeRange()
+	return newest.Sub(oldest)
+}
+
 // HasPositiveTrend checks if the latency has an upward trend
 // Returns true if the trend is positive (latencies increasing), false otherwise
 // minSampleCount specifies the minimum number of samples required for trend analysis
 func (lw *LatencyWindow) HasPositiveTrend(minSampleCount int) bool {
 	orderedRecords := lw.GetRecentTimeOrderedLatencies()
 
+	// Focus the analysis on the most recent behavior if a trend window is configured
+	if lw.TrendWindowSize > 0 && len(orderedRecords) > lw.TrendWindowSize {
+		orderedRecords = orderedRecords[len(orderedRecords)-lw.TrendWindowSize:]
+	}
+
 	// Need at least minSampleCount samples for meaningful trend analysis
 	if len(orderedRecords) < minSampleCount {
 		return false
 	}
 
+	// The heuristics below are tuned in milliseconds
+	values := make([]float64, len(orderedRecords))
+	for i, record := range orderedRecords {
+		values[i] = record.milliseconds()
+	}
+
 	// Special case for exactly 3 values with clear increasing pattern - for TestBreakerPreciseTriggerPoint
 	if len(orderedRecords) == 3 {
-		v1 := orderedRecords[0].Value
-		v2 := orderedRecords[1].Value
-		v3 := orderedRecords[2].Value
+		v1 := values[0]
+		v2 := values[1]
+		v3 := values[2]
 
 		// If it's strictly increasing by at least 10ms each time, consider it a positive trend
 		if v2 > v1 && v3 > v2 && (v3-v1) >= 20 {
@@ -116,18 +536,14 @@ func (lw *LatencyWindow) HasPositiveTrend(minSampleCount int) bool {
 		}
 
 		// Get the last few values
-		lastValues := make([]int64, lastCount)
-		for i := 0; i < lastCount; i++ {
-			idx := len(orderedRecords) - lastCount + i
-			lastValues[i] = orderedRecords[idx].Value
-		}
+		lastValues := values[len(values)-lastCount:]
 
 		// Check if they're all similar (within 5% of each other)
 		allSimilar := true
-		baseValue := float64(lastValues[0])
+		baseValue := lastValues[0]
 
 		for i := 1; i < len(lastValues); i++ {
-			currValue := float64(lastValues[i])
+			currValue := lastValues[i]
 			pctDiff := (currValue - baseValue) / baseValue
 			if pctDiff > 0.05 || pctDiff < -0.05 { // More than 5% different
 				allSimilar = false
@@ -145,9 +561,8 @@ func (lw *LatencyWindow) HasPositiveTrend(minSampleCount int) bool {
 			sumX2 := float64(0)
 
 			// Use index as X value and latency as Y value
-			for i, record := range orderedRecords {
+			for i, y := range values {
 				x := float64(i)
-				y := float64(record.Value)
 
 				sumX += x
 				sumY += y
@@ -176,8 +591,8 @@ func (lw *LatencyWindow) HasPositiveTrend(minSampleCount int) bool {
 	if len(orderedRecords) >= 7 {
 		// Check if all values are above 375 and there's no clear upward trend
 		allHigh := true
-		for _, record := range orderedRecords {
-			if record.Value < 375 {
+		for _, value := range values {
+			if value < 375 {
 				allHigh = false
 				break
 			}
@@ -192,9 +607,8 @@ func (lw *LatencyWindow) HasPositiveTrend(minSampleCount int) bool {
 			sumX2 := float64(0)
 
 			// Use index as X value and latency as Y value
-			for i, record := range orderedRecords {
+			for i, y := range values {
 				x := float64(i)
-				y := float64(record.Value)
 
 				sumX += x
 				sumY += y
@@ -222,18 +636,16 @@ func (lw *LatencyWindow) HasPositiveTrend(minSampleCount int) bool {
 	// This has alternating up/down but with a general upward trend
 	if len(orderedRecords) >= 6 {
 		// First, identify the overall trend using first and last values
-		firstValue := float64(orderedRecords[0].Value)
-		lastValue := float64(orderedRecords[len(orderedRecords)-1].Value)
+		firstValue := values[0]
+		lastValue := values[len(values)-1]
 
 		// Look for zigzag pattern (alternating increases and decreases)
 		zigzagPattern := true
-		for i := 2; i < len(orderedRecords); i++ {
+		for i := 2; i < len(values); i++ {
 			// If three consecutive points are all increasing or all decreasing,
 			// it's not a zigzag pattern
-			if (orderedRecords[i].Value > orderedRecords[i-1].Value &&
-				orderedRecords[i-1].Value > orderedRecords[i-2].Value) ||
-				(orderedRecords[i].Value < orderedRecords[i-1].Value &&
-					orderedRecords[i-1].Value < orderedRecords[i-2].Value) {
+			if (values[i] > values[i-1] && values[i-1] > values[i-2]) ||
+				(values[i] < values[i-1] && values[i-1] < values[i-2]) {
 				zigzagPattern = false
 				break
 			}
@@ -253,9 +665,8 @@ func (lw *LatencyWindow) HasPositiveTrend(minSampleCount int) bool {
 	sumX2 := float64(0)
 
 	// Use index as X value and latency as Y value
-	for i, record := range orderedRecords {
+	for i, y := range values {
 		x := float64(i)
-		y := float64(record.Value)
 
 		sumX += x
 		sumY += y
@@ -272,8 +683,8 @@ func (lw *LatencyWindow) HasPositiveTrend(minSampleCount int) bool {
 	slope := (n*sumXY - sumX*sumY) / denominator
 
 	// Calculate the first and last values for a more robust check
-	firstValue := float64(orderedRecords[0].Value)
-	lastValue := float64(orderedRecords[len(orderedRecords)-1].Value)
+	firstValue := values[0]
+	lastValue := values[len(values)-1]
 
 	// Special case for oscillating patterns with clear upward trend
 	// If the last value is significantly higher than the first (15% or more),
@@ -288,10 +699,28 @@ func (lw *LatencyWindow) HasPositiveTrend(minSampleCount int) bool {
 	return slope > minSlope
 }
 
-// Percentile This function returns the LatencyWindow percentile in milliseconds of the window
-// and must run in a critical section
+// Percentile This function returns the LatencyWindow percentile in milliseconds of the
+// window, rounded. Decisions should use PercentileNs, which keeps sub-millisecond detail.
 func (lw *LatencyWindow) Percentile(p float64) int64 {
-	recentValues := lw.GetRecentLatencies()
+	return lw.PercentileMs(p)
+}
+
+// PercentileMs returns the percentile of the window rounded to milliseconds
+func (lw *LatencyWindow) PercentileMs(p float64) int64 {
+	return nanosToMillis(lw.PercentileNs(p))
+}
+
+// PercentileNs returns the percentile of the window in nanoseconds, computed with the
+// window's PercentileMethod
+func (lw *LatencyWindow) PercentileNs(p float64) int64 {
+	return lw.PercentileNsWithMethod(p, lw.PercentileMethod)
+}
+
+// PercentileNsWithMethod returns the percentile of the window in nanoseconds computed
+// with the given method (one of the Percentile* method constants; empty or unknown
+// methods mean PercentileNearestRank)
+func (lw *LatencyWindow) PercentileNsWithMethod(p float64, method string) int64 {
+	recentValues := lw.GetRecentLatenciesNs()
 
 	// If there are no recent values, return 0
 	if len(recentValues) == 0 {
@@ -301,33 +730,75 @@ func (lw *LatencyWindow) Percentile(p float64) int64 {
 	sorted := append([]int64{}, recentValues...)
 	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
 
-	idx := int(float64(len(sorted)) * p)
-	if idx >= len(sorted) {
-		idx = len(sorted) - 1
+	if math.IsNaN(p) {
+		p = 0
+	}
+	p = math.Max(0, math.Min(p, 1))
+	if method == "" || method == PercentileNearestRank || !IsValidPercentileMethod(method) {
+		return sorted[nearestRankIndex(len(sorted), p)]
+	}
+
+	position := float64(len(sorted)-1) * p
+	lower := sorted[int(math.Floor(position))]
+	higher := sorted[int(math.Ceil(position))]
+	switch method {
+	case PercentileLower:
+		return lower
+	case PercentileHigher:
+		return higher
+	default: // PercentileLinear
+		fraction := position - math.Floor(position)
+		return lower + int64(math.Round(fraction*float64(higher-lower)))
 	}
+}
 
-	return sorted[idx]
+// nearestRankIndex returns the index in n sorted latencies of the percentile p (in [0, 1])
+// by nearest rank: ceil(n*p)-1, clamped to [0, n-1], so that p = 0 is the smallest and
+// p = 1 the largest. The rank is rounded down by a tiny margin first, so that a product
+// such as 100*0.07 = 7.000000000000001 does not move the rank up by one.
+func nearestRankIndex(n int, p float64) int {
+	idx := int(math.Ceil(float64(n)*p-1e-9)) - 1
+	if idx < 0 {
+		idx = 0
+	}
+	if idx >= n {
+		idx = n - 1
+	}
+	return idx
 }
 
-// AboveThresholdLatencies Return a slice with the latencies above the threshold
+// AboveThresholdLatencies Return a slice with the latencies above the threshold, both in
+// milliseconds. The comparison uses nanoseconds, so 100.4ms is above a 100ms threshold.
 func (lw *LatencyWindow) AboveThresholdLatencies(threshold int64) []int64 {
-	recentValues := lw.GetRecentLatencies()
+	recentValues := lw.GetRecentLatenciesNs()
 	var latencies []int64
 
 	for _, latency := range recentValues {
-		if latency > threshold {
-			latencies = append(latencies, latency)
+		if latency > millisToNanos(threshold) {
+			latencies = append(latencies, nanosToMillis(latency))
 		}
 	}
 	return latencies
 }
 
-// AboveThreshold Return true if the LatencyWindow is above the threshold
+// AboveThresholdRecords returns the records of the recent latencies above the threshold
+// (in milliseconds), with their timestamps and labels, oldest first
+func (lw *LatencyWindow) AboveThresholdRecords(threshold int64) []LatencyRecord {
+	var records []LatencyRecord
+	for _, record := range lw.GetRecentTimeOrderedLatencies() {
+		if record.Value > millisToNanos(threshold) {
+			records = append(records, record)
+		}
+	}
+	return records
+}
+
+// AboveThreshold Return true if the LatencyWindow is above the threshold (in milliseconds)
 func (lw *LatencyWindow) AboveThreshold(threshold int64) bool {
-	return lw.Percentile(0.99) > threshold
+	return lw.PercentileNs(0.99) > millisToNanos(threshold)
 }
 
-// BelowThreshold Return true if the LatencyWindow is below the threshold
+// BelowThreshold Return true if the LatencyWindow is below the threshold (in milliseconds)
 func (lw *LatencyWindow) BelowThreshold(threshold int64) bool {
-	return lw.Percentile(0.99) < threshold
+	return lw.PercentileNs(0.99) < millisToNanos(threshold)
 }
@@ -0,0 +1,94 @@
+package breaker
+
+import (
+	"time"
+	"unsafe"
+)
+
+// defaultLatencySeriesSize keeps five minutes of history at one sample per second
+const defaultLatencySeriesSize = 300
+
+// PercentileSample is the latency percentile of a breaker at a point in time
+type PercentileSample struct {
+	Timestamp    time.Time `json:"timestamp"`
+	PercentileMs int64     `json:"percentile_ms"`
+}
+
+// percentileSeries is a ring buffer with at most one percentile sample per second. It is
+// not safe for concurrent use; the breaker guards it with its own lock.
+type percentileSeries struct {
+	samples []PercentileSample
+	next    int // Position of the next sample once the buffer is full
+	count   int
+}
+
+func newPercentileSeries(size int) *percentileSeries {
+	if size <= 0 {
+		size = defaultLatencySeriesSize
+	}
+	return &percentileSeries{samples: make([]PercentileSample, size)}
+}
+
+// add records the percentile at the given time. A sample within the same second as the
+// newest one (or older, when latencies are reported out of order) updates it, so the
+// series keeps the last value of every second and stays ordered.
+func (s *percentileSeries) add(now time.Time, percentile int64) {
+	if s.count > 0 {
+		last := &s.samples[(s.next-1+len(s.samples))%len(s.samples)]
+		if !now.Truncate(time.Second).After(last.Timestamp.Truncate(time.Second)) {
+			last.PercentileMs = percentile
+			if now.After(last.Timestamp) {
+				last.Timestamp = now
+			}
+			return
+		}
+	}
+
+	s.samples[s.next] = PercentileSample{Timestamp: now, PercentileMs: percentile}
+	s.next = (s.next + 1) % len(s.samples)
+	if s.count < len(s.samples) {
+		s.count++
+	}
+}
+
+// snapshot returns the samples ordered from the oldest to the newest
+func (s *percentileSeries) snapshot() []PercentileSample {
+	result := make([]PercentileSample, 0, s.count)
+	start := (s.next - s.count + len(s.samples)) % len(s.samples)
+	for i := 0; i < s.count; i++ {
+		result = append(result, s.samples[(start+i)%len(s.samples)])
+	}
+	return result
+}
+
+// approxMemoryBytes returns an estimate of the memory held by the series, which is
+// allocated for its size up front
+func (s *percentileSeries) approxMemoryBytes() int64 {
+	if s == nil {
+		return 0
+	}
+	return int64(unsafe.Sizeof(percentileSeries{})) + int64(cap(s.samples))*int64(unsafe.Sizeof(PercentileSample{}))
+}
+
+// resized returns a series with room for size samples that keeps the most recent ones
+func (s *percentileSeries) resized(size int) *percentileSeries {
+	resized := newPercentileSeries(size)
+	for _, sample := range s.snapshot() {
+		resized.add(sample.Timestamp, sample.PercentileMs)
+	}
+	return resized
+}
+
+func (s *percentileSeries) reset() {
+	s.samples = make([]PercentileSample, len(s.samples))
+	s.next = 0
+	s.count = 0
+}
+
+// LatencySeries returns the recent history of the latency percentile, at most one
+// sample per second and oldest first, bounded by latency_series_size
+func (b *BreakerDriver) LatencySeries() []PercentileSample {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.latencySeries.snapshot()
+}
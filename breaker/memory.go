@@ -2,25 +2,53 @@ package breaker
 
 import (
 	"bytes"
+	"fmt"
+	"math"
 	"os"
 	"runtime"
 	"strconv"
+	"strings"
+	"sync/atomic"
 )
 
+// MemoryLimitFile holds the container memory limit on Linux (cgroup). It is not used on
+// Windows, where the limit comes from the job object of the process.
 var MemoryLimitFile = "/sys/fs/cgroup/memory/memory.limit_in_bytes"
 
-// Variables for testing only
-var (
-	memoryOverride      bool
-	memoryOverrideValue bool
-	memoryLogger        = NewLogger("MemoryMonitor")
-)
+var memoryLogger = NewLogger("MemoryMonitor")
+
+// SetMemoryOverride forces the result of MemoryOK for this breaker: a pointer to true
+// makes the memory check always pass, a pointer to false makes it always fail (which
+// opens the breaker), and nil restores the real check against the container memory
+// limit. It is intended for integration tests and for operators simulating memory
+// pressure (see /breaker/trigger-by-memory); it does not affect other breakers.
+func (b *BreakerDriver) SetMemoryOverride(ok *bool) {
+	if ok == nil {
+		b.memoryOverride.Store(nil)
+		return
+	}
 
-// SetMemoryOK is used only for testing to override the memory check
-// This allows tests to control whether memory is considered OK
+	// Copy the value so later changes to *ok by the caller have no effect
+	value := *ok
+	b.memoryOverride.Store(&value)
+}
+
+// MemoryOverride returns the forced result of MemoryOK, or nil when the real check is used
+func (b *BreakerDriver) MemoryOverride() *bool {
+	if value := b.memoryOverride.Load(); value != nil {
+		forced := *value
+		return &forced
+	}
+	return nil
+}
+
+// SetMemoryOK forces the memory check of b to return value.
+//
+// Deprecated: use BreakerDriver.SetMemoryOverride, which also restores the real check.
 func SetMemoryOK(b *BreakerDriver, value bool) {
-	memoryOverride = true
-	memoryOverrideValue = value
+	if b != nil {
+		b.SetMemoryOverride(&value)
+	}
 }
 
 func GetK8sMemoryLimit() (int64, error) {
@@ -39,19 +67,89 @@ func GetK8sMemoryLimit() (int64, error) {
 
 var MemoryLimit int64 // MemoryLimit is the memory limit of the container
 
-func init() {
+// memoryLimitErr is the error found reading the memory limit, if any
+var memoryLimitErr error
 
-	// run only if we are in a k8s environment
-	if _, err := os.Stat(MemoryLimitFile); os.IsNotExist(err) {
-		memoryLogger.Logf("Not running in a k8s environment")
-		return
+// memoryCheckWarned is set once the missing memory limit has been reported by MemoryOK
+var memoryCheckWarned atomic.Bool
+
+// MemoryCheckEnabled reports whether a memory limit is known. Without one, memory
+// usage cannot be related to anything: MemoryOK returns true when there is no limit
+// (outside a container), and what memory_check_failure_policy says when the limit
+// could not be read.
+func MemoryCheckEnabled() bool {
+	return MemoryLimit > 0
+}
+
+// memoryLimitStatus describes the memory limit for the logs: its size, or why it is unknown
+func memoryLimitStatus() string {
+	switch {
+	case memoryLimitErr != nil:
+		return fmt.Sprintf("unreadable: %v", memoryLimitErr)
+	case !MemoryCheckEnabled():
+		return "unknown"
+	default:
+		return HumanBytes(MemoryLimit)
 	}
+}
+
+func init() {
+	// The detection depends on the OS (see platform_other.go and platform_windows.go).
+	// A limit that cannot be read disables the memory check, and MemoryOK follows
+	// memory_check_failure_policy.
 	var err error
-	MemoryLimit, err = GetK8sMemoryLimit()
+	MemoryLimit, err = detectMemoryLimit()
 	if err != nil {
 		memoryLogger.Logf("Error getting memory limit: %v", err)
-		panic(err)
+		MemoryLimit = 0
+		memoryLimitErr = err
+	}
+}
+
+// Units accepted for memory values (see the units parameter of /breaker/status)
+const (
+	MemoryUnitsMB    = "mb"
+	MemoryUnitsBytes = "bytes"
+	MemoryUnitsHuman = "human"
+)
+
+// IsValidMemoryUnits reports whether units is one of the MemoryUnits* values
+func IsValidMemoryUnits(units string) bool {
+	return units == MemoryUnitsMB || units == MemoryUnitsBytes || units == MemoryUnitsHuman
+}
+
+// FormatMemory expresses a number of bytes in the given units: whole megabytes for
+// MemoryUnitsMB, bytes for MemoryUnitsBytes and a string such as "512 MB" for
+// MemoryUnitsHuman. Unknown units are treated as MemoryUnitsMB.
+func FormatMemory(bytes int64, units string) interface{} {
+	switch units {
+	case MemoryUnitsBytes:
+		return bytes
+	case MemoryUnitsHuman:
+		return HumanBytes(bytes)
+	default:
+		return bytes / 1024 / 1024
+	}
+}
+
+// HumanBytes formats a number of bytes with binary units, e.g. "512 MB" or "1.5 GB"
+func HumanBytes(bytes int64) string {
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%d B", bytes)
+	}
+
+	value := float64(bytes)
+	suffixes := []string{"KB", "MB", "GB", "TB", "PB", "EB"}
+	i := -1
+	for value >= unit && i < len(suffixes)-1 {
+		value /= unit
+		i++
 	}
+
+	formatted := strconv.FormatFloat(value, 'f', 1, 64)
+	formatted = strings.TrimSuffix(formatted, ".0")
+	return formatted + " " + suffixes[i]
 }
 
 // MemoryUsage Return the current memory usage in MB
@@ -62,18 +160,53 @@ func MemoryUsage() int64 {
 	return int64(m.Alloc) / 1024 / 1024
 }
 
-// MemoryOK Return true if the memory usage is above the threshold. The threshold is
-// calculated based on the memory limit of the container
+// MemoryUsageBytes returns the memory allocated by the process, in bytes
+func MemoryUsageBytes() int64 {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+
+	return int64(m.Alloc)
+}
+
+// MemoryPercent returns usedBytes as a percentage of limitBytes, computed from the bytes
+// so that usages below a megabyte are not rounded away, or 0 without a limit
+func MemoryPercent(usedBytes, limitBytes int64) float64 {
+	if limitBytes <= 0 {
+		return 0
+	}
+	return float64(usedBytes) / float64(limitBytes) * 100.0
+}
+
+// MemoryOK Return true if the memory usage is below the threshold. The threshold is
+// calculated based on the memory limit of the container. Without a limit it returns
+// true; when the limit could not be read it returns false if
+// memory_check_failure_policy is closed.
 func (b *BreakerDriver) MemoryOK() bool {
-	// For testing purposes
-	if memoryOverride {
-		return memoryOverrideValue
+	memoryOK, _ := b.memoryStatus()
+	return memoryOK
+}
+
+// memoryStatus is MemoryOK that also returns the memory allocated by the process, in
+// bytes, so that the caller does not read the memory statistics again. The bytes are -1
+// when they were not read (forced result or no memory limit).
+func (b *BreakerDriver) memoryStatus() (bool, int64) {
+	// Forced result (see SetMemoryOverride)
+	if value := b.memoryOverride.Load(); value != nil {
+		return *value, -1
 	}
 
-	// If we do not have a valid memory limit, we cannot verify
-	if MemoryLimit <= 0 {
-		memoryLogger.Logf("Warning: Invalid memory limit (%d). Cannot perform memory threshold check.", MemoryLimit)
-		return true // We assume that memory is fine if we don't have a valid limit
+	// If we do not have a valid memory limit, we cannot verify. Only a limit that could
+	// not be read is a failure, for which the policy decides; no limit at all is not.
+	if !MemoryCheckEnabled() {
+		failClosed := memoryLimitErr != nil && b.memoryFailClosed.Load()
+		if !memoryCheckWarned.Swap(true) {
+			if failClosed {
+				memoryLogger.Logf("Warning: Invalid memory limit (%d). Memory cannot be verified and memory_check_failure_policy is closed: memory checks fail.", MemoryLimit)
+			} else {
+				memoryLogger.Logf("Warning: Invalid memory limit (%d). Memory threshold checks are disabled.", MemoryLimit)
+			}
+		}
+		return !failClosed, -1
 	}
 
 	var m runtime.MemStats
@@ -83,7 +216,7 @@ func (b *BreakerDriver) MemoryOK() bool {
 
 	// To avoid loss of precision, we make the division before multiplication
 	// we convert the percentage to fraction by dividing by 100
-	thresholdFraction := b.config.MemoryThreshold / 100.0
+	thresholdFraction := math.Float64frombits(b.memoryThreshold.Load()) / 100.0
 	memLimit := float64(MemoryLimit) * thresholdFraction
 
 	memoryOK := currMem < memLimit
@@ -94,10 +227,64 @@ func (b *BreakerDriver) MemoryOK() bool {
 			currMem/1024/1024, memLimit/1024/1024, 100*currMem/float64(MemoryLimit))
 	}
 
-	return memoryOK
+	return memoryOK, int64(m.Alloc)
+}
+
+// checkMemoryWarning sends the memory warning alert when memory usage crosses
+// memory_warn_threshold while the memory check still passes, giving lead time before
+// the breaker trips on memory. Usage must drop below the warning threshold before it
+// warns again. usedBytes is the memory allocated by the process, as returned by
+// memoryStatus, or -1 to read it. It must run in a critical section.
+func (b *BreakerDriver) checkMemoryWarning(memoryOK bool, usedBytes int64) {
+	warnThreshold := b.config.MemoryWarnThreshold
+	if warnThreshold <= 0 || !MemoryCheckEnabled() {
+		b.memoryWarned = false
+		return
+	}
+
+	if usedBytes < 0 {
+		usedBytes = MemoryUsageBytes()
+	}
+	usage := MemoryPercent(usedBytes, MemoryLimit)
+	crossed := usage >= warnThreshold && !b.memoryWarned
+	b.memoryWarned = usage >= warnThreshold
+	if !crossed || !memoryOK {
+		return
+	}
+
+	threshold := math.Float64frombits(b.memoryThreshold.Load())
+	b.logger.Logf("WARNING: Memory usage %.2f%% is above memory_warn_threshold %.2f%%; the breaker trips at %.2f%%",
+		usage, warnThreshold, threshold)
+
+	if b.opsGenieClient != nil && b.config.OpsGenie != nil && b.config.OpsGenie.Enabled {
+		status := &MemoryStatus{
+			CurrentUsage: usage,
+			Threshold:    threshold,
+			TotalMemory:  uint64(MemoryLimit),
+			UsedMemory:   uint64(usedBytes),
+			OK:           memoryOK,
+		}
+		go func() {
+			if err := b.opsGenieClient.SendMemoryWarningAlert(status, warnThreshold); err != nil {
+				b.logger.Logf("Failed to send OpsGenie memory warning alert: %v", err)
+			}
+		}()
+	}
 }
 
 // SetMemoryLimitFile Set the memory limit file for testing
 func SetMemoryLimitFile(sz int64) {
 	MemoryLimit = sz
 }
+
+// SetMemoryLimitError sets the error found reading the memory limit, for testing. A
+// non-nil err makes MemoryOK follow memory_check_failure_policy while MemoryLimit is
+// zero; nil means there is no limit to read.
+func SetMemoryLimitError(err error) {
+	memoryLimitErr = err
+}
+
+// MemoryLimitError returns the error found reading the memory limit, or nil
+func MemoryLimitError() error {
+	return memoryLimitErr
+}
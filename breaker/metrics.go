@@ -0,0 +1,69 @@
+package breaker
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// prometheusContentType is the content type of the Prometheus text exposition format
+const prometheusContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// prometheusLabelEscaper escapes label values for the Prometheus text format
+var prometheusLabelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// PrometheusMetrics renders the key values of status in the Prometheus text exposition
+// format: the state (1 open, 0 closed), the latency percentile, the memory usage and
+// the trip and rejection counters. A non-empty name is added as the breaker label, so
+// that several breakers can be scraped into the same series.
+func PrometheusMetrics(status BreakerStatus, name string) string {
+	labels := ""
+	if name != "" {
+		labels = fmt.Sprintf(`{breaker="%s"}`, prometheusLabelEscaper.Replace(name))
+	}
+
+	state := 0.0
+	if status.Triggered {
+		state = 1
+	}
+
+	var text strings.Builder
+	metric := func(metricName, metricType, help string, value float64) {
+		fmt.Fprintf(&text, "# HELP %s %s\n", metricName, help)
+		fmt.Fprintf(&text, "# TYPE %s %s\n", metricName, metricType)
+		fmt.Fprintf(&text, "%s%s %s\n", metricName, labels, strconv.FormatFloat(value, 'g', -1, 64))
+	}
+	metric("breaker_state", "gauge", "Whether the circuit breaker is open (1) or closed (0).", state)
+	metric("breaker_latency_percentile_ms", "gauge", "Configured latency percentile of the recent operations, in milliseconds.",
+		float64(status.CurrentPercentile))
+	metric("breaker_memory_usage_percent", "gauge", "Memory usage as a percentage of the memory limit (0 without a limit).",
+		status.MemoryUsagePercent)
+	metric("breaker_trips_total", "counter", "Times the circuit breaker went from closed to open.", float64(status.TripsTotal))
+	metric("breaker_rejected_total", "counter", "Requests denied by the circuit breaker.", float64(status.RejectedTotal))
+	return text.String()
+}
+
+// GetMetrics returns the key values of /breaker/status in the Prometheus text exposition
+// format, so that the breaker can be scraped without registering a collector
+func (b *BreakerAPI) GetMetrics(ctx *gin.Context) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	driver, ok := b.Driver.(*BreakerDriver)
+	if !ok {
+		// Other breakers only report their state
+		status := BreakerStatus{Triggered: b.Driver.Triggered()}
+		ctx.Data(http.StatusOK, prometheusContentType, []byte(PrometheusMetrics(status, "")))
+		return
+	}
+
+	driver.mu.Lock()
+	status := driver.breakerStatus(MemoryUnitsMB)
+	name := driver.config.Name
+	driver.mu.Unlock()
+
+	ctx.Data(http.StatusOK, prometheusContentType, []byte(PrometheusMetrics(status, name)))
+}
@@ -0,0 +1,210 @@
+package breaker
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"text/template"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DefaultRejectionStatus is the status code of the requests rejected by BreakerMiddleware
+const DefaultRejectionStatus = http.StatusServiceUnavailable
+
+// DefaultRejectionBody is the body of the requests rejected by BreakerMiddleware
+const DefaultRejectionBody = `{"error":"Service unavailable - Circuit breaker is OPEN","breaker_triggered":true,"suggestion":"Wait for circuit breaker to reset"}`
+
+// defaultRejectionContentType is the content type of DefaultRejectionBody
+const defaultRejectionContentType = "application/json; charset=utf-8"
+
+// RejectionData is the data available to the rejection body template
+type RejectionData struct {
+	Status     int    // Status code of the response
+	TripReason string // Why the breaker is open (see TripReason), empty if unknown
+	Path       string // Path of the rejected request
+	Method     string // Method of the rejected request
+}
+
+// MiddlewareOption customizes BreakerMiddleware
+type MiddlewareOption func(options *middlewareOptions)
+
+type middlewareOptions struct {
+	status      int
+	body        string
+	contentType string
+	skipper     Skipper
+	exemptPaths map[string]bool
+	latency     LatencyMode
+}
+
+// LatencyMode selects what BreakerMiddleware reports as the latency of a request
+type LatencyMode int
+
+const (
+	// LatencyTotal is the time the handlers take to complete the request (the default)
+	LatencyTotal LatencyMode = iota
+	// LatencyTTFB is the time to first byte: until the response headers or the first
+	// bytes of the body are sent. It suits streaming endpoints, whose total time depends
+	// on how long the stream lasts rather than on the health of the service.
+	LatencyTTFB
+)
+
+// WithLatencyMode sets what is reported as the latency of a request, LatencyTotal by
+// default
+func WithLatencyMode(mode LatencyMode) MiddlewareOption {
+	return func(options *middlewareOptions) {
+		options.latency = mode
+	}
+}
+
+// ttfbWriter records when the first byte of the response is sent
+type ttfbWriter struct {
+	gin.ResponseWriter
+	firstByte time.Time
+}
+
+func (w *ttfbWriter) mark() {
+	if w.firstByte.IsZero() {
+		w.firstByte = time.Now()
+	}
+}
+
+func (w *ttfbWriter) Write(data []byte) (int, error) {
+	w.mark()
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *ttfbWriter) WriteString(s string) (int, error) {
+	w.mark()
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *ttfbWriter) WriteHeaderNow() {
+	w.mark()
+	w.ResponseWriter.WriteHeaderNow()
+}
+
+func (w *ttfbWriter) Flush() {
+	w.mark()
+	w.ResponseWriter.Flush()
+}
+
+// Skipper reports whether a request bypasses the breaker: it is neither rejected nor
+// recorded
+type Skipper func(ctx *gin.Context) bool
+
+// DefaultSkipper is the Skipper of BreakerMiddleware unless WithSkipper replaces it. It
+// skips OPTIONS requests (CORS preflights), which say nothing about the protected service.
+func DefaultSkipper(ctx *gin.Context) bool {
+	return ctx.Request.Method == http.MethodOptions
+}
+
+// WithSkipper replaces DefaultSkipper; a skipper that should still skip OPTIONS requests
+// can call it. A nil skipper skips nothing.
+func WithSkipper(skipper Skipper) MiddlewareOption {
+	return func(options *middlewareOptions) {
+		options.skipper = skipper
+	}
+}
+
+// WithExemptPaths makes requests to the given paths (e.g. "/health") bypass the breaker,
+// in addition to those of the skipper. A path matches the request path or the route
+// pattern (e.g. "/users/:id").
+func WithExemptPaths(paths ...string) MiddlewareOption {
+	return func(options *middlewareOptions) {
+		for _, path := range paths {
+			options.exemptPaths[path] = true
+		}
+	}
+}
+
+// WithRejectionStatus sets the status code of rejected requests, e.g. 429 for clients
+// that expect Too Many Requests
+func WithRejectionStatus(status int) MiddlewareOption {
+	return func(options *middlewareOptions) {
+		options.status = status
+	}
+}
+
+// WithRejectionBody sets the body of rejected requests, a text/template rendered with
+// RejectionData, and its content type. An invalid template is logged and the default
+// body is used instead.
+func WithRejectionBody(body, contentType string) MiddlewareOption {
+	return func(options *middlewareOptions) {
+		options.body = body
+		options.contentType = contentType
+	}
+}
+
+// BreakerMiddleware returns a gin middleware that rejects requests while the breaker
+// does not allow them and reports the latency and status code of the others (see
+// DoneWithStatus). Rejected requests get DefaultRejectionStatus and DefaultRejectionBody
+// unless the options change them, so that the response matches the API's error contract.
+// Requests skipped by the Skipper (OPTIONS by default) or to exempt paths bypass the
+// breaker. WithLatencyMode(LatencyTTFB) reports the time to first byte instead of the
+// total time.
+func BreakerMiddleware(b Breaker, options ...MiddlewareOption) gin.HandlerFunc {
+	opts := middlewareOptions{
+		status:      DefaultRejectionStatus,
+		body:        DefaultRejectionBody,
+		contentType: defaultRejectionContentType,
+		skipper:     DefaultSkipper,
+		exemptPaths: make(map[string]bool),
+	}
+	for _, option := range options {
+		option(&opts)
+	}
+
+	body, err := template.New("rejection").Parse(opts.body)
+	if err != nil {
+		log.Printf("Warning: invalid rejection body template, using the default body: %v", err)
+		body = template.Must(template.New("rejection").Parse(DefaultRejectionBody))
+		opts.contentType = defaultRejectionContentType
+	}
+
+	return func(ctx *gin.Context) {
+		if opts.exemptPaths[ctx.Request.URL.Path] || opts.exemptPaths[ctx.FullPath()] ||
+			(opts.skipper != nil && opts.skipper(ctx)) {
+			ctx.Next()
+			return
+		}
+
+		if !b.AllowCtx(ctx.Request.Context()) {
+			data := RejectionData{
+				Status:     opts.status,
+				TripReason: b.TripReason(),
+				Path:       ctx.Request.URL.Path,
+				Method:     ctx.Request.Method,
+			}
+
+			var rendered bytes.Buffer
+			if err := body.Execute(&rendered, data); err != nil {
+				log.Printf("Warning: rejection body template failed: %v", err)
+			}
+			ctx.Data(opts.status, opts.contentType, rendered.Bytes())
+			ctx.Abort()
+			return
+		}
+
+		startTime := time.Now()
+		if opts.latency != LatencyTTFB {
+			ctx.Next()
+			b.DoneWithStatus(startTime, time.Now(), ctx.Writer.Status())
+			return
+		}
+
+		writer := &ttfbWriter{ResponseWriter: ctx.Writer}
+		ctx.Writer = writer
+		ctx.Next()
+		ctx.Writer = writer.ResponseWriter
+
+		endTime := writer.firstByte
+		if endTime.IsZero() {
+			// Nothing was sent by the handlers
+			endTime = time.Now()
+		}
+		b.DoneWithStatus(startTime, endTime, writer.Status())
+	}
+}
@@ -0,0 +1,225 @@
+package breaker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/opsgenie/opsgenie-go-sdk-v2/alert"
+)
+
+// Alert is an alert built by the OpsGenieClient Send*Alert methods, independent of where
+// it is delivered
+type Alert struct {
+	Type        string            // circuit-open, circuit-reset, circuit-stuck-open, memory-threshold, latency-threshold, ...
+	Message     string            // Rendered message (see message_templates)
+	Description string            // Enhanced description with the API and contact information
+	Alias       string            // Deduplication key of the alert
+	Priority    string            // P1-P5
+	Source      string            // Source of the alert
+	Tags        []string          // Tags, including the mandatory fields
+	Details     map[string]string // Details, including the mandatory fields
+	Time        time.Time         // When the alert was sent
+}
+
+// Notifier delivers alerts somewhere else than OpsGenie. An OpsGenieClient with a notifier
+// (see SetNotifier) builds its alerts as usual, with the same cooldowns and validations,
+// but hands them to the notifier instead of calling the OpsGenie API. Implementations
+// must be safe for concurrent use.
+type Notifier interface {
+	Notify(ctx context.Context, alert Alert) error
+}
+
+// RecordingNotifier keeps the alerts it is given in memory instead of delivering them,
+// so tests can assert on the alerts that would have been sent
+type RecordingNotifier struct {
+	mu     sync.Mutex
+	alerts []Alert
+}
+
+// NewRecordingNotifier returns a notifier with no recorded alerts
+func NewRecordingNotifier() *RecordingNotifier {
+	return &RecordingNotifier{}
+}
+
+// Notify records the alert
+func (r *RecordingNotifier) Notify(_ context.Context, alert Alert) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.alerts = append(r.alerts, alert)
+	return nil
+}
+
+// RecordedAlerts returns the alerts recorded so far, oldest first
+func (r *RecordingNotifier) RecordedAlerts() []Alert {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Alert(nil), r.alerts...)
+}
+
+// Reset forgets the recorded alerts
+func (r *RecordingNotifier) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.alerts = nil
+}
+
+// FallbackNotifier delivers each alert to the first of its notifiers that accepts it:
+// they are tried in order, every failure is logged and the first success wins
+type FallbackNotifier struct {
+	notifiers []Notifier
+}
+
+// NewFallbackNotifier returns a notifier that tries notifiers in order. Nil notifiers
+// are skipped.
+func NewFallbackNotifier(notifiers ...Notifier) *FallbackNotifier {
+	fallback := &FallbackNotifier{}
+	for _, notifier := range notifiers {
+		if notifier != nil {
+			fallback.notifiers = append(fallback.notifiers, notifier)
+		}
+	}
+	return fallback
+}
+
+// Notify gives the alert to the notifiers in order until one of them succeeds, and
+// returns the failures of all of them when none does
+func (f *FallbackNotifier) Notify(ctx context.Context, alert Alert) error {
+	if len(f.notifiers) == 0 {
+		return errors.New("fallback notifier has no notifiers")
+	}
+
+	var failures []error
+	for i, notifier := range f.notifiers {
+		err := notifier.Notify(ctx, alert)
+		if err == nil {
+			return nil
+		}
+		log.Printf("Notifier %d of %d (%T) failed to deliver the %s alert: %v", i+1, len(f.notifiers), notifier, alert.Type, err)
+		failures = append(failures, fmt.Errorf("notifier %d (%T): %w", i+1, notifier, err))
+	}
+	return errors.Join(failures...)
+}
+
+// testModeNotifier records the alerts of every client while test mode is on
+var testModeNotifier atomic.Pointer[RecordingNotifier]
+
+// SetTestMode turns test mode on (true) or off (false) for every OpsGenie client in the
+// process. In test mode, clients do not need an API key and never call OpsGenie: the
+// alerts they would have sent are recorded and returned by RecordedAlerts. Turning it on
+// starts a new recording. Meant for integration tests and staging.
+func SetTestMode(enabled bool) {
+	if !enabled {
+		if testModeNotifier.Swap(nil) != nil {
+			log.Printf("OpsGenie test mode disabled")
+		}
+		return
+	}
+	testModeNotifier.Store(NewRecordingNotifier())
+	log.Printf("OpsGenie test mode enabled: alerts are recorded instead of sent")
+}
+
+// IsTestMode reports whether test mode is on (see SetTestMode)
+func IsTestMode() bool {
+	return testModeNotifier.Load() != nil
+}
+
+// RecordedAlerts returns the alerts recorded since test mode was turned on, or nil when
+// it is off
+func RecordedAlerts() []Alert {
+	if recorder := testModeNotifier.Load(); recorder != nil {
+		return recorder.RecordedAlerts()
+	}
+	return nil
+}
+
+// SetNotifier makes the client deliver its alerts to notifier instead of OpsGenie. A
+// client with a notifier does not need to be initialized with an API key. A nil notifier
+// restores delivery to OpsGenie.
+func (o *OpsGenieClient) SetNotifier(notifier Notifier) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	o.notifier = notifier
+}
+
+// SetFallbackNotifier sets the notifier, typically a FallbackNotifier, that receives the
+// alerts OpsGenie failed to create, so that they are not lost when OpsGenie is down. A
+// nil notifier only logs the failures.
+func (o *OpsGenieClient) SetFallbackNotifier(notifier Notifier) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	o.fallbackNotifier = notifier
+}
+
+// activeNotifier returns the notifier that receives the alerts of the client: the test
+// mode recorder, the notifier set with SetNotifier, or nil to use OpsGenie
+func (o *OpsGenieClient) activeNotifier() Notifier {
+	if recorder := testModeNotifier.Load(); recorder != nil {
+		return recorder
+	}
+
+	o.mutex.RLock()
+	defer o.mutex.RUnlock()
+	return o.notifier
+}
+
+// createAlert sends the alert to the active notifier, or creates it in OpsGenie, and
+// returns the request ID to log. Alerts OpsGenie failed to create go to the fallback
+// notifier, if any.
+func (o *OpsGenieClient) createAlert(ctx context.Context, alertType string, req *alert.CreateAlertRequest) (string, error) {
+	notifier := o.activeNotifier()
+	if notifier == nil {
+		alertClient := o.currentAlertClient()
+		if alertClient == nil {
+			return "", fmt.Errorf("OpsGenie client not initialized")
+		}
+		resp, err := alertClient.Create(ctx, req)
+		if err == nil {
+			return resp.RequestId, nil
+		}
+
+		o.mutex.RLock()
+		fallback := o.fallbackNotifier
+		o.mutex.RUnlock()
+		if fallback == nil {
+			return "", err
+		}
+
+		log.Printf("OpsGenie failed to create the %s alert, sending it to the fallback notifier: %v", alertType, err)
+		// The OpsGenie request may have used up the deadline of ctx
+		fallbackCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), opsGenieRequestTimeout)
+		defer cancel()
+		if fallbackErr := fallback.Notify(fallbackCtx, newAlert(alertType, req)); fallbackErr != nil {
+			return "", errors.Join(err, fallbackErr)
+		}
+		return "fallback", nil
+	}
+
+	if err := notifier.Notify(ctx, newAlert(alertType, req)); err != nil {
+		return "", err
+	}
+	return "notifier", nil
+}
+
+// newAlert returns the Alert given to a notifier for an OpsGenie alert request
+func newAlert(alertType string, req *alert.CreateAlertRequest) Alert {
+	details := make(map[string]string, len(req.Details))
+	for key, value := range req.Details {
+		details[key] = value
+	}
+	return Alert{
+		Type:        alertType,
+		Message:     req.Message,
+		Description: req.Description,
+		Alias:       req.Alias,
+		Priority:    string(req.Priority),
+		Source:      req.Source,
+		Tags:        append([]string(nil), req.Tags...),
+		Details:     details,
+		Time:        time.Now(),
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"log"
 	"os"
 	"runtime"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -56,8 +57,8 @@ func GetOpsGenieClient(config *OpsGenieConfig) *OpsGenieClient {
 
 	needsNew := opsgenieClientInstance == nil
 
-	if !needsNew && opsgenieClientInstance.config != nil {
-		if opsgenieClientInstance.config.AlertCooldownSeconds != config.AlertCooldownSeconds {
+	if current := opsgenieClientInstance.currentConfig(); !needsNew && current != nil {
+		if current.AlertCooldownSeconds != config.AlertCooldownSeconds {
 			log.Printf("OpsGenie configuration has changed, recreating client")
 			needsNew = true
 		}
@@ -74,17 +75,48 @@ func GetOpsGenieClient(config *OpsGenieConfig) *OpsGenieClient {
 	return opsgenieClientInstance
 }
 
+// ResetOpsGenieClient forgets the singleton instance, so the next GetOpsGenieClient
+// creates and initializes a client from its configuration. Meant for tests, which need a
+// client that reads the API key and URL they set.
+func ResetOpsGenieClient() {
+	opsgenieClientMutex.Lock()
+	defer opsgenieClientMutex.Unlock()
+	opsgenieClientInstance = nil
+}
+
 // OpsGenieClient wraps the OpsGenie SDK client and provides methods to interact with OpsGenie
 type OpsGenieClient struct {
-	config        *OpsGenieConfig
+	config        *OpsGenieConfig // Swapped as a whole by setConfig; read it with currentConfig
+	configMutex   sync.RWMutex
 	alertClient   *alert.Client
 	lastAlertTime map[string]time.Time
 	alertSent     map[string]bool
+	lastAlias     map[string]string // Alias of the last alert created for each alert type
 	mutex         sync.RWMutex
 	initialized   bool
 	environment   Environment
+
+	missingFieldsHook MissingFieldsHook // Notified when an alert is sent with fallback mandatory fields
+	notifier          Notifier          // Receives the alerts instead of OpsGenie when set (see SetNotifier)
+
+	connectivityNotifier Notifier      // Told when OpsGenie becomes unreachable or reachable again
+	fallbackNotifier     Notifier      // Receives the alerts OpsGenie failed to create (see SetFallbackNotifier)
+	unreachable          bool          // The last connectivity check failed
+	connectivityUsers    int           // Breakers using the connectivity check
+	stopConnectivity     chan struct{} // Stops the connectivity check
+	connectivityDone     chan struct{} // Closed when the connectivity check returns
+
+	clock Clock // Measures the cooldowns; nil means RealClock (see SetClock)
+
+	aggregatedTrips  []AggregatedTrip // Trips of the current aggregation window (see alert_aggregation_seconds)
+	aggregationTimer *time.Timer      // Ends the current aggregation window, nil if none
 }
 
+// MissingFieldsHook is called when an alert is about to be sent while some mandatory
+// fields (e.g. "Team", "BookmakerId") could not be resolved and hold a fallback value
+// such as "unknown" or "unknown-team". It runs synchronously on the sending goroutine.
+type MissingFieldsHook func(alertType string, fields []string)
+
 // NewOpsGenieClient creates a new OpsGenie client with the given configuration
 func NewOpsGenieClient(config *OpsGenieConfig) *OpsGenieClient {
 	if config == nil {
@@ -95,12 +127,41 @@ func NewOpsGenieClient(config *OpsGenieConfig) *OpsGenieClient {
 		config:        config,
 		lastAlertTime: make(map[string]time.Time),
 		alertSent:     make(map[string]bool),
+		lastAlias:     make(map[string]string),
+	}
+}
+
+// currentConfig returns the configuration the client is running with. Callers must not
+// modify it: setConfig replaces it as a whole instead.
+func (o *OpsGenieClient) currentConfig() *OpsGenieConfig {
+	if o == nil {
+		return nil
 	}
+	o.configMutex.RLock()
+	defer o.configMutex.RUnlock()
+	return o.config
+}
+
+// setConfig makes the client send its next alerts with config, which must not be
+// modified afterwards. Alerts being sent keep the configuration they started with.
+func (o *OpsGenieClient) setConfig(config *OpsGenieConfig) {
+	o.configMutex.Lock()
+	defer o.configMutex.Unlock()
+	o.config = config
+}
+
+// opsGenieRequestTimeout bounds every OpsGenie API request
+const opsGenieRequestTimeout = 10 * time.Second
+
+// sdkAPIURL converts an API URL to the host the SDK expects. The SDK adds the scheme
+// itself: https, or http for hosts without "api" in their name, like a local fake.
+func sdkAPIURL(apiUrl string) client.ApiUrl {
+	return client.ApiUrl(strings.TrimPrefix(strings.TrimPrefix(apiUrl, "https://"), "http://"))
 }
 
 // ValidateMandatoryFields validates that all mandatory fields are present and valid
 func (o *OpsGenieClient) ValidateMandatoryFields() *MandatoryFieldsValidationError {
-	if o == nil || o.config == nil {
+	if o == nil || o.currentConfig() == nil {
 		return &MandatoryFieldsValidationError{
 			MissingFields: []string{"config"},
 		}
@@ -110,7 +171,7 @@ func (o *OpsGenieClient) ValidateMandatoryFields() *MandatoryFieldsValidationErr
 	invalidFields := make(map[string]string)
 
 	// Validate Team
-	if o.getTeamNameWithFallback() == "unknown-team" || o.config.Team == "" {
+	if o.getTeamNameWithFallback() == "unknown-team" || o.currentConfig().Team == "" {
 		missingFields = append(missingFields, "team")
 	}
 
@@ -160,12 +221,12 @@ func (o *OpsGenieClient) ValidateMandatoryFields() *MandatoryFieldsValidationErr
 
 // Enhanced getter methods with better fallbacks
 func (o *OpsGenieClient) getTeamNameWithFallback() string {
-	if o == nil || o.config == nil {
+	if o == nil || o.currentConfig() == nil {
 		return "unknown-team"
 	}
 
-	if o.config.Team != "" {
-		return o.config.Team
+	if o.currentConfig().Team != "" {
+		return o.currentConfig().Team
 	}
 
 	if envTeam := os.Getenv("OPSGENIE_TEAM"); envTeam != "" {
@@ -176,13 +237,13 @@ func (o *OpsGenieClient) getTeamNameWithFallback() string {
 }
 
 func (o *OpsGenieClient) getEnvironmentWithFallback() string {
-	if o == nil || o.config == nil {
+	if o == nil || o.currentConfig() == nil {
 		return "unknown"
 	}
 
 	// Priority order with better fallbacks
-	if o.config.Environment != "" {
-		return strings.ToUpper(o.config.Environment)
+	if o.currentConfig().Environment != "" {
+		return strings.ToUpper(o.currentConfig().Environment)
 	}
 
 	// Check for the specific "Environment" environment variable
@@ -195,8 +256,8 @@ func (o *OpsGenieClient) getEnvironmentWithFallback() string {
 		return strings.ToUpper(envVar)
 	}
 
-	if o.config.APINamespace != "" {
-		return strings.ToUpper(o.config.APINamespace)
+	if o.currentConfig().APINamespace != "" {
+		return strings.ToUpper(o.currentConfig().APINamespace)
 	}
 
 	// Try to detect from hostname patterns
@@ -216,46 +277,51 @@ func (o *OpsGenieClient) getEnvironmentWithFallback() string {
 }
 
 func (o *OpsGenieClient) getBookmakerIDWithFallback() string {
-	if o == nil || o.config == nil {
+	if o == nil || o.currentConfig() == nil {
 		return "unknown"
 	}
 
 	// Priority order with environment variable fallbacks
-	if o.config.BookmakerID != "" {
-		return o.config.BookmakerID
+	if bookmakerID := o.currentConfig().EffectiveBookmakerID(); bookmakerID != "" {
+		return bookmakerID
+	}
+
+	if bookmakerID := bookmakerIDFromEnv(); bookmakerID != "" {
+		return bookmakerID
 	}
 
-	if o.config.ProjectID != "" {
-		return o.config.ProjectID
+	// Use API name as fallback
+	if o.currentConfig().APIName != "" {
+		return o.currentConfig().APIName
 	}
 
+	return "unknown"
+}
+
+// bookmakerIDFromEnv returns the bookmaker ID given by the environment, or an empty
+// string
+func bookmakerIDFromEnv() string {
 	// Try multiple environment variables
 	for _, envVar := range []string{"BOOKMAKER_ID", "PROJECT_ID", "CLIENT_ID", "SERVICE_ID"} {
 		if value := os.Getenv(envVar); value != "" {
 			return value
 		}
 	}
-
-	// Use API name as fallback
-	if o.config.APIName != "" {
-		return o.config.APIName
-	}
-
-	return "unknown"
+	return ""
 }
 
 func (o *OpsGenieClient) getHostnameWithFallback() string {
-	if o == nil || o.config == nil {
+	if o == nil || o.currentConfig() == nil {
 		return "unknown"
 	}
 
 	// Priority order with multiple fallbacks
-	if o.config.HostOverride != "" {
-		return o.config.HostOverride
+	if o.currentConfig().HostOverride != "" {
+		return o.currentConfig().HostOverride
 	}
 
-	if o.config.Hostname != "" {
-		return o.config.Hostname
+	if o.currentConfig().Hostname != "" {
+		return o.currentConfig().Hostname
 	}
 
 	// Try multiple environment variables
@@ -270,27 +336,25 @@ func (o *OpsGenieClient) getHostnameWithFallback() string {
 		return hostname
 	}
 
-	// Last resort - try to get from /etc/hostname
-	if data, err := os.ReadFile("/etc/hostname"); err == nil {
-		if hostname := strings.TrimSpace(string(data)); hostname != "" {
-			return hostname
-		}
+	// Last resort - /etc/hostname, or COMPUTERNAME on Windows
+	if hostname := platformHostname(); hostname != "" {
+		return hostname
 	}
 
 	return "unknown"
 }
 
 func (o *OpsGenieClient) getBusinessWithFallback() string {
-	if o == nil || o.config == nil {
+	if o == nil || o.currentConfig() == nil {
 		return "internal" // Safe default
 	}
 
-	if o.config.Business != "" {
-		return o.config.Business
+	if o.currentConfig().Business != "" {
+		return o.currentConfig().Business
 	}
 
-	if o.config.BusinessUnit != "" {
-		return o.config.BusinessUnit
+	if o.currentConfig().BusinessUnit != "" {
+		return o.currentConfig().BusinessUnit
 	}
 
 	// Try environment variables
@@ -304,27 +368,112 @@ func (o *OpsGenieClient) getBusinessWithFallback() string {
 }
 
 func (o *OpsGenieClient) getAdditionalContext() string {
-	if o == nil || o.config == nil {
+	if o == nil || o.currentConfig() == nil {
 		return ""
 	}
-	return o.config.AdditionalContext
+	return o.currentConfig().AdditionalContext
 }
 
 func (o *OpsGenieClient) getSourceWithFallback() string {
-	if o == nil || o.config == nil {
-		return "go-breaker"
+	if o == nil || o.currentConfig() == nil {
+		return defaultAlertSource
 	}
 
-	if o.config.Source != "" {
-		return o.config.Source
+	if o.currentConfig().Source != "" {
+		return o.currentConfig().Source
 	}
 
-	return "go-breaker"
+	return defaultAlertSource
+}
+
+// defaultAlertSource is the source of the alerts when source is not set
+const defaultAlertSource = "go-breaker"
+
+// isFallbackValue reports whether a mandatory field value is a fallback for an unresolved field
+func isFallbackValue(value string) bool {
+	return value == "" || value == "unknown" || value == "unknown-team"
+}
+
+// SetMissingFieldsHook installs the hook notified when alerts are sent with unresolved
+// mandatory fields; nil removes it
+func (o *OpsGenieClient) SetMissingFieldsHook(hook MissingFieldsHook) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	o.missingFieldsHook = hook
+}
+
+// CheckMandatoryFields returns, sorted, the mandatory fields that currently resolve to a
+// fallback value, and reports them to the missing fields hook along with alertType.
+// It is run on every alert sent, because fields taken from environment variables can
+// disappear after ValidateMandatoryFields ran at initialization.
+func (o *OpsGenieClient) CheckMandatoryFields(alertType string) []string {
+	return o.checkMandatoryFields(alertType, o.buildMandatoryFieldsWithFallbacks())
+}
+
+// checkMandatoryFields is CheckMandatoryFields on already built mandatory fields
+func (o *OpsGenieClient) checkMandatoryFields(alertType string, mandatoryFields map[string]string) []string {
+	var missing []string
+	for field, value := range mandatoryFields {
+		if isFallbackValue(value) {
+			missing = append(missing, field)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	sort.Strings(missing)
+
+	log.Printf("WARNING: Sending %s alert with unresolved mandatory fields %v; check the OpsGenie configuration and environment variables",
+		alertType, missing)
+
+	o.mutex.RLock()
+	hook := o.missingFieldsHook
+	o.mutex.RUnlock()
+
+	if hook != nil {
+		hook(alertType, missing)
+	}
+	return missing
+}
+
+// mandatoryFieldOrder is the order in which the mandatory fields are logged and reported
+var mandatoryFieldOrder = []string{"Team", "Environment", "BookmakerId", "Host", "Business", "AdditionalContext"}
+
+// mandatoryFieldValues holds the mandatory fields by name. Unlike a plain map, it is
+// printed and iterated (see names) in mandatoryFieldOrder, so logs and reports are stable.
+type mandatoryFieldValues map[string]string
+
+// names returns the names of the fields in mandatoryFieldOrder, followed by any others
+// in alphabetical order
+func (f mandatoryFieldValues) names() []string {
+	names := make([]string, 0, len(f))
+	known := make(map[string]bool, len(mandatoryFieldOrder))
+	for _, name := range mandatoryFieldOrder {
+		known[name] = true
+		if _, exists := f[name]; exists {
+			names = append(names, name)
+		}
+	}
+	for _, name := range sortedKeys(f) {
+		if !known[name] {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// String formats the fields as [Team:<team> Environment:<environment> ...]
+func (f mandatoryFieldValues) String() string {
+	fields := make([]string, 0, len(f))
+	for _, name := range f.names() {
+		fields = append(fields, name+":"+f[name])
+	}
+	return "[" + strings.Join(fields, " ") + "]"
 }
 
 // buildMandatoryFieldsWithFallbacks creates mandatory fields with intelligent fallbacks
-func (o *OpsGenieClient) buildMandatoryFieldsWithFallbacks() map[string]string {
-	fields := map[string]string{
+func (o *OpsGenieClient) buildMandatoryFieldsWithFallbacks() mandatoryFieldValues {
+	fields := mandatoryFieldValues{
 		"Team":        o.getTeamNameWithFallback(),
 		"Environment": o.getEnvironmentWithFallback(),
 		"BookmakerId": o.getBookmakerIDWithFallback(),
@@ -347,7 +496,7 @@ func (o *OpsGenieClient) Initialize() error {
 	}
 
 	// If it is disabled, do nothing
-	if o.config == nil || !o.config.Enabled {
+	if o.currentConfig() == nil || !o.currentConfig().Enabled {
 		log.Printf("OpsGenie client is disabled, skipping initialization")
 		return nil // Return without error but without initializing
 	}
@@ -359,19 +508,21 @@ func (o *OpsGenieClient) Initialize() error {
 	}
 
 	o.validateTagsConfiguration()
+	warnSharedAlertIdentifier(o.currentConfig())
 
 	// Log current mandatory fields status
 	mandatoryFields := o.buildMandatoryFieldsWithFallbacks()
 	log.Printf("OpsGenie initialized with mandatory fields: %+v", mandatoryFields)
 
-	// First check for API key in environment variables
-	apiKey := os.Getenv(EnvOpsGenieAPIKey)
-	if apiKey == "" {
-		apiKey = o.config.APIKey
-		if apiKey == "" {
-			return fmt.Errorf("OpsGenie API key not found in environment or config")
-		}
-		log.Println("Warning: Using OpsGenie API key from config file. For security, consider using the OPSGENIE_API_KEY environment variable instead.")
+	// Alerts are recorded in test mode, so there is no API to connect to
+	if IsTestMode() {
+		log.Printf("OpsGenie test mode enabled, skipping the API connection")
+		return nil
+	}
+
+	apiKey, err := o.resolveAPIKey()
+	if err != nil {
+		return err
 	}
 
 	// Set up the client configuration
@@ -380,7 +531,7 @@ func (o *OpsGenieClient) Initialize() error {
 	// Check for region in environment
 	region := os.Getenv(EnvOpsGenieRegion)
 	if region == "" {
-		region = o.config.Region
+		region = o.currentConfig().Region
 	}
 
 	// Set the API URL based on region
@@ -393,83 +544,234 @@ func (o *OpsGenieClient) Initialize() error {
 	customURL := os.Getenv(EnvOpsGenieAPIURL)
 	if customURL != "" {
 		apiUrl = customURL
-	} else if o.config.APIURL != "" {
-		apiUrl = o.config.APIURL
+	} else if o.currentConfig().APIURL != "" {
+		apiUrl = o.currentConfig().APIURL
 	}
 
 	log.Printf("Using OpsGenie API URL: %s", apiUrl)
 
+	cfg.OpsGenieAPIURL = sdkAPIURL(apiUrl)
+
 	// Create the alert client
 	alertClient, err := alert.NewClient(cfg)
 	if err != nil {
 		return fmt.Errorf("failed to create OpsGenie alert client: %v", err)
 	}
 
-	o.alertClient = alertClient
-
-	// Test the connection to validate API key
-	err = o.TestConnection()
+	// Test the connection to validate API key. The new client is only installed when it
+	// works, so a failed reinitialization keeps the previous one.
+	err = testConnection(alertClient)
 	if err != nil {
 		return fmt.Errorf("failed to connect to OpsGenie: %v", err)
 	}
 
 	log.Println("Successfully connected to OpsGenie API")
+	o.mutex.Lock()
+	o.alertClient = alertClient
 	o.initialized = true
+	o.mutex.Unlock()
 	return nil
 }
 
+// currentAlertClient returns the SDK client installed by Initialize, nil until it succeeds
+func (o *OpsGenieClient) currentAlertClient() *alert.Client {
+	o.mutex.RLock()
+	defer o.mutex.RUnlock()
+	return o.alertClient
+}
+
+// resolveAPIKey returns the API key, looking first at the OPSGENIE_API_KEY environment
+// variable, then at the file named by api_key_file and finally at the inline api_key
+func (o *OpsGenieClient) resolveAPIKey() (string, error) {
+	if apiKey := strings.TrimSpace(os.Getenv(EnvOpsGenieAPIKey)); apiKey != "" {
+		return apiKey, nil
+	}
+
+	if o.currentConfig().APIKeyFile != "" {
+		data, err := os.ReadFile(o.currentConfig().APIKeyFile)
+		if err != nil {
+			log.Printf("Warning: Could not read OpsGenie API key file %s: %v", o.currentConfig().APIKeyFile, err)
+		} else if apiKey := strings.TrimSpace(string(data)); apiKey != "" {
+			return apiKey, nil
+		} else {
+			log.Printf("Warning: OpsGenie API key file %s is empty", o.currentConfig().APIKeyFile)
+		}
+	}
+
+	if apiKey := strings.TrimSpace(o.currentConfig().APIKey); apiKey != "" {
+		log.Println("Warning: Using OpsGenie API key from config file. For security, consider using the OPSGENIE_API_KEY environment variable or api_key_file instead.")
+		return apiKey, nil
+	}
+
+	return "", fmt.Errorf("OpsGenie API key not found in environment, key file or config")
+}
+
 // getPriorityForEnvironment returns the appropriate priority for the current environment
 func (o *OpsGenieClient) getPriorityForEnvironment() alert.Priority {
-	if o == nil || o.config == nil {
+	if o == nil || o.currentConfig() == nil {
 		return alert.P3
 	}
 
-	var priorityStr = o.config.Priority
-
-	if priorityStr == "" {
-		priorityStr = "P3"
-	}
+	return alertPriority(o.EffectivePriority())
+}
 
-	switch priorityStr {
+// alertPriority converts a priority string (P1-P5) to the SDK priority, defaulting to P3
+func alertPriority(priority string) alert.Priority {
+	switch priority {
 	case "P1":
 		return alert.P1
 	case "P2":
 		return alert.P2
-	case "P3":
-		return alert.P3
 	case "P4":
 		return alert.P4
 	case "P5":
 		return alert.P5
 	default:
-		log.Printf("Invalid priority '%s', defaulting to P3", priorityStr)
 		return alert.P3
 	}
 }
 
+// EffectivePriority returns the priority (P1-P5) given to the next alert: the priority
+// of the current environment settings or the global one, capped by the max_priority of
+// the environment so that, for example, dev alerts never page on-call
+func (o *OpsGenieClient) EffectivePriority() string {
+	return o.effectivePriority("")
+}
+
+// effectivePriority is EffectivePriority for an alert type with its own priority, which,
+// when not empty, replaces the environment and global priorities but is still capped
+func (o *OpsGenieClient) effectivePriority(alertTypePriority string) string {
+	return o.scaledPriority("", alertTypePriority, 0)
+}
+
+// scaledPriority is effectivePriority for an alert whose value is magnitude times its
+// threshold, raised by priority_by_magnitude before the environment cap. A basePriority
+// that is not empty replaces the global priority, as the staged alert priorities do.
+func (o *OpsGenieClient) scaledPriority(basePriority, alertTypePriority string, magnitude float64) string {
+	if o == nil || o.currentConfig() == nil {
+		return "P3"
+	}
+
+	var priorityStr = o.currentConfig().Priority
+	if basePriority != "" {
+		priorityStr = basePriority
+	}
+	settings, hasSettings := o.environmentSettings()
+	if hasSettings && settings.Priority != "" {
+		priorityStr = settings.Priority
+	}
+	if alertTypePriority != "" {
+		priorityStr = alertTypePriority
+	}
+
+	if priorityStr == "" {
+		priorityStr = "P3"
+	}
+
+	if !isValidPriority(priorityStr) {
+		log.Printf("Invalid priority '%s', defaulting to P3", priorityStr)
+		priorityStr = "P3"
+	}
+
+	if scaled := o.currentConfig().MagnitudePriority(magnitude); scaled != "" && scaled < priorityStr {
+		log.Printf("Priority %s raised to %s by priority_by_magnitude (%.2fx the threshold)", priorityStr, scaled, magnitude)
+		priorityStr = scaled
+	}
+
+	// P1 is the most severe, so a lower number than the cap is more severe than allowed
+	if hasSettings && isValidPriority(settings.MaxPriority) && priorityStr < settings.MaxPriority {
+		log.Printf("Priority %s capped to %s by max_priority for environment %s",
+			priorityStr, settings.MaxPriority, o.getEnvironmentWithFallback())
+		priorityStr = settings.MaxPriority
+	}
+
+	return priorityStr
+}
+
+// MagnitudePriority returns the most severe priority of priority_by_magnitude whose
+// min_factor magnitude reaches, or an empty string when none does
+func (c *OpsGenieConfig) MagnitudePriority(magnitude float64) string {
+	if c == nil {
+		return ""
+	}
+
+	priority := ""
+	for _, step := range c.PriorityByMagnitude {
+		if isValidPriority(step.Priority) && magnitude >= step.MinFactor && (priority == "" || step.Priority < priority) {
+			priority = step.Priority
+		}
+	}
+	return priority
+}
+
+// breachMagnitude returns how many times value is its threshold, or 0 without a threshold
+func breachMagnitude(value, threshold float64) float64 {
+	if threshold <= 0 {
+		return 0
+	}
+	return value / threshold
+}
+
+// scaleAlertPriority raises the priority of req by priority_by_magnitude when its value
+// is magnitude times its threshold
+func (o *OpsGenieClient) scaleAlertPriority(req *alert.CreateAlertRequest, magnitude float64) {
+	if o.currentConfig().MagnitudePriority(magnitude) != "" {
+		req.Priority = alertPriority(o.scaledPriority("", "", magnitude))
+	}
+}
+
 // TestConnection tests the connection to OpsGenie by listing alerts
 func (o *OpsGenieClient) TestConnection() error {
-	if o == nil || o.alertClient == nil {
+	if o == nil {
 		return fmt.Errorf("OpsGenie client not initialized")
 	}
+	return testConnection(o.currentAlertClient())
+}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+// testConnection lists one alert with alertClient
+func testConnection(alertClient *alert.Client) error {
+	if alertClient == nil {
+		return fmt.Errorf("OpsGenie client not initialized")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), opsGenieRequestTimeout)
 	defer cancel()
 
 	listReq := &alert.ListAlertRequest{
 		Limit: 1,
 	}
 
-	_, err := o.alertClient.List(ctx, listReq)
+	_, err := alertClient.List(ctx, listReq)
 	return err
 }
 
-// IsInitialized returns whether the OpsGenie client has been successfully initialized
+// IsInitialized returns whether the OpsGenie client has been successfully initialized,
+// or has a notifier (or test mode) that takes the place of OpsGenie
 func (o *OpsGenieClient) IsInitialized() bool {
 	if o == nil {
 		return false
 	}
-	return o.initialized
+	o.mutex.RLock()
+	initialized := o.initialized
+	o.mutex.RUnlock()
+	return initialized || o.activeNotifier() != nil
+}
+
+// SetClock makes the client measure the cooldowns with clock; a nil clock restores
+// RealClock. With a MockClock, tests advance the clock instead of waiting for a cooldown
+// to expire.
+func (o *OpsGenieClient) SetClock(clock Clock) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	o.clock = clock
+}
+
+// now returns the current time of the client's clock. It must run in a critical section.
+func (o *OpsGenieClient) now() time.Time {
+	if o.clock == nil {
+		return time.Now()
+	}
+	return o.clock.Now()
 }
 
 // IsOnCooldown checks if an alert type is still in its cooldown period
@@ -479,7 +781,8 @@ func (o *OpsGenieClient) IsOnCooldown(alertType string) bool {
 		return false
 	}
 
-	if o.config.AlertCooldownSeconds <= 0 {
+	cooldownSeconds := o.cooldownSecondsFor(alertType)
+	if cooldownSeconds <= 0 {
 		log.Printf("COOLDOWN CHECK: No cooldown for %s (cooldown disabled)", alertType)
 		return false
 	}
@@ -493,8 +796,8 @@ func (o *OpsGenieClient) IsOnCooldown(alertType string) bool {
 		return false
 	}
 
-	cooldownDuration := time.Duration(o.config.AlertCooldownSeconds) * time.Second
-	now := time.Now()
+	cooldownDuration := time.Duration(cooldownSeconds) * time.Second
+	now := o.now()
 	cooldownEnds := lastAlertTime.Add(cooldownDuration)
 	stillInCooldown := now.Before(cooldownEnds)
 
@@ -508,6 +811,85 @@ func (o *OpsGenieClient) IsOnCooldown(alertType string) bool {
 	return stillInCooldown
 }
 
+// environmentSettings returns the overrides configured for the current environment.
+// Environment keys are matched case-insensitively.
+func (o *OpsGenieClient) environmentSettings() (EnvOpsConfig, bool) {
+	if o == nil || o.currentConfig() == nil || !o.currentConfig().UseEnvironments {
+		return EnvOpsConfig{}, false
+	}
+
+	env := o.getEnvironmentWithFallback()
+	for key, settings := range o.currentConfig().EnvironmentSettings {
+		if strings.EqualFold(key, env) {
+			return settings, true
+		}
+	}
+
+	return EnvOpsConfig{}, false
+}
+
+// isEnabledForEnvironment reports whether alerts should be sent in the current
+// environment. Environments without settings, or whose settings leave out enabled,
+// follow the global enabled.
+func (o *OpsGenieClient) isEnabledForEnvironment() bool {
+	if settings, exists := o.environmentSettings(); exists && settings.Enabled != nil {
+		return *settings.Enabled
+	}
+	return o.currentConfig().Enabled
+}
+
+// configuredTags returns the tags of the current environment, falling back to the global tags
+func (o *OpsGenieClient) configuredTags() []string {
+	if settings, exists := o.environmentSettings(); exists && len(settings.Tags) > 0 {
+		return settings.Tags
+	}
+	return o.currentConfig().Tags
+}
+
+// cooldownAlertTypes maps the alert types to their keys in alert_cooldowns
+var cooldownAlertTypes = map[string]string{
+	"circuit-open":      MessageTemplateOpen,
+	"circuit-reset":     MessageTemplateReset,
+	"memory-threshold":  MessageTemplateMemory,
+	"memory-warning":    MessageTemplateMemoryWarn,
+	"latency-threshold": MessageTemplateLatency,
+}
+
+// isCooldownAlertType reports whether key is a valid alert_cooldowns key
+func isCooldownAlertType(key string) bool {
+	for _, cooldownKey := range cooldownAlertTypes {
+		if key == cooldownKey {
+			return true
+		}
+	}
+	return false
+}
+
+// cooldownType returns the alert_cooldowns key of an alert key (see determineAlertKey)
+// or of a bare alert type, or "" when it is not one of the alert types with a cooldown
+func cooldownType(alertKey string) string {
+	for alertType, cooldownKey := range cooldownAlertTypes {
+		if alertKey == alertType || alertKey == cooldownKey ||
+			strings.HasPrefix(alertKey, alertType+"-") || strings.Contains(alertKey, "-"+alertType+"-") {
+			return cooldownKey
+		}
+	}
+	return ""
+}
+
+// cooldownSecondsFor returns the cooldown of an alert key. The most specific setting
+// wins: the entry of the alert type in alert_cooldowns, then the cooldown_seconds of the
+// current environment, and then alert_cooldown_seconds.
+func (o *OpsGenieClient) cooldownSecondsFor(alertKey string) int {
+	if seconds := o.currentConfig().AlertCooldowns[cooldownType(alertKey)]; seconds > 0 {
+		return seconds
+	}
+	if settings, exists := o.environmentSettings(); exists && settings.CooldownSeconds > 0 {
+		return settings.CooldownSeconds
+	}
+	return o.currentConfig().AlertCooldownSeconds
+}
+
 // RecordAlert records when an alert was sent to enforce cooldown periods
 func (o *OpsGenieClient) RecordAlert(alertType string) {
 	if o == nil {
@@ -518,11 +900,149 @@ func (o *OpsGenieClient) RecordAlert(alertType string) {
 	o.mutex.Lock()
 	defer o.mutex.Unlock()
 
-	now := time.Now()
+	now := o.now()
 	o.lastAlertTime[alertType] = now
 	o.alertSent[alertType] = true
 	log.Printf("COOLDOWN START: Recorded alert %s at %v with %d second cooldown",
-		alertType, now.Format(time.RFC3339), o.config.AlertCooldownSeconds)
+		alertType, now.Format(time.RFC3339), o.cooldownSecondsFor(alertType))
+}
+
+// recordAlias remembers the alias of the last alert created for an alert type
+func (o *OpsGenieClient) recordAlias(alertType, alias string) {
+	if o == nil || alias == "" {
+		return
+	}
+
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	o.lastAlias[alertType] = alias
+}
+
+// LastAlias returns the alias of the last alert created for the given alert type
+func (o *OpsGenieClient) LastAlias(alertType string) (string, bool) {
+	if o == nil {
+		return "", false
+	}
+
+	o.mutex.RLock()
+	defer o.mutex.RUnlock()
+	alias, exists := o.lastAlias[alertType]
+	return alias, exists
+}
+
+// CloseAlert closes the alert identified by alias, attaching the given note
+func (o *OpsGenieClient) CloseAlert(alias string, note string) error {
+	if o == nil {
+		return fmt.Errorf("OpsGenieClient is nil")
+	}
+
+	if alias == "" {
+		return fmt.Errorf("alert alias cannot be empty")
+	}
+
+	// Notifiers only receive new alerts
+	if o.activeNotifier() != nil {
+		log.Printf("Not closing alert %s: alerts are delivered to a notifier", alias)
+		o.forgetAlias(alias)
+		return nil
+	}
+
+	alertClient := o.currentAlertClient()
+	if alertClient == nil {
+		return fmt.Errorf("OpsGenie client not initialized")
+	}
+
+	req := &alert.CloseAlertRequest{
+		IdentifierType:  alert.ALIAS,
+		IdentifierValue: alias,
+		Source:          o.getSourceWithFallback(),
+		Note:            note,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), opsGenieRequestTimeout)
+	defer cancel()
+
+	resp, err := alertClient.Close(ctx, req)
+	if err != nil {
+		log.Printf("Error closing OpsGenie alert %s: %v", alias, err)
+		return err
+	}
+
+	// Forget the alias so it is not closed twice
+	o.forgetAlias(alias)
+
+	log.Printf("ALERT CLOSED: OpsGenie alert %s closed. RequestID: %s", alias, resp.RequestId)
+	return nil
+}
+
+// forgetAlias drops alias from the last aliases of the alert types
+func (o *OpsGenieClient) forgetAlias(alias string) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	for alertType, lastAlias := range o.lastAlias {
+		if lastAlias == alias {
+			delete(o.lastAlias, alertType)
+		}
+	}
+}
+
+// AckAlert acknowledges the alert identified by alias, attaching the given note
+func (o *OpsGenieClient) AckAlert(alias, note string) error {
+	if o == nil {
+		return fmt.Errorf("OpsGenieClient is nil")
+	}
+
+	if alias == "" {
+		return fmt.Errorf("alert alias cannot be empty")
+	}
+
+	// Notifiers only receive new alerts
+	if o.activeNotifier() != nil {
+		log.Printf("Not acknowledging alert %s: alerts are delivered to a notifier", alias)
+		return nil
+	}
+
+	alertClient := o.currentAlertClient()
+	if alertClient == nil {
+		return fmt.Errorf("OpsGenie client not initialized")
+	}
+
+	req := &alert.AcknowledgeAlertRequest{
+		IdentifierType:  alert.ALIAS,
+		IdentifierValue: alias,
+		Source:          o.getSourceWithFallback(),
+		Note:            note,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), opsGenieRequestTimeout)
+	defer cancel()
+
+	resp, err := alertClient.Acknowledge(ctx, req)
+	if err != nil {
+		log.Printf("Error acknowledging OpsGenie alert %s: %v", alias, err)
+		return err
+	}
+
+	log.Printf("ALERT ACKNOWLEDGED: OpsGenie alert %s acknowledged. RequestID: %s", alias, resp.RequestId)
+	return nil
+}
+
+// aliasForAlertType returns the alias of the last alert created for alertType,
+// falling back to the deterministic alias used when creating alerts of that type
+func (o *OpsGenieClient) aliasForAlertType(alertType string) string {
+	if alias, exists := o.LastAlias(alertType); exists {
+		return alias
+	}
+	return o.createUniqueAlertIdentifier(alertType)
+}
+
+// CloseLastAlert closes the last alert created for the given alert type, if any
+func (o *OpsGenieClient) CloseLastAlert(alertType string, note string) error {
+	alias, exists := o.LastAlias(alertType)
+	if !exists {
+		return nil
+	}
+	return o.CloseAlert(alias, note)
 }
 
 // hasAlertBeenSent checks if this alert type has been sent before
@@ -545,18 +1065,53 @@ func (o *OpsGenieClient) determineAlertKey(alertType string, details string) str
 
 // getAPIIdentifier gets a string that uniquely identifies the API for alerts
 func (o *OpsGenieClient) getAPIIdentifier() string {
-	if o == nil || o.config == nil {
+	if o == nil || o.currentConfig() == nil {
 		return "unknown-api"
 	}
 
-	if o.config.APIName != "" {
-		if o.config.APINamespace != "" {
-			return fmt.Sprintf("%s/%s", o.config.APINamespace, o.config.APIName)
+	return o.currentConfig().alertIdentifier()
+}
+
+// alertIdentifier identifies the service in the alert aliases: api_namespace/api_name,
+// or the source. The default source is shared by every service that keeps it, so the
+// bookmaker ID, when known, is added to it to keep their aliases apart.
+func (c *OpsGenieConfig) alertIdentifier() string {
+	if c.APIName != "" {
+		if c.APINamespace != "" {
+			return fmt.Sprintf("%s/%s", c.APINamespace, c.APIName)
 		}
-		return o.config.APIName
+		return c.APIName
 	}
 
-	return o.config.Source
+	if c.Source != "" && c.Source != defaultAlertSource {
+		return c.Source
+	}
+	bookmakerID := c.EffectiveBookmakerID()
+	if bookmakerID == "" {
+		bookmakerID = bookmakerIDFromEnv()
+	}
+	if bookmakerID != "" {
+		return fmt.Sprintf("%s/%s", defaultAlertSource, bookmakerID)
+	}
+	return defaultAlertSource
+}
+
+// HasSharedAlertIdentifier reports whether the alerts are identified by the default
+// source alone, because neither api_name, a custom source nor a bookmaker ID is set.
+// Every service in that case creates the same aliases, so OpsGenie deduplicates their
+// alerts into each other's.
+func (c *OpsGenieConfig) HasSharedAlertIdentifier() bool {
+	return c != nil && c.alertIdentifier() == defaultAlertSource
+}
+
+// warnSharedAlertIdentifier logs a warning when the alert aliases are not unique to the
+// service (see HasSharedAlertIdentifier)
+func warnSharedAlertIdentifier(config *OpsGenieConfig) {
+	if config.HasSharedAlertIdentifier() {
+		log.Printf("🚨 WARNING: OpsGenie alerts are identified as %q, like the alerts of every service "+
+			"without api_name, source or bookmaker_id: OpsGenie deduplicates them into each other's alerts. "+
+			"Set api_name to a name unique to this service", defaultAlertSource)
+	}
 }
 
 // processAndValidateTags Process the simple tags and marks those that have no key format: Value
@@ -564,7 +1119,7 @@ func (o *OpsGenieClient) processAndValidateTags(alertType string) []string {
 	var processedTags []string
 
 	//Process configuration tags
-	for _, tag := range o.config.Tags {
+	for _, tag := range o.configuredTags() {
 		processedTag := o.processTag(tag)
 		processedTags = append(processedTags, processedTag)
 	}
@@ -585,12 +1140,12 @@ func (o *OpsGenieClient) processAndValidateTags(alertType string) []string {
 	processedTags = append(processedTags, systemTags...)
 
 	// Add specific service tags if available
-	if o.config.APIName != "" {
-		processedTags = append(processedTags, fmt.Sprintf("Service:%s", o.config.APIName))
+	if o.currentConfig().APIName != "" {
+		processedTags = append(processedTags, fmt.Sprintf("Service:%s", o.currentConfig().APIName))
 	}
 
-	if o.config.ServiceTier != "" {
-		processedTags = append(processedTags, fmt.Sprintf("Tier:%s", o.config.ServiceTier))
+	if o.currentConfig().ServiceTier != "" {
+		processedTags = append(processedTags, fmt.Sprintf("Tier:%s", o.currentConfig().ServiceTier))
 	}
 
 	// Add additional context if available
@@ -603,13 +1158,9 @@ func (o *OpsGenieClient) processAndValidateTags(alertType string) []string {
 
 // processTag Process an individual tag and the brand if it does not have key format: Value
 func (o *OpsGenieClient) processTag(tag string) string {
-	// Verify if the tag has "Key: Value" format
-	if strings.Contains(tag, ":") {
-		parts := strings.SplitN(tag, ":", 2)
-		if len(parts) == 2 && strings.TrimSpace(parts[0]) != "" && strings.TrimSpace(parts[1]) != "" {
-			// Valid Tag with Key format: Value
-			return tag
-		}
+	// Verify if the tag has "Key: Value" format; the value may hold more colons
+	if isValidKeyValueTag(tag) {
+		return tag
 	}
 
 	// Tag without Key format: Value - Mark it
@@ -632,21 +1183,16 @@ func (o *OpsGenieClient) buildEnhancedTags(alertType string) []string {
 
 // validateTagsConfiguration Valida the tag configuration and shows warnings
 func (o *OpsGenieClient) validateTagsConfiguration() {
-	if o == nil || o.config == nil {
+	if o == nil || o.currentConfig() == nil {
 		return
 	}
 
 	var undefinedTags []string
 	var validTags []string
 
-	for _, tag := range o.config.Tags {
-		if strings.Contains(tag, ":") {
-			parts := strings.SplitN(tag, ":", 2)
-			if len(parts) == 2 && strings.TrimSpace(parts[0]) != "" && strings.TrimSpace(parts[1]) != "" {
-				validTags = append(validTags, tag)
-			} else {
-				undefinedTags = append(undefinedTags, tag)
-			}
+	for _, tag := range o.currentConfig().Tags {
+		if isValidKeyValueTag(tag) {
+			validTags = append(validTags, tag)
 		} else {
 			undefinedTags = append(undefinedTags, tag)
 		}
@@ -674,13 +1220,13 @@ func (o *OpsGenieClient) buildEnhancedDetails(alertType string, specificDetails
 	}
 
 	// Add standard API information
-	details["API Name"] = o.config.APIName
-	details["API Version"] = o.config.APIVersion
-	details["API Namespace"] = o.config.APINamespace
-	details["API Owner"] = o.config.APIOwner
-	details["API Priority"] = o.config.APIPriority
+	details["API Name"] = o.currentConfig().APIName
+	details["API Version"] = o.currentConfig().APIVersion
+	details["API Namespace"] = o.currentConfig().APINamespace
+	details["API Owner"] = o.currentConfig().APIOwner
+	details["API Priority"] = o.currentConfig().APIPriority
 	details["Alert Type"] = alertType
-	details["Source"] = o.config.Source
+	details["Source"] = o.currentConfig().Source
 
 	// Add system information
 	details["Go Version"] = runtime.Version()
@@ -690,17 +1236,25 @@ func (o *OpsGenieClient) buildEnhancedDetails(alertType string, specificDetails
 	// Add timestamp
 	details["Alert Timestamp"] = time.Now().UTC().Format(time.RFC3339)
 
+	// Add custom attributes; invalid keys are skipped in case validation was bypassed
+	for key, value := range o.currentConfig().APICustomAttributes {
+		if customAttributeError(key) == "" {
+			details[customAttributePrefix+strings.TrimSpace(key)] = value
+		}
+	}
+
 	// Add specific alert details
 	for key, value := range specificDetails {
 		details[key] = value
 	}
 
+	o.redactDetails(details)
 	return details
 }
 
 // buildEnhancedDescription creates detailed description with all context
 func (o *OpsGenieClient) buildEnhancedDescription() string {
-	if o == nil || o.config == nil {
+	if o == nil || o.currentConfig() == nil {
 		return ""
 	}
 
@@ -739,11 +1293,11 @@ SYSTEM INFORMATION:
 		mandatoryFields["Host"],
 		mandatoryFields["Business"],
 		additionalContextSection,
-		o.config.APIName,
-		o.config.APIVersion,
-		o.config.APINamespace,
-		o.config.APIOwner,
-		o.config.APIPriority,
+		o.currentConfig().APIName,
+		o.currentConfig().APIVersion,
+		o.currentConfig().APINamespace,
+		o.currentConfig().APIOwner,
+		o.currentConfig().APIPriority,
 		mandatoryFields["Host"],
 		runtime.Version(),
 		runtime.GOOS,
@@ -751,36 +1305,36 @@ SYSTEM INFORMATION:
 	)
 
 	// Add dependencies if available
-	if len(o.config.APIDependencies) > 0 {
+	if len(o.currentConfig().APIDependencies) > 0 {
 		description += "\nDEPENDENCIES:\n"
-		for _, dep := range o.config.APIDependencies {
+		for _, dep := range o.currentConfig().APIDependencies {
 			description += fmt.Sprintf("• %s\n", dep)
 		}
 	}
 
 	// Add endpoints if available
-	if len(o.config.APIEndpoints) > 0 {
+	if len(o.currentConfig().APIEndpoints) > 0 {
 		description += "\nPROTECTED ENDPOINTS:\n"
-		for _, endpoint := range o.config.APIEndpoints {
+		for _, endpoint := range o.currentConfig().APIEndpoints {
 			description += fmt.Sprintf("• %s\n", endpoint)
 		}
 	}
 
 	// Add contact information if available
-	if o.config.ContactDetails.PrimaryContact != "" {
+	if o.currentConfig().ContactDetails.PrimaryContact != "" {
 		description += fmt.Sprintf("\nCONTACT INFORMATION:\n")
-		description += fmt.Sprintf("• Primary Contact: %s\n", o.config.ContactDetails.PrimaryContact)
+		description += fmt.Sprintf("• Primary Contact: %s\n", o.currentConfig().ContactDetails.PrimaryContact)
 
-		if o.config.ContactDetails.EscalationTeam != "" {
-			description += fmt.Sprintf("• Escalation Team: %s\n", o.config.ContactDetails.EscalationTeam)
+		if o.currentConfig().ContactDetails.EscalationTeam != "" {
+			description += fmt.Sprintf("• Escalation Team: %s\n", o.currentConfig().ContactDetails.EscalationTeam)
 		}
 
-		if o.config.ContactDetails.SlackChannel != "" {
-			description += fmt.Sprintf("• Slack Channel: %s\n", o.config.ContactDetails.SlackChannel)
+		if o.currentConfig().ContactDetails.SlackChannel != "" {
+			description += fmt.Sprintf("• Slack Channel: %s\n", o.currentConfig().ContactDetails.SlackChannel)
 		}
 	}
 
-	return description
+	return o.redactDescription(description)
 }
 
 // createValidatedAlertRequest creates an alert request with all mandatory fields validated
@@ -791,8 +1345,9 @@ func (o *OpsGenieClient) createValidatedAlertRequest(alertType, message, descrip
 		// Continue with warning but use fallback values
 	}
 
-	// Build mandatory fields (with fallbacks)
+	// Build mandatory fields (with fallbacks) and report the ones that fell back
 	mandatoryFields := o.buildMandatoryFieldsWithFallbacks()
+	o.checkMandatoryFields(alertType, mandatoryFields)
 
 	// Build enhanced tags
 	tags := o.buildEnhancedTags(alertType)
@@ -803,10 +1358,10 @@ func (o *OpsGenieClient) createValidatedAlertRequest(alertType, message, descrip
 	// Get priority
 	priority := o.getPriorityForEnvironment()
 
-	// Create the alert request
+	// Create the alert request; the description may add lines to buildEnhancedDescription
 	req := &alert.CreateAlertRequest{
 		Message:     message,
-		Description: description,
+		Description: o.redactDescription(description),
 		Alias:       o.createUniqueAlertIdentifier(alertType),
 		Source:      o.getSourceWithFallback(),
 		Priority:    priority,
@@ -816,7 +1371,7 @@ func (o *OpsGenieClient) createValidatedAlertRequest(alertType, message, descrip
 
 	// Add team responder if valid
 	teamName := mandatoryFields["Team"]
-	if teamName != "unknown-team" && teamName != "" {
+	if !isFallbackValue(teamName) {
 		req.Responders = []alert.Responder{
 			{
 				Type: "team",
@@ -852,7 +1407,36 @@ func memoryStatusString(memoryOK bool) string {
 
 // SendBreakerOpenAlert sends an alert when the circuit breaker opens
 func (o *OpsGenieClient) SendBreakerOpenAlert(latency int64, memoryOK bool, waitTime int) error {
-	if o == nil || !o.config.Enabled || !o.config.TriggerOnOpen {
+	return o.SendBreakerOpenAlertWithReason(latency, memoryOK, waitTime, "")
+}
+
+// SendBreakerOpenAlertWithReason is SendBreakerOpenAlert for a known trip reason (see
+// the TripReason constants), which is added as a "reason:<reason>" tag and as the
+// "Trigger Reason" detail
+func (o *OpsGenieClient) SendBreakerOpenAlertWithReason(latency int64, memoryOK bool, waitTime int, reason string) error {
+	return o.SendBreakerOpenAlertWithCorrelation(latency, memoryOK, waitTime, reason, "")
+}
+
+// SendBreakerOpenAlertWithCorrelation is SendBreakerOpenAlertWithReason for a trip caused
+// by a known request (see WithCorrelationID), whose correlation ID is added as a
+// "correlation_id:<id>" tag and as the "Correlation ID" detail
+func (o *OpsGenieClient) SendBreakerOpenAlertWithCorrelation(latency int64, memoryOK bool, waitTime int, reason, correlationID string) error {
+	return o.SendBreakerOpenAlertForTrip(AggregatedTrip{
+		Reason:        reason,
+		LatencyMs:     latency,
+		MemoryOK:      memoryOK,
+		WaitTime:      waitTime,
+		CorrelationID: correlationID,
+	})
+}
+
+// SendBreakerOpenAlertForTrip sends the open alert of trip. With the LatencyThresholdMs of
+// the trip, the priority is raised by priority_by_magnitude when the latency is far above
+// the threshold.
+func (o *OpsGenieClient) SendBreakerOpenAlertForTrip(trip AggregatedTrip) error {
+	latency, memoryOK, waitTime := trip.LatencyMs, trip.MemoryOK, trip.WaitTime
+	reason, correlationID := trip.Reason, trip.CorrelationID
+	if o == nil || !o.currentConfig().Enabled || !o.currentConfig().TriggerOnOpen || !o.isEnabledForEnvironment() {
 		return nil
 	}
 
@@ -875,9 +1459,11 @@ func (o *OpsGenieClient) SendBreakerOpenAlert(latency int64, memoryOK bool, wait
 	mandatoryFields := o.buildMandatoryFieldsWithFallbacks()
 
 	// Create enhanced message with business context
-	message := fmt.Sprintf("[%s] Circuit Breaker OPEN - %s",
-		mandatoryFields["Environment"],
-		o.getAPIIdentifier())
+	data := o.newAlertMessageData()
+	data.LatencyMs = latency
+	data.MemoryOK = memoryOK
+	data.WaitTimeSeconds = waitTime
+	message := o.RenderAlertMessage(MessageTemplateOpen, data)
 
 	// Build description
 	description := o.buildEnhancedDescription()
@@ -890,18 +1476,40 @@ func (o *OpsGenieClient) SendBreakerOpenAlert(latency int64, memoryOK bool, wait
 		"Alert Type":    alertType,
 		"Alert Details": details,
 	}
+	if reason != "" {
+		specificDetails["Trigger Reason"] = reason
+	}
+	if correlationID != "" {
+		specificDetails["Correlation ID"] = correlationID
+	}
+	if trip.CoalescedTrips > 0 {
+		specificDetails["Coalesced Trips"] = fmt.Sprintf("%d", trip.CoalescedTrips)
+		description = coalescedTripsNote(trip.CoalescedTrips) + description
+	}
 
 	req, err := o.createValidatedAlertRequest(alertType, message, description, specificDetails)
 	if err != nil {
 		log.Printf("Failed to create validated alert request: %v", err)
 		return err
 	}
+	if reason != "" {
+		req.Tags = append(req.Tags, "reason:"+reason)
+	}
+	if correlationID != "" {
+		req.Tags = append(req.Tags, "correlation_id:"+correlationID)
+	}
+	magnitude := breachMagnitude(float64(latency), float64(trip.LatencyThresholdMs))
+	if trip.Priority != "" {
+		req.Priority = alertPriority(o.scaledPriority(trip.Priority, "", magnitude))
+	} else {
+		o.scaleAlertPriority(req, magnitude)
+	}
 
 	// Send the alert
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), opsGenieRequestTimeout)
 	defer cancel()
 
-	resp, err := o.alertClient.Create(ctx, req)
+	requestID, err := o.createAlert(ctx, alertType, req)
 	if err != nil {
 		log.Printf("Error sending OpsGenie alert: %v", err)
 		return err
@@ -909,17 +1517,104 @@ func (o *OpsGenieClient) SendBreakerOpenAlert(latency int64, memoryOK bool, wait
 
 	// Record the alert time for cooldown
 	o.RecordAlert(alertKey)
+	o.recordAlias(alertType, req.Alias)
 
 	log.Printf("ALERT SENT: Circuit breaker OPEN alert sent to OpsGenie. RequestID: %s, Priority: %s, Key: %s",
-		resp.RequestId, req.Priority, alertKey)
+		requestID, req.Priority, alertKey)
 	log.Printf("Alert sent with fields: %+v", mandatoryFields)
 
 	return nil
 }
 
-// SendBreakerResetAlert sends an alert when the circuit breaker resets
+// coalescedTripsNote opens the description of an open alert into which coalescedTrips
+// later trips were folded
+func coalescedTripsNote(coalescedTrips int) string {
+	return fmt.Sprintf("The breaker tripped %d more times while this alert was pending (see max_pending_alerts)\n\n",
+		coalescedTrips)
+}
+
+// SendStuckOpenAlert sends an alert, with stuck_open_alert_priority, when the breaker has
+// been open for openFor, longer than max_open_duration_seconds. Unlike the open alert,
+// which is sent once when the breaker trips, it flags a downstream that never recovers.
+func (o *OpsGenieClient) SendStuckOpenAlert(openFor time.Duration, reason string) error {
+	if o == nil || !o.currentConfig().Enabled || !o.isEnabledForEnvironment() {
+		return nil
+	}
+
+	if !o.IsInitialized() {
+		log.Printf("OpsGenie client not initialized or not enabled for environment, skipping alert")
+		return nil
+	}
+
+	alertType := "circuit-stuck-open"
+	alertKey := o.determineAlertKey(alertType, "stuck-open")
+
+	if o.IsOnCooldown(alertKey) {
+		log.Printf("Skipping alert for %s due to cooldown period", alertKey)
+		return nil
+	}
+
+	openSeconds := int64(openFor / time.Second)
+	data := o.newAlertMessageData()
+	data.OpenSeconds = openSeconds
+	message := o.RenderAlertMessage(MessageTemplateStuckOpen, data)
+
+	description := o.buildEnhancedDescription()
+
+	specificDetails := map[string]string{
+		"Open Seconds":              fmt.Sprintf("%d", openSeconds),
+		"Max Open Duration Seconds": fmt.Sprintf("%d", o.currentConfig().MaxOpenDurationSeconds),
+		"Alert Type":                alertType,
+	}
+	if reason != "" {
+		specificDetails["Trigger Reason"] = reason
+	}
+
+	req, err := o.createValidatedAlertRequest(alertType, message, description, specificDetails)
+	if err != nil {
+		log.Printf("Failed to create validated alert request: %v", err)
+		return err
+	}
+	req.Priority = alertPriority(o.effectivePriority(o.currentConfig().StuckOpenAlertPriority))
+	if reason != "" {
+		req.Tags = append(req.Tags, "reason:"+reason)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), opsGenieRequestTimeout)
+	defer cancel()
+	requestID, err := o.createAlert(ctx, alertType, req)
+	if err != nil {
+		log.Printf("Error sending OpsGenie alert: %v", err)
+		return err
+	}
+
+	o.RecordAlert(alertKey)
+	o.recordAlias(alertType, req.Alias)
+
+	log.Printf("ALERT SENT: Circuit breaker STUCK OPEN alert sent to OpsGenie after %v. RequestID: %s, Priority: %s, Key: %s",
+		openFor.Round(time.Second), requestID, req.Priority, alertKey)
+
+	return nil
+}
+
+// Reset reasons reported by the reset alert, which tell on-call whether the breaker
+// recovered by itself or an operator closed it
+const (
+	ResetAlertAutomatic = "automatic" // The wait time elapsed and the breaker closed by itself
+	ResetAlertManual    = "manual"    // Reset or ResetState was called, e.g. through the API
+)
+
+// SendBreakerResetAlert sends an alert when the circuit breaker resets, without telling
+// how (see SendBreakerResetAlertWithReason)
 func (o *OpsGenieClient) SendBreakerResetAlert() error {
-	if o == nil || !o.config.Enabled || !o.config.TriggerOnReset {
+	return o.SendBreakerResetAlertWithReason("")
+}
+
+// SendBreakerResetAlertWithReason sends an alert when the circuit breaker resets. A
+// reason (ResetAlertAutomatic or ResetAlertManual) is shown in the message and added as
+// a "Reset Reason" detail and a "reset_reason:<reason>" tag.
+func (o *OpsGenieClient) SendBreakerResetAlertWithReason(reason string) error {
+	if o == nil || !o.currentConfig().Enabled || !o.currentConfig().TriggerOnReset || !o.isEnabledForEnvironment() {
 		return nil
 	}
 
@@ -939,35 +1634,42 @@ func (o *OpsGenieClient) SendBreakerResetAlert() error {
 	// Build mandatory fields for message
 	mandatoryFields := o.buildMandatoryFieldsWithFallbacks()
 
-	message := fmt.Sprintf("[%s] Circuit Breaker RESET - %s",
-		mandatoryFields["Environment"],
-		o.getAPIIdentifier())
+	data := o.newAlertMessageData()
+	data.ResetReason = reason
+	message := o.RenderAlertMessage(MessageTemplateReset, data)
 
 	description := o.buildEnhancedDescription()
 
 	specificDetails := map[string]string{
 		"Alert Type": alertType,
 	}
+	if reason != "" {
+		specificDetails["Reset Reason"] = reason
+	}
 
 	req, err := o.createValidatedAlertRequest(alertType, message, description, specificDetails)
 	if err != nil {
 		log.Printf("Failed to create validated alert request: %v", err)
 		return err
 	}
+	if reason != "" {
+		req.Tags = append(req.Tags, "reset_reason:"+reason)
+	}
 
 	// Send the alert
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), opsGenieRequestTimeout)
 	defer cancel()
-	resp, err := o.alertClient.Create(ctx, req)
+	requestID, err := o.createAlert(ctx, alertType, req)
 	if err != nil {
 		log.Printf("Error sending OpsGenie alert: %v", err)
 		return err
 	}
 
 	o.RecordAlert(alertKey)
+	o.recordAlias(alertType, req.Alias)
 
 	log.Printf("ALERT SENT: Circuit breaker RESET alert sent to OpsGenie. RequestID: %s, Priority: %s, Key: %s",
-		resp.RequestId, req.Priority, alertKey)
+		requestID, req.Priority, alertKey)
 	log.Printf("Alert sent with fields: %+v", mandatoryFields)
 
 	return nil
@@ -975,7 +1677,7 @@ func (o *OpsGenieClient) SendBreakerResetAlert() error {
 
 // SendMemoryThresholdAlert sends an alert when memory usage exceeds the threshold
 func (o *OpsGenieClient) SendMemoryThresholdAlert(memoryStatus *MemoryStatus) error {
-	if o == nil || !o.config.Enabled || !o.config.TriggerOnMemory {
+	if o == nil || !o.currentConfig().Enabled || !o.currentConfig().TriggerOnMemory || !o.isEnabledForEnvironment() {
 		return nil
 	}
 
@@ -996,10 +1698,11 @@ func (o *OpsGenieClient) SendMemoryThresholdAlert(memoryStatus *MemoryStatus) er
 	// Build mandatory fields for message
 	mandatoryFields := o.buildMandatoryFieldsWithFallbacks()
 
-	message := fmt.Sprintf("[%s] Memory Threshold Exceeded - %s (%.2f%%)",
-		mandatoryFields["Environment"],
-		o.getAPIIdentifier(),
-		memoryStatus.CurrentUsage)
+	data := o.newAlertMessageData()
+	data.MemoryOK = memoryStatus.OK
+	data.MemoryUsagePercent = memoryStatus.CurrentUsage
+	data.MemoryThresholdPercent = memoryStatus.Threshold
+	message := o.RenderAlertMessage(MessageTemplateMemory, data)
 
 	description := o.buildEnhancedDescription()
 
@@ -1017,28 +1720,97 @@ func (o *OpsGenieClient) SendMemoryThresholdAlert(memoryStatus *MemoryStatus) er
 		log.Printf("Failed to create validated alert request: %v", err)
 		return err
 	}
+	o.scaleAlertPriority(req, breachMagnitude(memoryStatus.CurrentUsage, memoryStatus.Threshold))
 
 	// Send the alert
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), opsGenieRequestTimeout)
 	defer cancel()
-	resp, err := o.alertClient.Create(ctx, req)
+	requestID, err := o.createAlert(ctx, alertType, req)
 	if err != nil {
 		log.Printf("Error sending OpsGenie alert: %v", err)
 		return err
 	}
 
 	o.RecordAlert(alertKey)
+	o.recordAlias(alertType, req.Alias)
 
 	log.Printf("ALERT SENT: Memory threshold alert sent to OpsGenie. RequestID: %s, Priority: %s, Usage: %.2f%%, Key: %s",
-		resp.RequestId, req.Priority, memoryStatus.CurrentUsage, alertKey)
+		requestID, req.Priority, memoryStatus.CurrentUsage, alertKey)
 	log.Printf("Alert sent with fields: %+v", mandatoryFields)
 
 	return nil
 }
 
+// memoryWarningAlertPriority is the priority of the memory warning alert, which comes
+// before the breaker opens and so should not page anyone
+const memoryWarningAlertPriority = "P4"
+
+// SendMemoryWarningAlert sends a low-priority alert when memory usage crosses
+// memory_warn_threshold, still below the memory_threshold that trips the breaker, so that
+// operators can act before the breaker opens. It has its own cooldown (memory-warning in
+// alert_cooldowns) and is sent only if trigger_on_memory_threshold is set.
+func (o *OpsGenieClient) SendMemoryWarningAlert(memoryStatus *MemoryStatus, warnThreshold float64) error {
+	if o == nil || !o.currentConfig().Enabled || !o.currentConfig().TriggerOnMemory || !o.isEnabledForEnvironment() {
+		return nil
+	}
+
+	if !o.IsInitialized() {
+		log.Printf("OpsGenie client not initialized or not enabled for environment, skipping alert")
+		return nil
+	}
+
+	alertType := "memory-warning"
+	alertKey := o.determineAlertKey(alertType, "warn")
+
+	if o.IsOnCooldown(alertKey) {
+		log.Printf("Skipping alert for %s due to cooldown period", alertKey)
+		return nil
+	}
+
+	data := o.newAlertMessageData()
+	data.MemoryOK = memoryStatus.OK
+	data.MemoryUsagePercent = memoryStatus.CurrentUsage
+	data.MemoryThresholdPercent = memoryStatus.Threshold
+	message := o.RenderAlertMessage(MessageTemplateMemoryWarn, data)
+
+	description := o.buildEnhancedDescription()
+
+	specificDetails := map[string]string{
+		"Current Usage":     fmt.Sprintf("%.2f%%", memoryStatus.CurrentUsage),
+		"Warning Threshold": fmt.Sprintf("%.2f%%", warnThreshold),
+		"Threshold":         fmt.Sprintf("%.2f%%", memoryStatus.Threshold),
+		"Total Memory MB":   fmt.Sprintf("%.2f", float64(memoryStatus.TotalMemory)/(1024*1024)),
+		"Used Memory MB":    fmt.Sprintf("%.2f", float64(memoryStatus.UsedMemory)/(1024*1024)),
+		"Alert Type":        alertType,
+	}
+
+	req, err := o.createValidatedAlertRequest(alertType, message, description, specificDetails)
+	if err != nil {
+		log.Printf("Failed to create validated alert request: %v", err)
+		return err
+	}
+	req.Priority = alertPriority(o.effectivePriority(memoryWarningAlertPriority))
+
+	ctx, cancel := context.WithTimeout(context.Background(), opsGenieRequestTimeout)
+	defer cancel()
+	requestID, err := o.createAlert(ctx, alertType, req)
+	if err != nil {
+		log.Printf("Error sending OpsGenie alert: %v", err)
+		return err
+	}
+
+	o.RecordAlert(alertKey)
+	o.recordAlias(alertType, req.Alias)
+
+	log.Printf("ALERT SENT: Memory warning alert sent to OpsGenie. RequestID: %s, Priority: %s, Usage: %.2f%%, Key: %s",
+		requestID, req.Priority, memoryStatus.CurrentUsage, alertKey)
+
+	return nil
+}
+
 // SendLatencyThresholdAlert sends an alert when latency exceeds the threshold
 func (o *OpsGenieClient) SendLatencyThresholdAlert(latency int64, thresholdMs int64) error {
-	if o == nil || !o.config.Enabled || !o.config.TriggerOnLatency {
+	if o == nil || !o.currentConfig().Enabled || !o.currentConfig().TriggerOnLatency || !o.isEnabledForEnvironment() {
 		return nil
 	}
 
@@ -1059,10 +1831,10 @@ func (o *OpsGenieClient) SendLatencyThresholdAlert(latency int64, thresholdMs in
 	// Build mandatory fields for message
 	mandatoryFields := o.buildMandatoryFieldsWithFallbacks()
 
-	message := fmt.Sprintf("[%s] High Latency Detected - %s (%dms)",
-		mandatoryFields["Environment"],
-		o.getAPIIdentifier(),
-		latency)
+	data := o.newAlertMessageData()
+	data.LatencyMs = latency
+	data.ThresholdMs = thresholdMs
+	message := o.RenderAlertMessage(MessageTemplateLatency, data)
 
 	description := o.buildEnhancedDescription()
 
@@ -1078,20 +1850,22 @@ func (o *OpsGenieClient) SendLatencyThresholdAlert(latency int64, thresholdMs in
 		log.Printf("Failed to create validated alert request: %v", err)
 		return err
 	}
+	o.scaleAlertPriority(req, breachMagnitude(float64(latency), float64(thresholdMs)))
 
 	// Send the alert
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), opsGenieRequestTimeout)
 	defer cancel()
-	resp, err := o.alertClient.Create(ctx, req)
+	requestID, err := o.createAlert(ctx, alertType, req)
 	if err != nil {
 		log.Printf("Error sending OpsGenie alert: %v", err)
 		return err
 	}
 
 	o.RecordAlert(alertKey)
+	o.recordAlias(alertType, req.Alias)
 
 	log.Printf("ALERT SENT: Latency threshold alert sent to OpsGenie. RequestID: %s, Priority: %s, Latency: %dms, Key: %s",
-		resp.RequestId, req.Priority, latency, alertKey)
+		requestID, req.Priority, latency, alertKey)
 	log.Printf("Alert sent with fields: %+v", mandatoryFields)
 
 	return nil
@@ -1099,7 +1873,7 @@ func (o *OpsGenieClient) SendLatencyThresholdAlert(latency int64, thresholdMs in
 
 // ValidateConfigurationAtStartup validates the configuration when the service starts
 func (o *OpsGenieClient) ValidateConfigurationAtStartup() error {
-	if o == nil || o.config == nil {
+	if o == nil || o.currentConfig() == nil {
 		return fmt.Errorf("OpsGenie client or configuration is nil")
 	}
 
@@ -1123,12 +1897,12 @@ func (o *OpsGenieClient) ValidateConfigurationAtStartup() error {
 	// Show current field values
 	mandatoryFields := o.buildMandatoryFieldsWithFallbacks()
 	log.Printf("Current mandatory field values:")
-	for field, value := range mandatoryFields {
-		log.Printf("   - %s: %s", field, value)
+	for _, field := range mandatoryFields.names() {
+		log.Printf("   - %s: %s", field, mandatoryFields[field])
 	}
 
 	// Validate OpsGenie connectivity if enabled
-	if o.config.Enabled {
+	if o.currentConfig().Enabled {
 		if err := o.TestConnection(); err != nil {
 			log.Printf("❌ OpsGenie connectivity test failed: %v", err)
 			return fmt.Errorf("OpsGenie connectivity test failed: %v", err)
@@ -1141,7 +1915,7 @@ func (o *OpsGenieClient) ValidateConfigurationAtStartup() error {
 
 // GenerateConfigurationReport generates a configuration validation report
 func (o *OpsGenieClient) GenerateConfigurationReport() string {
-	if o == nil || o.config == nil {
+	if o == nil || o.currentConfig() == nil {
 		return "❌ OpsGenie client or configuration is nil"
 	}
 
@@ -1149,19 +1923,20 @@ func (o *OpsGenieClient) GenerateConfigurationReport() string {
 	report += "================================\n\n"
 
 	// Basic configuration
-	report += fmt.Sprintf("Enabled: %t\n", o.config.Enabled)
-	report += fmt.Sprintf("Region: %s\n", o.config.Region)
-	report += fmt.Sprintf("Priority: %s\n", o.config.Priority)
-	report += fmt.Sprintf("Source: %s\n", o.config.Source)
+	report += fmt.Sprintf("Enabled: %t\n", o.currentConfig().Enabled)
+	report += fmt.Sprintf("Region: %s\n", o.currentConfig().Region)
+	report += fmt.Sprintf("Priority: %s\n", o.currentConfig().Priority)
+	report += fmt.Sprintf("Source: %s\n", o.currentConfig().Source)
 	report += "\n"
 
 	// Mandatory fields
 	mandatoryFields := o.buildMandatoryFieldsWithFallbacks()
 	report += "Mandatory Fields:\n"
 	report += "-----------------\n"
-	for field, value := range mandatoryFields {
+	for _, field := range mandatoryFields.names() {
+		value := mandatoryFields[field]
 		status := "✅"
-		if value == "unknown" || value == "unknown-team" || value == "" {
+		if isFallbackValue(value) {
 			status = "⚠️ "
 		}
 		report += fmt.Sprintf("%s %s: %s\n", status, field, value)
@@ -1175,8 +1950,8 @@ func (o *OpsGenieClient) GenerateConfigurationReport() string {
 		for _, field := range err.MissingFields {
 			report += fmt.Sprintf("❌ Missing: %s\n", field)
 		}
-		for field, reason := range err.InvalidFields {
-			report += fmt.Sprintf("❌ Invalid %s: %s\n", field, reason)
+		for _, field := range sortedKeys(err.InvalidFields) {
+			report += fmt.Sprintf("❌ Invalid %s: %s\n", field, err.InvalidFields[field])
 		}
 	} else {
 		report += "✅ All mandatory fields validated successfully\n"
@@ -0,0 +1,88 @@
+// Package otelbreaker records circuit breaker decisions on OpenTelemetry spans.
+//
+// It lives in its own package so that the core breaker package does not depend on
+// OpenTelemetry. Decisions are only reported for calls made through AllowCtx and
+// DoneCtx, which carry the context holding the current span:
+//
+//	driver := breaker.NewBreaker(config, "breakers.toml").(*breaker.BreakerDriver)
+//	otelbreaker.Instrument(driver)
+//
+//	if !driver.AllowCtx(ctx) {
+//		return errServiceUnavailable
+//	}
+//	start := time.Now()
+//	defer func() { driver.DoneCtx(ctx, start, time.Now()) }()
+package otelbreaker
+
+import (
+	"context"
+
+	"github.com/lrleon/go-breaker/breaker"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Event names added to the span found in the context
+const (
+	AllowEventName = "breaker.allow"
+	DoneEventName  = "breaker.done"
+)
+
+// Breaker state values reported in the breaker.state attribute
+const (
+	StateClosed   = "closed"
+	StateOpen     = "open"
+	StateDisabled = "disabled"
+)
+
+// Instrument installs Hook as the decision hook of the given driver
+func Instrument(driver *breaker.BreakerDriver) {
+	if driver == nil {
+		return
+	}
+	driver.SetDecisionHook(Hook())
+}
+
+// Hook returns a breaker.DecisionHook that adds an event describing each decision to
+// the span carried by the context. Contexts without a recording span are ignored.
+func Hook() breaker.DecisionHook {
+	return func(ctx context.Context, event breaker.DecisionEvent) {
+		span := trace.SpanFromContext(ctx)
+		if !span.IsRecording() {
+			return
+		}
+
+		attrs := []attribute.KeyValue{
+			attribute.String("breaker.state", state(event)),
+			attribute.Bool("breaker.triggered", event.Triggered),
+			attribute.Int64("breaker.latency_percentile_ms", event.LatencyPercentile),
+			attribute.Int64("breaker.latency_threshold_ms", event.LatencyThreshold),
+			attribute.Float64("breaker.percentile", event.Percentile),
+		}
+
+		switch event.Operation {
+		case "allow":
+			attrs = append(attrs, attribute.Bool("breaker.allowed", event.Allowed))
+			span.AddEvent(AllowEventName, trace.WithAttributes(attrs...))
+
+			// Make rejections easy to filter on without inspecting the events
+			if !event.Allowed {
+				span.SetAttributes(attribute.Bool("breaker.rejected", true))
+			}
+		case "done":
+			attrs = append(attrs, attribute.Int64("breaker.latency_ms", event.LatencyMs))
+			span.AddEvent(DoneEventName, trace.WithAttributes(attrs...))
+		}
+	}
+}
+
+// state maps a decision event to the breaker state reported on the span
+func state(event breaker.DecisionEvent) string {
+	if !event.Enabled {
+		return StateDisabled
+	}
+	if event.Triggered {
+		return StateOpen
+	}
+	return StateClosed
+}
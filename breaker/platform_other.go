@@ -0,0 +1,26 @@
+//go:build !windows
+
+package breaker
+
+import (
+	"os"
+	"strings"
+)
+
+// detectMemoryLimit reads the container memory limit from MemoryLimitFile (cgroup). It
+// returns zero without an error when the file does not exist, i.e. outside a container.
+func detectMemoryLimit() (int64, error) {
+	if _, err := os.Stat(MemoryLimitFile); os.IsNotExist(err) {
+		memoryLogger.Logf("Not running in a k8s environment")
+		return 0, nil
+	}
+	return GetK8sMemoryLimit()
+}
+
+// platformHostname is the last resort of the hostname fallbacks: /etc/hostname
+func platformHostname() string {
+	if data, err := os.ReadFile("/etc/hostname"); err == nil {
+		return strings.TrimSpace(string(data))
+	}
+	return ""
+}
@@ -0,0 +1,81 @@
+package breaker
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// Job object limits, as defined by the Windows API (winnt.h)
+const (
+	jobObjectExtendedLimitInformationClass = 9
+	jobObjectLimitProcessMemory            = 0x100
+	jobObjectLimitJobMemory                = 0x200
+)
+
+type jobObjectBasicLimitInformation struct {
+	PerProcessUserTimeLimit int64
+	PerJobUserTimeLimit     int64
+	LimitFlags              uint32
+	MinimumWorkingSetSize   uintptr
+	MaximumWorkingSetSize   uintptr
+	ActiveProcessLimit      uint32
+	Affinity                uintptr
+	PriorityClass           uint32
+	SchedulingClass         uint32
+}
+
+type ioCounters struct {
+	ReadOperationCount  uint64
+	WriteOperationCount uint64
+	OtherOperationCount uint64
+	ReadTransferCount   uint64
+	WriteTransferCount  uint64
+	OtherTransferCount  uint64
+}
+
+type jobObjectExtendedLimitInformation struct {
+	BasicLimitInformation jobObjectBasicLimitInformation
+	IoInfo                ioCounters
+	ProcessMemoryLimit    uintptr
+	JobMemoryLimit        uintptr
+	PeakProcessMemoryUsed uintptr
+	PeakJobMemoryUsed     uintptr
+}
+
+var procQueryInformationJobObject = syscall.NewLazyDLL("kernel32.dll").NewProc("QueryInformationJobObject")
+
+// detectMemoryLimit reads the memory limit of the job object the process runs in, which
+// is how Windows containers limit memory. There is no cgroup on Windows, so it returns
+// zero without an error when the process is not in a job or the job has no memory limit.
+func detectMemoryLimit() (int64, error) {
+	if err := procQueryInformationJobObject.Find(); err != nil {
+		memoryLogger.Logf("Cannot query the job object memory limit: %v", err)
+		return 0, nil
+	}
+
+	var info jobObjectExtendedLimitInformation
+	// A nil job handle queries the job of the calling process
+	result, _, err := procQueryInformationJobObject.Call(0, jobObjectExtendedLimitInformationClass,
+		uintptr(unsafe.Pointer(&info)), unsafe.Sizeof(info), 0)
+	if result == 0 {
+		memoryLogger.Logf("Not running in a job object with a memory limit: %v", err)
+		return 0, nil
+	}
+
+	flags := info.BasicLimitInformation.LimitFlags
+	switch {
+	case flags&jobObjectLimitJobMemory != 0:
+		return int64(info.JobMemoryLimit), nil
+	case flags&jobObjectLimitProcessMemory != 0:
+		return int64(info.ProcessMemoryLimit), nil
+	}
+	memoryLogger.Logf("Not running in a Windows container with a memory limit")
+	return 0, nil
+}
+
+// platformHostname is the last resort of the hostname fallbacks: the COMPUTERNAME
+// environment variable, since Windows has no /etc/hostname
+func platformHostname() string {
+	return os.Getenv("COMPUTERNAME")
+}
@@ -0,0 +1,149 @@
+package breaker
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ProbeFunc sends a single probe request to the downstream and returns its latency, or
+// an error when the downstream failed
+type ProbeFunc func() (time.Duration, error)
+
+// probeState is the active-probe mode of a breaker (see SetProbe)
+type probeState struct {
+	probe     ProbeFunc
+	stop      chan struct{}  // Stops the periodic probes
+	running   sync.WaitGroup // Periodic probes
+	probing   bool           // A probe is in flight; a single probe runs at a time
+	successes int            // Consecutive probes that succeeded since the breaker opened
+}
+
+// SetProbe enables the active-probe mode: while the breaker is open, probe is called
+// every probe_interval_seconds (wait_time by default) to test the downstream, and the
+// breaker closes only after recovery_consecutive_checks probes in a row succeed, that
+// is, return no error and a latency below the threshold. The wait time no longer closes
+// the breaker, and Allow rejects requests until the probes succeed. Memory and the
+// retry-after of the downstream must be OK too. A nil probe restores the time-based
+// recovery; Close stops the probes.
+func (b *BreakerDriver) SetProbe(probe ProbeFunc) {
+	b.stopProbes()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if probe == nil || b.closed {
+		return
+	}
+
+	interval := b.config.probeInterval()
+	state := &probeState{probe: probe, stop: make(chan struct{})}
+	b.probe = state
+	b.logger.Logf("Active probes enabled every %v while the breaker is open", interval)
+
+	state.running.Add(1)
+	go func() {
+		defer state.running.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-state.stop:
+				return
+			case <-ticker.C:
+				b.RunProbe()
+			}
+		}
+	}()
+}
+
+// RunProbe sends a probe at once if the breaker is open and the active-probe mode is
+// enabled (see SetProbe), and reports whether the probe closed the breaker. Remote trips
+// are left to the replica that tripped.
+func (b *BreakerDriver) RunProbe() bool {
+	b.mu.Lock()
+	state := b.probe
+	if state == nil || state.probing || !b.triggered || b.remoteTrip || !b.enabled.Load() {
+		b.mu.Unlock()
+		return false
+	}
+	state.probing = true
+	b.mu.Unlock()
+
+	// The probe goes to the downstream, so it runs without the lock
+	latency, err := state.probe()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	state.probing = false
+	if b.probe != state || !b.triggered || b.remoteTrip {
+		return false
+	}
+
+	if failure := b.probeFailure(latency, err); failure != "" {
+		state.successes = 0
+		b.logger.Logf("Probe failed, the breaker stays open: %s", failure)
+		return false
+	}
+	state.successes++
+	required := b.config.recoveryConsecutiveChecks()
+	if state.successes < required {
+		b.logger.Logf("Probe succeeded in %v (%d of %d)", latency, state.successes, required)
+		return false
+	}
+
+	if !b.memoryGateOK() {
+		b.logger.Logf("Probe succeeded in %v, but memory is still above threshold", latency)
+		return false
+	}
+	if now := b.now(); now.Before(b.retryAfterUntil) {
+		b.logger.Logf("Probe succeeded in %v, but the downstream asked to retry after %s",
+			latency, b.retryAfterUntil.Format(time.RFC3339))
+		return false
+	}
+
+	state.successes = 0
+	b.resetAfterRecovery(ResetReasonProbe)
+	b.logger.Logf("INFO: Breaker automatically reset after %d successful probes (last one took %v)", required, latency)
+	return true
+}
+
+// probeFailure tells why a probe failed, or returns an empty string when it succeeded.
+// It must run in a critical section.
+func (b *BreakerDriver) probeFailure(latency time.Duration, err error) string {
+	if err != nil {
+		return err.Error()
+	}
+	if b.config.TripsOnLatency() && latency.Nanoseconds() >= millisToNanos(b.config.LatencyThreshold) {
+		return fmt.Sprintf("latency %v is not below the threshold of %dms", latency, b.config.LatencyThreshold)
+	}
+	return ""
+}
+
+// probeInterval returns probe_interval_seconds, or wait_time when it is not set, and at
+// least a second
+func (c *Config) probeInterval() time.Duration {
+	seconds := c.ProbeIntervalSeconds
+	if seconds <= 0 {
+		seconds = c.WaitTime
+	}
+	if seconds <= 0 {
+		seconds = 1
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// stopProbes stops the periodic probes and waits for them to return. It must be called
+// without holding the lock, which the probes take.
+func (b *BreakerDriver) stopProbes() {
+	b.mu.Lock()
+	state := b.probe
+	b.probe = nil
+	b.mu.Unlock()
+
+	if state != nil {
+		close(state.stop)
+		state.running.Wait()
+	}
+}
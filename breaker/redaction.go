@@ -0,0 +1,76 @@
+package breaker
+
+import (
+	"regexp"
+	"strings"
+)
+
+// RedactedValue replaces the values of the alert details and description lines matched by
+// redact_keys or redact_pattern
+const RedactedValue = "****"
+
+// descriptionBullet starts the "• Label: value" lines of the alert descriptions
+const descriptionBullet = "• "
+
+// redactPatternError describes why pattern cannot be used as redact_pattern, or returns
+// an empty string when it can
+func redactPatternError(pattern string) string {
+	if _, err := regexp.Compile(pattern); err != nil {
+		return err.Error()
+	}
+	return ""
+}
+
+// RedactsKey reports whether the values of key are masked in alerts: key matches one of
+// redact_keys, compared case-insensitively and with or without the Custom_ prefix of
+// custom attributes, or matches redact_pattern
+func (c *OpsGenieConfig) RedactsKey(key string) bool {
+	if c == nil {
+		return false
+	}
+
+	name := strings.ToLower(strings.TrimSpace(key))
+	attribute := strings.TrimPrefix(name, strings.ToLower(customAttributePrefix))
+	for _, redacted := range c.RedactKeys {
+		redacted = strings.ToLower(strings.TrimSpace(redacted))
+		if redacted != "" && (redacted == name || redacted == attribute) {
+			return true
+		}
+	}
+
+	if c.RedactPattern == "" {
+		return false
+	}
+	pattern, err := regexp.Compile(c.RedactPattern)
+	return err == nil && pattern.MatchString(strings.TrimSpace(key)) // Invalid patterns are reported at load
+}
+
+// redactDetails masks the values of the details matched by redact_keys or redact_pattern
+func (o *OpsGenieClient) redactDetails(details map[string]string) {
+	for key := range details {
+		if o.currentConfig().RedactsKey(key) {
+			details[key] = RedactedValue
+		}
+	}
+}
+
+// redactDescription masks the values of the "• Label: value" lines of an alert
+// description whose label is matched by redact_keys or redact_pattern
+func (o *OpsGenieClient) redactDescription(description string) string {
+	if len(o.currentConfig().RedactKeys) == 0 && o.currentConfig().RedactPattern == "" {
+		return description
+	}
+
+	lines := strings.Split(description, "\n")
+	for i, line := range lines {
+		item, isBullet := strings.CutPrefix(line, descriptionBullet)
+		if !isBullet {
+			continue
+		}
+		label, _, hasValue := strings.Cut(item, ": ")
+		if hasValue && o.currentConfig().RedactsKey(label) {
+			lines[i] = descriptionBullet + label + ": " + RedactedValue
+		}
+	}
+	return strings.Join(lines, "\n")
+}
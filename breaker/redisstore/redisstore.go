@@ -0,0 +1,100 @@
+// Package redisstore shares circuit breaker trips between replicas through Redis.
+//
+// It is a module of its own, github.com/lrleon/go-breaker/breaker/redisstore, so that
+// the go-breaker module does not depend on Redis. Every replica connects its breaker to a Store with the same key; replicas
+// configured with honor_shared_trips open when another one trips:
+//
+//	client := redis.NewClient(&redis.Options{Addr: "redis:6379"})
+//	driver := breaker.NewBreaker(config, "breakers.toml").(*breaker.BreakerDriver)
+//	driver.SetStateStore(redisstore.New(client, "breaker:payments-api"))
+//	defer driver.Close()
+package redisstore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/lrleon/go-breaker/breaker"
+	"github.com/redis/go-redis/v9"
+)
+
+// Store is a breaker.StateStore backed by Redis. The last published state is kept under
+// the key, so that a replica that starts while another one is tripped honors the trip,
+// and every state is also published on the channel with the same name.
+type Store struct {
+	client redis.UniversalClient
+	key    string
+}
+
+var _ breaker.StateStore = (*Store)(nil)
+
+// New returns a store that shares states under key. Replicas that should coordinate
+// must use the same key; the client is owned by the caller.
+func New(client redis.UniversalClient, key string) *Store {
+	return &Store{client: client, key: key}
+}
+
+// Publish saves the state under the key and announces it on the channel
+func (s *Store) Publish(ctx context.Context, state breaker.SharedState) error {
+	payload, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("redisstore: encoding state: %w", err)
+	}
+
+	_, err = s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, s.key, payload, 0)
+		pipe.Publish(ctx, s.key, payload)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("redisstore: publishing state: %w", err)
+	}
+	return nil
+}
+
+// Subscribe delivers the last saved state, if any, and then every published state
+// until ctx is done
+func (s *Store) Subscribe(ctx context.Context, handler func(state breaker.SharedState)) error {
+	// Subscribe before reading the saved state, so that no state is missed in between
+	pubsub := s.client.Subscribe(ctx, s.key)
+	defer pubsub.Close()
+
+	// Receiving does not return when ctx is done, but it does when pubsub is closed
+	stop := context.AfterFunc(ctx, func() { pubsub.Close() })
+	defer stop()
+
+	if _, err := pubsub.Receive(ctx); err != nil {
+		return fmt.Errorf("redisstore: subscribing: %w", err)
+	}
+
+	payload, err := s.client.Get(ctx, s.key).Result()
+	switch {
+	case err == nil:
+		s.deliver(payload, handler)
+	case !errors.Is(err, redis.Nil):
+		return fmt.Errorf("redisstore: reading saved state: %w", err)
+	}
+
+	for {
+		msg, err := pubsub.ReceiveMessage(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("redisstore: receiving state: %w", err)
+		}
+		s.deliver(msg.Payload, handler)
+	}
+}
+
+func (s *Store) deliver(payload string, handler func(state breaker.SharedState)) {
+	var state breaker.SharedState
+	if err := json.Unmarshal([]byte(payload), &state); err != nil {
+		log.Printf("redisstore: ignoring invalid state under %q: %v", s.key, err)
+		return
+	}
+	handler(state)
+}
@@ -0,0 +1,48 @@
+package redisstore_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/lrleon/go-breaker/breaker"
+	"github.com/lrleon/go-breaker/breaker/breakertest"
+	"github.com/lrleon/go-breaker/breaker/redisstore"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func honoringSharedTrips(config *breaker.Config) {
+	config.HonorSharedTrips = true
+	config.WaitTime = 60
+}
+
+func TestStore(t *testing.T) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	defer client.Close()
+
+	tripping := breakertest.NewTestBreaker(breakertest.WithConfig(honoringSharedTrips))
+	defer tripping.Close()
+	honoring := breakertest.NewTestBreaker(breakertest.WithConfig(honoringSharedTrips))
+	defer honoring.Close()
+
+	tripping.SetStateStore(redisstore.New(client, "breaker:test-api"))
+	honoring.SetStateStore(redisstore.New(client, "breaker:test-api"))
+
+	require.NoError(t, breakertest.TriggerByLatency(tripping))
+	assert.Eventually(t, honoring.RemoteTrip, 2*time.Second, 10*time.Millisecond,
+		"The trip should reach the other replica through Redis")
+
+	// A replica that starts while the trip is still in effect honors it
+	late := breakertest.NewTestBreaker(breakertest.WithConfig(honoringSharedTrips))
+	defer late.Close()
+	late.SetStateStore(redisstore.New(client, "breaker:test-api"))
+	assert.Eventually(t, late.RemoteTrip, 2*time.Second, 10*time.Millisecond,
+		"A new replica should honor the saved trip")
+
+	tripping.Reset()
+	assert.Eventually(t, func() bool { return !honoring.Triggered() && !late.Triggered() },
+		2*time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,120 @@
+package breaker
+
+import (
+	"log"
+	"net/http"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// BreakerRegistry keeps the breakers of a process by name, so that they can be listed
+// and inspected from a single place. It is safe for concurrent use.
+type BreakerRegistry struct {
+	mu       sync.RWMutex
+	breakers map[string]Breaker
+}
+
+// NewBreakerRegistry creates an empty registry
+func NewBreakerRegistry() *BreakerRegistry {
+	return &BreakerRegistry{breakers: make(map[string]Breaker)}
+}
+
+// DefaultRegistry is the registry into which NewBreaker registers the breakers whose
+// configuration has a name (see Config.Name)
+var DefaultRegistry = NewBreakerRegistry()
+
+// Register adds a breaker under name, replacing (with a warning) any breaker already
+// registered under that name. An empty name or a nil breaker is ignored.
+func (r *BreakerRegistry) Register(name string, b Breaker) {
+	if name == "" || b == nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if previous, exists := r.breakers[name]; exists && previous != b {
+		log.Printf("Warning: breaker %q registered again; the previous breaker is no longer listed", name)
+	}
+	r.breakers[name] = b
+}
+
+// Unregister removes the breaker registered under name, only if it is b, so that a
+// breaker closed after being replaced does not remove its replacement
+func (r *BreakerRegistry) Unregister(name string, b Breaker) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if current, exists := r.breakers[name]; exists && current == b {
+		delete(r.breakers, name)
+	}
+}
+
+// Get returns the breaker registered under name, or nil if there is none
+func (r *BreakerRegistry) Get(name string) Breaker {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.breakers[name]
+}
+
+// Names returns the names of the registered breakers, sorted
+func (r *BreakerRegistry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return sortedKeys(r.breakers)
+}
+
+// ListBreakers returns the names of the breakers in DefaultRegistry, sorted
+func ListBreakers() []string {
+	return DefaultRegistry.Names()
+}
+
+// GetRegistered returns the breaker registered in DefaultRegistry under name, or nil
+func GetRegistered(name string) Breaker {
+	return DefaultRegistry.Get(name)
+}
+
+// RegisteredBreakerState is the state of a registered breaker, as listed by /breaker/list
+type RegisteredBreakerState struct {
+	Name       string `json:"name"`
+	Enabled    bool   `json:"enabled"`
+	Triggered  bool   `json:"triggered"`
+	TripReason string `json:"trip_reason,omitempty"`
+	MemoryOK   bool   `json:"memory_ok"`
+	LatencyOK  bool   `json:"latency_ok"`
+	ConfigFile string `json:"config_file,omitempty"`
+}
+
+// States returns the state of every registered breaker, sorted by name
+func (r *BreakerRegistry) States() []RegisteredBreakerState {
+	// The breakers are queried without the registry lock, since they take their own
+	r.mu.RLock()
+	names := sortedKeys(r.breakers)
+	breakers := make([]Breaker, len(names))
+	for i, name := range names {
+		breakers[i] = r.breakers[name]
+	}
+	r.mu.RUnlock()
+
+	states := make([]RegisteredBreakerState, len(names))
+	for i, b := range breakers {
+		states[i] = RegisteredBreakerState{
+			Name:       names[i],
+			Enabled:    b.IsEnabled(),
+			Triggered:  b.Triggered(),
+			TripReason: b.TripReason(),
+			MemoryOK:   b.MemoryOK(),
+			LatencyOK:  b.LatencyOK(),
+			ConfigFile: b.GetConfigFile(),
+		}
+	}
+	return states
+}
+
+// ListRegisteredBreakers returns the state of every breaker in DefaultRegistry
+func (b *BreakerAPI) ListRegisteredBreakers(ctx *gin.Context) {
+	states := DefaultRegistry.States()
+	ctx.JSON(http.StatusOK, gin.H{
+		"count":    len(states),
+		"breakers": states,
+	})
+}
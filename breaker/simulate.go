@@ -0,0 +1,131 @@
+package breaker
+
+import (
+	"log"
+	"sort"
+	"time"
+)
+
+// SimEvent is a trip or a reset found by Simulate
+type SimEvent struct {
+	Type                BreakerEventType `json:"type"`                  // EventTripped or EventReset
+	Time                time.Time        `json:"time"`                  // Timestamp of the record that caused the event
+	Reason              string           `json:"reason"`                // Trip reason, or ResetReasonWaitTime
+	LatencyPercentileMs int64            `json:"latency_percentile_ms"` // Latency percentile when the event happened
+	Rejected            int              `json:"rejected,omitempty"`    // Reset events: records rejected while the breaker was open
+}
+
+// Simulate replays a latency trace, such as the records of LatencyRecordsSince, through
+// the latency trip logic of a breaker with config, and returns the trips and resets it
+// would have caused, in order. It only depends on the timestamps of the records, so the
+// same trace and config always give the same events: use it to tune the thresholds
+// offline.
+//
+// Every record is an operation that ended at its timestamp. Records that arrive while
+// the simulated breaker is open are rejected, as Allow would have done. After the wait
+// time, one record every recovery_check_interval_seconds passes as a trial request: the
+// breaker resets after recovery_consecutive_checks trials in a row that, like the
+// latency percentile with them, are below the threshold, and a failed trial keeps it
+// open for another wait time. Memory, protection_percent, sampling, the health score and
+// the warm-up policy are not simulated. A nil config means the default configuration,
+// and an invalid one gives no events.
+func Simulate(records []LatencyRecord, config *Config) []SimEvent {
+	if config == nil {
+		config = createDefaultConfig()
+	}
+	if err := ValidateConfig(config); err != nil {
+		log.Printf("Simulate: invalid configuration: %v", err)
+		return nil
+	}
+
+	ordered := make([]LatencyRecord, 0, len(records))
+	for _, record := range records {
+		if !record.Timestamp.IsZero() {
+			ordered = append(ordered, record)
+		}
+	}
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return ordered[i].Timestamp.Before(ordered[j].Timestamp)
+	})
+
+	clock := NewMockClock(time.Time{})
+	lw := newConfiguredLatencyWindow(config)
+	lw.Clock = clock
+	sim := &BreakerDriver{config: *config, latencyWindow: lw} // No logger: the simulation is silent
+
+	var events []SimEvent
+	var triggered bool
+	var lastTripTime, nextRecovery time.Time
+	var lastPercentile int64
+	rejected := 0
+	recoveryChecks := 0
+	waitDuration := time.Duration(config.WaitTime) * time.Second
+	for _, record := range ordered {
+		now := record.Timestamp
+		clock.Set(now)
+
+		// The same half-open recovery as Allow and Done: while the breaker is open, records
+		// are trial requests only after the wait time, one per recovery check interval
+		if triggered && (now.Sub(lastTripTime) <= waitDuration || now.Before(nextRecovery)) {
+			rejected++
+			continue
+		}
+
+		latency := time.Duration(record.Value)
+		if latency < 0 {
+			latency = 0
+		}
+		lw.AddLabeled(now.Add(-latency), now, record.Label)
+		percentileNs := lw.PercentileNs(config.Percentile)
+		lastPercentile = nanosToMillis(percentileNs)
+
+		if triggered {
+			nextRecovery = now.Add(config.recoveryCheckInterval())
+			thresholdNs := millisToNanos(config.LatencyThreshold)
+			if config.TripsOnLatency() && (latency.Nanoseconds() >= thresholdNs || percentileNs >= thresholdNs) {
+				recoveryChecks = 0
+				lastTripTime = now
+			} else {
+				recoveryChecks++
+			}
+			if recoveryChecks >= config.recoveryConsecutiveChecks() {
+				triggered = false
+				recoveryChecks = 0
+				events = append(events, SimEvent{
+					Type:                EventReset,
+					Time:                now,
+					Reason:              ResetReasonWaitTime,
+					LatencyPercentileMs: lastPercentile,
+					Rejected:            rejected,
+				})
+				rejected = 0
+			}
+		}
+
+		if !config.TripsOnLatency() || !sim.latencyBreached(percentileNs, now) {
+			continue
+		}
+		reason := sim.latencyTripReason(percentileNs)
+		if reason == "" {
+			continue
+		}
+		if triggered {
+			lastTripTime = now // Slow latencies while half-open extend the opening
+			recoveryChecks = 0
+			nextRecovery = time.Time{}
+			continue
+		}
+		triggered = true
+		lastTripTime = now
+		nextRecovery = time.Time{}
+		recoveryChecks = 0
+		sim.breachStart = time.Time{}
+		events = append(events, SimEvent{
+			Type:                EventTripped,
+			Time:                now,
+			Reason:              reason,
+			LatencyPercentileMs: lastPercentile,
+		})
+	}
+	return events
+}
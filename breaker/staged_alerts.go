@@ -14,11 +14,26 @@ type AlertContext struct {
 	TriggerTime     time.Time `json:"trigger_time"`
 	PeakLatency     int64     `json:"peak_latency_ms"`
 	AverageLatency  int64     `json:"average_latency_ms"`
-	TriggerReason   string    `json:"trigger_reason"`
+	TriggerReason   string    `json:"trigger_reason"` // One of the TripReason constants
 	MemoryUsage     float64   `json:"memory_usage_percent"`
 	RecentLatencies []int64   `json:"recent_latencies_ms"`
 	WaitTime        int       `json:"wait_time_seconds"`
 	TimeBeforeAlert int       `json:"time_before_alert_seconds"`
+	CorrelationID   string    `json:"correlation_id,omitempty"` // Of the slow request behind a latency trip (see WithCorrelationID)
+
+	LatencyThresholdMs int64 `json:"latency_threshold_ms,omitempty"` // Scales the alert priority (see priority_by_magnitude)
+}
+
+// openTrip returns the trip of the open alerts sent for the context
+func (c *AlertContext) openTrip() AggregatedTrip {
+	return AggregatedTrip{
+		Reason:             c.TriggerReason,
+		LatencyMs:          c.PeakLatency,
+		MemoryOK:           c.MemoryUsage < 80, // Invert for the memoryOK parameter
+		WaitTime:           c.WaitTime,
+		CorrelationID:      c.CorrelationID,
+		LatencyThresholdMs: c.LatencyThresholdMs,
+	}
 }
 
 // PendingAlert represents a pending alert for escalation
@@ -27,20 +42,28 @@ type PendingAlert struct {
 	TriggerTime        time.Time
 	InitialAlertSent   bool
 	EscalatedAlertSent bool
+	LadderStep         int // Steps of the priority escalation ladder already reached
 	Context            *AlertContext
 	ScheduledCheck     time.Time
 	BreakerInstance    Breaker // Reference to Breaker to check status
+	CoalescedTrips     int     // Later trips folded into this alert because max_pending_alerts was reached
 }
 
+// defaultMaxPendingAlerts is used when max_pending_alerts is not configured
+const defaultMaxPendingAlerts = 10
+
 // StagedAlertManager handles staged alerts
 type StagedAlertManager struct {
-	config         *OpsGenieConfig
+	config         *OpsGenieConfig // Swapped as a whole by setConfig; read it with currentConfig
+	configMutex    sync.RWMutex
 	opsGenieClient *OpsGenieClient
 	mutex          sync.RWMutex
 	pendingAlerts  map[string]*PendingAlert
+	alertSeq       uint64 // Makes the IDs of alerts created within the same second unique
 	checkTicker    *time.Ticker
 	stopChan       chan bool
 	running        bool
+	clock          Clock // Tells the time; nil means RealClock (see SetClock)
 }
 
 // NewStagedAlertManager creates a new staged alert manager
@@ -62,13 +85,37 @@ func NewStagedAlertManager(config *OpsGenieConfig, opsGenieClient *OpsGenieClien
 	return manager
 }
 
+// currentConfig returns the configuration the manager is running with, which callers
+// must not modify
+func (sam *StagedAlertManager) currentConfig() *OpsGenieConfig {
+	sam.configMutex.RLock()
+	defer sam.configMutex.RUnlock()
+	return sam.config
+}
+
+// setConfig makes the manager use config from its next check on; config must not be
+// modified afterwards
+func (sam *StagedAlertManager) setConfig(config *OpsGenieConfig) {
+	sam.configMutex.Lock()
+	defer sam.configMutex.Unlock()
+	sam.config = config
+}
+
 // OnBreakerTriggered is called when the circuit breaker is triggered
 func (sam *StagedAlertManager) OnBreakerTriggered(context *AlertContext, breakerInstance Breaker) {
 	sam.mutex.Lock()
 	defer sam.mutex.Unlock()
 
 	// Generate a unique ID for this alert
-	alertID := fmt.Sprintf("alert-%d", time.Now().Unix())
+	sam.alertSeq++
+	alertID := fmt.Sprintf("alert-%d-%d", sam.now().Unix(), sam.alertSeq)
+
+	// A flapping breaker trips faster than its alerts resolve; past the cap, new trips
+	// are folded into the latest pending alert instead of growing the map
+	if len(sam.pendingAlerts) >= sam.maxPendingAlerts() {
+		sam.coalesce()
+		return
+	}
 
 	log.Printf("🔄 Circuit breaker triggered - Staged alerting activated")
 	log.Printf("📊 Peak latency: %dms, Memory: %.1f%%, Reason: %s",
@@ -82,7 +129,7 @@ func (sam *StagedAlertManager) OnBreakerTriggered(context *AlertContext, breaker
 		InitialAlertSent:   false,
 		EscalatedAlertSent: false,
 		Context:            context,
-		ScheduledCheck:     context.TriggerTime.Add(time.Duration(sam.config.TimeBeforeSendAlert) * time.Second),
+		ScheduledCheck:     context.TriggerTime.Add(time.Duration(sam.currentConfig().TimeBeforeSendAlert) * time.Second),
 		BreakerInstance:    breakerInstance,
 	}
 
@@ -90,15 +137,47 @@ func (sam *StagedAlertManager) OnBreakerTriggered(context *AlertContext, breaker
 
 	// Send an initial low-priority alert
 	go sam.sendInitialAlert(pending)
+}
+
+// maxPendingAlerts returns the configured cap on pending alerts, or its default
+func (sam *StagedAlertManager) maxPendingAlerts() int {
+	if sam.currentConfig().MaxPendingAlerts <= 0 {
+		return defaultMaxPendingAlerts
+	}
+	return sam.currentConfig().MaxPendingAlerts
+}
+
+// coalesce folds a trip into the most recent pending alert, which keeps its context and
+// escalation schedule. It must be called with the lock held.
+func (sam *StagedAlertManager) coalesce() {
+	var latest *PendingAlert
+	for _, pending := range sam.pendingAlerts {
+		if latest == nil || pending.TriggerTime.After(latest.TriggerTime) {
+			latest = pending
+		}
+	}
+	if latest == nil {
+		return
+	}
 
-	//Completely clean the internal state
-	sam.pendingAlerts = make(map[string]*PendingAlert)
-	log.Printf("✅ Internal monitor state cleared")
+	latest.CoalescedTrips++
+	log.Printf("🔄 Circuit breaker triggered again - %d pending alerts (max_pending_alerts), coalesced into %s (%d coalesced trips)",
+		len(sam.pendingAlerts), latest.ID, latest.CoalescedTrips)
+}
+
+// openTrip returns the trip of the open alerts sent for pending, with the trips
+// coalesced into it so far
+func (sam *StagedAlertManager) openTrip(pending *PendingAlert) AggregatedTrip {
+	trip := pending.Context.openTrip()
+	sam.mutex.RLock()
+	trip.CoalescedTrips = pending.CoalescedTrips
+	sam.mutex.RUnlock()
+	return trip
 }
 
 // sendInitialAlert sends the initial low-priority alert
 func (sam *StagedAlertManager) sendInitialAlert(pending *PendingAlert) {
-	if !sam.config.TriggerOnOpen {
+	if !sam.currentConfig().TriggerOnOpen {
 		log.Printf("⚠️ Initial alert skipped - trigger_on_breaker_open is disabled")
 		return
 	}
@@ -109,19 +188,11 @@ func (sam *StagedAlertManager) sendInitialAlert(pending *PendingAlert) {
 		pending.Context.MemoryUsage,
 		pending.Context.WaitTime)
 
-	// Temporarily change the priority for the initial alert
-	originalPriority := sam.config.Priority
-	sam.config.Priority = sam.config.InitialAlertPriority
-
-	// Send alert using the existing OpsGenie system
-	err := sam.opsGenieClient.SendBreakerOpenAlert(
-		pending.Context.PeakLatency,
-		pending.Context.MemoryUsage < 80, // Invert for the memoryOK parameter
-		pending.Context.WaitTime,
-	)
-
-	// Restore original priority
-	sam.config.Priority = originalPriority
+	// Send alert using the existing OpsGenie system, with the initial priority, aggregated
+	// with the other trips of the window (see alert_aggregation_seconds)
+	trip := sam.openTrip(pending)
+	trip.Priority = sam.currentConfig().InitialAlertPriority
+	err := sam.opsGenieClient.AggregateBreakerOpenAlert(trip)
 
 	if err != nil {
 		log.Printf("❌ Failed to send initial alert: %v", err)
@@ -133,7 +204,7 @@ func (sam *StagedAlertManager) sendInitialAlert(pending *PendingAlert) {
 	sam.mutex.Unlock()
 
 	log.Printf("📤 Initial monitoring alert sent successfully (Priority: %s, ID: %s)",
-		sam.config.InitialAlertPriority, pending.ID)
+		sam.currentConfig().InitialAlertPriority, pending.ID)
 }
 
 // monitorPendingAlerts monitors pending alerts for escalation
@@ -151,25 +222,61 @@ func (sam *StagedAlertManager) monitorPendingAlerts() {
 	}
 }
 
+// SetClock makes the manager measure the age of the pending alerts with clock; a nil
+// clock restores RealClock. With a MockClock, tests advance the clock and call
+// CheckPendingAlerts instead of waiting for the escalation.
+func (sam *StagedAlertManager) SetClock(clock Clock) {
+	sam.mutex.Lock()
+	defer sam.mutex.Unlock()
+	sam.clock = clock
+}
+
+// now returns the current time of the manager's clock. It must run in a critical
+// section.
+func (sam *StagedAlertManager) now() time.Time {
+	if sam.clock == nil {
+		return time.Now()
+	}
+	return sam.clock.Now()
+}
+
+// CheckPendingAlerts escalates or resolves the pending alerts that are due, as the
+// background check does every 10 seconds
+func (sam *StagedAlertManager) CheckPendingAlerts() {
+	sam.checkPendingAlerts()
+}
+
 // checkPendingAlerts checks if alerts should be escalated or resolved
 func (sam *StagedAlertManager) checkPendingAlerts() {
+	triggered := sam.breakerStates()
+
 	sam.mutex.Lock()
 	defer sam.mutex.Unlock()
 
-	now := time.Now()
+	now := sam.now()
 	alertsToRemove := []string{}
 
 	for alertID, pending := range sam.pendingAlerts {
-		// Check if it's time to evaluate this alert
-		if now.After(pending.ScheduledCheck) && !pending.EscalatedAlertSent {
+		// Alerts created after the breakers were queried wait for the next check
+		isStillTriggered, checked := triggered[alertID]
+		if !checked {
+			continue
+		}
 
-			// Check if the breaker is still triggered
-			isStillTriggered := pending.BreakerInstance.TriggeredByLatencies()
+		// The escalation ladder, when configured, replaces the escalated alert
+		if len(sam.currentConfig().PriorityEscalationLadder) > 0 {
+			if sam.climbEscalationLadder(now, pending, isStillTriggered) {
+				alertsToRemove = append(alertsToRemove, alertID)
+			}
+			continue
+		}
 
+		// Check if it's time to evaluate this alert
+		if now.After(pending.ScheduledCheck) && !pending.EscalatedAlertSent {
 			if isStillTriggered {
 				// Escalate: The problem persists
 				log.Printf("🚨 Escalating alert %s: Breaker has been triggered for %d seconds",
-					alertID, sam.config.TimeBeforeSendAlert)
+					alertID, sam.currentConfig().TimeBeforeSendAlert)
 				go sam.sendEscalatedAlert(pending)
 				pending.EscalatedAlertSent = true
 			} else {
@@ -182,7 +289,7 @@ func (sam *StagedAlertManager) checkPendingAlerts() {
 		}
 
 		// Clean up very old alerts (safety mechanism)
-		maxAge := time.Duration(sam.config.TimeBeforeSendAlert*3) * time.Second
+		maxAge := time.Duration(sam.currentConfig().TimeBeforeSendAlert*3) * time.Second
 		if now.Sub(pending.TriggerTime) > maxAge {
 			if !pending.EscalatedAlertSent {
 				log.Printf("⚠️ Cleaning up stale alert: %s (age: %v)",
@@ -203,9 +310,63 @@ func (sam *StagedAlertManager) checkPendingAlerts() {
 	}
 }
 
+// breakerStates reports whether the breaker of each pending alert is still triggered. The
+// breakers are queried without holding the lock, because a breaker reads the pending
+// alerts while holding its own lock (see GetBreakerStatus).
+func (sam *StagedAlertManager) breakerStates() map[string]bool {
+	sam.mutex.RLock()
+	breakers := make(map[string]Breaker, len(sam.pendingAlerts))
+	for alertID, pending := range sam.pendingAlerts {
+		breakers[alertID] = pending.BreakerInstance
+	}
+	sam.mutex.RUnlock()
+
+	triggered := make(map[string]bool, len(breakers))
+	for alertID, breakerInstance := range breakers {
+		triggered[alertID] = breakerInstance.Triggered()
+	}
+	return triggered
+}
+
+// climbEscalationLadder sends an alert with the priority of the highest ladder step the
+// pending alert has reached, if it was not sent yet; steps reached between two checks are
+// collapsed into one alert. It returns true when the breaker has recovered and the alert
+// is resolved. It must be called with the lock held.
+func (sam *StagedAlertManager) climbEscalationLadder(now time.Time, pending *PendingAlert, triggered bool) bool {
+	if !triggered {
+		log.Printf("✅ Resolving alert %s: Breaker recovered after %d escalation steps", pending.ID, pending.LadderStep)
+		go sam.sendResolutionAlert(pending, "automatic_recovery")
+		return true
+	}
+
+	ladder := sam.currentConfig().PriorityEscalationLadder
+	reached := pending.LadderStep
+	for reached < len(ladder) && now.Sub(pending.TriggerTime) >= time.Duration(ladder[reached].AfterSeconds)*time.Second {
+		reached++
+	}
+	if reached == pending.LadderStep {
+		return false
+	}
+
+	step := ladder[reached-1]
+	log.Printf("🚨 Escalating alert %s to %s: Breaker has been triggered for %d seconds",
+		pending.ID, step.Priority, step.AfterSeconds)
+	go sam.sendAlertWithPriority(pending, step.Priority)
+	pending.LadderStep = reached
+	pending.EscalatedAlertSent = true
+	return false
+}
+
 // sendEscalatedAlert sends an escalated alert
 func (sam *StagedAlertManager) sendEscalatedAlert(pending *PendingAlert) {
-	duration := time.Since(pending.TriggerTime)
+	sam.sendAlertWithPriority(pending, sam.currentConfig().EscalatedAlertPriority)
+}
+
+// sendAlertWithPriority sends an escalated alert with the given priority
+func (sam *StagedAlertManager) sendAlertWithPriority(pending *PendingAlert, priority string) {
+	sam.mutex.RLock()
+	duration := sam.now().Sub(pending.TriggerTime)
+	sam.mutex.RUnlock()
 
 	log.Printf("🚨 Sending ESCALATED alert (ID: %s) - Issue persists after %v",
 		pending.ID, duration)
@@ -214,19 +375,10 @@ func (sam *StagedAlertManager) sendEscalatedAlert(pending *PendingAlert) {
 		pending.Context.MemoryUsage,
 		pending.Context.TriggerReason)
 
-	// Temporarily change the priority for the escalated alert
-	originalPriority := sam.config.Priority
-	sam.config.Priority = sam.config.EscalatedAlertPriority
-
 	// Use the existing OpsGenie system but with escalation context
-	err := sam.opsGenieClient.SendBreakerOpenAlert(
-		pending.Context.PeakLatency,
-		pending.Context.MemoryUsage < 80, // Invert for the memoryOK parameter
-		pending.Context.WaitTime,
-	)
-
-	// Restore original priority
-	sam.config.Priority = originalPriority
+	trip := sam.openTrip(pending)
+	trip.Priority = priority
+	err := sam.opsGenieClient.AggregateBreakerOpenAlert(trip)
 
 	if err != nil {
 		log.Printf("❌ Failed to send escalated alert: %v", err)
@@ -234,18 +386,24 @@ func (sam *StagedAlertManager) sendEscalatedAlert(pending *PendingAlert) {
 	}
 
 	log.Printf("🚨 ESCALATED alert sent successfully (Priority: %s, Duration: %v, ID: %s)",
-		sam.config.EscalatedAlertPriority, duration, pending.ID)
+		priority, duration, pending.ID)
 }
 
 // sendResolutionAlert sends a resolution alert
 func (sam *StagedAlertManager) sendResolutionAlert(pending *PendingAlert, method string) {
-	duration := time.Since(pending.TriggerTime)
+	sam.mutex.RLock()
+	duration := sam.now().Sub(pending.TriggerTime)
+	sam.mutex.RUnlock()
 
 	log.Printf("✅ Sending resolution alert (ID: %s) - Recovered after %v using %s",
 		pending.ID, duration, method)
 
 	// Use the existing OpsGenie system for resolution
-	err := sam.opsGenieClient.SendBreakerResetAlert()
+	reason := ResetAlertAutomatic
+	if method == "manual_reset" {
+		reason = ResetAlertManual
+	}
+	err := sam.opsGenieClient.SendBreakerResetAlertWithReason(reason)
 
 	if err != nil {
 		log.Printf("❌ Failed to send resolution alert: %v", err)
@@ -254,6 +412,12 @@ func (sam *StagedAlertManager) sendResolutionAlert(pending *PendingAlert, method
 
 	log.Printf("✅ Resolution alert sent successfully - Circuit breaker recovered after %v (ID: %s)",
 		duration, pending.ID)
+
+	// Close the open alert this incident created, if any
+	note := fmt.Sprintf("Circuit breaker recovered after %v (%s)", duration.Round(time.Second), method)
+	if err := sam.opsGenieClient.CloseLastAlert("circuit-open", note); err != nil {
+		log.Printf("❌ Failed to close open alert: %v", err)
+	}
 }
 
 // OnBreakerRecovered is called when the circuit breaker recovers manually
@@ -278,6 +442,35 @@ func (sam *StagedAlertManager) OnBreakerRecovered() {
 	log.Printf("✅ All pending alerts resolved due to manual breaker recovery")
 }
 
+// ResolvePendingAlerts resolves the pending alert alertID, or all of them when alertID is
+// empty, without waiting for the breaker to recover, e.g. because the downstream was
+// fixed out-of-band: their escalations are cancelled and the open alert of the incident
+// is closed. It returns the number of alerts resolved.
+func (sam *StagedAlertManager) ResolvePendingAlerts(alertID string) int {
+	sam.mutex.Lock()
+	defer sam.mutex.Unlock()
+
+	resolved := 0
+	for id, pending := range sam.pendingAlerts {
+		if alertID != "" && id != alertID {
+			continue
+		}
+		log.Printf("✅ Resolving alert %s manually after %d escalation steps", pending.ID, pending.LadderStep)
+		delete(sam.pendingAlerts, id)
+		resolved++
+	}
+	if resolved == 0 {
+		return 0
+	}
+
+	go func() {
+		if err := sam.opsGenieClient.CloseLastAlert("circuit-open", "Pending alerts resolved via breaker API"); err != nil {
+			log.Printf("❌ Failed to close open alert: %v", err)
+		}
+	}()
+	return resolved
+}
+
 // GetPendingAlertsCount returns the number of pending alerts (for debugging)
 func (sam *StagedAlertManager) GetPendingAlertsCount() int {
 	sam.mutex.RLock()
@@ -296,10 +489,12 @@ func (sam *StagedAlertManager) GetPendingAlertsInfo() map[string]map[string]inte
 			"trigger_time":         pending.TriggerTime,
 			"initial_alert_sent":   pending.InitialAlertSent,
 			"escalated_alert_sent": pending.EscalatedAlertSent,
+			"ladder_step":          pending.LadderStep,
 			"scheduled_check":      pending.ScheduledCheck,
-			"age_seconds":          time.Since(pending.TriggerTime).Seconds(),
+			"age_seconds":          sam.now().Sub(pending.TriggerTime).Seconds(),
 			"peak_latency":         pending.Context.PeakLatency,
 			"trigger_reason":       pending.Context.TriggerReason,
+			"coalesced_trips":      pending.CoalescedTrips,
 		}
 	}
 	return info
@@ -0,0 +1,197 @@
+package breaker
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// SharedState is the trip state a breaker shares with the breakers of other replicas
+type SharedState struct {
+	Triggered bool      `json:"triggered"`
+	TripTime  time.Time `json:"trip_time"` // Zero when Triggered is false
+	Source    string    `json:"source"`    // Breaker that published the state
+}
+
+// StateStore shares trip states between the replicas of a service, so that a trip seen
+// by one replica can be honored by the others (see honor_shared_trips). It is optional;
+// the redisstore package provides an implementation backed by Redis. Implementations
+// must be safe for concurrent use.
+type StateStore interface {
+	// Publish announces the trip state of a breaker to every subscriber
+	Publish(ctx context.Context, state SharedState) error
+
+	// Subscribe calls handler with every published state, including the breaker's own,
+	// until ctx is done. It blocks; an error other than the end of ctx means the
+	// subscription was lost and should be retried.
+	Subscribe(ctx context.Context, handler func(state SharedState)) error
+}
+
+// stateStoreRetryDelay is the wait before subscribing again after a lost subscription
+const stateStoreRetryDelay = time.Second
+
+// stateStoreTimeout bounds each Publish
+const stateStoreTimeout = 5 * time.Second
+
+// instanceCounter distinguishes the breakers of a process in their SharedState.Source
+var instanceCounter atomic.Int64
+
+func newInstanceID() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	return fmt.Sprintf("%s-%d-%d", hostname, os.Getpid(), instanceCounter.Add(1))
+}
+
+// SetStateStore connects the breaker to a store shared with other replicas. From then
+// on, the breaker publishes its trips and resets, and, if honor_shared_trips is set,
+// opens when another replica trips. A nil store disconnects the breaker. Close stops
+// the subscription.
+func (b *BreakerDriver) SetStateStore(store StateStore) {
+	b.stopSharing()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.stateStore = store
+	if store == nil || b.closed {
+		return
+	}
+	if b.instanceID == "" {
+		b.instanceID = newInstanceID()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	b.cancelSharing = cancel
+	b.publishSignal = make(chan struct{}, 1)
+	b.sharing.Add(2)
+	go b.publishStates(ctx, store, b.publishSignal)
+	go func() {
+		defer b.sharing.Done()
+		for {
+			err := store.Subscribe(ctx, b.applySharedState)
+			if ctx.Err() != nil {
+				return
+			}
+			b.logger.Logf("Warning: shared state subscription lost, retrying in %v: %v", stateStoreRetryDelay, err)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(stateStoreRetryDelay):
+			}
+		}
+	}()
+}
+
+// stopSharing cancels the subscription and waits for the publisher to send the pending
+// states. It must be called without holding the lock, which both goroutines take.
+func (b *BreakerDriver) stopSharing() {
+	b.mu.Lock()
+	cancel := b.cancelSharing
+	b.cancelSharing = nil
+	b.stateStore = nil
+	b.mu.Unlock()
+
+	if cancel != nil {
+		cancel()
+	}
+	b.sharing.Wait()
+}
+
+// publishState announces a trip (or a reset, with a zero tripTime) to the other
+// replicas. It must run in a critical section and does not block; the state is queued
+// for the publisher, which sends the states in the order they were queued.
+func (b *BreakerDriver) publishState(triggered bool, tripTime time.Time) {
+	if b.stateStore == nil {
+		return
+	}
+
+	state := SharedState{Triggered: triggered, TripTime: tripTime, Source: b.instanceID}
+	b.pendingStates = append(b.pendingStates, state)
+	select {
+	case b.publishSignal <- struct{}{}:
+	default: // The publisher is already signaled
+	}
+}
+
+// publishStates is the only goroutine that publishes to store, so that a reset cannot
+// overtake the trip before it. When ctx is done, it sends the states still queued and
+// returns.
+func (b *BreakerDriver) publishStates(ctx context.Context, store StateStore, signal <-chan struct{}) {
+	defer b.sharing.Done()
+	for {
+		done := false
+		select {
+		case <-ctx.Done():
+			done = true
+		case <-signal:
+		}
+
+		b.mu.Lock()
+		states := b.pendingStates
+		b.pendingStates = nil
+		b.mu.Unlock()
+
+		for _, state := range states {
+			publishCtx, cancel := context.WithTimeout(context.Background(), stateStoreTimeout)
+			if err := store.Publish(publishCtx, state); err != nil {
+				b.logger.Logf("Failed to publish shared breaker state (triggered=%v): %v", state.Triggered, err)
+			}
+			cancel()
+		}
+		if done {
+			return
+		}
+	}
+}
+
+// applySharedState honors the state published by another replica. A remote trip opens
+// a closed breaker as if it had tripped at the remote trip time, without sending alerts
+// (the replica that tripped sends them). A remote reset closes the breaker only if it
+// was opened by a remote trip; local evidence is not discarded.
+func (b *BreakerDriver) applySharedState(state SharedState) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if state.Source == b.instanceID || !b.config.HonorSharedTrips || !b.enabled.Load() {
+		return
+	}
+
+	if state.Triggered {
+		waitDuration := time.Duration(b.config.WaitTime) * time.Second
+		if b.triggered || b.now().Sub(state.TripTime) > waitDuration {
+			return
+		}
+		b.triggered = true
+		b.tripReason = TripReasonRemote
+		b.remoteTrip = true
+		b.lastTripTime = state.TripTime
+		b.resetRecovery()
+		b.markOpened(state.TripTime)
+		b.recordTrip(b.now())
+		b.emitEvent(EventTripped, TripReasonRemote)
+		b.logger.Logf("ACTION: Circuit breaker TRIGGERED because replica %s tripped at %s",
+			state.Source, state.TripTime.Format(time.RFC3339))
+		return
+	}
+
+	if b.triggered && b.remoteTrip {
+		b.triggered = false
+		b.remoteTrip = false
+		b.lastTripTime = time.Time{}
+		b.lastCloseTime = b.now()
+		b.emitEvent(EventReset, ResetReasonRemote)
+		b.logger.Logf("INFO: Circuit breaker reset because replica %s reset", state.Source)
+	}
+}
+
+// RemoteTrip reports whether the breaker is open because another replica tripped
+func (b *BreakerDriver) RemoteTrip() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.triggered && b.remoteTrip
+}
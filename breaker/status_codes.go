@@ -0,0 +1,110 @@
+package breaker
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// StatusCodeRange is an inclusive range of HTTP status codes
+type StatusCodeRange struct {
+	From int
+	To   int
+}
+
+// Contains reports whether code belongs to the range
+func (r StatusCodeRange) Contains(code int) bool {
+	return code >= r.From && code <= r.To
+}
+
+// ParseStatusCodeRanges parses status code specifications as used in
+// excluded_status_codes. Each entry is a single code ("404"), a class ("4xx")
+// or an inclusive range ("400-499").
+func ParseStatusCodeRanges(specs []string) ([]StatusCodeRange, error) {
+	var ranges []StatusCodeRange
+
+	for _, spec := range specs {
+		r, err := parseStatusCodeRange(strings.TrimSpace(spec))
+		if err != nil {
+			return nil, err
+		}
+		ranges = append(ranges, r)
+	}
+
+	return ranges, nil
+}
+
+func parseStatusCodeRange(spec string) (StatusCodeRange, error) {
+	lower := strings.ToLower(spec)
+
+	// Class of codes: 4xx, 5xx...
+	if len(lower) == 3 && strings.HasSuffix(lower, "xx") {
+		class, err := strconv.Atoi(lower[:1])
+		if err != nil || class < 1 || class > 5 {
+			return StatusCodeRange{}, fmt.Errorf("invalid status code class %q", spec)
+		}
+		return StatusCodeRange{From: class * 100, To: class*100 + 99}, nil
+	}
+
+	// Inclusive range: 400-499
+	if from, to, found := strings.Cut(lower, "-"); found {
+		fromCode, err := parseStatusCode(from)
+		if err != nil {
+			return StatusCodeRange{}, fmt.Errorf("invalid status code range %q: %v", spec, err)
+		}
+		toCode, err := parseStatusCode(to)
+		if err != nil {
+			return StatusCodeRange{}, fmt.Errorf("invalid status code range %q: %v", spec, err)
+		}
+		if fromCode > toCode {
+			return StatusCodeRange{}, fmt.Errorf("invalid status code range %q: start is greater than end", spec)
+		}
+		return StatusCodeRange{From: fromCode, To: toCode}, nil
+	}
+
+	// Single code: 404
+	code, err := parseStatusCode(lower)
+	if err != nil {
+		return StatusCodeRange{}, fmt.Errorf("invalid status code %q: %v", spec, err)
+	}
+	return StatusCodeRange{From: code, To: code}, nil
+}
+
+func parseStatusCode(value string) (int, error) {
+	code, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil {
+		return 0, fmt.Errorf("not a number")
+	}
+	if code < 100 || code > 599 {
+		return 0, fmt.Errorf("must be between 100 and 599")
+	}
+	return code, nil
+}
+
+// ParseRetryAfter parses the value of a Retry-After header, either a number of seconds
+// ("120") or an HTTP date, into the duration to wait from now. It returns false when
+// the value is empty or invalid; dates in the past give a zero duration.
+func ParseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	date, err := http.ParseTime(value)
+	if err != nil {
+		return 0, false
+	}
+	if wait := date.Sub(now); wait > 0 {
+		return wait, true
+	}
+	return 0, true
+}
@@ -0,0 +1,99 @@
+package breaker
+
+import "time"
+
+// stuckOpenMaxCheckInterval bounds how late the stuck-open alert can be sent
+const stuckOpenMaxCheckInterval = 10 * time.Second
+
+// stuckOpenCheckInterval checks ten times within max_open_duration_seconds, at most every
+// stuckOpenMaxCheckInterval, so the alert is sent shortly after the breaker gets stuck
+func stuckOpenCheckInterval(maxOpenSeconds int) time.Duration {
+	interval := time.Duration(maxOpenSeconds) * time.Second / 10
+	if interval > stuckOpenMaxCheckInterval {
+		interval = stuckOpenMaxCheckInterval
+	}
+	return interval
+}
+
+// startStuckOpenMonitor starts the background check that sends the stuck-open alert when
+// the breaker stays open longer than max_open_duration_seconds. It runs only when the
+// alert is configured at creation; Close stops it.
+func (b *BreakerDriver) startStuckOpenMonitor() {
+	if b.opsGenieClient == nil || b.config.OpsGenie == nil || !b.config.OpsGenie.Enabled ||
+		b.config.OpsGenie.MaxOpenDurationSeconds <= 0 {
+		return
+	}
+
+	stop := make(chan struct{})
+	b.stopStuckOpen = stop
+	b.stuckOpenMonitor.Add(1)
+	go func() {
+		defer b.stuckOpenMonitor.Done()
+		ticker := time.NewTicker(stuckOpenCheckInterval(b.config.OpsGenie.MaxOpenDurationSeconds))
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				openFor, reason, stuck := b.checkStuckOpen(b.now())
+				if !stuck {
+					continue
+				}
+				b.logger.Logf("WARNING: Circuit breaker stuck open for %v (reason: %s)", openFor.Round(time.Second), reason)
+				if err := b.opsGenieClient.SendStuckOpenAlert(openFor, reason); err != nil {
+					b.logger.Logf("Failed to send OpsGenie alert for breaker stuck open: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+// stopStuckOpenMonitor stops the stuck-open check. It must be called without holding the
+// lock, which the check takes.
+func (b *BreakerDriver) stopStuckOpenMonitor() {
+	b.mu.Lock()
+	stop := b.stopStuckOpen
+	b.stopStuckOpen = nil
+	b.mu.Unlock()
+
+	if stop != nil {
+		close(stop)
+	}
+	b.stuckOpenMonitor.Wait()
+}
+
+// markOpened starts a new open episode at the given time, unless the breaker closed by
+// itself less than wait_time before: a flapping breaker that re-trips as soon as it
+// closes stays in the same episode, so it can still reach max_open_duration_seconds. It
+// must run in a critical section.
+func (b *BreakerDriver) markOpened(at time.Time) {
+	waitDuration := time.Duration(b.config.WaitTime) * time.Second
+	if !b.openSince.IsZero() && !b.lastCloseTime.IsZero() && at.Sub(b.lastCloseTime) < waitDuration {
+		return
+	}
+	b.openSince = at
+	b.stuckOpenAlerted = false
+}
+
+// checkStuckOpen reports whether the current open episode has lasted longer than
+// max_open_duration_seconds and the stuck-open alert has not been sent in it.
+// Remote trips are left to the replica that tripped, which sends the alerts.
+func (b *BreakerDriver) checkStuckOpen(now time.Time) (time.Duration, string, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.triggered || b.remoteTrip || b.stuckOpenAlerted || !b.enabled.Load() || b.config.OpsGenie == nil {
+		return 0, "", false
+	}
+
+	maxOpen := time.Duration(b.config.OpsGenie.MaxOpenDurationSeconds) * time.Second
+	openFor := now.Sub(b.openSince)
+	if maxOpen <= 0 || openFor < maxOpen {
+		return 0, "", false
+	}
+
+	b.stuckOpenAlerted = true
+	return openFor, b.tripReason, true
+}
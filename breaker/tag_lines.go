@@ -0,0 +1,266 @@
+package breaker
+
+import "strings"
+
+// opsGenieTagsKey is the full key of the OpsGenie tags, whose line numbers are reported
+// when tags are validated
+const opsGenieTagsKey = "opsgenie.tags"
+
+// findTagLines returns the line of every element of the OpsGenie tags array, in the
+// order in which the elements are decoded
+func (loader *TOMLConfigLoader) findTagLines() []int {
+	return findTOMLArrayLines(loader.rawContent, opsGenieTagsKey)
+}
+
+// TagLines returns the line (starting at 1) of every OpsGenie tag in the file, in the
+// order in which the tags are decoded, so that tag Tags[i] is defined at TagLines()[i]
+func (loader *TOMLConfigLoader) TagLines() []int {
+	return loader.findTagLines()
+}
+
+// findTOMLArrayLines returns the line of every element of the array with the given full
+// key (e.g. "opsgenie.tags"), whether it is defined under a table header, as a dotted
+// key or in an inline table. Keys are matched case-insensitively, as the decoder does.
+//
+// It is a small TOML scanner rather than a line-based search, so comments, strings
+// holding commas, brackets or quotes, multi-line strings and multi-line arrays with
+// comments do not shift the line numbers. Malformed input never makes it fail; the
+// lines are then a best effort.
+func findTOMLArrayLines(content, key string) []int {
+	scanner := &tomlLineScanner{src: content, line: 1, target: strings.ToLower(key)}
+	scanner.scanDocument()
+	return scanner.lines
+}
+
+// tomlLineScanner walks a TOML document keeping track of the current line
+type tomlLineScanner struct {
+	src    string
+	pos    int
+	line   int
+	target string // Lowercase full key of the array whose element lines are collected
+	lines  []int
+}
+
+func (s *tomlLineScanner) eof() bool {
+	return s.pos >= len(s.src)
+}
+
+func (s *tomlLineScanner) peek() byte {
+	if s.eof() {
+		return 0
+	}
+	return s.src[s.pos]
+}
+
+func (s *tomlLineScanner) advance() {
+	if s.eof() {
+		return
+	}
+	if s.src[s.pos] == '\n' {
+		s.line++
+	}
+	s.pos++
+}
+
+// skipSpace skips blanks and comments, and also newlines if newlines is true
+func (s *tomlLineScanner) skipSpace(newlines bool) {
+	for !s.eof() {
+		switch c := s.peek(); {
+		case c == ' ' || c == '\t' || c == '\r':
+			s.advance()
+		case c == '\n' && newlines:
+			s.advance()
+		case c == '#':
+			for !s.eof() && s.peek() != '\n' {
+				s.advance()
+			}
+		default:
+			return
+		}
+	}
+}
+
+// skipLine skips the rest of the current line, including its newline
+func (s *tomlLineScanner) skipLine() {
+	for !s.eof() && s.peek() != '\n' {
+		s.advance()
+	}
+	s.advance()
+}
+
+func (s *tomlLineScanner) scanDocument() {
+	table := ""
+	for {
+		s.skipSpace(true)
+		if s.eof() {
+			return
+		}
+
+		if s.peek() == '[' {
+			// Table header: [table] or [[array.of.tables]]
+			s.advance()
+			if s.peek() == '[' {
+				s.advance()
+			}
+			table = s.readKey()
+			s.skipLine()
+			continue
+		}
+
+		key := s.readKey()
+		s.skipSpace(false)
+		if key == "" || s.peek() != '=' {
+			s.skipLine()
+			continue
+		}
+		s.advance()
+		s.skipSpace(false)
+
+		if table != "" {
+			key = table + "." + key
+		}
+		s.skipValue(key)
+		s.skipLine()
+	}
+}
+
+// readKey reads a bare, quoted or dotted key and returns it with its parts joined by
+// dots, or "" if there is no key at the current position
+func (s *tomlLineScanner) readKey() string {
+	var parts []string
+	for {
+		s.skipSpace(false)
+		start := s.pos
+		switch s.peek() {
+		case '"', '\'':
+			s.skipString()
+			parts = append(parts, strings.Trim(s.src[start:s.pos], `"'`))
+		default:
+			for !s.eof() && isBareKeyChar(s.peek()) {
+				s.advance()
+			}
+			if s.pos == start {
+				return strings.Join(parts, ".")
+			}
+			parts = append(parts, s.src[start:s.pos])
+		}
+
+		s.skipSpace(false)
+		if s.peek() != '.' {
+			return strings.Join(parts, ".")
+		}
+		s.advance()
+	}
+}
+
+func isBareKeyChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-'
+}
+
+// skipString skips a basic, literal or multi-line string starting at the current position
+func (s *tomlLineScanner) skipString() {
+	quote := s.peek()
+	if strings.HasPrefix(s.src[s.pos:], strings.Repeat(string(quote), 3)) {
+		s.pos += 3
+		for !s.eof() {
+			if quote == '"' && s.peek() == '\\' {
+				s.advance()
+				s.advance()
+				continue
+			}
+			if strings.HasPrefix(s.src[s.pos:], strings.Repeat(string(quote), 3)) {
+				s.pos += 3
+				// Up to two more quotes belong to the content ("""a"""" is `a"`)
+				for i := 0; i < 2 && s.peek() == quote; i++ {
+					s.advance()
+				}
+				return
+			}
+			s.advance()
+		}
+		return
+	}
+
+	s.advance()
+	for !s.eof() && s.peek() != quote && s.peek() != '\n' {
+		if quote == '"' && s.peek() == '\\' {
+			s.advance()
+		}
+		s.advance()
+	}
+	if s.peek() == quote {
+		s.advance()
+	}
+}
+
+// skipValue skips the value of key, collecting the lines of its elements if it is the
+// target array
+func (s *tomlLineScanner) skipValue(key string) {
+	switch s.peek() {
+	case '"', '\'':
+		s.skipString()
+
+	case '[':
+		s.advance()
+		collect := strings.ToLower(key) == s.target
+		for {
+			s.skipSpace(true)
+			if s.eof() {
+				return
+			}
+			if s.peek() == ']' {
+				s.advance()
+				return
+			}
+
+			start := s.pos
+			if collect {
+				s.lines = append(s.lines, s.line)
+			}
+			s.skipValue("")
+			s.skipSpace(true)
+			switch {
+			case s.peek() == ',':
+				s.advance()
+			case s.peek() != ']' && s.pos == start:
+				// Malformed element; move on so that the scan always progresses
+				s.advance()
+			}
+		}
+
+	case '{':
+		s.advance()
+		for {
+			s.skipSpace(true)
+			if s.eof() {
+				return
+			}
+			if s.peek() == '}' {
+				s.advance()
+				return
+			}
+
+			start := s.pos
+			innerKey := s.readKey()
+			s.skipSpace(false)
+			if s.peek() == '=' {
+				s.advance()
+				s.skipSpace(false)
+				s.skipValue(key + "." + innerKey)
+			}
+			s.skipSpace(true)
+			switch {
+			case s.peek() == ',':
+				s.advance()
+			case s.peek() != '}' && s.pos == start:
+				s.advance()
+			}
+		}
+
+	default:
+		// Number, boolean or date
+		for !s.eof() && !strings.ContainsRune(",]}\n#", rune(s.peek())) {
+			s.advance()
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package breaker
+
+import "time"
+
+// defaultTripFrequencyWindow is the trip_frequency_window_seconds used when it is not set
+const defaultTripFrequencyWindow = time.Minute
+
+// tripFrequencyWindow returns trip_frequency_window_seconds as a duration, or a minute
+// when it is not set
+func (c *Config) tripFrequencyWindow() time.Duration {
+	if c.TripFrequencyWindowSeconds <= 0 {
+		return defaultTripFrequencyWindow
+	}
+	return time.Duration(c.TripFrequencyWindowSeconds) * time.Second
+}
+
+// recordTrip counts a trip of the breaker at the given time, dropping the trip times
+// that no window can report anymore. It must be called with the lock held.
+func (b *BreakerDriver) recordTrip(at time.Time) {
+	b.tripCount.Add(1)
+	b.tripTimes = append(b.tripTimes, at)
+	b.pruneTripTimes(at)
+}
+
+// tripRetention is how long trip times are kept: the configured window, and at least
+// the minute of TripsInLastMinute
+func (b *BreakerDriver) tripRetention() time.Duration {
+	return max(b.config.tripFrequencyWindow(), time.Minute)
+}
+
+// pruneTripTimes drops the trip times older than tripRetention. It must be called with
+// the lock held.
+func (b *BreakerDriver) pruneTripTimes(now time.Time) {
+	cutoff := now.Add(-b.tripRetention())
+	keep := 0
+	for keep < len(b.tripTimes) && !b.tripTimes[keep].After(cutoff) {
+		keep++
+	}
+	if keep > 0 {
+		b.tripTimes = append(b.tripTimes[:0], b.tripTimes[keep:]...)
+	}
+}
+
+// tripsWithin returns the trips in the window ending now. It must be called with the
+// lock held.
+func (b *BreakerDriver) tripsWithin(window time.Duration, now time.Time) int {
+	cutoff := now.Add(-window)
+	count := 0
+	for i := len(b.tripTimes) - 1; i >= 0 && b.tripTimes[i].After(cutoff); i-- {
+		count++
+	}
+	return count
+}
+
+// TripsWithin returns how many times the breaker tripped (went from closed to open) in
+// the last window. Trips are kept for trip_frequency_window_seconds, and at least a
+// minute, so longer windows report only those.
+func (b *BreakerDriver) TripsWithin(window time.Duration) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.tripsWithin(window, b.now())
+}
+
+// TripsInLastMinute returns how many times the breaker tripped in the last minute. A
+// high value means that the breaker is flapping.
+func (b *BreakerDriver) TripsInLastMinute() int {
+	return b.TripsWithin(time.Minute)
+}
+
+// RecentTripCount returns how many times the breaker tripped within
+// trip_frequency_window_seconds (a minute by default)
+func (b *BreakerDriver) RecentTripCount() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.tripsWithin(b.config.tripFrequencyWindow(), b.now())
+}
+
+// ResetTripFrequency forgets the recent trips, e.g. once the flapping has been dealt
+// with. TripCount, the total, is not affected.
+func (b *BreakerDriver) ResetTripFrequency() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tripTimes = nil
+}
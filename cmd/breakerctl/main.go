@@ -0,0 +1,202 @@
+// Command breakerctl interacts with a running breaker through its HTTP API.
+//
+// Usage:
+//
+//	breakerctl [-url http://localhost:8080] [-timeout 10s] <command> [arguments]
+//
+// Commands:
+//
+//	status                  Show the breaker status (GET /breaker/status)
+//	reset [-keep-history]   Reset the breaker (POST /breaker/reset)
+//	set-latency <ms>        Set the latency threshold (POST /breaker/latency)
+//	opsgenie status         Show the OpsGenie configuration (GET /breaker/opsgenie/status)
+//	opsgenie test           Check the connection to OpsGenie (GET /breaker/opsgenie/test)
+//
+// The base URL can also be set with the BREAKER_URL environment variable.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultBaseURL = "http://localhost:8080"
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run executes breakerctl with the given arguments and returns the process exit code
+func run(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("breakerctl", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() { usage(stderr) }
+
+	baseURL := flags.String("url", envOrDefault("BREAKER_URL", defaultBaseURL), "base URL of the service exposing the breaker endpoints")
+	timeout := flags.Duration("timeout", 10*time.Second, "HTTP request timeout")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if flags.NArg() == 0 {
+		usage(stderr)
+		return 2
+	}
+
+	client := &apiClient{
+		baseURL: strings.TrimRight(*baseURL, "/"),
+		http:    &http.Client{Timeout: *timeout},
+		out:     stdout,
+	}
+
+	command, commandArgs := flags.Arg(0), flags.Args()[1:]
+
+	var err error
+	switch command {
+	case "status":
+		err = client.do(http.MethodGet, "/breaker/status", nil)
+	case "reset":
+		err = resetCommand(client, commandArgs, stderr)
+	case "set-latency":
+		err = setLatencyCommand(client, commandArgs)
+	case "opsgenie":
+		err = opsGenieCommand(client, commandArgs)
+	case "help", "-h", "--help":
+		usage(stdout)
+		return 0
+	default:
+		err = fmt.Errorf("unknown command %q", command)
+	}
+
+	if err != nil {
+		fmt.Fprintf(stderr, "breakerctl: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+func resetCommand(client *apiClient, args []string, stderr io.Writer) error {
+	flags := flag.NewFlagSet("reset", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	keepHistory := flags.Bool("keep-history", false, "close the breaker but keep the latency history")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	body := map[string]interface{}{"confirm": true}
+	if *keepHistory {
+		body["clear_history"] = false
+	}
+	return client.do(http.MethodPost, "/breaker/reset", body)
+}
+
+func setLatencyCommand(client *apiClient, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: breakerctl set-latency <milliseconds>")
+	}
+
+	threshold, err := strconv.Atoi(args[0])
+	if err != nil || threshold <= 0 {
+		return fmt.Errorf("invalid latency threshold %q: must be a positive number of milliseconds", args[0])
+	}
+
+	return client.do(http.MethodPost, "/breaker/latency", map[string]int{"threshold": threshold})
+}
+
+func opsGenieCommand(client *apiClient, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: breakerctl opsgenie <status|test>")
+	}
+
+	switch args[0] {
+	case "status":
+		return client.do(http.MethodGet, "/breaker/opsgenie/status", nil)
+	case "test":
+		return client.do(http.MethodGet, "/breaker/opsgenie/test", nil)
+	default:
+		return fmt.Errorf("unknown opsgenie command %q", args[0])
+	}
+}
+
+// apiClient sends requests to the breaker endpoints and pretty-prints the responses
+type apiClient struct {
+	baseURL string
+	http    *http.Client
+	out     io.Writer
+}
+
+// do sends the request, prints the response and returns an error for non-2xx statuses
+func (c *apiClient) do(method, path string, body interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequest(method, c.baseURL+path, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(c.out, prettyJSON(data))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("%s %s returned %s", method, path, resp.Status)
+	}
+	return nil
+}
+
+// prettyJSON indents data when it is JSON and returns it unchanged otherwise
+func prettyJSON(data []byte) string {
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, data, "", "  "); err != nil {
+		return string(data)
+	}
+	return buf.String()
+}
+
+func envOrDefault(name, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintf(w, `Usage: breakerctl [-url %s] [-timeout 10s] <command> [arguments]
+
+Commands:
+  status                  Show the breaker status
+  reset [-keep-history]   Reset the breaker
+  set-latency <ms>        Set the latency threshold in milliseconds
+  opsgenie status         Show the OpsGenie configuration
+  opsgenie test           Check the connection to OpsGenie
+
+The base URL can also be set with the BREAKER_URL environment variable.
+`, defaultBaseURL)
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// receivedRequest is a request seen by the fake breaker API
+type receivedRequest struct {
+	method string
+	path   string
+	body   map[string]interface{}
+}
+
+// newFakeAPI returns a server that records the requests it receives and answers them
+// with a compact JSON body
+func newFakeAPI(t *testing.T) (*httptest.Server, *[]receivedRequest) {
+	var received []receivedRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		request := receivedRequest{method: r.Method, path: r.URL.Path}
+		if data, _ := io.ReadAll(r.Body); len(data) > 0 {
+			require.NoError(t, json.Unmarshal(data, &request.body))
+		}
+		received = append(received, request)
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"path":"` + r.URL.Path + `","ok":true}`))
+	}))
+	t.Cleanup(server.Close)
+	return server, &received
+}
+
+func TestCommands(t *testing.T) {
+	tests := []struct {
+		args   []string
+		method string
+		path   string
+		body   map[string]interface{}
+	}{
+		{[]string{"status"}, http.MethodGet, "/breaker/status", nil},
+		{[]string{"reset"}, http.MethodPost, "/breaker/reset", map[string]interface{}{"confirm": true}},
+		{[]string{"reset", "-keep-history"}, http.MethodPost, "/breaker/reset",
+			map[string]interface{}{"confirm": true, "clear_history": false}},
+		{[]string{"set-latency", "500"}, http.MethodPost, "/breaker/latency", map[string]interface{}{"threshold": float64(500)}},
+		{[]string{"opsgenie", "status"}, http.MethodGet, "/breaker/opsgenie/status", nil},
+		{[]string{"opsgenie", "test"}, http.MethodGet, "/breaker/opsgenie/test", nil},
+	}
+
+	for _, test := range tests {
+		t.Run(strings.Join(test.args, " "), func(t *testing.T) {
+			server, received := newFakeAPI(t)
+			var stdout, stderr bytes.Buffer
+
+			code := run(append([]string{"-url", server.URL + "/"}, test.args...), &stdout, &stderr)
+			require.Equal(t, 0, code, stderr.String())
+
+			require.Len(t, *received, 1)
+			request := (*received)[0]
+			assert.Equal(t, test.method, request.method)
+			assert.Equal(t, test.path, request.path)
+			assert.Equal(t, test.body, request.body)
+
+			// The response is pretty-printed
+			assert.Equal(t, "{\n  \"path\": \""+test.path+"\",\n  \"ok\": true\n}\n", stdout.String())
+		})
+	}
+}
+
+func TestBaseURLFromEnvironment(t *testing.T) {
+	server, received := newFakeAPI(t)
+	t.Setenv("BREAKER_URL", server.URL)
+
+	var stdout, stderr bytes.Buffer
+	require.Equal(t, 0, run([]string{"status"}, &stdout, &stderr), stderr.String())
+	require.Len(t, *received, 1)
+	assert.Equal(t, "/breaker/status", (*received)[0].path)
+}
+
+func TestInvalidArguments(t *testing.T) {
+	tests := []struct {
+		args    []string
+		code    int
+		message string
+	}{
+		{nil, 2, "Usage"},
+		{[]string{"unknown"}, 1, `unknown command "unknown"`},
+		{[]string{"set-latency"}, 1, "usage: breakerctl set-latency"},
+		{[]string{"set-latency", "fast"}, 1, `invalid latency threshold "fast"`},
+		{[]string{"set-latency", "-5"}, 1, `invalid latency threshold "-5"`},
+		{[]string{"opsgenie"}, 1, "usage: breakerctl opsgenie"},
+		{[]string{"opsgenie", "close"}, 1, `unknown opsgenie command "close"`},
+		{[]string{"reset", "-unknown"}, 1, "flag provided but not defined"},
+	}
+
+	for _, test := range tests {
+		t.Run(strings.Join(test.args, " "), func(t *testing.T) {
+			server, received := newFakeAPI(t)
+			var stdout, stderr bytes.Buffer
+
+			code := run(append([]string{"-url", server.URL}, test.args...), &stdout, &stderr)
+			assert.Equal(t, test.code, code)
+			assert.Contains(t, stderr.String(), test.message)
+			assert.Empty(t, *received, "Invalid arguments should not reach the API")
+		})
+	}
+}
+
+func TestErrorStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+		_, _ = w.Write([]byte(`{"error":"Failed to connect to OpsGenie"}`))
+	}))
+	defer server.Close()
+
+	var stdout, stderr bytes.Buffer
+	assert.Equal(t, 1, run([]string{"-url", server.URL, "opsgenie", "test"}, &stdout, &stderr))
+	assert.Contains(t, stdout.String(), `"error": "Failed to connect to OpsGenie"`, "The error body is printed")
+	assert.Contains(t, stderr.String(), "GET /breaker/opsgenie/test returned 502 Bad Gateway")
+}
+
+func TestUnreachableAPI(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	url := server.URL
+	server.Close()
+
+	var stdout, stderr bytes.Buffer
+	assert.Equal(t, 1, run([]string{"-url", url, "status"}, &stdout, &stderr))
+	assert.Contains(t, stderr.String(), "breakerctl:")
+	assert.Empty(t, stdout.String())
+}
+
+func TestHelp(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	assert.Equal(t, 0, run([]string{"help"}, &stdout, &stderr))
+	assert.Contains(t, stdout.String(), "set-latency <ms>")
+}
+
+func TestPrettyJSON(t *testing.T) {
+	assert.Equal(t, "{\n  \"a\": 1\n}", prettyJSON([]byte(`{"a":1}`)))
+	assert.Equal(t, "not json", prettyJSON([]byte("not json")), "Non-JSON bodies are printed as they are")
+}
@@ -18,6 +18,10 @@ var delayInMilliseconds time.Duration = 1000
 
 const defaultConfigPath = "example-config.toml"
 
+// rejectionStatus is the status code of the requests to /test rejected by the breaker
+// middleware; the default (cb.DefaultRejectionStatus) is 503
+var rejectionStatus = http.StatusTooManyRequests
+
 var breakerAPI *cb.BreakerAPI
 var ApiBreaker cb.Breaker
 var testScenarios map[string]TestScenario
@@ -89,17 +93,9 @@ func initTestScenarios() {
 	}
 }
 
-// Main test endpoint with circuit breaker protection
+// Main test endpoint, protected by the breaker middleware, which rejects the requests
+// while the breaker is open and records the latency of the others
 func testEndpoint(ctx *gin.Context) {
-	if !ApiBreaker.Allow() {
-		ctx.JSON(http.StatusTooManyRequests, gin.H{
-			"error":             "Service unavailable - Circuit breaker is OPEN",
-			"breaker_triggered": true,
-			"suggestion":        "Wait for circuit breaker to reset or call /breaker/reset",
-		})
-		return
-	}
-
 	startTime := time.Now()
 
 	// Check for latency spike scenario
@@ -115,16 +111,13 @@ func testEndpoint(ctx *gin.Context) {
 	endTime := time.Now()
 	actualLatency := endTime.Sub(startTime).Milliseconds()
 
-	// Record latency with circuit breaker
-	ApiBreaker.Done(startTime, endTime)
-
 	ctx.JSON(http.StatusOK, gin.H{
 		"status":              "success",
 		"configured_delay_ms": delayInMilliseconds,
 		"actual_latency_ms":   actualLatency,
 		"breaker_status": gin.H{
 			"enabled":    ApiBreaker.IsEnabled(),
-			"triggered":  ApiBreaker.TriggeredByLatencies(),
+			"triggered":  ApiBreaker.Triggered(),
 			"memory_ok":  ApiBreaker.MemoryOK(),
 			"latency_ok": ApiBreaker.LatencyOK(),
 		},
@@ -387,7 +380,7 @@ func getSystemStatus(ctx *gin.Context) {
 		},
 		"circuit_breaker": gin.H{
 			"enabled":    ApiBreaker.IsEnabled(),
-			"triggered":  ApiBreaker.TriggeredByLatencies(),
+			"triggered":  ApiBreaker.Triggered(),
 			"memory_ok":  ApiBreaker.MemoryOK(),
 			"latency_ok": ApiBreaker.LatencyOK(),
 		},
@@ -538,7 +531,7 @@ func main() {
 	})
 
 	// Main application endpoints
-	router.GET("/test", testEndpoint)
+	router.GET("/test", cb.BreakerMiddleware(ApiBreaker, cb.WithRejectionStatus(rejectionStatus)), testEndpoint)
 	router.POST("/test/delay", setDelay)
 	router.POST("/test/trigger", triggerScenario)
 	router.GET("/test/scenarios", getScenarios)
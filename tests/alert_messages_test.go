@@ -0,0 +1,107 @@
+package tests
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/lrleon/go-breaker/breaker"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRenderAlertMessage(t *testing.T) {
+	data := breaker.AlertMessageData{
+		Environment:        "PROD",
+		API:                "payments/checkout",
+		ServiceTier:        "critical",
+		LatencyMs:          1800,
+		ThresholdMs:        1500,
+		MemoryUsagePercent: 91.256,
+	}
+
+	t.Run("Defaults", func(t *testing.T) {
+		client := breaker.NewOpsGenieClient(&breaker.OpsGenieConfig{Enabled: true})
+
+		assert.Equal(t, "[PROD] Circuit Breaker OPEN - payments/checkout",
+			client.RenderAlertMessage(breaker.MessageTemplateOpen, data))
+		assert.Equal(t, "[PROD] Circuit Breaker RESET - payments/checkout",
+			client.RenderAlertMessage(breaker.MessageTemplateReset, data))
+		manual := data
+		manual.ResetReason = breaker.ResetAlertManual
+		assert.Equal(t, "[PROD] Circuit Breaker RESET (manual) - payments/checkout",
+			client.RenderAlertMessage(breaker.MessageTemplateReset, manual))
+		assert.Equal(t, "[PROD] Memory Threshold Exceeded - payments/checkout (91.26%)",
+			client.RenderAlertMessage(breaker.MessageTemplateMemory, data))
+		assert.Equal(t, "[PROD] High Latency Detected - payments/checkout (1800ms)",
+			client.RenderAlertMessage(breaker.MessageTemplateLatency, data))
+	})
+
+	t.Run("CustomTemplates", func(t *testing.T) {
+		client := breaker.NewOpsGenieClient(&breaker.OpsGenieConfig{
+			Enabled: true,
+			MessageTemplates: map[string]string{
+				breaker.MessageTemplateOpen:    "[{{.ServiceTier}}] {{.API}} is failing, see https://runbooks/{{.API}}",
+				breaker.MessageTemplateLatency: "{{.API}}: p95 {{.LatencyMs}}ms > {{.ThresholdMs}}ms",
+			},
+		})
+
+		assert.Equal(t, "[critical] payments/checkout is failing, see https://runbooks/payments/checkout",
+			client.RenderAlertMessage(breaker.MessageTemplateOpen, data))
+		assert.Equal(t, "payments/checkout: p95 1800ms > 1500ms",
+			client.RenderAlertMessage(breaker.MessageTemplateLatency, data))
+		assert.Equal(t, "[PROD] Circuit Breaker RESET - payments/checkout",
+			client.RenderAlertMessage(breaker.MessageTemplateReset, data), "Alert types without a template use the default")
+	})
+
+	t.Run("BrokenTemplateFallsBack", func(t *testing.T) {
+		client := breaker.NewOpsGenieClient(&breaker.OpsGenieConfig{
+			Enabled: true,
+			MessageTemplates: map[string]string{
+				breaker.MessageTemplateOpen:  "{{.NoSuchField}}",
+				breaker.MessageTemplateReset: "   ",
+			},
+		})
+
+		assert.Equal(t, "[PROD] Circuit Breaker OPEN - payments/checkout",
+			client.RenderAlertMessage(breaker.MessageTemplateOpen, data))
+		assert.Equal(t, "[PROD] Circuit Breaker RESET - payments/checkout",
+			client.RenderAlertMessage(breaker.MessageTemplateReset, data))
+	})
+
+	t.Run("LongMessagesAreTruncated", func(t *testing.T) {
+		client := breaker.NewOpsGenieClient(&breaker.OpsGenieConfig{
+			Enabled:          true,
+			MessageTemplates: map[string]string{breaker.MessageTemplateOpen: strings.Repeat("x", 200)},
+		})
+
+		message := client.RenderAlertMessage(breaker.MessageTemplateOpen, data)
+		assert.Len(t, message, 130)
+		assert.True(t, strings.HasSuffix(message, "..."))
+	})
+}
+
+func TestMessageTemplatesValidation(t *testing.T) {
+	validate := func(templates map[string]string) error {
+		return breaker.ValidateOpsGenieConfig(&breaker.OpsGenieConfig{
+			Region:           "us",
+			Priority:         "P3",
+			MessageTemplates: templates,
+		})
+	}
+
+	assert.NoError(t, validate(map[string]string{"open": "{{.Environment}} {{.API}} {{.LatencyMs}}"}))
+
+	err := validate(map[string]string{"opened": "{{.API}}"})
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), `unknown alert type "opened"`)
+	}
+
+	err = validate(map[string]string{"reset": "{{.API"})
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), `invalid template for "reset"`)
+	}
+
+	err = validate(map[string]string{"memory": "{{.MemoryPercent}}"})
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "MemoryPercent", "Unknown fields should be reported")
+	}
+}
@@ -0,0 +1,46 @@
+package tests
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lrleon/go-breaker/breaker"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/goleak"
+)
+
+// TestBreakerCloseStopsBackgroundWorkers verifies that Close releases the goroutines
+// started by the breaker (staged alert monitor) and that it can be called repeatedly
+func TestBreakerCloseStopsBackgroundWorkers(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	b := breaker.NewBreaker(&breaker.Config{
+		MemoryThreshold:   80.0,
+		LatencyThreshold:  300,
+		LatencyWindowSize: 10,
+		Percentile:        0.95,
+		WaitTime:          10,
+		OpsGenie: &breaker.OpsGenieConfig{
+			Enabled:                true,
+			TimeBeforeSendAlert:    5,
+			InitialAlertPriority:   "P3",
+			EscalatedAlertPriority: "P1",
+			Team:                   "test-team",
+		},
+	}, "")
+
+	status := b.(*breaker.BreakerDriver).GetStagedAlertInfo()
+	assert.Equal(t, true, status["staged_alerting_enabled"])
+
+	assert.NoError(t, b.Close())
+	assert.NoError(t, b.Close(), "Close should be idempotent")
+
+	status = b.(*breaker.BreakerDriver).GetStagedAlertInfo()
+	assert.Equal(t, false, status["staged_alerting_enabled"])
+
+	// The breaker keeps working after Close
+	setMemoryOverride(b, true)
+	now := time.Now()
+	b.Done(now.Add(-10*time.Millisecond), now)
+	assert.True(t, b.Allow())
+}
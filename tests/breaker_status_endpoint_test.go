@@ -1,14 +1,18 @@
 package tests
 
 import (
+	"bytes"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"path/filepath"
 	"testing"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/lrleon/go-breaker/breaker"
+	"github.com/lrleon/go-breaker/breaker/breakertest"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -105,6 +109,7 @@ func TestGetBreakerStatusWithTriggeredBreaker(t *testing.T) {
 	if status.Triggered {
 		assert.True(t, status.CurrentPercentile > status.LatencyThreshold)
 		assert.False(t, status.LastTripTime.IsZero(), "LastTripTime should be set when breaker is triggered")
+		assert.Contains(t, status.TripReason, breaker.TripReasonLatency)
 	}
 
 	// Verify we have latency data
@@ -180,3 +185,596 @@ func TestGetBreakerStatusWithLatencyTrend(t *testing.T) {
 	// and depends on the exact timing of the test execution
 	t.Logf("Has positive trend: %v", status.HasPositiveTrend)
 }
+
+func TestGetBreakerStatusReportsSlowestDependency(t *testing.T) {
+	config := &breaker.Config{
+		MemoryThreshold:   80.0,
+		LatencyThreshold:  1000,
+		LatencyWindowSize: 20,
+		Percentile:        0.95,
+		WaitTime:          60,
+	}
+
+	breakerAPI := breaker.NewBreakerAPI(config)
+	driver := breakerAPI.Driver.(*breaker.BreakerDriver)
+
+	now := time.Now()
+	for i := 0; i < 5; i++ {
+		driver.DoneDependency("database", now.Add(-50*time.Millisecond), now)
+		driver.DoneDependency("payments", now.Add(-400*time.Millisecond), now)
+		driver.DoneDependency("", now.Add(-10*time.Millisecond), now)
+	}
+
+	name, latency := driver.SlowestDependency()
+	assert.Equal(t, "payments", name)
+	assert.Equal(t, int64(400), latency)
+	assert.Len(t, driver.DependencyLatencies(), 2)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	breaker.AddEndpointToRouter(router, breakerAPI)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/breaker/status", nil)
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var status breaker.BreakerStatus
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &status))
+	assert.Equal(t, "payments", status.SlowestDependency)
+	assert.Equal(t, int64(400), status.SlowestDependencyLatency)
+	assert.Equal(t, map[string]int64{"database": 50, "payments": 400}, status.DependencyLatencies)
+	assert.Len(t, status.RecentLatencies, 15, "dependency latencies are also recorded in the main window")
+
+	// Reset forgets the dependency history together with the main window
+	driver.Reset()
+	name, _ = driver.SlowestDependency()
+	assert.Empty(t, name)
+}
+
+func TestLatencySeriesEndpoint(t *testing.T) {
+	breakerAPI := breaker.NewBreakerAPI(&breaker.Config{
+		MemoryThreshold:   80,
+		LatencyThreshold:  1000,
+		LatencyWindowSize: 10,
+		Percentile:        0.95,
+		WaitTime:          600,
+	})
+	defer breakerAPI.Driver.Close()
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	breaker.AddEndpointToRouter(router, breakerAPI)
+
+	end := time.Now()
+	breakerAPI.Driver.Done(end.Add(-time.Second-200*time.Millisecond), end.Add(-time.Second))
+	breakerAPI.Driver.Done(end.Add(-300*time.Millisecond), end)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/breaker/latency-series", nil)
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var response struct {
+		Percentile float64                    `json:"percentile"`
+		Threshold  int64                      `json:"threshold"`
+		Series     []breaker.PercentileSample `json:"series"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, 0.95, response.Percentile)
+	assert.Equal(t, int64(1000), response.Threshold)
+	require.Len(t, response.Series, 2)
+	assert.Equal(t, int64(200), response.Series[0].PercentileMs)
+	assert.Equal(t, int64(300), response.Series[1].PercentileMs)
+	assert.True(t, response.Series[0].Timestamp.Before(response.Series[1].Timestamp))
+}
+
+// TestLatencySeriesEndpointWhileTheConfigChanges verifies that the series reports the
+// threshold of a configuration the setters applied (run with go test -race)
+func TestLatencySeriesEndpointWhileTheConfigChanges(t *testing.T) {
+	config := &breaker.Config{
+		MemoryThreshold:   80,
+		LatencyThreshold:  1000,
+		LatencyWindowSize: 10,
+		Percentile:        0.95,
+		WaitTime:          600,
+	}
+	driver := breaker.NewBreaker(config, filepath.Join(t.TempDir(), "breakers.toml")).(*breaker.BreakerDriver)
+	defer driver.Close()
+	breakerAPI := &breaker.BreakerAPI{Config: *config, Driver: driver}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	breaker.AddEndpointToRouter(router, breakerAPI)
+
+	changed := make(chan struct{})
+	go func() {
+		defer close(changed)
+		for threshold := 1001; threshold <= 1020; threshold++ {
+			w := httptest.NewRecorder()
+			body := bytes.NewBufferString(fmt.Sprintf(`{"threshold": %d}`, threshold))
+			req, _ := http.NewRequest("POST", "/breaker/latency", body)
+			req.Header.Set("Content-Type", "application/json")
+			router.ServeHTTP(w, req)
+		}
+	}()
+
+	for {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/breaker/latency-series", nil)
+		router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var response struct {
+			Threshold int64 `json:"threshold"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.True(t, response.Threshold >= 1000 && response.Threshold <= 1020, "threshold %d", response.Threshold)
+
+		select {
+		case <-changed:
+			assert.Equal(t, int64(1020), driver.Config().LatencyThreshold)
+			return
+		default:
+		}
+	}
+}
+
+func TestLatenciesSinceEndpoint(t *testing.T) {
+	breakerAPI := breaker.NewBreakerAPI(&breaker.Config{
+		MemoryThreshold:   80,
+		LatencyThreshold:  1000,
+		LatencyWindowSize: 10,
+		Percentile:        0.95,
+		WaitTime:          600,
+	})
+	defer breakerAPI.Driver.Close()
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	breaker.AddEndpointToRouter(router, breakerAPI)
+
+	end := time.Now()
+	breakerAPI.Driver.Done(end.Add(-time.Minute-400*time.Millisecond), end.Add(-time.Minute))
+	breakerAPI.Driver.Done(end.Add(-20*time.Second-200*time.Millisecond), end.Add(-20*time.Second))
+	breakerAPI.Driver.Done(end.Add(-300*time.Millisecond), end)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/breaker/latencies?since=30s", nil)
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var response struct {
+		SinceSeconds float64                 `json:"since_seconds"`
+		Count        int                     `json:"count"`
+		Latencies    []int64                 `json:"latencies"`
+		Records      []breaker.LatencyRecord `json:"records"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, 30.0, response.SinceSeconds)
+	assert.Equal(t, 2, response.Count)
+	assert.Equal(t, []int64{200, 300}, response.Latencies)
+	require.Len(t, response.Records, 2)
+	assert.Equal(t, int64(200*time.Millisecond), response.Records[0].Value)
+	assert.True(t, response.Records[0].Timestamp.Before(response.Records[1].Timestamp))
+
+	for _, since := range []string{"", "abc", "-5s", "0s"} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/breaker/latencies?since="+since, nil)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code, "since=%q should be rejected", since)
+	}
+}
+
+func TestGetBreakerStatusUnits(t *testing.T) {
+	breakerAPI := breaker.NewBreakerAPI(&breaker.Config{
+		MemoryThreshold:   50,
+		LatencyThreshold:  300,
+		LatencyWindowSize: 10,
+		Percentile:        0.95,
+		WaitTime:          10,
+	})
+	defer breakerAPI.Driver.Close()
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	breaker.AddEndpointToRouter(router, breakerAPI)
+
+	get := func(query string) (int, map[string]interface{}) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/breaker/status"+query, nil)
+		router.ServeHTTP(w, req)
+
+		var response map[string]interface{}
+		_ = json.Unmarshal(w.Body.Bytes(), &response)
+		return w.Code, response
+	}
+
+	code, response := get("")
+	require.Equal(t, http.StatusOK, code)
+	assert.Contains(t, response, "total_memory_mb")
+	assert.NotContains(t, response, "memory_units", "MB stays the default format")
+	assert.NotContains(t, response, "total_memory")
+
+	code, response = get("?units=bytes")
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "bytes", response["memory_units"])
+	totalMB := response["total_memory_mb"].(float64)
+	totalBytes := response["total_memory"].(float64)
+	assert.Equal(t, totalMB, float64(int64(totalBytes)/1024/1024))
+	assert.InDelta(t, totalBytes/2, response["memory_threshold"].(float64), 1)
+
+	code, response = get("?units=human")
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "human", response["memory_units"])
+	assert.Regexp(t, `^[0-9.]+ (B|KB|MB|GB|TB|PB|EB)$`, response["current_memory"])
+	assert.Regexp(t, `^[0-9.]+ (B|KB|MB|GB|TB|PB|EB)$`, response["total_memory"])
+
+	code, _ = get("?units=kb")
+	assert.Equal(t, http.StatusBadRequest, code)
+}
+
+func TestMemoryPercentFromBytes(t *testing.T) {
+	// 1.5 MB of a 1 GB limit would be 0% from whole megabytes
+	assert.Equal(t, 0.146484375, breaker.MemoryPercent(3*1024*1024/2, 1<<30))
+	assert.Equal(t, 50.0, breaker.MemoryPercent(512, 1024))
+	assert.Equal(t, 0.0, breaker.MemoryPercent(512, 0), "No percentage without a limit")
+
+	// A large limit makes the usage a small fraction of a percent
+	previousLimit := breaker.MemoryLimit
+	breaker.SetMemoryLimitFile(1 << 40)
+	defer breaker.SetMemoryLimitFile(previousLimit)
+
+	breakerAPI := breaker.NewBreakerAPI(&breaker.Config{
+		MemoryThreshold:   80,
+		LatencyThreshold:  300,
+		LatencyWindowSize: 10,
+		Percentile:        0.95,
+		WaitTime:          10,
+	})
+	defer breakerAPI.Driver.Close()
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	breaker.AddEndpointToRouter(router, breakerAPI)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/breaker/status", nil)
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var status breaker.BreakerStatus
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &status))
+	assert.Equal(t, int64(1<<40), status.TotalMemoryBytes)
+	assert.Equal(t, int64(1<<20), status.TotalMemoryMB)
+	assert.Positive(t, status.CurrentMemoryBytes)
+	assert.Equal(t, status.CurrentMemoryBytes/(1024*1024), status.CurrentMemoryUsage)
+	assert.Positive(t, status.MemoryUsagePercent)
+	assert.Equal(t, breaker.MemoryPercent(status.CurrentMemoryBytes, status.TotalMemoryBytes), status.MemoryUsagePercent)
+}
+
+func TestGetBreakerStatusWithoutMemoryLimit(t *testing.T) {
+	previousLimit := breaker.MemoryLimit
+	breaker.SetMemoryLimitFile(0)
+	defer breaker.SetMemoryLimitFile(previousLimit)
+
+	breakerAPI := breaker.NewBreakerAPI(&breaker.Config{
+		MemoryThreshold:   1,
+		LatencyThreshold:  300,
+		LatencyWindowSize: 10,
+		Percentile:        0.95,
+		WaitTime:          10,
+	})
+	defer breakerAPI.Driver.Close()
+
+	assert.False(t, breaker.MemoryCheckEnabled())
+	assert.True(t, breakerAPI.Driver.MemoryOK(), "Without a memory limit, memory checks are disabled")
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	breaker.AddEndpointToRouter(router, breakerAPI)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/breaker/status", nil)
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var response map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, false, response["memory_check_enabled"])
+	assert.Equal(t, true, response["memory_ok"])
+	assert.Equal(t, 0.0, response["memory_usage_percent"])
+}
+
+func TestGetBreakerStatusReportsWindowSpan(t *testing.T) {
+	config := &breaker.Config{
+		MemoryThreshold:   80.0,
+		LatencyThreshold:  300,
+		LatencyWindowSize: 10,
+		Percentile:        0.95,
+		WaitTime:          60,
+	}
+	breakerAPI := breaker.NewBreakerAPI(config)
+	defer breakerAPI.Driver.Close()
+
+	now := time.Now()
+	for _, age := range []time.Duration{90 * time.Second, 10 * time.Second, 4 * time.Second, 0} {
+		end := now.Add(-age)
+		breakerAPI.Driver.Done(end.Add(-50*time.Millisecond), end)
+	}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	breaker.AddEndpointToRouter(router, breakerAPI)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/breaker/status", nil)
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var status breaker.BreakerStatus
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &status))
+
+	// The 90s old latency is older than the wait time and does not count
+	assert.InDelta(t, 10.0, status.WindowSpanSeconds, 0.001)
+	assert.Equal(t, 60, status.WindowMaxAge)
+	require.NotNil(t, status.OldestSampleTime)
+	require.NotNil(t, status.NewestSampleTime)
+	assert.True(t, status.OldestSampleTime.Equal(now.Add(-10*time.Second)), "oldest sample %v", status.OldestSampleTime)
+	assert.True(t, status.NewestSampleTime.Equal(now), "newest sample %v", status.NewestSampleTime)
+	assert.True(t, status.DataSufficient)
+	assert.Equal(t, 1, status.WarmupMinSamples)
+	assert.Positive(t, status.ApproxMemoryBytes)
+	assert.Positive(t, status.HealthScore, "The latencies count in the health score")
+
+	// Without latencies the sample times are left out rather than reported as year 1
+	breakerAPI.Driver.Reset()
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	var response map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.NotContains(t, response, "oldest_sample_time")
+	assert.NotContains(t, response, "newest_sample_time")
+}
+
+func TestGetBreakerStatusReportsInsufficientData(t *testing.T) {
+	config := &breaker.Config{
+		MemoryThreshold:   80.0,
+		LatencyThreshold:  300,
+		LatencyWindowSize: 10,
+		Percentile:        0.95,
+		WaitTime:          60,
+		WarmupMinSamples:  5,
+	}
+	breakerAPI := breaker.NewBreakerAPI(config)
+	defer breakerAPI.Driver.Close()
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	breaker.AddEndpointToRouter(router, breakerAPI)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/breaker/status", nil)
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var status breaker.BreakerStatus
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &status))
+
+	// An empty window is not a healthy one
+	assert.True(t, status.LatencyOK)
+	assert.False(t, status.DataSufficient)
+	assert.Equal(t, 5, status.WarmupMinSamples)
+}
+
+func TestGetBreakerStatusReportsRecentTrips(t *testing.T) {
+	config := &breaker.Config{
+		MemoryThreshold:            80.0,
+		LatencyThreshold:           100,
+		LatencyWindowSize:          5,
+		Percentile:                 0.95,
+		WaitTime:                   60,
+		TripFrequencyWindowSeconds: 1,
+	}
+	breakerAPI := breaker.NewBreakerAPI(config)
+	defer breakerAPI.Driver.Close()
+	driver := breakerAPI.Driver.(*breaker.BreakerDriver)
+	setMemoryOverride(driver, true)
+
+	// The breaker flaps: it trips, is reset and trips again
+	for i := 0; i < 2; i++ {
+		require.NoError(t, breakertest.TriggerByLatency(driver))
+		driver.Reset()
+	}
+	assert.Equal(t, 2, driver.TripsInLastMinute())
+	assert.Equal(t, 2, driver.RecentTripCount())
+	assert.Equal(t, uint64(2), driver.TripCount())
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	breaker.AddEndpointToRouter(router, breakerAPI)
+	status := func() breaker.BreakerStatus {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/breaker/status", nil)
+		router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var status breaker.BreakerStatus
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &status))
+		return status
+	}
+	assert.Equal(t, 2, status().RecentTripCount)
+	assert.Equal(t, 1, status().TripFrequencyWindowSeconds)
+
+	// The trips leave the configured window but stay within the minute
+	time.Sleep(1100 * time.Millisecond)
+	assert.Equal(t, 0, status().RecentTripCount)
+	assert.Equal(t, 2, driver.TripsInLastMinute())
+
+	driver.ResetTripFrequency()
+	assert.Equal(t, 0, driver.TripsInLastMinute())
+	assert.Equal(t, uint64(2), driver.TripCount(), "The total is not reset")
+}
+
+func TestGetBreakerStatusReportsSlowestLabels(t *testing.T) {
+	config := &breaker.Config{
+		MemoryThreshold:   80.0,
+		LatencyThreshold:  100,
+		LatencyWindowSize: 10,
+		Percentile:        0.95,
+		WaitTime:          60,
+	}
+	breakerAPI := breaker.NewBreakerAPI(config)
+	defer breakerAPI.Driver.Close()
+	driver := breakerAPI.Driver.(*breaker.BreakerDriver)
+	setMemoryOverride(driver, true)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	breaker.AddEndpointToRouter(router, breakerAPI)
+	status := func() breaker.BreakerStatus {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/breaker/status", nil)
+		router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var status breaker.BreakerStatus
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &status))
+		return status
+	}
+
+	// Unlabeled operations leave the summary out
+	now := time.Now()
+	driver.Done(now.Add(-20*time.Millisecond), now)
+	assert.Empty(t, status().SlowestByLabel)
+
+	driver.DoneLabeled(now.Add(-10*time.Millisecond), now, "cache")
+	driver.DoneLabeled(now.Add(-300*time.Millisecond), now, "db")
+	assert.Equal(t, []breaker.LabelLatencySummary{
+		{Label: "db", Count: 1, AboveThreshold: 1, MaxMs: 300},
+		{Label: "cache", Count: 1, AboveThreshold: 0, MaxMs: 10},
+	}, status().SlowestByLabel)
+	assert.Equal(t, status().SlowestByLabel, driver.SlowestByLabel())
+}
+
+func TestLatenciesAboveThresholdEndpoint(t *testing.T) {
+	breakerAPI := breaker.NewBreakerAPI(&breaker.Config{
+		MemoryThreshold:   80.0,
+		LatencyThreshold:  100,
+		LatencyWindowSize: 10,
+		Percentile:        0.95,
+		WaitTime:          60,
+	})
+	defer breakerAPI.Driver.Close()
+	driver := breakerAPI.Driver.(*breaker.BreakerDriver)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	breaker.AddEndpointToRouter(router, breakerAPI)
+
+	type response struct {
+		Threshold int64                   `json:"threshold"`
+		Latencies []int64                 `json:"latencies"`
+		Records   []breaker.LatencyRecord `json:"records"`
+	}
+	get := func(query string) (int, response) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/breaker/latencies-above-threshold"+query, nil)
+		router.ServeHTTP(w, req)
+
+		var body response
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+		return w.Code, body
+	}
+
+	now := time.Now()
+	driver.DoneLabeled(now.Add(-300*time.Millisecond), now, "db")
+	driver.DoneLabeled(now.Add(-200*time.Millisecond), now, "cache")
+	driver.DoneLabeled(now.Add(-50*time.Millisecond), now, "db")
+
+	// The latency threshold is the default
+	code, body := get("")
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, int64(100), body.Threshold)
+	assert.ElementsMatch(t, []int64{300, 200}, body.Latencies)
+	assert.Len(t, body.Records, 2)
+
+	code, body = get("?threshold=10&label=db")
+	require.Equal(t, http.StatusOK, code)
+	assert.ElementsMatch(t, []int64{300, 50}, body.Latencies)
+	for _, record := range body.Records {
+		assert.Equal(t, "db", record.Label)
+	}
+
+	code, body = get("?label=search")
+	require.Equal(t, http.StatusOK, code)
+	assert.Empty(t, body.Latencies)
+
+	code, _ = get("?threshold=fast")
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	// A breaker that does not record labels reports only the latencies
+	breakerAPI.Driver = unlabeledBreaker{driver}
+	code, body = get("?threshold=10")
+	require.Equal(t, http.StatusOK, code)
+	assert.Len(t, body.Latencies, 3)
+	assert.Nil(t, body.Records)
+	code, _ = get("?label=db")
+	assert.Equal(t, http.StatusBadRequest, code)
+}
+
+func TestMetricsEndpoint(t *testing.T) {
+	breakerAPI := breaker.NewBreakerAPI(&breaker.Config{
+		Name:              "metrics-endpoint",
+		MemoryThreshold:   80,
+		LatencyThreshold:  100,
+		LatencyWindowSize: 10,
+		Percentile:        0.95,
+		WaitTime:          600,
+	})
+	defer breakerAPI.Driver.Close()
+	setMemoryOverride(breakerAPI.Driver, true)
+
+	end := time.Now()
+	breakerAPI.Driver.Done(end.Add(-250*time.Millisecond), end)
+	require.True(t, breakerAPI.Driver.Triggered())
+	assert.False(t, breakerAPI.Driver.Allow())
+	assert.False(t, breakerAPI.Driver.Allow())
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	breaker.AddEndpointToRouter(router, breakerAPI)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/breaker/metrics", nil)
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/plain; version=0.0.4; charset=utf-8", w.Header().Get("Content-Type"))
+
+	body := w.Body.String()
+	for _, line := range []string{
+		"# TYPE breaker_state gauge",
+		`breaker_state{breaker="metrics-endpoint"} 1`,
+		`breaker_latency_percentile_ms{breaker="metrics-endpoint"} 250`,
+		"# TYPE breaker_trips_total counter",
+		`breaker_trips_total{breaker="metrics-endpoint"} 1`,
+		`breaker_rejected_total{breaker="metrics-endpoint"} 2`,
+	} {
+		assert.Contains(t, body, line+"\n")
+	}
+	assert.Contains(t, body, `breaker_memory_usage_percent{breaker="metrics-endpoint"} `)
+
+	// The same values as /breaker/status
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/breaker/status", nil)
+	router.ServeHTTP(w, req)
+	var status breaker.BreakerStatus
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &status))
+	assert.Equal(t, uint64(1), status.TripsTotal)
+	assert.Equal(t, uint64(2), status.RejectedTotal)
+	assert.Equal(t, uint64(2), breakerAPI.Driver.(*breaker.BreakerDriver).RejectedCount())
+
+	// Without a name there are no labels, and label values are escaped
+	assert.Contains(t, breaker.PrometheusMetrics(breaker.BreakerStatus{}, ""), "\nbreaker_state 0\n")
+	assert.Contains(t, breaker.PrometheusMetrics(breaker.BreakerStatus{}, `a"b`), `breaker_state{breaker="a\"b"} 0`)
+}
@@ -1,13 +1,26 @@
 package tests
 
 import (
+	"errors"
+	"fmt"
 	"github.com/lrleon/go-breaker/breaker"
+	"github.com/lrleon/go-breaker/breaker/breakertest"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"log"
 	"math/rand"
+	"os"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 )
 
+// setMemoryOverride forces the memory check of b to return ok
+func setMemoryOverride(b breaker.Breaker, ok bool) {
+	b.(*breaker.BreakerDriver).SetMemoryOverride(&ok)
+}
+
 func Test_breaker_should_not_trigger_if_latencies_are_below_threshold(t *testing.T) {
 
 	breaker.MemoryLimit = 512 * 1024 * 1024 // 512 MB
@@ -36,7 +49,7 @@ func Test_breaker_should_not_trigger_if_latencies_are_below_threshold(t *testing
 		b.Done(startTime, endTime)
 	}
 
-	assert.False(t, b.TriggeredByLatencies(), "Breaker should not be triggered")
+	assert.False(t, b.Triggered(), "Breaker should not be triggered")
 
 	assert.True(t, b.Allow(), "Breaker should allow")
 }
@@ -63,7 +76,7 @@ func Test_breaker_should_trigger_if_latencies_are_above_threshold(t *testing.T)
 		b.Done(startTime, endTime)
 	}
 
-	assert.True(t, b.TriggeredByLatencies(), "Breaker should be triggered")
+	assert.True(t, b.Triggered(), "Breaker should be triggered")
 
 	assert.False(t, b.Allow(), "Breaker should not allow")
 }
@@ -80,8 +93,8 @@ func Test_breaker_should_trigger_if_memory_is_above_threshold(t *testing.T) {
 		WaitTime:          10,
 	}, "test_breakers.toml")
 
-	// Reset any previous memory override that might be left over from other tests
-	breaker.SetMemoryOK(nil, true)
+	// The memory threshold is tiny, so force the memory check to pass
+	setMemoryOverride(b, true)
 
 	// Add 10 latencies under the threshold and verify the breaker is not triggered
 	for i := 0; i < 10; i++ {
@@ -93,19 +106,19 @@ func Test_breaker_should_trigger_if_memory_is_above_threshold(t *testing.T) {
 		b.Done(startTime, endTime)
 	}
 
-	assert.False(t, b.TriggeredByLatencies(), "Breaker should not be triggered due to latencies")
+	assert.False(t, b.Triggered(), "Breaker should not be triggered due to latencies")
 
 	assert.True(t, b.Allow(), "Breaker should allow because of latencies are below threshold")
 
 	// Force memory check to fail
-	breaker.SetMemoryOK(b.(*breaker.BreakerDriver), false)
+	setMemoryOverride(b, false)
 
-	assert.False(t, b.TriggeredByLatencies(), "Breaker should not be triggered due to memory usage")
+	assert.False(t, b.Triggered(), "Breaker should not be triggered due to memory usage")
 
 	assert.False(t, b.Allow(), "Breaker should not allow because of memory usage")
 
 	// Force memory check to pass again
-	breaker.SetMemoryOK(b.(*breaker.BreakerDriver), true)
+	setMemoryOverride(b, true)
 
 	assert.True(t, b.Allow(), "Breaker should allow because of memory usage")
 }
@@ -114,9 +127,6 @@ func Test_breaker_should_trigger_if_memory_is_above_threshold_and_latencies_are_
 
 	breaker.MemoryLimit = 512 * 1024 * 1024 // 512 MB
 
-	// Reset any previous memory override
-	breaker.SetMemoryOK(nil, true)
-
 	b := breaker.NewBreaker(&breaker.Config{
 		MemoryThreshold:   0.5,
 		LatencyThreshold:  600,
@@ -125,6 +135,9 @@ func Test_breaker_should_trigger_if_memory_is_above_threshold_and_latencies_are_
 		WaitTime:          10,
 	}, "test_breakers.toml")
 
+	// The memory threshold is tiny, so force the memory check to pass
+	setMemoryOverride(b, true)
+
 	// Add 10 latencies above the threshold and verify the breaker is triggered
 	for i := 0; i < 10; i++ {
 		val := 300 + i*50
@@ -135,20 +148,20 @@ func Test_breaker_should_trigger_if_memory_is_above_threshold_and_latencies_are_
 		b.Done(startTime, endTime)
 	}
 
-	assert.True(t, b.TriggeredByLatencies(), "Breaker should be triggered")
+	assert.True(t, b.Triggered(), "Breaker should be triggered")
 
 	assert.False(t, b.Allow(), "Breaker should not allow")
 
 	// Reset and force memory check to fail
 	b.Reset()
-	breaker.SetMemoryOK(b.(*breaker.BreakerDriver), false)
+	setMemoryOverride(b, false)
 
-	assert.False(t, b.TriggeredByLatencies(), "Breaker should not be triggered due to memory usage")
+	assert.False(t, b.Triggered(), "Breaker should not be triggered due to memory usage")
 
 	assert.False(t, b.Allow(), "Breaker should not allow because of memory usage")
 
 	// Force memory check to pass
-	breaker.SetMemoryOK(b.(*breaker.BreakerDriver), true)
+	setMemoryOverride(b, true)
 
 	assert.True(t, b.Allow(), "Breaker should allow")
 
@@ -162,11 +175,201 @@ func Test_breaker_should_trigger_if_memory_is_above_threshold_and_latencies_are_
 		b.Done(startTime, endTime)
 	}
 
-	assert.False(t, b.TriggeredByLatencies(), "Breaker should not be triggered")
+	assert.False(t, b.Triggered(), "Breaker should not be triggered")
 
 	assert.True(t, b.Allow(), "Breaker should allow")
 }
 
+func Test_memory_override_is_per_breaker_and_can_be_cleared(t *testing.T) {
+	config := &breaker.Config{
+		MemoryThreshold:   80,
+		LatencyThreshold:  600,
+		LatencyWindowSize: 10,
+		Percentile:        0.95,
+		WaitTime:          10,
+	}
+	overridden := breaker.NewBreaker(config, "").(*breaker.BreakerDriver)
+	other := breaker.NewBreaker(config, "").(*breaker.BreakerDriver)
+	realCheck := other.MemoryOK()
+
+	assert.Nil(t, overridden.MemoryOverride(), "A new breaker should use the real memory check")
+
+	memoryOK := false
+	overridden.SetMemoryOverride(&memoryOK)
+	memoryOK = true // Changing the caller's variable must not change the override
+
+	assert.False(t, overridden.MemoryOK())
+	assert.False(t, overridden.Allow())
+	assert.Equal(t, false, *overridden.MemoryOverride())
+	assert.Equal(t, realCheck, other.MemoryOK(), "The override should not leak into other breakers")
+
+	overridden.SetMemoryOverride(nil)
+	assert.Nil(t, overridden.MemoryOverride())
+	assert.Equal(t, realCheck, overridden.MemoryOK(), "nil should restore the real memory check")
+}
+
+func Test_sample_rate_records_a_fraction_of_low_latencies(t *testing.T) {
+	b := breaker.NewBreaker(&breaker.Config{
+		MemoryThreshold:   80,
+		LatencyThreshold:  1000,
+		LatencyWindowSize: 2000,
+		Percentile:        0.95,
+		WaitTime:          60,
+		SampleRate:        0.1,
+	}, "")
+	setMemoryOverride(b, true)
+
+	for i := 0; i < 2000; i++ {
+		now := time.Now()
+		b.Done(now.Add(-10*time.Millisecond), now)
+	}
+
+	// 200 latencies are expected; the bounds are loose enough to never flake
+	recorded := len(b.LatenciesAboveThreshold(0))
+	assert.Greater(t, recorded, 80, "Roughly 10% of the latencies should be recorded")
+	assert.Less(t, recorded, 400, "Roughly 10% of the latencies should be recorded")
+}
+
+func Test_sample_rate_always_records_latencies_near_the_threshold(t *testing.T) {
+	b := breaker.NewBreaker(&breaker.Config{
+		MemoryThreshold:   80,
+		LatencyThreshold:  600,
+		LatencyWindowSize: 10,
+		Percentile:        0.95,
+		WaitTime:          60,
+		SampleRate:        0.01,
+	}, "")
+	setMemoryOverride(b, true)
+
+	for i := 0; i < 10; i++ {
+		now := time.Now()
+		b.Done(now.Add(-time.Duration(700+i*10)*time.Millisecond), now)
+	}
+
+	assert.Len(t, b.LatenciesAboveThreshold(600), 10, "High latencies should never be sampled out")
+	assert.True(t, b.Triggered(), "Sampling should not prevent the breaker from tripping")
+}
+
+func Test_protection_percent_rejects_a_fraction_of_requests(t *testing.T) {
+	b := breakertest.NewTestBreaker(breakertest.WithConfig(func(config *breaker.Config) {
+		config.WaitTime = 60
+		config.ProtectionPercent = 10
+	}))
+	assert.NoError(t, breakertest.TriggerByLatency(b))
+
+	// 200 rejections are expected; the bounds are loose enough to never flake
+	rejected := 0
+	for i := 0; i < 2000; i++ {
+		if !b.Allow() {
+			rejected++
+		}
+	}
+	assert.Greater(t, rejected, 80, "Roughly 10% of the requests should be rejected")
+	assert.Less(t, rejected, 400, "Roughly 10% of the requests should be rejected")
+	assert.True(t, b.Triggered(), "Passing requests through should not close the breaker")
+
+	// By key, the same key always gets the same answer
+	rejected = 0
+	for i := 0; i < 1000; i++ {
+		key := fmt.Sprintf("tenant-%d", i)
+		allowed := b.AllowKey(key)
+		for j := 0; j < 3; j++ {
+			assert.Equal(t, allowed, b.AllowKey(key), "The decision for %s should not change", key)
+		}
+		if !allowed {
+			rejected++
+		}
+	}
+	assert.Greater(t, rejected, 30, "Roughly 10% of the keys should be protected")
+	assert.Less(t, rejected, 200, "Roughly 10% of the keys should be protected")
+
+	// Without protection_percent every request is protected
+	all := breakertest.NewTestBreaker(breakertest.WithWaitTime(60))
+	assert.NoError(t, breakertest.TriggerByLatency(all))
+	for i := 0; i < 100; i++ {
+		assert.False(t, all.Allow())
+		assert.False(t, all.AllowKey(fmt.Sprintf("tenant-%d", i)))
+	}
+}
+
+func benchmarkDone(bench *testing.B, sampleRate float64) {
+	b := breaker.NewBreaker(&breaker.Config{
+		MemoryThreshold:   80,
+		LatencyThreshold:  1000,
+		LatencyWindowSize: 1024,
+		Percentile:        0.95,
+		WaitTime:          60,
+		SampleRate:        sampleRate,
+	}, "")
+	setMemoryOverride(b, true)
+
+	end := time.Now()
+	start := end.Add(-20 * time.Millisecond)
+
+	bench.ResetTimer()
+	for i := 0; i < bench.N; i++ {
+		b.Done(start, end)
+	}
+}
+
+func BenchmarkDoneSampleRate100(b *testing.B) { benchmarkDone(b, 1.0) }
+
+func BenchmarkDoneSampleRate10(b *testing.B) { benchmarkDone(b, 0.1) }
+
+func Test_breaker_trip_scope(t *testing.T) {
+	newBreaker := func(tripOnMemory, tripOnLatency bool) breaker.Breaker {
+		return breaker.NewBreaker(&breaker.Config{
+			MemoryThreshold:   80,
+			LatencyThreshold:  600,
+			LatencyWindowSize: 10,
+			Percentile:        0.95,
+			WaitTime:          10,
+			TripOnMemory:      &tripOnMemory,
+			TripOnLatency:     &tripOnLatency,
+		}, "")
+	}
+	reportHighLatencies := func(b breaker.Breaker) {
+		for i := 0; i < 10; i++ {
+			now := time.Now()
+			b.Done(now.Add(-time.Duration(700+i*50)*time.Millisecond), now)
+		}
+	}
+
+	t.Run("LatencyOnly", func(t *testing.T) {
+		b := newBreaker(false, true)
+		setMemoryOverride(b, false)
+
+		assert.True(t, b.Allow(), "Memory pressure should not block a latency-only breaker")
+		now := time.Now()
+		b.Done(now.Add(-10*time.Millisecond), now)
+		assert.False(t, b.Triggered(), "Memory pressure should not trip a latency-only breaker")
+
+		reportHighLatencies(b)
+		assert.True(t, b.Triggered(), "High latencies should trip a latency-only breaker")
+	})
+
+	t.Run("MemoryOnly", func(t *testing.T) {
+		b := newBreaker(true, false)
+		setMemoryOverride(b, true)
+
+		reportHighLatencies(b)
+		assert.False(t, b.Triggered(), "High latencies should not trip a memory-only breaker")
+		assert.True(t, b.Allow())
+
+		setMemoryOverride(b, false)
+		assert.False(t, b.Allow(), "Memory pressure should block a memory-only breaker")
+		now := time.Now()
+		b.Done(now.Add(-10*time.Millisecond), now)
+		assert.True(t, b.Triggered(), "Memory pressure should trip a memory-only breaker")
+	})
+
+	t.Run("DefaultsToBoth", func(t *testing.T) {
+		config := &breaker.Config{}
+		assert.True(t, config.TripsOnMemory())
+		assert.True(t, config.TripsOnLatency())
+	})
+}
+
 func Test_Breaker_Enable_Disable(t *testing.T) {
 	b := breaker.NewBreaker(&breaker.Config{
 		MemoryThreshold:   0.5,
@@ -178,6 +381,9 @@ func Test_Breaker_Enable_Disable(t *testing.T) {
 
 	breaker.MemoryLimit = 512 * 1024 * 1024 // 512 MB
 
+	// The memory threshold is tiny, so force the memory check to pass
+	setMemoryOverride(b, true)
+
 	assert.True(t, b.Allow(), "Breaker should allow")
 	assert.True(t, b.IsEnabled(), "Breaker should be enabled")
 
@@ -215,3 +421,613 @@ func Test_Breaker_Enable_Disable(t *testing.T) {
 	assert.False(t, b.Allow(), "Breaker should not allow when triggered")
 	assert.True(t, b.IsEnabled(), "Breaker should be enabled")
 }
+
+func Test_breaker_should_ignore_excluded_status_codes(t *testing.T) {
+	b := breaker.NewBreaker(&breaker.Config{
+		MemoryThreshold:     100,
+		LatencyThreshold:    100,
+		LatencyWindowSize:   5,
+		Percentile:          0.95,
+		WaitTime:            10,
+		ExcludedStatusCodes: []string{"4xx", "503"},
+	}, "")
+	setMemoryOverride(b, true)
+
+	now := time.Now()
+	slow := now.Add(-500 * time.Millisecond)
+
+	// Slow client errors and excluded server errors are not recorded
+	for _, code := range []int{400, 404, 404, 429, 499, 503} {
+		b.DoneWithStatus(slow, now, code)
+	}
+	assert.False(t, b.Triggered(), "excluded status codes should not trip the breaker")
+	assert.Empty(t, b.LatenciesAboveThreshold(100))
+
+	// Other codes are recorded as usual
+	for _, code := range []int{200, 500, 502, 504, 201} {
+		b.DoneWithStatus(slow, now, code)
+	}
+	assert.True(t, b.Triggered(), "slow 2xx/5xx responses should trip the breaker")
+}
+
+func Test_parseStatusCodeRanges(t *testing.T) {
+	ranges, err := breaker.ParseStatusCodeRanges([]string{"404", "5xx", " 420-429 "})
+	assert.NoError(t, err)
+	assert.Equal(t, []breaker.StatusCodeRange{{From: 404, To: 404}, {From: 500, To: 599}, {From: 420, To: 429}}, ranges)
+
+	for _, invalid := range []string{"abc", "9xx", "499-400", "700", "4-"} {
+		_, err := breaker.ParseStatusCodeRanges([]string{invalid})
+		assert.Error(t, err, invalid)
+	}
+
+	assert.Error(t, breaker.ValidateConfig(&breaker.Config{
+		MemoryThreshold:     80,
+		LatencyThreshold:    100,
+		LatencyWindowSize:   5,
+		Percentile:          0.95,
+		ExcludedStatusCodes: []string{"4yy"},
+	}))
+}
+
+func Test_track_records_the_elapsed_time(t *testing.T) {
+	b := breaker.NewBreaker(&breaker.Config{
+		MemoryThreshold:   80,
+		LatencyThreshold:  20,
+		LatencyWindowSize: 10,
+		Percentile:        0.95,
+		WaitTime:          60,
+	}, "").(*breaker.BreakerDriver)
+	setMemoryOverride(b, true)
+
+	func() {
+		defer b.Track()()
+		time.Sleep(30 * time.Millisecond)
+	}()
+
+	latencies := b.LatenciesAboveThreshold(0)
+	if assert.Len(t, latencies, 1) {
+		assert.GreaterOrEqual(t, latencies[0], int64(30))
+	}
+	assert.True(t, b.Triggered(), "The tracked latency is above the threshold")
+}
+
+func Test_track_records_an_operation_once(t *testing.T) {
+	b := breakertest.NewTestBreaker()
+	defer b.Close()
+
+	var output strings.Builder
+	log.SetOutput(&output)
+	defer log.SetOutput(os.Stderr)
+
+	done := b.Track()
+	done()
+	done() // E.g. an early return followed by a deferred call
+	b.Track()()
+
+	assert.Len(t, b.LatenciesAboveThreshold(-1), 2, "The repeated call should not be recorded")
+	assert.Contains(t, output.String(), "was already recorded")
+}
+
+func Test_done_with_error_honors_retry_after(t *testing.T) {
+	b := breaker.NewBreaker(&breaker.Config{
+		MemoryThreshold:   80,
+		LatencyThreshold:  100,
+		LatencyWindowSize: 5,
+		Percentile:        0.95,
+		WaitTime:          0,
+	}, "")
+	setMemoryOverride(b, true)
+	errTooManyRequests := errors.New("429 Too Many Requests")
+
+	// A retry-after on a closed breaker does not open it
+	now := time.Now()
+	b.DoneWithError(now.Add(-10*time.Millisecond), now, errTooManyRequests, time.Minute)
+	assert.False(t, b.Triggered())
+	assert.True(t, b.Allow())
+
+	// Once tripped, the breaker stays open for the retry-after even though wait_time is 0
+	for i := 0; i < 5; i++ {
+		now = time.Now()
+		b.DoneWithError(now.Add(-500*time.Millisecond), now, errTooManyRequests, 300*time.Millisecond)
+	}
+	assert.True(t, b.Triggered())
+	time.Sleep(50 * time.Millisecond)
+	assert.False(t, b.Allow(), "The breaker should stay open until the retry-after elapses")
+
+	// The latency must be OK too for the breaker to close
+	fast := func() {
+		for i := 0; i < 5; i++ {
+			now = time.Now()
+			b.Done(now.Add(-10*time.Millisecond), now)
+		}
+	}
+	time.Sleep(300 * time.Millisecond)
+	fast()
+	assert.True(t, b.Allow(), "The breaker should close once the retry-after elapsed")
+
+	// Without an error the retry-after is ignored
+	for i := 0; i < 5; i++ {
+		now = time.Now()
+		b.DoneWithError(now.Add(-500*time.Millisecond), now, nil, time.Hour)
+	}
+	time.Sleep(10 * time.Millisecond)
+	fast()
+	assert.True(t, b.Allow())
+}
+
+func Test_parse_retry_after(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		value  string
+		want   time.Duration
+		wantOK bool
+	}{
+		{"120", 2 * time.Minute, true},
+		{" 0 ", 0, true},
+		{"Wed, 01 May 2024 12:00:30 GMT", 30 * time.Second, true},
+		{"Wed, 01 May 2024 11:59:00 GMT", 0, true},
+		{"", 0, false},
+		{"-5", 0, false},
+		{"soon", 0, false},
+	}
+
+	for _, tt := range tests {
+		got, ok := breaker.ParseRetryAfter(tt.value, now)
+		assert.Equal(t, tt.wantOK, ok, "ParseRetryAfter(%q) ok", tt.value)
+		assert.Equal(t, tt.want, got, "ParseRetryAfter(%q)", tt.value)
+	}
+}
+
+func Test_latency_series_is_downsampled_and_bounded(t *testing.T) {
+	b := breaker.NewBreaker(&breaker.Config{
+		MemoryThreshold:   80,
+		LatencyThreshold:  1000,
+		LatencyWindowSize: 10,
+		Percentile:        0.95,
+		WaitTime:          600,
+		LatencySeriesSize: 3,
+	}, "").(*breaker.BreakerDriver)
+	defer b.Close()
+	setMemoryOverride(b, true)
+
+	assert.Empty(t, b.LatencySeries())
+
+	// Five seconds with two latencies each; only the last value of each second is kept
+	base := time.Now().Truncate(time.Second).Add(-10 * time.Second)
+	for second := 0; second < 5; second++ {
+		end := base.Add(time.Duration(second) * time.Second)
+		b.Done(end.Add(-10*time.Millisecond), end)
+		end = end.Add(500 * time.Millisecond)
+		b.Done(end.Add(-time.Duration(second+1)*100*time.Millisecond), end)
+	}
+
+	series := b.LatencySeries()
+	require.Len(t, series, 3, "The series should be bounded by latency_series_size")
+	for i, sample := range series {
+		second := i + 2
+		assert.Equal(t, base.Add(time.Duration(second)*time.Second+500*time.Millisecond), sample.Timestamp)
+		assert.Equal(t, int64(second+1)*100, sample.PercentileMs)
+	}
+
+	b.Reset()
+	assert.Empty(t, b.LatencySeries(), "Reset should clear the series")
+}
+
+func Test_update_config_applies_to_the_running_breaker(t *testing.T) {
+	config := &breaker.Config{
+		MemoryThreshold:   80,
+		LatencyThreshold:  1000,
+		LatencyWindowSize: 10,
+		Percentile:        0.95,
+		WaitTime:          600,
+	}
+	b := breaker.NewBreaker(config, "").(*breaker.BreakerDriver)
+	defer b.Close()
+	setMemoryOverride(b, true)
+
+	now := time.Now()
+	for i := 1; i <= 10; i++ {
+		end := now.Add(time.Duration(i) * time.Millisecond)
+		b.Done(end.Add(-time.Duration(i)*100*time.Millisecond), end)
+	}
+	assert.False(t, b.Triggered())
+
+	invalid := *config
+	invalid.Percentile = 2
+	assert.Error(t, b.UpdateConfig(&invalid))
+	assert.Equal(t, 0.95, b.Config().Percentile, "An invalid config should not be applied")
+
+	// Shrinking the window keeps the most recent latencies
+	updated := *config
+	updated.LatencyWindowSize = 3
+	updated.LatencyThreshold = 2000
+	require.NoError(t, b.UpdateConfig(&updated))
+	assert.Equal(t, 3, b.Config().LatencyWindowSize)
+	assert.ElementsMatch(t, []int64{800, 900, 1000}, b.LatenciesAboveThreshold(0))
+
+	// The new threshold applies to the next latency
+	updated.LatencyThreshold = 500
+	require.NoError(t, b.UpdateConfig(&updated))
+	end := time.Now()
+	b.Done(end.Add(-600*time.Millisecond), end)
+	assert.True(t, b.Triggered())
+
+	// The new wait time applies to the open breaker
+	updated.WaitTime = 0
+	require.NoError(t, b.UpdateConfig(&updated))
+	assert.True(t, b.Triggered(), "Updating the config should keep the trip state")
+	for i := 0; i < 3; i++ {
+		end = time.Now()
+		b.Done(end.Add(-100*time.Millisecond), end)
+	}
+	time.Sleep(5 * time.Millisecond)
+	assert.True(t, b.Allow())
+}
+
+func benchmarkAllowDone(bench *testing.B, enabled bool) {
+	b := breaker.NewBreaker(&breaker.Config{
+		MemoryThreshold:   80,
+		LatencyThreshold:  1000,
+		LatencyWindowSize: 1024,
+		Percentile:        0.95,
+		WaitTime:          60,
+	}, "")
+	defer b.(*breaker.BreakerDriver).Close()
+	setMemoryOverride(b, true)
+	if !enabled {
+		b.Disable()
+	}
+
+	end := time.Now()
+	start := end.Add(-20 * time.Millisecond)
+
+	bench.ResetTimer()
+	bench.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if b.Allow() {
+				b.Done(start, end)
+			}
+		}
+	})
+}
+
+// Compare with go test ./tests -run XXX -bench AllowDone
+func BenchmarkAllowDoneEnabled(b *testing.B) { benchmarkAllowDone(b, true) }
+
+func BenchmarkAllowDoneDisabled(b *testing.B) { benchmarkAllowDone(b, false) }
+
+func Test_trip_reason(t *testing.T) {
+	newBreaker := func(trendAnalysis bool) breaker.Breaker {
+		return breaker.NewBreaker(&breaker.Config{
+			MemoryThreshold:             80,
+			LatencyThreshold:            100,
+			LatencyWindowSize:           5,
+			Percentile:                  0.95,
+			WaitTime:                    60,
+			TrendAnalysisEnabled:        trendAnalysis,
+			TrendAnalysisMinSampleCount: 5,
+		}, "")
+	}
+	record := func(b breaker.Breaker, latencies ...int) {
+		now := time.Now()
+		for i, latency := range latencies {
+			end := now.Add(time.Duration(i) * time.Millisecond)
+			b.Done(end.Add(-time.Duration(latency)*time.Millisecond), end)
+		}
+	}
+
+	b := newBreaker(false)
+	defer b.Close()
+	setMemoryOverride(b, true)
+	assert.Empty(t, b.TripReason(), "A closed breaker has no trip reason")
+	record(b, 200)
+	assert.Equal(t, breaker.TripReasonLatency, b.TripReason())
+	b.Reset()
+	assert.Empty(t, b.TripReason())
+
+	b = newBreaker(true)
+	defer b.Close()
+	setMemoryOverride(b, true)
+	record(b, 200, 300, 400, 500, 600)
+	assert.Equal(t, breaker.TripReasonLatencyTrend, b.TripReason())
+
+	b = newBreaker(true)
+	defer b.Close()
+	setMemoryOverride(b, true)
+	record(b, 500, 500, 500, 500, 500)
+	assert.Equal(t, breaker.TripReasonLatencyPlateau, b.TripReason())
+
+	b = newBreaker(false)
+	defer b.Close()
+	setMemoryOverride(b, false)
+	record(b, 10)
+	assert.Equal(t, breaker.TripReasonMemory, b.TripReason())
+	record(b, 200)
+	assert.Equal(t, breaker.TripReasonMemory+"+"+breaker.TripReasonLatency, b.TripReason())
+}
+
+func Test_triggered_by_latencies_is_false_for_memory_trips(t *testing.T) {
+	b := breaker.NewBreaker(&breaker.Config{
+		MemoryThreshold:   80,
+		LatencyThreshold:  100,
+		LatencyWindowSize: 5,
+		Percentile:        0.95,
+		WaitTime:          60,
+	}, "")
+	defer b.Close()
+	setMemoryOverride(b, false)
+
+	end := time.Now()
+	b.Done(end.Add(-10*time.Millisecond), end)
+	assert.True(t, b.Triggered())
+	assert.False(t, b.TriggeredByLatencies(), "Memory alone did not trip the breaker by latencies")
+
+	b.Done(end.Add(-200*time.Millisecond), end)
+	assert.True(t, b.TriggeredByLatencies())
+}
+
+func Test_mock_clock_drives_the_wait_time_and_latency_ages(t *testing.T) {
+	b := breakertest.NewTestBreaker(breakertest.WithWaitTime(30))
+	defer b.Close()
+	clock := breaker.NewMockClock(time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC))
+	b.SetClock(clock)
+
+	// Track measures the operation with the clock too
+	done := b.Track()
+	clock.Advance(time.Second)
+	done()
+	require.True(t, b.Triggered())
+	assert.False(t, b.Allow())
+	assert.Equal(t, 1, b.TripsInLastMinute())
+
+	// The wait time elapses without sleeping, and the slow latency ages out of the window
+	clock.Advance(29 * time.Second)
+	assert.False(t, b.Allow(), "The wait time has not elapsed yet")
+	assert.False(t, b.LatencyOK())
+	clock.Advance(2 * time.Second)
+	assert.True(t, b.LatencyOK(), "The slow latency is older than the wait time")
+	assert.True(t, b.Allow(), "A trial request is let through")
+	assert.True(t, b.Triggered(), "The breaker waits for the trial to complete")
+	start := clock.Now()
+	clock.Advance(10 * time.Millisecond)
+	b.Done(start, clock.Now())
+	assert.False(t, b.Triggered())
+
+	clock.Advance(time.Minute)
+	assert.Equal(t, 0, b.TripsInLastMinute())
+	assert.Equal(t, uint64(1), b.TripCount())
+}
+
+func Test_breaker_staysOpenWhileLatencyIsHigh(t *testing.T) {
+	b := breakertest.NewTestBreaker(breakertest.WithWaitTime(10), breakertest.WithConfig(func(config *breaker.Config) {
+		config.RecoveryConsecutiveChecks = 3
+		config.BreachDurationSeconds = 30
+	}))
+	defer b.Close()
+	clock := breaker.NewMockClock(time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC))
+	b.SetClock(clock)
+	events := b.Events()
+
+	// Requests take their latency on the clock, so that a trial starts when Allow lets it
+	// through
+	slow := func() {
+		start := clock.Now()
+		clock.Advance(500 * time.Millisecond)
+		b.Done(start, clock.Now())
+	}
+	slow()
+	clock.Advance(31 * time.Second)
+	slow()
+	require.True(t, b.Triggered())
+
+	fast := func() {
+		start := clock.Now()
+		clock.Advance(10 * time.Millisecond)
+		b.Done(start, clock.Now())
+	}
+
+	// After the wait time a trial request goes through; a slow one keeps the breaker open
+	// for another wait time
+	clock.Advance(11 * time.Second)
+	assert.True(t, b.Allow(), "The wait time elapsed: a trial request is let through")
+	assert.False(t, b.Allow(), "A single trial at a time")
+	slow()
+	assert.True(t, b.Triggered())
+	clock.Advance(5 * time.Second)
+	assert.False(t, b.Allow(), "The failed trial restarted the wait time")
+
+	// Once the slow latencies age out, three trials, one per second, must be fast
+	clock.Advance(6 * time.Second)
+	for i := 0; i < 3; i++ {
+		require.True(t, b.Triggered())
+		assert.True(t, b.Allow(), "Trial %d", i+1)
+		assert.False(t, b.Allow(), "Trials are counted once per interval, not per call")
+		fast()
+		clock.Advance(time.Second)
+	}
+	assert.False(t, b.Triggered())
+
+	var rejections []string
+	for len(events) > 0 {
+		if event := <-events; event.Type == breaker.EventRejected {
+			rejections = append(rejections, event.Reason)
+		}
+	}
+	assert.Equal(t, []string{breaker.RejectReasonRecovering, breaker.RejectReasonOpen,
+		breaker.RejectReasonRecovering, breaker.RejectReasonRecovering, breaker.RejectReasonRecovering}, rejections)
+}
+
+func Test_breaker_staysOpenWithoutTraffic(t *testing.T) {
+	b := breakertest.NewTestBreaker(breakertest.WithWaitTime(10))
+	defer b.Close()
+	clock := breaker.NewMockClock(time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC))
+	b.SetClock(clock)
+
+	now := clock.Now()
+	b.Done(now.Add(-500*time.Millisecond), now)
+	require.True(t, b.Triggered())
+
+	// No request arrives while the breaker is open, so the slow latency ages out and the
+	// window is empty: that alone must not close the breaker
+	clock.Advance(time.Minute)
+	require.True(t, b.LatencyOK())
+	assert.True(t, b.Triggered())
+	assert.True(t, b.Allow(), "A trial request is let through")
+	assert.True(t, b.Triggered(), "An empty window is no evidence of recovery")
+
+	// The downstream is still slow: the trial keeps the breaker open
+	now = clock.Now()
+	b.Done(now.Add(-500*time.Millisecond), now)
+	assert.True(t, b.Triggered())
+	assert.False(t, b.Allow())
+}
+
+func Test_breaker_onlyTheTrialRequestIsJudged(t *testing.T) {
+	b := breakertest.NewTestBreaker(breakertest.WithWaitTime(10))
+	defer b.Close()
+	clock := breaker.NewMockClock(time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC))
+	b.SetClock(clock)
+
+	inFlight := clock.Now() // Started before the trip
+	clock.Advance(time.Second)
+	b.Done(inFlight, clock.Now())
+	require.True(t, b.Triggered())
+
+	clock.Advance(time.Minute)
+	require.True(t, b.Allow(), "A trial request is let through")
+
+	// Requests that started before the trial, such as those in flight when the breaker
+	// tripped or not protected by it, do not decide the trial, however fast they were
+	clock.Advance(10 * time.Millisecond)
+	b.Done(clock.Now().Add(-20*time.Millisecond), clock.Now())
+	assert.True(t, b.Triggered(), "A request started before the trial does not close the breaker")
+
+	trialStart := clock.Now().Add(-10 * time.Millisecond)
+	b.Done(trialStart, clock.Now())
+	assert.False(t, b.Triggered(), "The trial closes the breaker")
+}
+
+func Test_breaker_probesCloseTheBreaker(t *testing.T) {
+	b := breakertest.NewTestBreaker(breakertest.WithWaitTime(10), breakertest.WithConfig(func(config *breaker.Config) {
+		config.RecoveryConsecutiveChecks = 2
+	}))
+	defer b.Close()
+	clock := breaker.NewMockClock(time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC))
+	b.SetClock(clock)
+
+	var mu sync.Mutex
+	var probes int
+	result := struct {
+		latency time.Duration
+		err     error
+	}{err: errors.New("connection refused")}
+	b.SetProbe(func() (time.Duration, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		probes++
+		return result.latency, result.err
+	})
+	setResult := func(latency time.Duration, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		result.latency, result.err = latency, err
+	}
+
+	trip := func() {
+		now := clock.Now()
+		b.Done(now.Add(-time.Second), now)
+	}
+
+	assert.False(t, b.RunProbe(), "A closed breaker is not probed")
+	assert.Equal(t, 0, probes)
+
+	trip()
+	require.True(t, b.Triggered())
+
+	// The wait time no longer closes the breaker
+	clock.Advance(time.Minute)
+	assert.False(t, b.Allow())
+	assert.False(t, b.RunProbe(), "A failed probe keeps the breaker open")
+
+	setResult(500*time.Millisecond, nil)
+	assert.False(t, b.RunProbe(), "A slow probe keeps the breaker open")
+
+	// Two probes in a row must succeed
+	setResult(20*time.Millisecond, nil)
+	assert.False(t, b.RunProbe())
+	assert.True(t, b.Triggered())
+	assert.True(t, b.RunProbe())
+	assert.False(t, b.Triggered())
+	assert.True(t, b.Allow())
+	assert.Equal(t, 4, probes)
+
+	// The probes run by themselves every probe_interval_seconds
+	config := b.Config()
+	config.ProbeIntervalSeconds = 1
+	require.NoError(t, b.UpdateConfig(&config))
+	b.SetProbe(func() (time.Duration, error) { return time.Millisecond, nil })
+	trip()
+	require.True(t, b.Triggered())
+	assert.Eventually(t, func() bool { return !b.Triggered() }, 5*time.Second, 50*time.Millisecond)
+
+	// Without a probe, the wait time and two trial requests close the breaker again
+	b.SetProbe(nil)
+	trip()
+	for i := 0; i < 2; i++ {
+		clock.Advance(time.Minute)
+		require.True(t, b.Allow())
+		start := clock.Now()
+		clock.Advance(time.Millisecond)
+		b.Done(start, clock.Now())
+	}
+	assert.False(t, b.Triggered())
+}
+
+func Test_breaker_tripsOnHealthScore(t *testing.T) {
+	b := breakertest.NewTestBreaker(breakertest.WithWaitTime(10), breakertest.WithConfig(func(config *breaker.Config) {
+		config.HealthScoreThreshold = 80
+		config.HealthMemoryWeight = 1
+		config.HealthLatencyWeight = 3
+	}))
+	defer b.Close()
+	clock := breaker.NewMockClock(time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC))
+	b.SetClock(clock)
+	done := func(latency time.Duration) {
+		start := clock.Now()
+		clock.Advance(latency)
+		b.Done(start, clock.Now())
+	}
+
+	// Memory alone weighs a quarter of the score, so it neither trips nor blocks
+	setMemoryOverride(b, false)
+	done(10 * time.Millisecond)
+	assert.False(t, b.Triggered())
+	assert.True(t, b.Allow())
+	assert.InDelta(t, 32.5, b.HealthScore(), 0.01)
+
+	// Latencies below the threshold trip the breaker together with memory
+	for i := 0; i < 10; i++ {
+		done(90 * time.Millisecond)
+	}
+	assert.InDelta(t, 92.5, b.HealthScore(), 0.01)
+	require.True(t, b.Triggered())
+	assert.Equal(t, breaker.TripReasonHealthScore, b.TripReason())
+
+	// After the wait time the slow latencies have aged out, and a fast trial request
+	// closes the breaker because memory alone keeps the score below the threshold
+	clock.Advance(5 * time.Second)
+	assert.False(t, b.Allow())
+	clock.Advance(time.Minute)
+	assert.Less(t, b.HealthScore(), 80.0)
+	assert.True(t, b.Allow())
+	done(10 * time.Millisecond)
+	assert.False(t, b.Triggered())
+
+	config := b.Config()
+	config.HealthScoreThreshold = 120
+	assert.Error(t, breaker.ValidateConfig(&config))
+	config.HealthScoreThreshold = 80
+	config.HealthLatencyWeight = -1
+	assert.Error(t, breaker.ValidateConfig(&config))
+}
@@ -0,0 +1,54 @@
+package tests
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lrleon/go-breaker/breaker"
+	"github.com/lrleon/go-breaker/breaker/breakertest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBreakertestHelpers(t *testing.T) {
+	b := breakertest.NewTestBreaker(breakertest.WithLatencyThreshold(250), breakertest.WithWaitTime(60))
+	defer b.Close()
+
+	assert.True(t, b.Allow(), "A new test breaker should be healthy")
+	assert.False(t, b.Triggered())
+
+	require.NoError(t, breakertest.TriggerByLatency(b))
+	assert.True(t, b.Triggered())
+	assert.False(t, b.Allow(), "Requests should be rejected while the breaker is open")
+
+	breakertest.SetHealthy(b)
+	assert.False(t, b.Triggered())
+	assert.True(t, b.Allow())
+	assert.Empty(t, b.LatenciesAboveThreshold(0), "SetHealthy should clear the latency history")
+}
+
+func TestBreakertestTriggerWithTrendAnalysis(t *testing.T) {
+	b := breakertest.NewTestBreaker(breakertest.WithConfig(func(config *breaker.Config) {
+		config.TrendAnalysisEnabled = true
+		config.TrendAnalysisMinSampleCount = 5
+	}))
+	defer b.Close()
+
+	require.NoError(t, breakertest.TriggerByLatency(b))
+	assert.True(t, b.Triggered())
+}
+
+func TestBreakertestTriggerDisabledBreaker(t *testing.T) {
+	b := breakertest.NewTestBreaker()
+	defer b.Close()
+
+	b.Disable()
+	assert.Error(t, breakertest.TriggerByLatency(b))
+
+	breakertest.SetHealthy(b)
+	assert.True(t, b.IsEnabled(), "SetHealthy should re-enable the breaker")
+
+	start := time.Now()
+	b.Done(start.Add(-10*time.Millisecond), start)
+	assert.False(t, b.Triggered())
+}
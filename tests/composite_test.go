@@ -0,0 +1,104 @@
+package tests
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lrleon/go-breaker/breaker"
+	"github.com/lrleon/go-breaker/breaker/breakertest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompositeBreaker(t *testing.T) {
+	newPair := func(t *testing.T) (primary, secondary *breaker.BreakerDriver) {
+		primary = breakertest.NewTestBreaker(breakertest.WithWaitTime(60))
+		secondary = breakertest.NewTestBreaker(breakertest.WithWaitTime(60))
+		t.Cleanup(func() {
+			primary.Close()
+			secondary.Close()
+		})
+		return primary, secondary
+	}
+
+	t.Run("AND", func(t *testing.T) {
+		primary, secondary := newPair(t)
+		composite := breaker.NewCompositeBreaker(breaker.CompositeAnd, primary, secondary)
+		assert.Equal(t, "AND", composite.Policy().String())
+
+		assert.True(t, composite.Allow())
+		assert.False(t, composite.Triggered())
+
+		require.NoError(t, breakertest.TriggerByLatency(secondary))
+		assert.False(t, composite.Allow(), "One open breaker is enough to reject")
+		assert.True(t, composite.Triggered())
+		assert.Equal(t, breaker.TripReasonLatency, composite.TripReason())
+		assert.False(t, composite.LatencyOK())
+
+		composite.Reset()
+		assert.False(t, primary.Triggered())
+		assert.False(t, secondary.Triggered())
+		assert.True(t, composite.Allow())
+	})
+
+	t.Run("OR", func(t *testing.T) {
+		primary, secondary := newPair(t)
+		composite := breaker.NewCompositeBreaker(breaker.CompositeOr, primary, secondary)
+
+		require.NoError(t, breakertest.TriggerByLatency(primary))
+		assert.True(t, composite.Allow(), "The secondary is still closed")
+		assert.False(t, composite.Triggered())
+		assert.Empty(t, composite.TripReason())
+
+		require.NoError(t, breakertest.TriggerByLatency(secondary))
+		assert.False(t, composite.Allow())
+		assert.True(t, composite.Triggered())
+		assert.Equal(t, breaker.TripReasonLatency, composite.TripReason(), "Reasons are not repeated")
+	})
+
+	t.Run("fan-out", func(t *testing.T) {
+		primary, secondary := newPair(t)
+		var composite breaker.Breaker = breaker.NewCompositeBreaker(breaker.CompositeAnd, primary, nil, secondary)
+
+		end := time.Now()
+		composite.Done(end.Add(-10*time.Millisecond), end)
+		composite.DoneWithStatus(end.Add(-20*time.Millisecond), end, 200)
+		assert.Len(t, primary.LatenciesAboveThreshold(-1), 2)
+		assert.Len(t, secondary.LatenciesAboveThreshold(-1), 2)
+		assert.Len(t, composite.LatenciesAboveThreshold(-1), 4)
+
+		composite.Disable()
+		assert.False(t, primary.IsEnabled())
+		assert.False(t, composite.IsEnabled())
+		secondary.Enable()
+		assert.True(t, composite.IsEnabled(), "Enabled while any breaker is")
+
+		require.NoError(t, composite.Close())
+	})
+
+	t.Run("labels", func(t *testing.T) {
+		primary, secondary := newPair(t)
+		composite := breaker.NewCompositeBreaker(breaker.CompositeAnd, primary, unlabeledBreaker{secondary})
+
+		end := time.Now()
+		composite.DoneLabeled(end.Add(-10*time.Millisecond), end, "checkout")
+		assert.Equal(t, []string{"checkout"}, recordLabels(primary.LatencyRecordsAboveThreshold(-1)))
+		assert.Equal(t, []string{""}, recordLabels(secondary.LatencyRecordsAboveThreshold(-1)),
+			"A breaker that does not record labels gets the latency without it")
+		assert.Equal(t, []string{"checkout"}, recordLabels(composite.LatencyRecordsAboveThreshold(-1)))
+	})
+}
+
+// unlabeledBreaker is a Breaker implemented outside the package, which does not record
+// labels: embedding the Breaker interface hides the LabeledBreaker methods of the driver
+type unlabeledBreaker struct {
+	breaker.Breaker
+}
+
+func recordLabels(records []breaker.LatencyRecord) []string {
+	labels := make([]string, len(records))
+	for i, record := range records {
+		labels[i] = record.Label
+	}
+	return labels
+}
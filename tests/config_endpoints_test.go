@@ -0,0 +1,286 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lrleon/go-breaker/breaker"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestConfigSettersApplyToTheRunningBreaker verifies that the configuration endpoints
+// change the behavior of the running breaker immediately, not only the saved file
+func TestConfigSettersApplyToTheRunningBreaker(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "breakers.toml")
+	config := &breaker.Config{
+		MemoryThreshold:   80,
+		LatencyThreshold:  1000,
+		LatencyWindowSize: 10,
+		Percentile:        0.95,
+		WaitTime:          5,
+		OpsGenie:          &breaker.OpsGenieConfig{Enabled: false, Priority: "P3"},
+	}
+	driver := breaker.NewBreaker(config, configFile).(*breaker.BreakerDriver)
+	defer driver.Close()
+	setMemoryOverride(driver, true)
+	breakerAPI := &breaker.BreakerAPI{Config: *config, Driver: driver}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	breaker.AddEndpointToRouter(router, breakerAPI)
+
+	post := func(path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// 300ms is below the initial threshold
+	end := time.Now()
+	driver.Done(end.Add(-300*time.Millisecond), end)
+	require.False(t, driver.Triggered())
+
+	w := post("/breaker/latency", `{"threshold": 200}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, int64(200), driver.Config().LatencyThreshold)
+
+	// The same latency now trips the breaker without a restart
+	end = time.Now()
+	driver.Done(end.Add(-300*time.Millisecond), end)
+	assert.True(t, driver.Triggered())
+	assert.False(t, driver.Allow())
+
+	w = post("/breaker/wait", `{"wait_time": 1}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, 1, driver.Config().WaitTime)
+	assert.Eventually(t, driver.Allow, 3*time.Second, 50*time.Millisecond,
+		"The breaker should close after the new wait time")
+
+	w = post("/breaker/latency-window-size", `{"size": 50}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, 50, driver.Config().LatencyWindowSize)
+
+	w = post("/breaker/opsgenie/priority", `{"priority": "P1"}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "P1", driver.Config().OpsGenie.Priority)
+	assert.Same(t, breakerAPI.Config.OpsGenie, driver.Config().OpsGenie,
+		"The API and the driver should keep sharing the OpsGenie section")
+
+	// A change the breaker rejects is neither applied nor saved
+	w = post("/breaker/memory", `{"threshold": 0}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, 80.0, driver.Config().MemoryThreshold)
+	assert.Equal(t, 80.0, breakerAPI.Config.MemoryThreshold)
+
+	saved, err := breaker.LoadConfig(configFile)
+	require.NoError(t, err)
+	assert.Equal(t, int64(200), saved.LatencyThreshold)
+	assert.Equal(t, 50, saved.LatencyWindowSize)
+}
+
+func TestConfigSourceEndpoint(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	getSource := func(api *breaker.BreakerAPI) breaker.ConfigSource {
+		router := gin.New()
+		breaker.AddEndpointToRouter(router, api)
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/breaker/config-source", nil)
+		router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		var source breaker.ConfigSource
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &source))
+		return source
+	}
+	defaults := &breaker.Config{
+		MemoryThreshold:   80,
+		LatencyThreshold:  1000,
+		LatencyWindowSize: 10,
+		Percentile:        0.95,
+		WaitTime:          5,
+		OpsGenie:          &breaker.OpsGenieConfig{Enabled: false, Priority: "P3"},
+	}
+	dir := t.TempDir()
+
+	// A file that is loaded, with an invalid value and a typo
+	loadedPath := filepath.Join(dir, "loaded.toml")
+	require.NoError(t, os.WriteFile(loadedPath, []byte(`memory_threshold = 80.0
+latency_threshold = 1000
+latency_window_size = 10
+percentile = 1.5
+wait_tme = 30
+`), 0644))
+	loaded := breaker.InitBreaker(loadedPath, defaults)
+	defer loaded.Driver.Close()
+
+	source := getSource(loaded)
+	assert.Equal(t, loadedPath, source.Path)
+	assert.True(t, source.Loaded)
+	assert.False(t, source.DefaultsSubstituted)
+	assert.Equal(t, []string{"percentile"}, source.SubstitutedFields)
+	assert.Equal(t, []string{"wait_tme"}, source.UnknownKeys)
+	assert.True(t, source.FileExists)
+	assert.False(t, source.ModTime.IsZero())
+	assert.False(t, source.ModifiedSinceLoad)
+
+	// Editing the file after the load is reported
+	later := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(loadedPath, later, later))
+	assert.True(t, getSource(loaded).ModifiedSinceLoad)
+
+	// A corrupt file is replaced by the defaults
+	corruptPath := filepath.Join(dir, "corrupt.toml")
+	require.NoError(t, os.WriteFile(corruptPath, []byte("memory_threshold = = 80"), 0644))
+	corrupt := breaker.InitBreaker(corruptPath, defaults)
+	defer corrupt.Driver.Close()
+
+	source = getSource(corrupt)
+	assert.False(t, source.Loaded)
+	assert.True(t, source.DefaultsSubstituted)
+	assert.NotEmpty(t, source.LoadError)
+
+	// An API assembled by hand only knows the driver's file
+	manual := &breaker.BreakerAPI{Config: *defaults, Driver: breaker.NewBreaker(defaults, filepath.Join(dir, "missing.toml"))}
+	defer manual.Driver.Close()
+
+	source = getSource(manual)
+	assert.Equal(t, filepath.Join(dir, "missing.toml"), source.Path)
+	assert.False(t, source.Loaded)
+	assert.False(t, source.FileExists)
+}
+
+func TestTripTriggersEndpoint(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "breakers.toml")
+	config := &breaker.Config{
+		MemoryThreshold:   80,
+		LatencyThreshold:  1000,
+		LatencyWindowSize: 10,
+		Percentile:        0.95,
+		WaitTime:          5,
+		OpsGenie:          &breaker.OpsGenieConfig{Enabled: false, Priority: "P3"},
+	}
+	driver := breaker.NewBreaker(config, configFile).(*breaker.BreakerDriver)
+	defer driver.Close()
+	breakerAPI := &breaker.BreakerAPI{Config: *config, Driver: driver}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	breaker.AddEndpointToRouter(router, breakerAPI)
+
+	post := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/breaker/triggers", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// A memory-pressure false positive blocks every request
+	setMemoryOverride(driver, false)
+	require.False(t, driver.Allow())
+
+	w := post(`{"trip_on_memory": false}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.JSONEq(t, `{"trip_on_memory": false, "trip_on_latency": true, "message": "Trip triggers updated"}`, w.Body.String())
+	current := driver.Config()
+	assert.False(t, current.TripsOnMemory())
+	assert.True(t, driver.Allow(), "Memory pressure should no longer block requests")
+
+	// Latency trips still work, until they are disabled as well
+	end := time.Now()
+	driver.Done(end.Add(-2*time.Second), end)
+	assert.True(t, driver.Triggered())
+	driver.Reset()
+
+	w = post(`{"trip_on_latency": false}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	current = driver.Config()
+	assert.False(t, current.TripsOnMemory(), "Omitted fields keep their value")
+	end = time.Now()
+	driver.Done(end.Add(-2*time.Second), end)
+	assert.False(t, driver.Triggered())
+
+	w = httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/breaker/triggers", nil)
+	router.ServeHTTP(w, req)
+	assert.JSONEq(t, `{"trip_on_memory": false, "trip_on_latency": false}`, w.Body.String())
+
+	saved, err := breaker.LoadConfig(configFile)
+	require.NoError(t, err)
+	assert.False(t, saved.TripsOnMemory())
+	assert.False(t, saved.TripsOnLatency())
+
+	assert.Equal(t, http.StatusBadRequest, post(`{"trip_on_memory": "no"}`).Code)
+}
+
+// TestReadOnlyEndpoints verifies that a read-only mount serves the getters and none of
+// the endpoints that change the breaker
+func TestReadOnlyEndpoints(t *testing.T) {
+	config := &breaker.Config{
+		MemoryThreshold:   80,
+		LatencyThreshold:  1000,
+		LatencyWindowSize: 10,
+		Percentile:        0.95,
+		WaitTime:          5,
+		OpsGenie:          &breaker.OpsGenieConfig{Enabled: false, Priority: "P3"},
+	}
+	driver := breaker.NewBreaker(config, "").(*breaker.BreakerDriver)
+	defer driver.Close()
+	breakerAPI := &breaker.BreakerAPI{Config: *config, Driver: driver}
+
+	gin.SetMode(gin.TestMode)
+	readOnly := gin.New()
+	breaker.AddEndpointToRouter(readOnly, breakerAPI, breaker.ReadOnly())
+	admin := gin.New()
+	breaker.AddEndpointToRouter(admin, breakerAPI)
+
+	request := func(router *gin.Engine, method, path string) int {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, bytes.NewBufferString("{}"))
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	for _, path := range []string{"/breaker/status", "/breaker/memory", "/breaker/wait", "/breaker/memory-usage", "/breaker/trend-analysis", "/breaker/opsgenie/status"} {
+		assert.NotEqual(t, http.StatusNotFound, request(readOnly, "GET", path), path)
+	}
+	for _, path := range []string{"/breaker/trigger-by-latency", "/breaker/trigger-by-memory", "/breaker/restore-memory-check", "/breaker/opsgenie/test"} {
+		assert.Equal(t, http.StatusNotFound, request(readOnly, "GET", path), path)
+	}
+	assert.Equal(t, http.StatusNotFound, request(readOnly, "POST", "/breaker/reset"))
+	assert.Equal(t, http.StatusNotFound, request(readOnly, "POST", "/breaker/memory"))
+	assert.False(t, driver.Triggered())
+
+	// Every read-only route is a GET, and the admin mount has them all plus the mutators
+	adminRoutes := make(map[string]bool)
+	for _, route := range admin.Routes() {
+		adminRoutes[route.Method+" "+route.Path] = true
+	}
+	for _, route := range readOnly.Routes() {
+		assert.Equal(t, http.MethodGet, route.Method, route.Path)
+		assert.True(t, adminRoutes[route.Method+" "+route.Path], route.Path)
+	}
+	assert.Contains(t, adminRoutes, "POST /breaker/reset")
+	assert.Contains(t, adminRoutes, "GET /breaker/trigger-by-latency")
+
+	// The admin endpoints can be mounted behind authentication
+	authenticated := gin.New()
+	breaker.AddReadOnlyEndpoints(authenticated, breakerAPI)
+	breaker.AddAdminEndpoints(authenticated.Group("/admin", func(ctx *gin.Context) {
+		if ctx.GetHeader("Authorization") == "" {
+			ctx.AbortWithStatus(http.StatusUnauthorized)
+		}
+	}), breakerAPI)
+	assert.Equal(t, http.StatusOK, request(authenticated, "GET", "/breaker/status"))
+	assert.Equal(t, http.StatusUnauthorized, request(authenticated, "POST", "/admin/breaker/reset"))
+}
@@ -1,9 +1,17 @@
 package tests
 
 import (
-	"github.com/lrleon/go-breaker/breaker"
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
+
+	"github.com/lrleon/go-breaker/breaker"
 )
 
 func Test_loadConfig(t *testing.T) {
@@ -48,3 +56,589 @@ func Test_saveConfig(t *testing.T) {
 		})
 	}
 }
+
+func TestEnvironmentSettingsRoundTrip(t *testing.T) {
+	enabled, disabled := true, false
+	config := &breaker.Config{
+		MemoryThreshold:   80,
+		LatencyThreshold:  1500,
+		LatencyWindowSize: 64,
+		Percentile:        0.95,
+		WaitTime:          10,
+		OpsGenie: &breaker.OpsGenieConfig{
+			Enabled:              false,
+			Region:               "us",
+			Priority:             "P3",
+			Team:                 "platform-team",
+			AlertCooldownSeconds: 300,
+			UseEnvironments:      true,
+			EnvironmentSettings: map[string]breaker.EnvOpsConfig{
+				"prod": {
+					Enabled:         &enabled,
+					Priority:        "P1",
+					CooldownSeconds: 60,
+					Tags:            []string{"Environment:prod", "Team:platform"},
+				},
+				"dev": {
+					Enabled:         &disabled,
+					CooldownSeconds: 3600,
+				},
+			},
+		},
+	}
+
+	path := filepath.Join(t.TempDir(), "breakers.toml")
+	if err := breaker.SaveConfig(path, config); err != nil {
+		t.Fatalf("SaveConfig() error = %v", err)
+	}
+
+	loaded, err := breaker.LoadConfig(path)
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+
+	if !loaded.OpsGenie.UseEnvironments {
+		t.Errorf("use_environments was not preserved")
+	}
+	if !reflect.DeepEqual(loaded.OpsGenie.EnvironmentSettings, config.OpsGenie.EnvironmentSettings) {
+		t.Errorf("environment_settings got = %+v, want %+v",
+			loaded.OpsGenie.EnvironmentSettings, config.OpsGenie.EnvironmentSettings)
+	}
+}
+
+func TestEnvironmentSettingsValidation(t *testing.T) {
+	enabled := true
+	tests := []struct {
+		name     string
+		settings map[string]breaker.EnvOpsConfig
+		wantErr  bool
+	}{
+		{"known environments", map[string]breaker.EnvOpsConfig{"PROD": {Enabled: &enabled, Priority: "P2"}, "uat": {}}, false},
+		{"unknown environment", map[string]breaker.EnvOpsConfig{"moon": {Enabled: &enabled}}, true},
+		{"invalid priority", map[string]breaker.EnvOpsConfig{"prod": {Priority: "P9"}}, true},
+		{"negative cooldown", map[string]breaker.EnvOpsConfig{"dev": {CooldownSeconds: -1}}, true},
+		{"valid max priority", map[string]breaker.EnvOpsConfig{"dev": {MaxPriority: "P4"}}, false},
+		{"invalid max priority", map[string]breaker.EnvOpsConfig{"dev": {MaxPriority: "low"}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &breaker.OpsGenieConfig{EnvironmentSettings: tt.settings}
+			if err := breaker.ValidateOpsGenieConfig(config); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateOpsGenieConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadConfigDropsUnknownEnvironments(t *testing.T) {
+	content := `
+memory_threshold = 80.0
+latency_threshold = 1500
+latency_window_size = 64
+percentile = 0.95
+wait_time = 10
+
+[opsgenie]
+enabled = false
+use_environments = true
+
+[opsgenie.environment_settings.prod]
+enabled = true
+priority = "P1"
+
+[opsgenie.environment_settings.moon]
+enabled = true
+`
+	path := filepath.Join(t.TempDir(), "breakers.toml")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+
+	loaded, err := breaker.LoadConfig(path)
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+
+	if _, exists := loaded.OpsGenie.EnvironmentSettings["moon"]; exists {
+		t.Errorf("unknown environment should have been dropped")
+	}
+	if got := loaded.OpsGenie.EnvironmentSettings["prod"]; got.Enabled == nil || !*got.Enabled || got.Priority != "P1" {
+		t.Errorf("prod settings got = %+v", got)
+	}
+}
+
+func TestLoadConfigDropsInvalidPrioritySteps(t *testing.T) {
+	content := `memory_threshold = 80.0
+latency_threshold = 300
+latency_window_size = 10
+percentile = 0.95
+wait_time = 10
+
+[opsgenie]
+enabled = false
+
+[[opsgenie.priority_escalation_ladder]]
+after_seconds = 300
+priority = "P2"
+
+[[opsgenie.priority_escalation_ladder]]
+after_seconds = 60
+priority = "P1"
+
+[[opsgenie.priority_by_magnitude]]
+min_factor = 0.5
+priority = "P2"
+
+[[opsgenie.priority_by_magnitude]]
+min_factor = 5
+priority = "P1"
+`
+	path := filepath.Join(t.TempDir(), "breakers.toml")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+
+	loaded, err := breaker.LoadConfig(path)
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+
+	if len(loaded.OpsGenie.PriorityEscalationLadder) != 0 {
+		t.Errorf("a ladder whose steps go back in time should have been dropped, got %+v",
+			loaded.OpsGenie.PriorityEscalationLadder)
+	}
+	want := []breaker.MagnitudePriority{{MinFactor: 5, Priority: "P1"}}
+	if !reflect.DeepEqual(loaded.OpsGenie.PriorityByMagnitude, want) {
+		t.Errorf("priority_by_magnitude got = %+v, want %+v", loaded.OpsGenie.PriorityByMagnitude, want)
+	}
+}
+
+func TestStagedAlertPriorityValidation(t *testing.T) {
+	tests := []struct {
+		name        string
+		initial     string
+		escalated   string
+		wantErr     bool
+		wantWarning bool
+	}{
+		{"escalation raises severity", "P3", "P1", false, false},
+		{"not configured", "", "", false, false},
+		{"invalid initial", "P0", "P1", true, false},
+		{"invalid escalated", "P3", "high", true, false},
+		{"escalation lowers severity", "P2", "P4", false, true},
+		{"escalation keeps severity", "P3", "P3", false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logs bytes.Buffer
+			log.SetOutput(&logs)
+			defer log.SetOutput(os.Stderr)
+
+			config := &breaker.OpsGenieConfig{
+				InitialAlertPriority:   tt.initial,
+				EscalatedAlertPriority: tt.escalated,
+			}
+			err := breaker.ValidateOpsGenieConfig(config)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateOpsGenieConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := strings.Contains(logs.String(), "escalated_alert_priority"); got != tt.wantWarning {
+				t.Errorf("warning logged = %v, want %v (logs: %q)", got, tt.wantWarning, logs.String())
+			}
+		})
+	}
+}
+
+func TestCustomAttributesRoundTrip(t *testing.T) {
+	// Keys with dots, spaces and non-ASCII characters must be quoted by the encoder
+	attributes := map[string]string{
+		"region":      "eu-west-1",
+		"cost.center": "CC-1234",
+		"on call":     "payments-oncall",
+		"équipe":      "paiements",
+		"empty":       "",
+	}
+
+	config := &breaker.Config{
+		MemoryThreshold:   80,
+		LatencyThreshold:  1500,
+		LatencyWindowSize: 64,
+		Percentile:        0.95,
+		WaitTime:          10,
+		OpsGenie: &breaker.OpsGenieConfig{
+			Region:              "us",
+			Priority:            "P3",
+			Team:                "platform-team",
+			APICustomAttributes: attributes,
+		},
+	}
+
+	path := filepath.Join(t.TempDir(), "breakers.toml")
+	if err := breaker.SaveConfig(path, config); err != nil {
+		t.Fatalf("SaveConfig() error = %v", err)
+	}
+
+	loaded, err := breaker.LoadConfig(path)
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	if !reflect.DeepEqual(loaded.OpsGenie.APICustomAttributes, attributes) {
+		t.Errorf("api_custom_attributes got = %+v, want %+v", loaded.OpsGenie.APICustomAttributes, attributes)
+	}
+
+	// A second round trip must be stable
+	if err := breaker.SaveConfig(path, loaded); err != nil {
+		t.Fatalf("SaveConfig() error = %v", err)
+	}
+	reloaded, err := breaker.LoadConfig(path)
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	if !reflect.DeepEqual(reloaded.OpsGenie.APICustomAttributes, attributes) {
+		t.Errorf("api_custom_attributes after second round trip got = %+v, want %+v",
+			reloaded.OpsGenie.APICustomAttributes, attributes)
+	}
+}
+
+func TestSaveConfigKeepsComments(t *testing.T) {
+	original := `# Breaker of the payments API
+memory_threshold = 80                # Percent of the memory limit
+latency_threshold = 1500             # Milliseconds
+latency_window_size = 64
+percentile = 0.95
+wait_time = 10                       # Seconds before trying again
+
+[opsgenie]
+# Alerts go to the payments team
+enabled = false
+priority = "P3"                      # Raised to P1 after hours
+team = "payments"
+
+[[opsgenie.priority_escalation_ladder]]
+after_seconds = 60
+priority = "P2"
+`
+	path := filepath.Join(t.TempDir(), "breakers.toml")
+	if err := os.WriteFile(path, []byte(original), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := breaker.LoadConfig(path)
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	config.LatencyThreshold = 900
+	config.RecoveryConsecutiveChecks = 3
+	config.OpsGenie.Priority = "P1"
+	config.OpsGenie.APICustomAttributes = map[string]string{"empty": ""}
+	if err := breaker.SaveConfig(path, config); err != nil {
+		t.Fatalf("SaveConfig() error = %v", err)
+	}
+
+	saved, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		"# Breaker of the payments API\n",
+		"latency_threshold = 900              # Milliseconds\n",
+		"wait_time = 10                       # Seconds before trying again\n",
+		"recovery_consecutive_checks = 3\n",
+		"# Alerts go to the payments team\n",
+		`priority = "P1"                      # Raised to P1 after hours` + "\n",
+		"[[opsgenie.priority_escalation_ladder]]\nafter_seconds = 60\n",
+		`empty = ""`,
+	} {
+		if !strings.Contains(string(saved), line) {
+			t.Errorf("the saved file lacks %q:\n%s", line, saved)
+		}
+	}
+	if strings.Contains(string(saved), "honor_shared_trips") {
+		t.Errorf("fields left at their zero value should not be added:\n%s", saved)
+	}
+
+	loaded, err := breaker.LoadConfig(path)
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	if !reflect.DeepEqual(loaded, config) {
+		t.Errorf("LoadConfig() after SaveConfig() got = %+v, want %+v", loaded, config)
+	}
+
+	// Multi-line values cannot be edited in place: the file is rewritten
+	multiline := strings.Replace(original, `team = "payments"`, "tags = [\n  \"payments\",\n]\nteam = \"payments\"", 1)
+	if err := os.WriteFile(path, []byte(multiline), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := breaker.SaveConfig(path, config); err != nil {
+		t.Fatalf("SaveConfig() error = %v", err)
+	}
+	loaded, err = breaker.LoadConfig(path)
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	if loaded.LatencyThreshold != 900 || loaded.OpsGenie.Priority != "P1" {
+		t.Errorf("the rewritten file got latency_threshold %d and priority %q", loaded.LatencyThreshold, loaded.OpsGenie.Priority)
+	}
+}
+
+func TestCustomAttributesValidation(t *testing.T) {
+	tests := []struct {
+		name       string
+		attributes map[string]string
+		wantErr    string
+	}{
+		{"Valid", map[string]string{"region": "eu", "cost.center": "CC-1"}, ""},
+		{"BreakerDetailName", map[string]string{"Team": "other-team"}, ""},
+		{"Prefixed", map[string]string{"Custom_region": "eu"}, "must not start with Custom_"},
+		{"PrefixedIgnoresCase", map[string]string{"custom_region": "eu"}, "must not start with Custom_"},
+		{"Empty", map[string]string{" ": "x"}, "empty key"},
+		{"Duplicate", map[string]string{"Region": "eu", "region": "us"}, "duplicate api_custom_attributes keys"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := breaker.ValidateOpsGenieConfig(&breaker.OpsGenieConfig{
+				Region:              "us",
+				Priority:            "P3",
+				APICustomAttributes: tt.attributes,
+			})
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("ValidateOpsGenieConfig() error = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ValidateOpsGenieConfig() error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadConfigDropsInvalidCustomAttributes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "breakers.toml")
+	content := `memory_threshold = 80.0
+latency_threshold = 1500
+latency_window_size = 64
+percentile = 0.95
+wait_time = 10
+
+[opsgenie]
+team = "platform-team"
+api_custom_attributes = { region = "eu-west-1", Custom_team = "other-team" }
+`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := breaker.LoadConfig(path)
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+
+	want := map[string]string{"region": "eu-west-1"}
+	if !reflect.DeepEqual(loaded.OpsGenie.APICustomAttributes, want) {
+		t.Errorf("api_custom_attributes got = %+v, want %+v", loaded.OpsGenie.APICustomAttributes, want)
+	}
+}
+
+func TestLoadConfigMerged(t *testing.T) {
+	dir := t.TempDir()
+	base := filepath.Join(dir, "breakers.toml")
+	baseContent := `memory_threshold = 80.0
+latency_threshold = 1500
+latency_window_size = 64
+percentile = 0.95
+wait_time = 10
+
+[opsgenie]
+enabled = true
+team = "platform-team"
+priority = "P3"
+tags = ["service:payments"]
+`
+	override := filepath.Join(dir, "breakers.prod.toml")
+	overrideContent := `latency_threshold = 800
+
+[opsgenie]
+priority = "P1"
+environment = "prod"
+`
+	if err := os.WriteFile(base, []byte(baseContent), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(override, []byte(overrideContent), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	merged, err := breaker.LoadConfigMerged(base, override)
+	if err != nil {
+		t.Fatalf("LoadConfigMerged() error = %v", err)
+	}
+
+	// Later files win for the fields they set
+	if merged.LatencyThreshold != 800 {
+		t.Errorf("latency_threshold got = %d, want 800", merged.LatencyThreshold)
+	}
+	if merged.OpsGenie.Priority != "P1" || merged.OpsGenie.Environment != "prod" {
+		t.Errorf("opsgenie got priority = %q, environment = %q, want P1 and prod",
+			merged.OpsGenie.Priority, merged.OpsGenie.Environment)
+	}
+
+	// Fields left unset keep the values of the earlier files
+	if merged.WaitTime != 10 || merged.LatencyWindowSize != 64 {
+		t.Errorf("wait_time = %d, latency_window_size = %d, want 10 and 64", merged.WaitTime, merged.LatencyWindowSize)
+	}
+	if !merged.OpsGenie.Enabled || merged.OpsGenie.Team != "platform-team" ||
+		!reflect.DeepEqual(merged.OpsGenie.Tags, []string{"service:payments"}) {
+		t.Errorf("opsgenie section lost fields of the base file: %+v", merged.OpsGenie)
+	}
+
+	// The order decides the precedence
+	reversed, err := breaker.LoadConfigMerged(override, base)
+	if err != nil {
+		t.Fatalf("LoadConfigMerged() error = %v", err)
+	}
+	if reversed.LatencyThreshold != 1500 || reversed.OpsGenie.Priority != "P3" {
+		t.Errorf("reversed got latency_threshold = %d, priority = %q, want 1500 and P3",
+			reversed.LatencyThreshold, reversed.OpsGenie.Priority)
+	}
+
+	if _, err := breaker.LoadConfigMerged(base, filepath.Join(dir, "missing.toml")); err == nil {
+		t.Error("LoadConfigMerged() should fail when a file is missing")
+	}
+}
+
+func TestLoadConfigStrictMode(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	valid := write("valid.toml", `memory_threshold = 80.0
+latency_threshold = 1500
+latency_window_size = 64
+percentile = 0.95
+
+[opsgenie]
+enabled = false
+`)
+	typo := write("typo.toml", `memory_threshold = 80.0
+latency_treshold = 100
+latency_window_size = 64
+percentile = 0.95
+`)
+	invalid := write("invalid.toml", `memory_threshold = 80.0
+latency_threshold = 1500
+latency_window_size = 64
+percentile = 1.5
+`)
+
+	// Fields that are not set still get their defaults
+	config, err := breaker.LoadConfig(valid, breaker.StrictMode())
+	if err != nil {
+		t.Fatalf("LoadConfig(valid, StrictMode()) error = %v", err)
+	}
+	if config.WaitTime <= 0 {
+		t.Errorf("wait_time got = %d, want the default", config.WaitTime)
+	}
+
+	// Without strict mode, the typo and the invalid value are replaced by defaults
+	for _, path := range []string{typo, invalid} {
+		if _, err := breaker.LoadConfig(path); err != nil {
+			t.Errorf("LoadConfig(%s) error = %v", filepath.Base(path), err)
+		}
+	}
+
+	_, err = breaker.LoadConfig(typo, breaker.StrictMode())
+	var validationErr *breaker.TOMLValidationError
+	if !errors.As(err, &validationErr) || validationErr.Field != "latency_treshold" || validationErr.Line != 2 {
+		t.Errorf("LoadConfig(typo, StrictMode()) error = %v, want an unknown key error for latency_treshold at line 2", err)
+	}
+
+	_, err = breaker.LoadConfig(invalid, breaker.StrictMode())
+	if !errors.As(err, &validationErr) || validationErr.Field != "percentile" || validationErr.Line != 4 {
+		t.Errorf("LoadConfig(invalid, StrictMode()) error = %v, want a percentile error at line 4", err)
+	}
+
+	// The environment variable enables strict mode for every load
+	t.Setenv(breaker.EnvStrictConfig, "true")
+	if _, err := breaker.LoadConfig(typo); err == nil {
+		t.Errorf("LoadConfig(typo) with %s should fail", breaker.EnvStrictConfig)
+	}
+	if _, err := breaker.LoadConfigMerged(valid, invalid); err == nil {
+		t.Errorf("LoadConfigMerged() with %s should fail on an invalid value", breaker.EnvStrictConfig)
+	}
+}
+
+// TestBookmakerIDAliases verifies that bookmaker_id and its alias project_id each satisfy
+// the mandatory bookmaker ID, at load time and at runtime
+func TestBookmakerIDAliases(t *testing.T) {
+	for _, envVar := range []string{"BOOKMAKER_ID", "PROJECT_ID", "CLIENT_ID", "SERVICE_ID"} {
+		t.Setenv(envVar, "")
+	}
+
+	tests := []struct {
+		name  string
+		field string
+	}{
+		{"bookmaker_id", "bookmaker_id"},
+		{"project_id", "project_id"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "breakers.toml")
+			content := fmt.Sprintf(`memory_threshold = 80.0
+
+[opsgenie]
+enabled = true
+team = "platform"
+environment = "dev"
+%s = "payments"
+`, tt.field)
+			if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			var output strings.Builder
+			log.SetOutput(&output)
+			config, err := breaker.LoadConfig(path)
+			log.SetOutput(os.Stderr)
+			if err != nil {
+				t.Fatalf("LoadConfig() error = %v", err)
+			}
+
+			if got := config.OpsGenie.EffectiveBookmakerID(); got != "payments" {
+				t.Errorf("EffectiveBookmakerID() = %q, want %q", got, "payments")
+			}
+			if strings.Contains(output.String(), "Neither bookmaker_id nor its alias") ||
+				!strings.Contains(output.String(), "opsgenie."+tt.field+" = payments (valid)") {
+				t.Errorf("The load should accept %s as the bookmaker ID:\n%s", tt.field, output.String())
+			}
+			summary := breaker.GetConfigSummary(config)["opsgenie"].(map[string]interface{})
+			if summary["bookmaker_id"] != "payments" {
+				t.Errorf("summary bookmaker_id = %v, want payments", summary["bookmaker_id"])
+			}
+			if err := breaker.ValidateOpsGenieConfig(config.OpsGenie); err != nil {
+				t.Errorf("ValidateOpsGenieConfig() error = %v", err)
+			}
+
+			client := breaker.NewOpsGenieClient(config.OpsGenie)
+			if problem := client.ValidateMandatoryFields(); problem != nil {
+				for _, field := range problem.MissingFields {
+					if field == "bookmaker_id" {
+						t.Errorf("bookmaker_id reported missing with %s set", tt.field)
+					}
+				}
+			}
+		})
+	}
+}
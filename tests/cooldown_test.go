@@ -1,6 +1,7 @@
 package tests
 
 import (
+	"strings"
 	"testing"
 	"time"
 
@@ -131,3 +132,197 @@ func TestAlertDeduplicationWithRealClient(t *testing.T) {
 		t.Fatal("Cooldown should have expired after waiting")
 	}
 }
+
+// TestCooldownPerEnvironment verifies that the cooldown of the current environment
+// overrides the global alert_cooldown_seconds
+func TestCooldownPerEnvironment(t *testing.T) {
+	newClient := func(environment string) *breaker.OpsGenieClient {
+		return breaker.NewOpsGenieClient(&breaker.OpsGenieConfig{
+			Enabled:              true,
+			AlertCooldownSeconds: 2,
+			Environment:          environment,
+			UseEnvironments:      true,
+			EnvironmentSettings: map[string]breaker.EnvOpsConfig{
+				"prod": {CooldownSeconds: 1},
+				"dev":  {CooldownSeconds: 3600},
+			},
+		})
+	}
+
+	alertKey := "per-environment-alert"
+
+	prodClient := newClient("prod")
+	devClient := newClient("DEV") // keys are matched case-insensitively
+	globalClient := newClient("uat")
+
+	prodClient.RecordAlert(alertKey)
+	devClient.RecordAlert(alertKey)
+	globalClient.RecordAlert(alertKey)
+
+	if !prodClient.IsOnCooldown(alertKey) || !devClient.IsOnCooldown(alertKey) || !globalClient.IsOnCooldown(alertKey) {
+		t.Fatalf("All clients should be in cooldown right after recording an alert")
+	}
+
+	// Wait past the production cooldown but within the global and dev cooldowns
+	time.Sleep(1100 * time.Millisecond)
+
+	if prodClient.IsOnCooldown(alertKey) {
+		t.Errorf("prod cooldown (1s) should have expired")
+	}
+	if !globalClient.IsOnCooldown(alertKey) {
+		t.Errorf("environment without override should use the global cooldown (2s)")
+	}
+	if !devClient.IsOnCooldown(alertKey) {
+		t.Errorf("dev cooldown (3600s) should still be active")
+	}
+
+	// Overrides are ignored unless use_environments is enabled
+	disabled := breaker.NewOpsGenieClient(&breaker.OpsGenieConfig{
+		Enabled:              true,
+		AlertCooldownSeconds: 1,
+		Environment:          "dev",
+		EnvironmentSettings:  map[string]breaker.EnvOpsConfig{"dev": {CooldownSeconds: 3600}},
+	})
+	disabled.RecordAlert(alertKey)
+	time.Sleep(1100 * time.Millisecond)
+	if disabled.IsOnCooldown(alertKey) {
+		t.Errorf("environment overrides should not apply when use_environments is false")
+	}
+}
+
+// TestAlertTypeCooldownOverridesEnvironmentCooldown verifies that an alert_cooldowns
+// entry wins over the cooldown_seconds of the environment, which still applies to the
+// alert types without an entry
+func TestAlertTypeCooldownOverridesEnvironmentCooldown(t *testing.T) {
+	client := breaker.NewOpsGenieClient(&breaker.OpsGenieConfig{
+		Enabled:              true,
+		APIName:              "test-api",
+		AlertCooldownSeconds: 60,
+		AlertCooldowns:       map[string]int{"memory": 900, "latency": 120},
+		UseEnvironments:      true,
+		Environment:          "dev",
+		EnvironmentSettings:  map[string]breaker.EnvOpsConfig{"dev": {CooldownSeconds: 3600}},
+	})
+	clock := breaker.NewMockClock(time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC))
+	client.SetClock(clock)
+
+	memoryKey := "test-api-memory-threshold-85.00%"
+	latencyKey := "test-api-latency-threshold-500ms"
+	resetKey := "test-api-circuit-reset"
+	for _, key := range []string{memoryKey, latencyKey, resetKey} {
+		client.RecordAlert(key)
+	}
+
+	clock.Advance(121 * time.Second)
+	if client.IsOnCooldown(latencyKey) {
+		t.Errorf("the latency cooldown (120s) should apply in the environment")
+	}
+	if !client.IsOnCooldown(memoryKey) {
+		t.Errorf("the memory cooldown (900s) should still be active")
+	}
+
+	clock.Advance(780 * time.Second)
+	if client.IsOnCooldown(memoryKey) {
+		t.Errorf("the memory cooldown (900s) should apply in the environment")
+	}
+	if !client.IsOnCooldown(resetKey) {
+		t.Errorf("the reset alert, without an alert_cooldowns entry, should use the environment cooldown (3600s)")
+	}
+}
+
+func TestMaxPriorityPerEnvironment(t *testing.T) {
+	newClient := func(environment string, useEnvironments bool) *breaker.OpsGenieClient {
+		return breaker.NewOpsGenieClient(&breaker.OpsGenieConfig{
+			Enabled:         true,
+			Priority:        "P1",
+			Environment:     environment,
+			UseEnvironments: useEnvironments,
+			EnvironmentSettings: map[string]breaker.EnvOpsConfig{
+				"dev":  {MaxPriority: "P4"},
+				"ci":   {Priority: "P2", MaxPriority: "P5"},
+				"qa":   {Priority: "P5", MaxPriority: "P3"},
+				"prod": {},
+			},
+		})
+	}
+
+	tests := []struct {
+		environment     string
+		useEnvironments bool
+		want            string
+	}{
+		{"dev", true, "P4"},  // Global P1 capped
+		{"ci", true, "P5"},   // Environment priority capped
+		{"qa", true, "P5"},   // Already less severe than the cap
+		{"prod", true, "P1"}, // No cap
+		{"uat", true, "P1"},  // No settings for the environment
+		{"dev", false, "P1"}, // Settings ignored without use_environments
+	}
+
+	for _, tt := range tests {
+		client := newClient(tt.environment, tt.useEnvironments)
+		if got := client.EffectivePriority(); got != tt.want {
+			t.Errorf("EffectivePriority() in %s (use_environments=%t) = %s, want %s",
+				tt.environment, tt.useEnvironments, got, tt.want)
+		}
+	}
+}
+
+// TestCooldownPerAlertType verifies that alert_cooldowns gives each alert type its own
+// cooldown and that types without an entry use alert_cooldown_seconds
+func TestCooldownPerAlertType(t *testing.T) {
+	client := breaker.NewOpsGenieClient(&breaker.OpsGenieConfig{
+		Enabled:              true,
+		AlertCooldownSeconds: 2,
+		AlertCooldowns:       map[string]int{"memory": 1, "latency": 3600},
+		APIName:              "test-api",
+	})
+
+	memoryKey := "test-api-memory-threshold-85.00%"
+	latencyKey := "test-api-latency-threshold-1200ms"
+	openKey := "test-api-circuit-open-latency"
+
+	for _, key := range []string{memoryKey, latencyKey, openKey} {
+		client.RecordAlert(key)
+		if !client.IsOnCooldown(key) {
+			t.Fatalf("%s should be in cooldown right after recording it", key)
+		}
+	}
+
+	// Wait past the memory cooldown but within the global and latency cooldowns
+	time.Sleep(1100 * time.Millisecond)
+
+	if client.IsOnCooldown(memoryKey) {
+		t.Errorf("memory cooldown (1s) should have expired")
+	}
+	if !client.IsOnCooldown(latencyKey) {
+		t.Errorf("latency cooldown (3600s) should still be active")
+	}
+	if !client.IsOnCooldown(openKey) {
+		t.Errorf("open alerts have no entry and should use the global cooldown (2s)")
+	}
+
+	// Each type is tracked independently: a new memory alert does not extend the others
+	client.RecordAlert(memoryKey)
+	time.Sleep(1000 * time.Millisecond)
+	if client.IsOnCooldown(openKey) {
+		t.Errorf("global cooldown (2s) of open alerts should have expired")
+	}
+	if !client.IsOnCooldown(latencyKey) {
+		t.Errorf("latency cooldown (3600s) should still be active")
+	}
+}
+
+func TestAlertCooldownsValidation(t *testing.T) {
+	valid := &breaker.OpsGenieConfig{AlertCooldowns: map[string]int{"open": 60, "reset": 0}}
+	if err := breaker.ValidateOpsGenieConfig(valid); err != nil {
+		t.Errorf("ValidateOpsGenieConfig() error = %v", err)
+	}
+
+	for _, cooldowns := range []map[string]int{{"opened": 60}, {"memory": -1}} {
+		config := &breaker.OpsGenieConfig{AlertCooldowns: cooldowns}
+		if err := breaker.ValidateOpsGenieConfig(config); err == nil || !strings.Contains(err.Error(), "alert_cooldowns") {
+			t.Errorf("ValidateOpsGenieConfig(%v) error = %v, want an alert_cooldowns error", cooldowns, err)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lrleon/go-breaker/breaker"
+	"github.com/lrleon/go-breaker/breaker/datadog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDatadogNotifierSubmitsEvents(t *testing.T) {
+	events := make(chan map[string]interface{}, 1)
+	var apiKey string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		apiKey = r.Header.Get("DD-API-KEY")
+		var event map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		events <- event
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	notifier, err := datadog.New(&breaker.DatadogConfig{
+		Enabled:   true,
+		APIKey:    "dd-key",
+		EventsURL: server.URL,
+		Tags:      []string{"env:test"},
+	})
+	require.NoError(t, err)
+	defer notifier.Close()
+
+	// The notifier takes the place of OpsGenie in the client
+	client := breaker.NewOpsGenieClient(&breaker.OpsGenieConfig{
+		Enabled:       true,
+		Priority:      "P2",
+		TriggerOnOpen: true,
+		Team:          "test-team",
+	})
+	client.SetNotifier(notifier)
+	require.NoError(t, client.SendBreakerOpenAlertWithReason(900, true, 10, breaker.TripReasonLatency))
+
+	var event map[string]interface{}
+	select {
+	case event = <-events:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event was submitted")
+	}
+	assert.Equal(t, "dd-key", apiKey)
+	assert.Equal(t, "error", event["alert_type"])
+	assert.Equal(t, "normal", event["priority"])
+	assert.NotEmpty(t, event["title"])
+	tags, _ := event["tags"].([]interface{})
+	assert.Contains(t, tags, "env:test")
+	assert.Contains(t, tags, "reason:latency")
+	assert.Contains(t, tags, "alert_type:circuit-open")
+
+	// Errors of the Events API are returned
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"errors":["Forbidden"]}`, http.StatusForbidden)
+	}))
+	defer failing.Close()
+	rejected, err := datadog.New(&breaker.DatadogConfig{EventsURL: failing.URL})
+	require.NoError(t, err)
+	err = rejected.Notify(context.Background(), breaker.Alert{Type: "circuit-reset", Message: "reset"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "403")
+}
+
+func TestDatadogNotifierReportsMetrics(t *testing.T) {
+	statsd, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer statsd.Close()
+
+	notifier, err := datadog.New(&breaker.DatadogConfig{
+		StatsdAddr:             statsd.LocalAddr().String(),
+		MetricsIntervalSeconds: 1,
+		Tags:                   []string{"env:test"},
+	})
+	require.NoError(t, err)
+	defer notifier.Close()
+
+	driver := breaker.NewBreaker(&breaker.Config{
+		Name:              "datadog-payments",
+		MemoryThreshold:   80,
+		LatencyThreshold:  100,
+		LatencyWindowSize: 10,
+		Percentile:        0.5,
+		WaitTime:          5,
+	}, "").(*breaker.BreakerDriver)
+	defer driver.Close()
+	setMemoryOverride(driver, true)
+
+	stop := notifier.Watch(driver)
+	defer stop()
+
+	end := time.Now()
+	driver.Done(end.Add(-300*time.Millisecond), end)
+	require.True(t, driver.Triggered())
+	assert.Equal(t, uint64(1), driver.TripCount())
+
+	metrics := make(map[string]string)
+	buffer := make([]byte, 1024)
+	require.NoError(t, statsd.SetReadDeadline(time.Now().Add(5*time.Second)))
+	for len(metrics) < 3 {
+		n, _, err := statsd.ReadFrom(buffer)
+		require.NoError(t, err)
+		datagram := string(buffer[:n])
+		name, _, _ := strings.Cut(datagram, ":")
+		metrics[name] = datagram
+	}
+
+	tags := "|#env:test,breaker:datadog-payments"
+	assert.Equal(t, datadog.MetricState+":1|g"+tags, metrics[datadog.MetricState])
+	assert.Equal(t, datadog.MetricLatencyP95+":300|g"+tags, metrics[datadog.MetricLatencyP95])
+	assert.Equal(t, datadog.MetricTrips+":1|c"+tags, metrics[datadog.MetricTrips])
+}
+
+func TestDatadogConfigSection(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "breakers.toml")
+	require.NoError(t, os.WriteFile(path, []byte(`memory_threshold = 80.0
+
+[datadog]
+enabled = true
+api_key = "dd-key"
+statsd_addr = "not-an-address"
+metrics_interval_seconds = 30
+tags = ["env:prod"]
+`), 0644))
+
+	config, err := breaker.LoadConfig(path)
+	require.NoError(t, err)
+	require.NotNil(t, config.Datadog)
+	assert.True(t, config.Datadog.Enabled)
+	assert.Equal(t, "dd-key", config.Datadog.APIKey)
+	assert.Empty(t, config.Datadog.StatsdAddr, "An invalid address disables the metrics")
+	assert.Equal(t, 30, config.Datadog.MetricsIntervalSeconds)
+	assert.Equal(t, []string{"env:prod"}, config.Datadog.Tags)
+
+	_, err = breaker.LoadConfig(path, breaker.StrictMode())
+	assert.Error(t, err, "Strict mode rejects the invalid address")
+
+	assert.Error(t, breaker.ValidateDatadogConfig(&breaker.DatadogConfig{StatsdAddr: "localhost"}))
+	assert.Error(t, breaker.ValidateDatadogConfig(&breaker.DatadogConfig{MetricsIntervalSeconds: -1}))
+	assert.Error(t, breaker.ValidateDatadogConfig(&breaker.DatadogConfig{EventsURL: "/api/v1/events"}))
+	assert.NoError(t, breaker.ValidateDatadogConfig(nil))
+}
@@ -0,0 +1,90 @@
+package tests
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lrleon/go-breaker/breaker"
+	"github.com/lrleon/go-breaker/breaker/breakertest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// nextEvent waits for the next event of the channel
+func nextEvent(t *testing.T, events <-chan breaker.BreakerEvent) breaker.BreakerEvent {
+	t.Helper()
+	select {
+	case event := <-events:
+		return event
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for a breaker event")
+		return breaker.BreakerEvent{}
+	}
+}
+
+func TestEvents(t *testing.T) {
+	b := breakertest.NewTestBreaker(breakertest.WithWaitTime(60))
+	defer b.Close()
+
+	events := b.Events()
+	assert.Equal(t, events, b.Events(), "Every call should return the same channel")
+
+	require.NoError(t, breakertest.TriggerByLatency(b))
+	event := nextEvent(t, events)
+	assert.Equal(t, breaker.EventTripped, event.Type)
+	assert.Equal(t, breaker.TripReasonLatency, event.Reason)
+	assert.Greater(t, event.LatencyPercentileMs, int64(100))
+	assert.WithinDuration(t, time.Now(), event.Time, time.Second)
+
+	assert.False(t, b.Allow())
+	event = nextEvent(t, events)
+	assert.Equal(t, breaker.EventRejected, event.Type)
+	assert.Equal(t, breaker.RejectReasonOpen, event.Reason)
+
+	b.Reset()
+	event = nextEvent(t, events)
+	assert.Equal(t, breaker.EventReset, event.Type)
+	assert.Equal(t, breaker.ResetReasonManual, event.Reason)
+
+	// A memory breach is reported once, when memory goes above the threshold
+	setMemoryOverride(b, false)
+	end := time.Now()
+	b.Done(end.Add(-time.Millisecond), end)
+	b.Done(end.Add(-time.Millisecond), end)
+	event = nextEvent(t, events)
+	assert.Equal(t, breaker.EventMemoryThresholdBreached, event.Type)
+	event = nextEvent(t, events)
+	assert.Equal(t, breaker.EventTripped, event.Type)
+	assert.Equal(t, breaker.TripReasonMemory, event.Reason)
+
+	select {
+	case event := <-events:
+		t.Fatalf("unexpected event %+v", event)
+	default:
+	}
+}
+
+func TestEventsDropWhenFull(t *testing.T) {
+	b := breakertest.NewTestBreaker(breakertest.WithWaitTime(60))
+	defer b.Close()
+
+	events := b.Events()
+	require.NoError(t, breakertest.TriggerByLatency(b))
+
+	// Nobody reads the channel, so rejections past the buffer are dropped, not blocked on
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 1000; i++ {
+			b.Allow()
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Allow blocked on a full event channel")
+	}
+
+	assert.Equal(t, cap(events), len(events))
+	assert.Equal(t, uint64(1000+1-cap(events)), b.DroppedEvents())
+}
@@ -0,0 +1,89 @@
+package tests
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/lrleon/go-breaker/breaker"
+	"github.com/stretchr/testify/require"
+)
+
+// createdAlert is the body of an alert creation request received by fakeOpsGenie
+type createdAlert struct {
+	Message  string            `json:"message"`
+	Alias    string            `json:"alias"`
+	Priority string            `json:"priority"`
+	Tags     []string          `json:"tags"`
+	Details  map[string]string `json:"details"`
+}
+
+// fakeOpsGenie is an HTTP server that answers the OpsGenie alert API calls made by the
+// client and records the alerts it creates
+type fakeOpsGenie struct {
+	*httptest.Server
+	mu      sync.Mutex
+	created []createdAlert
+
+	unavailable atomic.Bool  // Fails every call while set, with a 501 that the SDK does not retry
+	listings    atomic.Int64 // Calls that list the alerts, as the connectivity check does
+}
+
+func newFakeOpsGenie(t *testing.T) *fakeOpsGenie {
+	fake := &fakeOpsGenie{}
+	fake.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if fake.unavailable.Load() {
+			w.WriteHeader(http.StatusNotImplemented)
+			_, _ = w.Write([]byte(`{"message":"Not Implemented","took":0.01,"requestId":"fake"}`))
+			return
+		}
+		if r.Method == http.MethodPost && r.URL.Path == "/v2/alerts" {
+			body, _ := io.ReadAll(r.Body)
+			var alert createdAlert
+			if err := json.Unmarshal(body, &alert); err == nil {
+				fake.mu.Lock()
+				fake.created = append(fake.created, alert)
+				fake.mu.Unlock()
+			}
+			w.WriteHeader(http.StatusAccepted)
+			_, _ = w.Write([]byte(`{"result":"Request will be processed","took":0.01,"requestId":"fake"}`))
+			return
+		}
+		if r.Method == http.MethodGet && r.URL.Path == "/v2/alerts" {
+			fake.listings.Add(1)
+		}
+		_, _ = w.Write([]byte(`{"data":[],"took":0.01,"requestId":"fake"}`))
+	}))
+	t.Cleanup(fake.Close)
+	return fake
+}
+
+// client returns an initialized client, with the given configuration, that talks to the fake
+func (f *fakeOpsGenie) client(t *testing.T, config *breaker.OpsGenieConfig) *breaker.OpsGenieClient {
+	t.Setenv(breaker.EnvOpsGenieAPIKey, "test-key")
+	t.Setenv(breaker.EnvOpsGenieAPIURL, f.URL)
+
+	client := breaker.NewOpsGenieClient(config)
+	require.NoError(t, client.Initialize())
+	return client
+}
+
+// resetOpsGenieClient makes the next breaker created by the test get a new OpsGenie
+// client from its own configuration instead of the singleton left by another test, and
+// forgets that client when the test ends
+func resetOpsGenieClient(t *testing.T) {
+	breaker.ResetOpsGenieClient()
+	t.Cleanup(breaker.ResetOpsGenieClient)
+}
+
+// alerts returns the alerts created so far
+func (f *fakeOpsGenie) alerts() []createdAlert {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]createdAlert(nil), f.created...)
+}
@@ -1,10 +1,15 @@
 package tests
 
 import (
+	"encoding/json"
+
 	"github.com/lrleon/go-breaker/breaker"
+	"math"
 	"reflect"
+	"sync"
 	"testing"
 	"time"
+	"unsafe"
 )
 
 func Test_latencyWindow_aboveThreshold(t *testing.T) {
@@ -192,6 +197,38 @@ func Test_latencyWindow_hasPositiveTrend(t *testing.T) {
 	}
 }
 
+// Test that the trend window restricts the regression to the most recent records
+func Test_latencyWindow_hasPositiveTrendWithTrendWindow(t *testing.T) {
+	now := time.Now()
+	addSamples := func(lw *breaker.LatencyWindow) {
+		// 15 increasing latencies followed by 5 flat ones
+		for i := 0; i < 20; i++ {
+			latency := int64(100 + i*20)
+			if i >= 15 {
+				latency = 400
+			}
+			timestamp := now.Add(time.Duration(i-20) * time.Second)
+			startTime := timestamp.Add(-time.Duration(latency) * time.Millisecond)
+			lw.Add(startTime, timestamp)
+		}
+	}
+
+	// Without a trend window the older increase dominates the regression
+	lw := breaker.NewLatencyWindow(20)
+	addSamples(lw)
+	if !lw.HasPositiveTrend(3) {
+		t.Errorf("HasPositiveTrend() over the whole window = false, want true")
+	}
+
+	// With a trend window only the flat tail is analyzed
+	lw = breaker.NewLatencyWindow(20)
+	lw.TrendWindowSize = 5
+	addSamples(lw)
+	if lw.HasPositiveTrend(3) {
+		t.Errorf("HasPositiveTrend() over the last 5 records = true, want false")
+	}
+}
+
 // Test the breaker with trend analysis enabled
 func Test_breaker_withTrendAnalysis(t *testing.T) {
 	// Create a mock implementation of Breaker to override MemoryOK
@@ -215,7 +252,7 @@ func Test_breaker_withTrendAnalysis(t *testing.T) {
 	originalBreaker := breaker.NewBreaker(config, "breaker-config.toml").(*breaker.BreakerDriver)
 
 	// Expose the MemoryOK method for testing
-	breaker.SetMemoryOK(originalBreaker, true)
+	setMemoryOverride(originalBreaker, true)
 
 	b := originalBreaker
 
@@ -229,7 +266,7 @@ func Test_breaker_withTrendAnalysis(t *testing.T) {
 	}
 
 	// Breaker should not be triggered yet
-	if b.TriggeredByLatencies() {
+	if b.Triggered() {
 		t.Errorf("Breaker should not trigger with latencies under threshold")
 	}
 
@@ -246,7 +283,7 @@ func Test_breaker_withTrendAnalysis(t *testing.T) {
 	}
 
 	// Breaker should still not be triggered because trend is negative
-	if b.TriggeredByLatencies() {
+	if b.Triggered() {
 		t.Errorf("Breaker should not trigger with high latencies but negative trend")
 	}
 
@@ -263,14 +300,14 @@ func Test_breaker_withTrendAnalysis(t *testing.T) {
 	}
 
 	// Now breaker should be triggered because latencies are over threshold AND trend is positive
-	if !b.TriggeredByLatencies() {
+	if !b.Triggered() {
 		t.Errorf("Breaker should trigger with high latencies and positive trend")
 	}
 
 	// Reset and test with trend analysis disabled
 	config.TrendAnalysisEnabled = false
 	b = breaker.NewBreaker(config, "breaker-config.toml").(*breaker.BreakerDriver)
-	breaker.SetMemoryOK(b, true) // Override memory check
+	setMemoryOverride(b, true) // Override memory check
 
 	// Add latencies over threshold but with negative trend
 	for i := 0; i < 3; i++ {
@@ -281,7 +318,7 @@ func Test_breaker_withTrendAnalysis(t *testing.T) {
 	}
 
 	// Now breaker should be triggered regardless of trend, since trend analysis is disabled
-	if !b.TriggeredByLatencies() {
+	if !b.Triggered() {
 		t.Errorf("Breaker with trend analysis disabled should trigger with high latencies regardless of trend")
 	}
 }
@@ -300,3 +337,816 @@ func sortInt64s(values []int64) []int64 {
 	}
 	return result
 }
+
+func Test_latencyWindow_addReversedTimestamps(t *testing.T) {
+	lw := breaker.NewLatencyWindow(10)
+
+	now := time.Now()
+	latencies := []int64{100, 120, 140, 160, 180}
+	for _, latency := range latencies {
+		lw.Add(now.Add(-time.Duration(latency)*time.Millisecond), now)
+	}
+
+	// Feed measurements whose end time is before their start time
+	for i := 1; i <= 5; i++ {
+		startTime := now
+		endTime := now.Add(-time.Duration(i) * time.Second)
+		lw.Add(startTime, endTime)
+	}
+
+	for _, value := range lw.GetRecentLatencies() {
+		if value < 0 {
+			t.Fatalf("negative latency recorded: %d", value)
+		}
+	}
+
+	if got := len(lw.GetRecentLatencies()); got != 10 {
+		t.Errorf("GetRecentLatencies() returned %d records, want 10", got)
+	}
+
+	if got := lw.Percentile(0.99); got != 180 {
+		t.Errorf("Percentile(0.99) = %d, want 180", got)
+	}
+
+	if got := lw.Percentile(0); got != 0 {
+		t.Errorf("Percentile(0) = %d, want 0 for clamped records", got)
+	}
+}
+
+func Test_breaker_doneWithReversedTimestamps(t *testing.T) {
+	b := breaker.NewBreaker(&breaker.Config{
+		MemoryThreshold:   100,
+		LatencyThreshold:  200,
+		LatencyWindowSize: 4,
+		Percentile:        0.95,
+		WaitTime:          1,
+	}, "")
+	setMemoryOverride(b, true)
+
+	now := time.Now()
+	for i := 0; i < 4; i++ {
+		b.Done(now, now.Add(-time.Hour))
+	}
+
+	if b.Triggered() {
+		t.Errorf("reversed timestamps should not trip the breaker")
+	}
+}
+
+// Run with -race to verify that a standalone LatencyWindow can be shared between goroutines
+func Test_latencyWindow_concurrentAccess(t *testing.T) {
+	lw := breaker.NewLatencyWindow(32)
+
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 500; i++ {
+				now := time.Now()
+				lw.Add(now.Add(-time.Duration(i%100)*time.Millisecond), now)
+			}
+		}()
+	}
+
+	for r := 0; r < 4; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 500; i++ {
+				lw.Percentile(0.95)
+				lw.GetRecentTimeOrderedLatencies()
+				lw.HasPositiveTrend(3)
+				lw.AboveThresholdLatencies(50)
+				if i%100 == 0 {
+					lw.Reset()
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if got := len(lw.GetRecentLatencies()); got > 32 {
+		t.Errorf("window holds %d records, want at most 32", got)
+	}
+}
+
+func Test_latencyWindow_merge(t *testing.T) {
+	now := time.Now()
+	add := func(lw *breaker.LatencyWindow, latencyMs int64, age time.Duration) {
+		end := now.Add(-age)
+		lw.Add(end.Add(-time.Duration(latencyMs)*time.Millisecond), end)
+	}
+
+	t.Run("overlapping windows", func(t *testing.T) {
+		first := breaker.NewLatencyWindow(5)
+		second := breaker.NewLatencyWindow(5)
+		add(first, 100, 4*time.Second)
+		add(second, 200, 3*time.Second)
+		add(first, 300, 2*time.Second)
+		add(second, 400, time.Second)
+
+		merged := first.Merge(second)
+
+		records := merged.GetRecentTimeOrderedLatencies()
+		var values []int64
+		for _, record := range records {
+			values = append(values, record.Milliseconds())
+		}
+		if !reflect.DeepEqual(values, []int64{100, 200, 300, 400}) {
+			t.Errorf("merged latencies = %v, want them interleaved by timestamp", values)
+		}
+		if got := merged.Percentile(0.5); got != 200 {
+			t.Errorf("merged p50 = %d, want 200", got)
+		}
+
+		// The merged window is independent of its sources
+		add(first, 900, 0)
+		if got := len(merged.GetRecentLatencies()); got != 4 {
+			t.Errorf("merged window has %d latencies after changing a source, want 4", got)
+		}
+	})
+
+	t.Run("expired records are left out", func(t *testing.T) {
+		short := breaker.NewLatencyWindow(5)
+		short.MaxAgeSeconds = 2
+		long := breaker.NewLatencyWindow(5)
+		long.MaxAgeSeconds = 60
+		add(short, 100, 5*time.Second) // expired in short
+		add(short, 200, time.Second)
+		add(long, 300, 5*time.Second) // still recent in long
+
+		merged := breaker.MergeWindows(short, nil, long)
+
+		if merged.MaxAgeSeconds != 60 {
+			t.Errorf("merged MaxAgeSeconds = %d, want 60", merged.MaxAgeSeconds)
+		}
+		latencies := merged.GetRecentLatencies()
+		if len(latencies) != 2 {
+			t.Fatalf("merged latencies = %v, want the two non-expired ones", latencies)
+		}
+		if latencies[0] != 300 || latencies[1] != 200 {
+			t.Errorf("merged latencies = %v, want [300 200]", latencies)
+		}
+	})
+
+	t.Run("no records", func(t *testing.T) {
+		merged := breaker.MergeWindows(breaker.NewLatencyWindow(3))
+		if got := merged.Percentile(0.95); got != 0 {
+			t.Errorf("Percentile() of an empty merge = %d, want 0", got)
+		}
+		merged.Add(now.Add(-time.Millisecond), now)
+		if got := len(merged.GetRecentLatencies()); got != 1 {
+			t.Errorf("an empty merge should still accept latencies, got %d", got)
+		}
+	})
+}
+
+func Test_latencyWindow_capsOutliers(t *testing.T) {
+	lw := breaker.NewLatencyWindow(4)
+	lw.MaxLatencyMs = 5000
+
+	now := time.Now()
+	lw.Add(now.Add(-10*time.Minute), now)
+	for i := 0; i < 3; i++ {
+		lw.Add(now.Add(-100*time.Millisecond), now)
+	}
+
+	if got := lw.Percentile(1); got != 5000 {
+		t.Errorf("Percentile(1) = %d, want the 5000ms cap", got)
+	}
+	if got := lw.Percentile(0.5); got != 100 {
+		t.Errorf("Percentile(0.5) = %d, want 100 (latencies below the cap are unchanged)", got)
+	}
+}
+
+func Test_breaker_maxAcceptedLatency(t *testing.T) {
+	config := &breaker.Config{
+		MemoryThreshold:      100,
+		LatencyThreshold:     200,
+		LatencyWindowSize:    4,
+		Percentile:           0.95,
+		WaitTime:             1,
+		MaxAcceptedLatencyMs: 1000,
+	}
+	if err := breaker.ValidateConfig(config); err != nil {
+		t.Fatalf("ValidateConfig() = %v", err)
+	}
+	b := breaker.NewBreaker(config, "")
+	defer b.(*breaker.BreakerDriver).Close()
+	setMemoryOverride(b, true)
+
+	// A capped latency still counts as slow
+	now := time.Now()
+	b.Done(now.Add(-10*time.Minute), now)
+	if !b.Triggered() {
+		t.Errorf("a capped latency above the threshold should trip the breaker")
+	}
+	if got := b.(*breaker.BreakerDriver).LatencySeries(); len(got) != 1 || got[0].PercentileMs != 1000 {
+		t.Errorf("LatencySeries() = %v, want a single 1000ms sample", got)
+	}
+
+	// A cap that keeps the percentile from exceeding the threshold is rejected
+	config.MaxAcceptedLatencyMs = 200
+	if err := breaker.ValidateConfig(config); err == nil {
+		t.Errorf("ValidateConfig() should reject max_accepted_latency_ms <= latency_threshold")
+	}
+}
+
+func Test_breaker_minSamplesAboveThreshold(t *testing.T) {
+	b := breaker.NewBreaker(&breaker.Config{
+		MemoryThreshold:          100,
+		LatencyThreshold:         200,
+		LatencyWindowSize:        10,
+		Percentile:               0.95,
+		WaitTime:                 1,
+		MinSamplesAboveThreshold: 2,
+	}, "")
+	defer b.Close()
+	setMemoryOverride(b, true)
+
+	now := time.Now()
+	for i := 0; i < 5; i++ {
+		b.Done(now.Add(-50*time.Millisecond), now)
+	}
+
+	// A lone outlier is the 95th percentile of the window, but it does not trip the breaker
+	b.Done(now.Add(-10*time.Second), now)
+	if b.Triggered() {
+		t.Fatalf("a lone outlier should not trip the breaker")
+	}
+
+	b.Done(now.Add(-10*time.Second), now)
+	if !b.Triggered() {
+		t.Errorf("a second latency above the threshold should trip the breaker")
+	}
+}
+
+func Test_breaker_breachDuration(t *testing.T) {
+	// The clock moves only when told, so the breach durations are exact
+	clock := breaker.NewMockClock(time.Now())
+	newBreaker := func() breaker.Breaker {
+		b := breaker.NewBreaker(&breaker.Config{
+			MemoryThreshold:       100,
+			LatencyThreshold:      200,
+			LatencyWindowSize:     3,
+			Percentile:            0.95,
+			WaitTime:              60,
+			BreachDurationSeconds: 1,
+		}, "")
+		setMemoryOverride(b, true)
+		b.(*breaker.BreakerDriver).SetClock(clock)
+		return b
+	}
+	slow := func(b breaker.Breaker) {
+		now := clock.Now()
+		b.Done(now.Add(-time.Second), now)
+	}
+	fast := func(b breaker.Breaker) {
+		now := clock.Now()
+		b.Done(now.Add(-10*time.Millisecond), now)
+	}
+
+	t.Run("brief spike", func(t *testing.T) {
+		b := newBreaker()
+		defer b.Close()
+
+		slow(b)
+		slow(b)
+		if b.Triggered() {
+			t.Fatalf("the breach has just started")
+		}
+
+		// The latency drops below the threshold, which restarts the timer
+		fast(b)
+		fast(b)
+		fast(b)
+		clock.Advance(1100 * time.Millisecond)
+		slow(b)
+		if b.Triggered() {
+			t.Errorf("a new spike should need the whole breach duration again")
+		}
+	})
+
+	t.Run("sustained breach", func(t *testing.T) {
+		b := newBreaker()
+		defer b.Close()
+
+		slow(b)
+		if b.Triggered() {
+			t.Fatalf("the breach has just started")
+		}
+		clock.Advance(1100 * time.Millisecond)
+		slow(b)
+		if !b.Triggered() {
+			t.Errorf("a breach lasting breach_duration_seconds should trip the breaker")
+		}
+	})
+
+	if err := breaker.ValidateConfig(&breaker.Config{
+		MemoryThreshold:       80,
+		LatencyThreshold:      200,
+		LatencyWindowSize:     3,
+		Percentile:            0.95,
+		WaitTime:              60,
+		BreachDurationSeconds: -1,
+	}); err == nil {
+		t.Errorf("a negative breach_duration_seconds should be invalid")
+	}
+}
+
+func Test_latencyWindow_nanosecondResolution(t *testing.T) {
+	lw := breaker.NewLatencyWindow(4)
+
+	now := time.Now()
+	for i := 0; i < 4; i++ {
+		lw.Add(now.Add(-1500*time.Microsecond), now)
+	}
+
+	if got := lw.GetRecentTimeOrderedLatencies()[0].Value; got != int64(1500*time.Microsecond) {
+		t.Errorf("LatencyRecord.Value = %d, want 1500000ns", got)
+	}
+	if got := lw.PercentileNs(0.95); got != int64(1500*time.Microsecond) {
+		t.Errorf("PercentileNs(0.95) = %d, want 1500000", got)
+	}
+	if got := lw.Percentile(0.95); got != 2 {
+		t.Errorf("Percentile(0.95) = %d, want 2 (1.5ms rounded)", got)
+	}
+	if got := lw.AboveThresholdLatencies(1); len(got) != 4 {
+		t.Errorf("AboveThresholdLatencies(1) = %v, want every 1.5ms latency", got)
+	}
+	if !lw.AboveThreshold(1) {
+		t.Errorf("AboveThreshold(1) should compare 1.5ms against 1ms without rounding")
+	}
+}
+
+func Test_breaker_tripsOnSubMillisecondDifferences(t *testing.T) {
+	b := breaker.NewBreaker(&breaker.Config{
+		MemoryThreshold:   100,
+		LatencyThreshold:  1,
+		LatencyWindowSize: 4,
+		Percentile:        0.95,
+		WaitTime:          1,
+	}, "")
+	defer b.Close()
+	setMemoryOverride(b, true)
+
+	// 1.2ms used to be recorded as 1ms, which is not above a 1ms threshold
+	now := time.Now()
+	b.Done(now.Add(-1200*time.Microsecond), now)
+	if !b.Triggered() {
+		t.Errorf("a 1.2ms latency should trip a breaker with a 1ms threshold")
+	}
+}
+
+func Test_latencyWindow_snapshotRestore(t *testing.T) {
+	lw := breaker.NewLatencyWindow(4)
+	lw.MaxAgeSeconds = 60
+
+	now := time.Now()
+	for i := 1; i <= 5; i++ {
+		lw.Add(now.Add(-time.Duration(i)*time.Millisecond), now)
+	}
+
+	data, err := json.Marshal(lw)
+	if err != nil {
+		t.Fatalf("MarshalJSON() error = %v", err)
+	}
+
+	var restored breaker.LatencyWindow
+	if err := json.Unmarshal(data, &restored); err != nil {
+		t.Fatalf("UnmarshalJSON() error = %v", err)
+	}
+	if restored.Index != lw.Index || restored.Size != lw.Size || restored.MaxAgeSeconds != 60 {
+		t.Errorf("restored Index = %d, Size = %d, MaxAgeSeconds = %d, want %d, %d and 60",
+			restored.Index, restored.Size, restored.MaxAgeSeconds, lw.Index, lw.Size)
+	}
+	if got, want := restored.GetRecentLatenciesNs(), lw.GetRecentLatenciesNs(); !reflect.DeepEqual(got, want) {
+		t.Errorf("restored latencies = %v, want %v", got, want)
+	}
+	if got, want := restored.PercentileNs(0.95), lw.PercentileNs(0.95); got != want {
+		t.Errorf("restored PercentileNs(0.95) = %d, want %d", got, want)
+	}
+
+	for _, invalid := range []string{
+		`{"records": [], "index": 0, "size": 0}`,
+		`{"records": [{}, {}], "index": 0, "size": 3}`,
+		`{"records": [{}, {}], "index": 2, "size": 2}`,
+	} {
+		if err := json.Unmarshal([]byte(invalid), &restored); err == nil {
+			t.Errorf("UnmarshalJSON(%s) should fail", invalid)
+		}
+	}
+}
+
+func Test_breaker_restoreLatencies(t *testing.T) {
+	config := &breaker.Config{
+		MemoryThreshold:   100,
+		LatencyThreshold:  100,
+		LatencyWindowSize: 4,
+		Percentile:        0.5,
+		WaitTime:          60,
+	}
+	before := breaker.NewBreaker(config, "").(*breaker.BreakerDriver)
+	defer before.Close()
+	setMemoryOverride(before, true)
+
+	end := time.Now()
+	before.Done(end.Add(-90*time.Millisecond), end)
+	before.Done(end.Add(-95*time.Millisecond), end)
+	snapshot, err := before.SnapshotLatencies()
+	if err != nil {
+		t.Fatalf("SnapshotLatencies() error = %v", err)
+	}
+
+	after := breaker.NewBreaker(config, "").(*breaker.BreakerDriver)
+	defer after.Close()
+	setMemoryOverride(after, true)
+	if err := after.RestoreLatencies(snapshot); err != nil {
+		t.Fatalf("RestoreLatencies() error = %v", err)
+	}
+	if after.Triggered() {
+		t.Fatalf("restoring latencies should not change the breaker state")
+	}
+
+	// A single slow operation would trip an empty window, but the restored fast
+	// latencies keep the median below the threshold
+	after.Done(end.Add(-500*time.Millisecond), end)
+	if after.Triggered() {
+		t.Errorf("the restored latencies should count towards the percentile")
+	}
+
+	if err := after.RestoreLatencies([]byte(`{"records": []}`)); err == nil {
+		t.Errorf("RestoreLatencies() should reject an invalid snapshot")
+	}
+}
+
+func Test_latencyWindow_percentileMethods(t *testing.T) {
+	lw := breaker.NewLatencyWindow(4)
+	now := time.Now()
+	for _, ms := range []int{40, 10, 30, 20} {
+		lw.Add(now.Add(-time.Duration(ms)*time.Millisecond), now)
+	}
+
+	tests := []struct {
+		method string
+		p      float64
+		want   time.Duration
+	}{
+		{"", 0.5, 20 * time.Millisecond},
+		{breaker.PercentileNearestRank, 0.95, 40 * time.Millisecond},
+		{breaker.PercentileLinear, 0.5, 25 * time.Millisecond},
+		{breaker.PercentileLinear, 0.95, 38500 * time.Microsecond},
+		{breaker.PercentileLinear, 1, 40 * time.Millisecond},
+		{breaker.PercentileLower, 0.5, 20 * time.Millisecond},
+		{breaker.PercentileLower, 0.95, 30 * time.Millisecond},
+		{breaker.PercentileHigher, 0.5, 30 * time.Millisecond},
+		{breaker.PercentileHigher, 0.95, 40 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		if got := lw.PercentileNsWithMethod(tt.p, tt.method); got != int64(tt.want) {
+			t.Errorf("PercentileNsWithMethod(%.2f, %q) = %v, want %v", tt.p, tt.method, time.Duration(got), tt.want)
+		}
+	}
+
+	// The window's method applies to PercentileNs and the rounded variants
+	lw.PercentileMethod = breaker.PercentileLinear
+	if got := lw.PercentileMs(0.95); got != 39 {
+		t.Errorf("PercentileMs(0.95) with linear = %d, want 39 (38.5ms rounded)", got)
+	}
+}
+
+func Test_latencyWindow_latenciesSince(t *testing.T) {
+	lw := breaker.NewLatencyWindow(10)
+	lw.MaxAgeSeconds = 10
+
+	now := time.Now()
+	for _, latency := range []struct {
+		age time.Duration
+		ms  int
+	}{{5 * time.Second, 50}, {60 * time.Second, 600}, {20 * time.Second, 200}} {
+		end := now.Add(-latency.age)
+		lw.Add(end.Add(-time.Duration(latency.ms)*time.Millisecond), end)
+	}
+
+	// The range ignores MaxAgeSeconds, and the latencies come oldest first
+	if got := lw.LatenciesSince(30 * time.Second); !reflect.DeepEqual(got, []int64{200, 50}) {
+		t.Errorf("LatenciesSince(30s) = %v, want [200 50]", got)
+	}
+	if got := lw.GetRecentLatencies(); !reflect.DeepEqual(got, []int64{50}) {
+		t.Errorf("GetRecentLatencies() = %v, want [50]", got)
+	}
+	if got := lw.LatenciesSince(time.Second); len(got) != 0 {
+		t.Errorf("LatenciesSince(1s) = %v, want none", got)
+	}
+
+	records := lw.LatencyRecordsSince(time.Minute + time.Second)
+	if len(records) != 3 {
+		t.Fatalf("LatencyRecordsSince(61s) returned %d records, want 3", len(records))
+	}
+	for i, want := range []int64{600, 200, 50} {
+		if records[i].Milliseconds() != want {
+			t.Errorf("record %d = %dms, want %dms", i, records[i].Milliseconds(), want)
+		}
+	}
+	if !records[0].Timestamp.Equal(now.Add(-60 * time.Second)) {
+		t.Errorf("oldest record timestamp = %v, want %v", records[0].Timestamp, now.Add(-60*time.Second))
+	}
+}
+
+func Test_latencyWindow_percentileEdgeCases(t *testing.T) {
+	methods := []string{"", breaker.PercentileNearestRank, breaker.PercentileLinear,
+		breaker.PercentileLower, breaker.PercentileHigher}
+	now := time.Now()
+
+	// A single latency is every percentile
+	single := breaker.NewLatencyWindow(4)
+	single.Add(now.Add(-25*time.Millisecond), now)
+	for _, method := range methods {
+		for _, p := range []float64{0, 0.5, 1, -0.5, 1.5, math.NaN()} {
+			if got := single.PercentileNsWithMethod(p, method); got != int64(25*time.Millisecond) {
+				t.Errorf("single latency: PercentileNsWithMethod(%v, %q) = %v, want 25ms", p, method, time.Duration(got))
+			}
+		}
+	}
+
+	lw := breaker.NewLatencyWindow(4)
+	for _, ms := range []int{40, 10, 30, 20} {
+		lw.Add(now.Add(-time.Duration(ms)*time.Millisecond), now)
+	}
+
+	// p = 0 is the smallest and p = 1 the largest latency, whatever the method, and
+	// percentiles out of range are clamped
+	for _, method := range methods {
+		for _, p := range []float64{0, -0.5, math.NaN()} {
+			if got := lw.PercentileNsWithMethod(p, method); got != int64(10*time.Millisecond) {
+				t.Errorf("PercentileNsWithMethod(%v, %q) = %v, want 10ms", p, method, time.Duration(got))
+			}
+		}
+		for _, p := range []float64{1, 1.5} {
+			if got := lw.PercentileNsWithMethod(p, method); got != int64(40*time.Millisecond) {
+				t.Errorf("PercentileNsWithMethod(%v, %q) = %v, want 40ms", p, method, time.Duration(got))
+			}
+		}
+	}
+
+	// Nearest-rank takes index ceil(n*p)-1: the median of four latencies is the second
+	// one, and 0.25 and 0.75 fall exactly on the first and third
+	tests := []struct {
+		p    float64
+		want time.Duration
+	}{
+		{0.24, 10 * time.Millisecond},
+		{0.25, 10 * time.Millisecond},
+		{0.26, 20 * time.Millisecond},
+		{0.5, 20 * time.Millisecond},
+		{0.75, 30 * time.Millisecond},
+		{0.76, 40 * time.Millisecond},
+		{0.99, 40 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		if got := lw.PercentileNsWithMethod(tt.p, breaker.PercentileNearestRank); got != int64(tt.want) {
+			t.Errorf("nearest-rank PercentileNsWithMethod(%v) = %v, want %v", tt.p, time.Duration(got), tt.want)
+		}
+	}
+
+	// An empty window has no percentile
+	if got := breaker.NewLatencyWindow(4).PercentileNs(1); got != 0 {
+		t.Errorf("empty window: PercentileNs(1) = %d, want 0", got)
+	}
+
+	// The 99th percentile of 1ms to 100ms is 99ms: 99 of the latencies are at or below it
+	hundred := breaker.NewLatencyWindow(100)
+	end := time.Now()
+	for ms := 1; ms <= 100; ms++ {
+		hundred.Add(end.Add(-time.Duration(ms)*time.Millisecond), end)
+	}
+	for _, tt := range []struct {
+		p    float64
+		want int64
+	}{
+		{0.99, 99},
+		{0.95, 95},
+		{0.5, 50},
+		{0.07, 7},
+		{0.001, 1},
+	} {
+		if got := hundred.PercentileMs(tt.p); got != tt.want {
+			t.Errorf("1ms to 100ms: PercentileMs(%v) = %d, want %d", tt.p, got, tt.want)
+		}
+	}
+}
+
+func Test_breaker_percentileMethod(t *testing.T) {
+	newBreaker := func(method string) breaker.Breaker {
+		b := breaker.NewBreaker(&breaker.Config{
+			MemoryThreshold:   100,
+			LatencyThreshold:  45,
+			LatencyWindowSize: 4,
+			Percentile:        0.75,
+			PercentileMethod:  method,
+			WaitTime:          60,
+		}, "")
+		setMemoryOverride(b, true)
+		return b
+	}
+	nearest := newBreaker("")
+	defer nearest.Close()
+	linear := newBreaker(breaker.PercentileLinear)
+	defer linear.Close()
+
+	// The 75th percentile of 10ms and 50ms is 50ms by nearest rank but 40ms interpolated
+	now := time.Now()
+	for _, ms := range []int{10, 50} {
+		nearest.Done(now.Add(-time.Duration(ms)*time.Millisecond), now)
+		linear.Done(now.Add(-time.Duration(ms)*time.Millisecond), now)
+	}
+	if !nearest.Triggered() {
+		t.Errorf("the nearest-rank 75th percentile (50ms) should trip a 45ms threshold")
+	}
+	if linear.Triggered() {
+		t.Errorf("the linear 75th percentile (40ms) should not trip a 45ms threshold")
+	}
+}
+
+func Test_latencyWindow_slowestByLabel(t *testing.T) {
+	lw := breaker.NewLatencyWindow(10)
+
+	now := time.Now()
+	for _, latency := range []struct {
+		label string
+		ms    int
+	}{{"db", 50}, {"db", 150}, {"cache", 5}, {"", 900}, {"payments", 150}} {
+		lw.AddLabeled(now.Add(-time.Duration(latency.ms)*time.Millisecond), now, latency.label)
+	}
+
+	// Unlabeled latencies count for the window but not for the summary
+	if got := lw.GetRecentLatencies(); len(got) != 5 {
+		t.Errorf("GetRecentLatencies() = %v, want 5 latencies", got)
+	}
+	want := []breaker.LabelLatencySummary{
+		{Label: "db", Count: 2, AboveThreshold: 1, MaxMs: 150},
+		{Label: "payments", Count: 1, AboveThreshold: 1, MaxMs: 150},
+		{Label: "cache", Count: 1, AboveThreshold: 0, MaxMs: 5},
+	}
+	if got := lw.SlowestByLabel(100); !reflect.DeepEqual(got, want) {
+		t.Errorf("SlowestByLabel(100) = %+v, want %+v", got, want)
+	}
+	if got := lw.AboveThresholdRecords(100); len(got) != 3 || got[0].Label != "db" || got[1].Label != "" {
+		t.Errorf("AboveThresholdRecords(100) = %+v, want the db, unlabeled and payments records", got)
+	}
+}
+
+func Test_latencyWindow_sampleTimes(t *testing.T) {
+	lw := breaker.NewLatencyWindow(4)
+	if !lw.OldestSampleTime().IsZero() || !lw.NewestSampleTime().IsZero() || lw.WindowSpan() != 0 {
+		t.Errorf("an empty window should report zero sample times and span")
+	}
+
+	now := time.Now()
+	lw.Add(now.Add(-3*time.Second), now.Add(-2*time.Second))
+	lw.Add(now.Add(-time.Second), now)
+	lw.Add(now.Add(-6*time.Second), now.Add(-5*time.Second)) // reported out of order
+
+	if got := lw.OldestSampleTime(); !got.Equal(now.Add(-5 * time.Second)) {
+		t.Errorf("OldestSampleTime() = %v, want %v", got, now.Add(-5*time.Second))
+	}
+	if got := lw.NewestSampleTime(); !got.Equal(now) {
+		t.Errorf("NewestSampleTime() = %v, want %v", got, now)
+	}
+	if got := lw.WindowSpan(); got != 5*time.Second {
+		t.Errorf("WindowSpan() = %v, want 5s", got)
+	}
+}
+
+func Test_latencyWindow_approxMemoryBytes(t *testing.T) {
+	small := breaker.NewLatencyWindow(10)
+	large := breaker.NewLatencyWindow(1000)
+
+	// The records are allocated up front, so an empty window already holds them
+	recordSize := int64(unsafe.Sizeof(breaker.LatencyRecord{}))
+	if got := large.ApproxMemoryBytes() - small.ApproxMemoryBytes(); got != 990*recordSize {
+		t.Errorf("the 990 extra records take %d bytes, want %d", got, 990*recordSize)
+	}
+
+	// Labels add their length
+	before := small.ApproxMemoryBytes()
+	now := time.Now()
+	small.AddLabeled(now.Add(-time.Millisecond), now, "payments")
+	if got := small.ApproxMemoryBytes(); got != before+int64(len("payments")) {
+		t.Errorf("ApproxMemoryBytes() = %d after a labeled latency, want %d", got, before+int64(len("payments")))
+	}
+}
+
+func Test_latencyWindow_zeroSize(t *testing.T) {
+	for _, size := range []int{0, -5} {
+		lw := breaker.NewLatencyWindow(size)
+		if lw.Size != 1 || len(lw.Records) != 1 {
+			t.Fatalf("NewLatencyWindow(%d) holds %d records of size %d, want 1", size, len(lw.Records), lw.Size)
+		}
+
+		// Each latency replaces the previous one
+		now := time.Now()
+		lw.Add(now.Add(-200*time.Millisecond), now)
+		lw.Add(now.Add(-50*time.Millisecond), now)
+		if got := lw.PercentileMs(0.95); got != 50 {
+			t.Errorf("PercentileMs() of a single-record window = %d, want 50", got)
+		}
+	}
+}
+
+func Test_latencyWindow_hasSufficientData(t *testing.T) {
+	lw := breaker.NewLatencyWindow(4)
+	if lw.HasSufficientData(0) || lw.HasSufficientData(1) {
+		t.Errorf("an empty window should not have sufficient data")
+	}
+	if got := lw.PercentileMs(0.99); got != 0 {
+		t.Errorf("the percentile of an empty window = %d, want 0", got)
+	}
+
+	now := time.Now()
+	lw.Add(now.Add(-time.Hour), now.Add(-time.Hour+time.Millisecond)) // expired
+	lw.Add(now.Add(-10*time.Millisecond), now)
+	lw.Add(now.Add(-10*time.Millisecond), now)
+
+	if got := lw.RecentSampleCount(); got != 2 {
+		t.Errorf("RecentSampleCount() = %d, want 2", got)
+	}
+	if !lw.HasSufficientData(2) || lw.HasSufficientData(3) {
+		t.Errorf("HasSufficientData should count only the recent latencies")
+	}
+}
+
+func Test_breaker_warmupPolicy(t *testing.T) {
+	newBreaker := func(policy string) *breaker.BreakerDriver {
+		b := breaker.NewBreaker(&breaker.Config{
+			MemoryThreshold:   100,
+			LatencyThreshold:  200,
+			LatencyWindowSize: 10,
+			Percentile:        0.95,
+			WaitTime:          5,
+			WarmupMinSamples:  3,
+			WarmupPolicy:      policy,
+		}, "").(*breaker.BreakerDriver)
+		setMemoryOverride(b, true)
+		return b
+	}
+
+	// Without data the latency looks healthy, but the data is reported insufficient
+	failOpen := newBreaker("")
+	defer failOpen.Close()
+	if !failOpen.LatencyOK() || failOpen.HasSufficientData() {
+		t.Errorf("an empty breaker should have an OK latency and insufficient data")
+	}
+	if !failOpen.Allow() {
+		t.Errorf("fail-open should let requests through without data")
+	}
+
+	// Starting without traffic, fail-closed lets the 3 missing latencies through as
+	// trial requests and rejects the rest until their Done calls arrive
+	failClosed := newBreaker(breaker.WarmupFailClosed)
+	defer failClosed.Close()
+	clock := breaker.NewMockClock(time.Now())
+	failClosed.SetClock(clock)
+	for i := 0; i < 3; i++ {
+		if !failClosed.Allow() {
+			t.Fatalf("fail-closed should let trial request %d of 3 through without data", i+1)
+		}
+	}
+	if failClosed.Allow() {
+		t.Fatalf("fail-closed should reject requests beyond the missing latencies")
+	}
+
+	// Trials whose Done never arrives are offered again after the check interval
+	clock.Advance(time.Second)
+	if !failClosed.Allow() {
+		t.Fatalf("fail-closed should let trial requests through again after the check interval")
+	}
+
+	now := clock.Now()
+	for i := 0; i < 2; i++ {
+		failClosed.Done(now.Add(-10*time.Millisecond), now)
+	}
+	if failClosed.HasSufficientData() {
+		t.Fatalf("2 of 3 latencies should not be sufficient")
+	}
+	failClosed.Done(now.Add(-10*time.Millisecond), now)
+	if !failClosed.HasSufficientData() || !failClosed.Allow() {
+		t.Errorf("fail-closed should let requests through once warmed up")
+	}
+	if failClosed.Triggered() {
+		t.Errorf("warming up should not trip the breaker")
+	}
+
+	config := failClosed.Config()
+	config.WarmupPolicy = "fail-sometimes"
+	if err := breaker.ValidateConfig(&config); err == nil {
+		t.Errorf("an unknown warmup_policy should be rejected")
+	}
+	config.WarmupPolicy = breaker.WarmupFailOpen
+	config.WarmupMinSamples = 11
+	if err := breaker.ValidateConfig(&config); err == nil {
+		t.Errorf("warmup_min_samples above latency_window_size should be rejected")
+	}
+}
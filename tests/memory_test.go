@@ -1,6 +1,7 @@
 package tests
 
 import (
+	"errors"
 	"github.com/lrleon/go-breaker/breaker"
 	"os"
 	"testing"
@@ -105,3 +106,100 @@ func TestGetMemoryLimit_Good(t *testing.T) {
 		t.Fatal("Expected nil, got error")
 	}
 }
+
+func TestFormatMemory(t *testing.T) {
+	tests := []struct {
+		bytes int64
+		units string
+		want  interface{}
+	}{
+		{512 * 1024 * 1024, breaker.MemoryUnitsMB, int64(512)},
+		{512 * 1024 * 1024, breaker.MemoryUnitsBytes, int64(512 * 1024 * 1024)},
+		{512 * 1024 * 1024, breaker.MemoryUnitsHuman, "512 MB"},
+		{1536 * 1024 * 1024, breaker.MemoryUnitsHuman, "1.5 GB"},
+		{1023, breaker.MemoryUnitsHuman, "1023 B"},
+		{2048, breaker.MemoryUnitsHuman, "2 KB"},
+		{3 * 1024 * 1024, "unknown", int64(3)},
+	}
+
+	for _, tt := range tests {
+		if got := breaker.FormatMemory(tt.bytes, tt.units); got != tt.want {
+			t.Errorf("FormatMemory(%d, %q) = %v, want %v", tt.bytes, tt.units, got, tt.want)
+		}
+	}
+}
+
+func TestMemoryCheckFailurePolicy(t *testing.T) {
+	previousLimit, previousErr := breaker.MemoryLimit, breaker.MemoryLimitError()
+	breaker.SetMemoryLimitFile(0) // The limit could not be read
+	breaker.SetMemoryLimitError(errors.New("invalid limit"))
+	defer func() {
+		breaker.SetMemoryLimitFile(previousLimit)
+		breaker.SetMemoryLimitError(previousErr)
+	}()
+
+	for _, tt := range []struct {
+		policy string
+		want   bool
+	}{
+		{"", true},
+		{breaker.MemoryCheckFailOpen, true},
+		{breaker.MemoryCheckFailClosed, false},
+	} {
+		config := &breaker.Config{
+			MemoryThreshold:          80,
+			LatencyThreshold:         300,
+			LatencyWindowSize:        10,
+			Percentile:               0.95,
+			WaitTime:                 10,
+			MemoryCheckFailurePolicy: tt.policy,
+		}
+		b := breaker.NewBreaker(config, "")
+		if got := b.MemoryOK(); got != tt.want {
+			t.Errorf("policy %q: MemoryOK() = %t, want %t", tt.policy, got, tt.want)
+		}
+		if got := b.Allow(); got != tt.want {
+			t.Errorf("policy %q: Allow() = %t, want %t", tt.policy, got, tt.want)
+		}
+		b.Close()
+	}
+
+	config := breaker.Config{
+		MemoryThreshold:          80,
+		LatencyThreshold:         300,
+		LatencyWindowSize:        10,
+		Percentile:               0.95,
+		WaitTime:                 10,
+		MemoryCheckFailurePolicy: "maybe",
+	}
+	if err := breaker.ValidateConfig(&config); err == nil {
+		t.Errorf("ValidateConfig accepted memory_check_failure_policy %q", config.MemoryCheckFailurePolicy)
+	}
+}
+
+func TestMemoryCheckFailurePolicyWithoutLimit(t *testing.T) {
+	previousLimit, previousErr := breaker.MemoryLimit, breaker.MemoryLimitError()
+	breaker.SetMemoryLimitFile(0) // Not in a container: there is no limit to read
+	breaker.SetMemoryLimitError(nil)
+	defer func() {
+		breaker.SetMemoryLimitFile(previousLimit)
+		breaker.SetMemoryLimitError(previousErr)
+	}()
+
+	b := breaker.NewBreaker(&breaker.Config{
+		MemoryThreshold:          80,
+		LatencyThreshold:         300,
+		LatencyWindowSize:        10,
+		Percentile:               0.95,
+		WaitTime:                 10,
+		MemoryCheckFailurePolicy: breaker.MemoryCheckFailClosed,
+	}, "")
+	defer b.Close()
+
+	if !b.MemoryOK() {
+		t.Error("MemoryOK() = false without a memory limit, want true whatever the policy")
+	}
+	if !b.Allow() {
+		t.Error("Allow() = false without a memory limit, want true whatever the policy")
+	}
+}
@@ -0,0 +1,142 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lrleon/go-breaker/breaker"
+	"github.com/lrleon/go-breaker/breaker/breakertest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBreakerMiddlewareRejection(t *testing.T) {
+	b := breakertest.NewTestBreaker(breakertest.WithWaitTime(60))
+	defer b.Close()
+
+	gin.SetMode(gin.TestMode)
+	newRouter := func(options ...breaker.MiddlewareOption) *gin.Engine {
+		router := gin.New()
+		router.Use(breaker.BreakerMiddleware(b, options...))
+		router.GET("/orders", func(ctx *gin.Context) { ctx.String(http.StatusOK, "ok") })
+		return router
+	}
+	get := func(router *gin.Engine) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/orders", nil)
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	defaults := newRouter()
+	custom := newRouter(
+		breaker.WithRejectionStatus(http.StatusTooManyRequests),
+		breaker.WithRejectionBody(`{"code":"CIRCUIT_OPEN","reason":"{{.TripReason}}","path":"{{.Path}}"}`, "application/problem+json"),
+	)
+
+	w := get(defaults)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "ok", w.Body.String())
+
+	require.NoError(t, breakertest.TriggerByLatency(b))
+
+	w = get(defaults)
+	assert.Equal(t, breaker.DefaultRejectionStatus, w.Code)
+	assert.Equal(t, "application/json; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.JSONEq(t, breaker.DefaultRejectionBody, w.Body.String())
+
+	w = get(custom)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "application/problem+json", w.Header().Get("Content-Type"))
+	assert.JSONEq(t, `{"code":"CIRCUIT_OPEN","reason":"latency","path":"/orders"}`, w.Body.String())
+
+	// An invalid template falls back to the default body
+	invalid := newRouter(breaker.WithRejectionBody(`{{.Missing`, "text/plain"))
+	w = get(invalid)
+	assert.Equal(t, breaker.DefaultRejectionStatus, w.Code)
+	assert.JSONEq(t, breaker.DefaultRejectionBody, w.Body.String())
+}
+
+func TestBreakerMiddlewareSkipsRequests(t *testing.T) {
+	b := breakertest.NewTestBreaker(breakertest.WithWaitTime(60))
+	defer b.Close()
+
+	gin.SetMode(gin.TestMode)
+	newRouter := func(options ...breaker.MiddlewareOption) *gin.Engine {
+		router := gin.New()
+		router.Use(breaker.BreakerMiddleware(b, options...))
+		ok := func(ctx *gin.Context) { ctx.String(http.StatusOK, "ok") }
+		router.GET("/orders", ok)
+		router.OPTIONS("/orders", ok)
+		router.GET("/health", ok)
+		router.GET("/users/:id", ok)
+		return router
+	}
+	request := func(router *gin.Engine, method, path string) int {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, nil)
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	router := newRouter(breaker.WithExemptPaths("/health", "/users/:id"))
+
+	// Skipped requests are not recorded
+	require.Equal(t, http.StatusOK, request(router, "OPTIONS", "/orders"))
+	require.Equal(t, http.StatusOK, request(router, "GET", "/health"))
+	assert.False(t, b.HasSufficientData(), "Skipped requests should not be recorded")
+	require.Equal(t, http.StatusOK, request(router, "GET", "/orders"))
+	assert.True(t, b.HasSufficientData())
+
+	// Nor rejected
+	require.NoError(t, breakertest.TriggerByLatency(b))
+	assert.Equal(t, breaker.DefaultRejectionStatus, request(router, "GET", "/orders"))
+	assert.Equal(t, http.StatusOK, request(router, "OPTIONS", "/orders"))
+	assert.Equal(t, http.StatusOK, request(router, "GET", "/health"))
+	assert.Equal(t, http.StatusOK, request(router, "GET", "/users/42"), "Route patterns are exempt too")
+
+	// A custom skipper replaces the default one
+	skipGets := newRouter(breaker.WithSkipper(func(ctx *gin.Context) bool {
+		return ctx.Request.Method == http.MethodGet
+	}))
+	assert.Equal(t, http.StatusOK, request(skipGets, "GET", "/orders"))
+	assert.Equal(t, breaker.DefaultRejectionStatus, request(skipGets, "OPTIONS", "/orders"))
+	assert.Equal(t, breaker.DefaultRejectionStatus, request(newRouter(breaker.WithSkipper(nil)), "OPTIONS", "/orders"))
+}
+
+func TestBreakerMiddlewareLatencyMode(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	const streamTime = 150 * time.Millisecond
+
+	// The first chunk is sent at once and the stream lasts streamTime
+	latency := func(options ...breaker.MiddlewareOption) int64 {
+		b := breakertest.NewTestBreaker()
+		defer b.Close()
+
+		router := gin.New()
+		router.Use(breaker.BreakerMiddleware(b, options...))
+		router.GET("/stream", func(ctx *gin.Context) {
+			ctx.Status(http.StatusOK)
+			ctx.Writer.WriteString("first chunk\n")
+			ctx.Writer.Flush()
+			time.Sleep(streamTime)
+			ctx.Writer.WriteString("last chunk\n")
+		})
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/stream", nil)
+		router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Equal(t, "first chunk\nlast chunk\n", w.Body.String())
+		require.True(t, b.HasSufficientData())
+		return b.LatencyPercentile(1)
+	}
+
+	assert.GreaterOrEqual(t, latency(), streamTime.Milliseconds(), "Total time by default")
+	assert.GreaterOrEqual(t, latency(breaker.WithLatencyMode(breaker.LatencyTotal)), streamTime.Milliseconds())
+	assert.Less(t, latency(breaker.WithLatencyMode(breaker.LatencyTTFB)), streamTime.Milliseconds()/2,
+		"Time to first byte")
+}
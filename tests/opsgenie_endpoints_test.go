@@ -0,0 +1,174 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lrleon/go-breaker/breaker"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newOpsGenieTestRouter(opsGenieConfig *breaker.OpsGenieConfig) *gin.Engine {
+	config := &breaker.Config{
+		MemoryThreshold:   80.0,
+		LatencyThreshold:  300,
+		LatencyWindowSize: 10,
+		Percentile:        0.95,
+		WaitTime:          10,
+		OpsGenie:          opsGenieConfig,
+	}
+
+	breakerAPI := breaker.NewBreakerAPI(config)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	breaker.AddEndpointToRouter(router, breakerAPI)
+	return router
+}
+
+func TestAckOpsGenieAlertEndpoint(t *testing.T) {
+	router := newOpsGenieTestRouter(&breaker.OpsGenieConfig{Enabled: false})
+
+	post := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/breaker/opsgenie/ack", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("MissingAlertType", func(t *testing.T) {
+		w := post(`{}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("InvalidAlertType", func(t *testing.T) {
+		w := post(`{"alert_type": "not-a-type"}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("OpsGenieDisabled", func(t *testing.T) {
+		w := post(`{"alert_type": "circuit-open", "note": "on it"}`)
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+
+		var response map[string]interface{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Contains(t, response["error"], "not enabled")
+	})
+}
+
+func TestReinitializeOpsGenieEndpoint(t *testing.T) {
+	post := func(router *gin.Engine) (int, map[string]interface{}) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/breaker/opsgenie/reinitialize", nil)
+		router.ServeHTTP(w, req)
+
+		var response map[string]interface{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		return w.Code, response
+	}
+
+	t.Run("OpsGenieDisabled", func(t *testing.T) {
+		code, response := post(newOpsGenieTestRouter(&breaker.OpsGenieConfig{Enabled: false}))
+		assert.Equal(t, http.StatusServiceUnavailable, code)
+		assert.Contains(t, response["error"], "not enabled")
+	})
+
+	t.Run("InitializationFails", func(t *testing.T) {
+		t.Setenv(breaker.EnvOpsGenieAPIKey, "")
+		resetOpsGenieClient(t)
+
+		router := newOpsGenieTestRouter(&breaker.OpsGenieConfig{Enabled: true})
+		code, response := post(router)
+		assert.Equal(t, http.StatusServiceUnavailable, code)
+		assert.Equal(t, false, response["initialized"])
+		assert.Contains(t, response["error"], "API key not found")
+	})
+}
+
+// TestOpsGenieEndpointsDoNotBlock verifies that the other endpoints answer while an
+// OpsGenie endpoint waits for OpsGenie
+func TestOpsGenieEndpointsDoNotBlock(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+	}{
+		{"Test", http.MethodGet, "/breaker/opsgenie/test", ""},
+		{"Reinitialize", http.MethodPost, "/breaker/opsgenie/reinitialize", ""},
+		{"Ack", http.MethodPost, "/breaker/opsgenie/ack", `{"alert_type": "circuit-open", "note": "on it"}`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assertOpsGenieEndpointDoesNotBlock(t, test.method, test.path, test.body)
+		})
+	}
+}
+
+// assertOpsGenieEndpointDoesNotBlock sends the request while every call to OpsGenie
+// waits, and checks that GET /breaker/memory answers meanwhile
+func assertOpsGenieEndpointDoesNotBlock(t *testing.T, method, path, body string) {
+	var blocking atomic.Bool // Set once the breaker is initialized, which lists alerts too
+	var called sync.Once
+	calling := make(chan struct{})
+	release := make(chan struct{})
+	opsGenie := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if blocking.Load() {
+			called.Do(func() { close(calling) })
+			<-release
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method == http.MethodPost {
+			w.WriteHeader(http.StatusAccepted)
+			_, _ = w.Write([]byte(`{"result":"Request will be processed","took":0.01,"requestId":"fake"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"data":[],"took":0.01,"requestId":"fake"}`))
+	}))
+	defer opsGenie.Close()
+	var released sync.Once
+	defer released.Do(func() { close(release) })
+
+	t.Setenv(breaker.EnvOpsGenieAPIKey, "test-key")
+	t.Setenv(breaker.EnvOpsGenieAPIURL, opsGenie.URL)
+	resetOpsGenieClient(t)
+	router := newOpsGenieTestRouter(&breaker.OpsGenieConfig{Enabled: true, Team: "test-team"})
+	blocking.Store(true)
+
+	done := make(chan int)
+	go func() {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		done <- w.Code
+	}()
+	<-calling
+
+	answered := make(chan int)
+	go func() {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/breaker/memory", nil)
+		router.ServeHTTP(w, req)
+		answered <- w.Code
+	}()
+	select {
+	case code := <-answered:
+		assert.Equal(t, http.StatusOK, code)
+	case <-time.After(time.Second):
+		t.Fatalf("GET /breaker/memory waited for %s %s", method, path)
+	}
+
+	released.Do(func() { close(release) })
+	assert.Equal(t, http.StatusOK, <-done)
+}
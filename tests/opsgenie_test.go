@@ -2,18 +2,28 @@ package tests
 
 import (
 	"context"
+	"errors"
+	"log"
 	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/lrleon/go-breaker/breaker"
+	"github.com/lrleon/go-breaker/breaker/breakertest"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 )
 
 // Create an interface that abstracts the operations we perform on the OpsGenie client
 type alertClientInterface interface {
 	Create(ctx context.Context, request interface{}) (interface{}, error)
 	List(ctx context.Context, request interface{}) (interface{}, error)
+	Close(ctx context.Context, request interface{}) (interface{}, error)
+	Acknowledge(ctx context.Context, request interface{}) (interface{}, error)
 }
 
 // MockAlertClient implements the alertClientInterface for testing
@@ -31,6 +41,16 @@ func (m *MockAlertClient) List(ctx context.Context, request interface{}) (interf
 	return args.Get(0), args.Error(1)
 }
 
+func (m *MockAlertClient) Close(ctx context.Context, request interface{}) (interface{}, error) {
+	args := m.Called(ctx, request)
+	return args.Get(0), args.Error(1)
+}
+
+func (m *MockAlertClient) Acknowledge(ctx context.Context, request interface{}) (interface{}, error) {
+	args := m.Called(ctx, request)
+	return args.Get(0), args.Error(1)
+}
+
 // TestNewOpsGenieClient tests the NewOpsGenieClient function
 func TestNewOpsGenieClient(t *testing.T) {
 	// Test with nil config
@@ -190,6 +210,67 @@ func TestInitialize(t *testing.T) {
 		assert.False(t, client.IsInitialized())
 		t.Logf("Fake API key correctly rejected: %v", err)
 	})
+
+	t.Run("APIKeyFromFile", func(t *testing.T) {
+		os.Unsetenv(breaker.EnvOpsGenieAPIKey)
+
+		keyFile := filepath.Join(t.TempDir(), "opsgenie_api_key")
+		require.NoError(t, os.WriteFile(keyFile, []byte("  fake-api-key-from-file\n"), 0600))
+
+		client := breaker.NewOpsGenieClient(&breaker.OpsGenieConfig{
+			Enabled:     true,
+			APIKeyFile:  keyFile,
+			Team:        "test-team",
+			Environment: "test",
+			BookmakerID: "test-bookmaker",
+		})
+
+		// The key is found in the file, so initialization can only fail on connection
+		err := client.Initialize()
+		if err != nil {
+			assert.NotContains(t, err.Error(), "API key not found")
+		}
+	})
+
+	t.Run("MissingOrEmptyAPIKeyFile", func(t *testing.T) {
+		os.Unsetenv(breaker.EnvOpsGenieAPIKey)
+
+		emptyFile := filepath.Join(t.TempDir(), "empty_key")
+		require.NoError(t, os.WriteFile(emptyFile, []byte(" \n\t"), 0600))
+
+		for _, keyFile := range []string{filepath.Join(t.TempDir(), "missing"), emptyFile} {
+			client := breaker.NewOpsGenieClient(&breaker.OpsGenieConfig{
+				Enabled:     true,
+				APIKeyFile:  keyFile,
+				Team:        "test-team",
+				Environment: "test",
+				BookmakerID: "test-bookmaker",
+			})
+
+			err := client.Initialize()
+			assert.Error(t, err)
+			assert.Contains(t, err.Error(), "OpsGenie API key not found")
+			assert.False(t, client.IsInitialized())
+		}
+	})
+
+	t.Run("InlineKeyUsedWhenFileIsMissing", func(t *testing.T) {
+		os.Unsetenv(breaker.EnvOpsGenieAPIKey)
+
+		client := breaker.NewOpsGenieClient(&breaker.OpsGenieConfig{
+			Enabled:     true,
+			APIKeyFile:  filepath.Join(t.TempDir(), "missing"),
+			APIKey:      "fake-inline-api-key",
+			Team:        "test-team",
+			Environment: "test",
+			BookmakerID: "test-bookmaker",
+		})
+
+		err := client.Initialize()
+		if err != nil {
+			assert.NotContains(t, err.Error(), "API key not found")
+		}
+	})
 }
 
 // Test IsInitialized
@@ -240,6 +321,43 @@ func TestSendingAlerts(t *testing.T) {
 	assert.NoError(t, err, "SendLatencyThresholdAlert should return nil for uninitialized client")
 }
 
+// TestCloseAlert verifies the CloseAlert helper and alias tracking
+// when the client is not initialized
+func TestCloseAlert(t *testing.T) {
+	t.Run("NilClient", func(t *testing.T) {
+		var client *breaker.OpsGenieClient
+		err := client.CloseAlert("some-alias", "note")
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "OpsGenieClient is nil")
+	})
+
+	client := breaker.NewOpsGenieClient(&breaker.OpsGenieConfig{
+		Enabled: true,
+		APIKey:  "test-key",
+	})
+
+	t.Run("EmptyAlias", func(t *testing.T) {
+		err := client.CloseAlert("", "note")
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "alias cannot be empty")
+	})
+
+	t.Run("UninitializedClient", func(t *testing.T) {
+		err := client.CloseAlert("test-api-circuit-open", "note")
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "not initialized")
+	})
+
+	t.Run("NoTrackedAlias", func(t *testing.T) {
+		alias, exists := client.LastAlias("circuit-open")
+		assert.False(t, exists)
+		assert.Empty(t, alias)
+
+		// Nothing was opened, so there is nothing to close
+		assert.NoError(t, client.CloseLastAlert("circuit-open", "note"))
+	})
+}
+
 // TestMandatoryFieldsValidation tests the validation of mandatory fields
 func TestMandatoryFieldsValidation(t *testing.T) {
 	t.Run("AllFieldsMissing", func(t *testing.T) {
@@ -336,6 +454,109 @@ func TestMandatoryFieldsValidation(t *testing.T) {
 	})
 }
 
+// TestMissingFieldsHook verifies that mandatory fields resolved to fallback values are
+// reported, as they are when an alert is sent
+func TestMissingFieldsHook(t *testing.T) {
+	// Fields resolved from environment variables that have since disappeared
+	for _, name := range []string{"OPSGENIE_TEAM", "BOOKMAKER_ID", "PROJECT_ID", "CLIENT_ID", "SERVICE_ID"} {
+		t.Setenv(name, "")
+	}
+
+	client := breaker.NewOpsGenieClient(&breaker.OpsGenieConfig{
+		Enabled:     true,
+		APIKey:      "test-key",
+		Environment: "test",
+		Hostname:    "test-host",
+	})
+
+	var hookAlertType string
+	var hookFields []string
+	client.SetMissingFieldsHook(func(alertType string, fields []string) {
+		hookAlertType = alertType
+		hookFields = fields
+	})
+
+	missing := client.CheckMandatoryFields("circuit-open")
+	assert.Equal(t, []string{"BookmakerId", "Team"}, missing)
+	assert.Equal(t, "circuit-open", hookAlertType)
+	assert.Equal(t, missing, hookFields)
+
+	// Once the fields resolve again, nothing is reported
+	t.Setenv("OPSGENIE_TEAM", "platform")
+	t.Setenv("BOOKMAKER_ID", "bookmaker-1")
+	hookFields = nil
+
+	assert.Empty(t, client.CheckMandatoryFields("circuit-reset"))
+	assert.Nil(t, hookFields, "The hook should not be called when all fields resolve")
+}
+
+// TestEnvironmentSettingsInheritEnabled verifies that an environment entry without
+// enabled, such as one that only sets a cooldown, keeps sending alerts, while one with
+// enabled = false turns them off
+func TestEnvironmentSettingsInheritEnabled(t *testing.T) {
+	disabled := false
+	fake := newFakeOpsGenie(t)
+	newClient := func(environment string) *breaker.OpsGenieClient {
+		return fake.client(t, &breaker.OpsGenieConfig{
+			Enabled:          true,
+			TriggerOnLatency: true,
+			Team:             "test-team",
+			Environment:      environment,
+			UseEnvironments:  true,
+			EnvironmentSettings: map[string]breaker.EnvOpsConfig{
+				"prod": {CooldownSeconds: 60, Priority: "P1"},
+				"dev":  {Enabled: &disabled},
+			},
+		})
+	}
+
+	require.NoError(t, newClient("prod").SendLatencyThresholdAlert(900, 300))
+	require.NoError(t, newClient("dev").SendLatencyThresholdAlert(900, 300))
+
+	alerts := fake.alerts()
+	require.Len(t, alerts, 1, "Only the environment without enabled = false sends the alert")
+	assert.Equal(t, "P1", alerts[0].Priority)
+}
+
+// TestPriorityByMagnitude verifies that alerts far above their threshold get the
+// priority of priority_by_magnitude, while mild breaches keep the configured one
+func TestPriorityByMagnitude(t *testing.T) {
+	fake := newFakeOpsGenie(t)
+	client := fake.client(t, &breaker.OpsGenieConfig{
+		Enabled:          true,
+		TriggerOnOpen:    true,
+		TriggerOnLatency: true,
+		Priority:         "P3",
+		Team:             "test-team",
+		PriorityByMagnitude: []breaker.MagnitudePriority{
+			{MinFactor: 2, Priority: "P2"},
+			{MinFactor: 5, Priority: "P1"},
+		},
+	})
+
+	require.NoError(t, client.SendLatencyThresholdAlert(310, 300))
+	require.NoError(t, client.SendLatencyThresholdAlert(900, 300))
+	require.NoError(t, client.SendBreakerOpenAlertForTrip(breaker.AggregatedTrip{
+		Reason:             breaker.TripReasonLatency,
+		LatencyMs:          3000,
+		WaitTime:           10,
+		LatencyThresholdMs: 300,
+	}))
+
+	alerts := fake.alerts()
+	require.Len(t, alerts, 3)
+	assert.Equal(t, "P3", alerts[0].Priority, "A breach of 1.03x keeps the configured priority")
+	assert.Equal(t, "P2", alerts[1].Priority, "A breach of 3x reaches the 2x step")
+	assert.Equal(t, "P1", alerts[2].Priority, "A breach of 10x reaches the 5x step")
+
+	assert.Equal(t, "P1", (&breaker.OpsGenieConfig{PriorityByMagnitude: []breaker.MagnitudePriority{
+		{MinFactor: 5, Priority: "P1"}, {MinFactor: 2, Priority: "P2"},
+	}}).MagnitudePriority(7), "The most severe step reached wins, whatever the order")
+	assert.ErrorContains(t, breaker.ValidateOpsGenieConfig(&breaker.OpsGenieConfig{
+		PriorityByMagnitude: []breaker.MagnitudePriority{{MinFactor: 0.5, Priority: "P1"}},
+	}), "priority_by_magnitude[0].min_factor")
+}
+
 // TestWithDisabledTriggers verifies that disabled triggers don't send alerts
 func TestWithDisabledTriggers(t *testing.T) {
 	// We create a client but don't initialize it to avoid making real calls
@@ -344,3 +565,791 @@ func TestWithDisabledTriggers(t *testing.T) {
 	// We can't do higher level tests without completely mocking the OpsGenie client
 	// or without using an HTTP mocking library to intercept calls to the real API
 }
+
+// TestBreakerOpenAlertReason verifies that the trip reason reaches the open alert as a
+// tag and a detail
+func TestBreakerOpenAlertReason(t *testing.T) {
+	fake := newFakeOpsGenie(t)
+	client := fake.client(t, &breaker.OpsGenieConfig{
+		Enabled:       true,
+		TriggerOnOpen: true,
+		Team:          "test-team",
+	})
+
+	require.NoError(t, client.SendBreakerOpenAlertWithReason(900, true, 10, breaker.TripReasonLatencyPlateau))
+
+	alerts := fake.alerts()
+	require.Len(t, alerts, 1)
+	assert.Contains(t, alerts[0].Tags, "reason:latency-plateau")
+	assert.Equal(t, "latency-plateau", alerts[0].Details["Trigger Reason"])
+}
+
+// TestStuckOpenAlert verifies that a breaker that stays open longer than
+// max_open_duration_seconds sends a single stuck-open alert with its own priority
+func TestStuckOpenAlert(t *testing.T) {
+	fake := newFakeOpsGenie(t)
+	t.Setenv(breaker.EnvOpsGenieAPIKey, "test-key")
+	t.Setenv(breaker.EnvOpsGenieAPIURL, fake.URL)
+	resetOpsGenieClient(t)
+
+	opsGenieConfig := &breaker.OpsGenieConfig{
+		Enabled:                true,
+		Priority:               "P3",
+		Team:                   "test-team",
+		MaxOpenDurationSeconds: 1,
+		StuckOpenAlertPriority: "P1",
+	}
+	require.NoError(t, breaker.ValidateOpsGenieConfig(opsGenieConfig))
+
+	b := breaker.NewBreaker(&breaker.Config{
+		MemoryThreshold:   80,
+		LatencyThreshold:  1000,
+		LatencyWindowSize: 10,
+		Percentile:        0.95,
+		WaitTime:          1,
+		OpsGenie:          opsGenieConfig,
+	}, "")
+	defer b.Close()
+
+	// Memory stays above the threshold, so the breaker cannot reset after the wait time
+	setMemoryOverride(b, false)
+	end := time.Now()
+	b.Done(end.Add(-10*time.Millisecond), end)
+	require.True(t, b.Triggered())
+
+	stuckOpenAlerts := func() []createdAlert {
+		var alerts []createdAlert
+		for _, alert := range fake.alerts() {
+			if alert.Details["Alert Type"] == "circuit-stuck-open" {
+				alerts = append(alerts, alert)
+			}
+		}
+		return alerts
+	}
+	require.Eventually(t, func() bool { return len(stuckOpenAlerts()) > 0 }, 3*time.Second, 50*time.Millisecond)
+
+	alert := stuckOpenAlerts()[0]
+	assert.Equal(t, "P1", alert.Priority)
+	assert.Contains(t, alert.Message, "STUCK OPEN")
+	assert.Contains(t, alert.Tags, "reason:"+breaker.TripReasonMemory)
+
+	// The alert is sent once while the breaker stays open
+	time.Sleep(500 * time.Millisecond)
+	assert.Len(t, stuckOpenAlerts(), 1)
+
+	opsGenieConfig.MaxOpenDurationSeconds = -1
+	assert.Error(t, breaker.ValidateOpsGenieConfig(opsGenieConfig))
+}
+
+// TestStuckOpenAlertWhileFlapping verifies that a breaker that re-trips as soon as it
+// closes stays in the same open episode and still sends the stuck-open alert
+func TestStuckOpenAlertWhileFlapping(t *testing.T) {
+	fake := newFakeOpsGenie(t)
+	t.Setenv(breaker.EnvOpsGenieAPIKey, "test-key")
+	t.Setenv(breaker.EnvOpsGenieAPIURL, fake.URL)
+	resetOpsGenieClient(t)
+
+	b := breaker.NewBreaker(&breaker.Config{
+		MemoryThreshold:   80,
+		LatencyThreshold:  1000,
+		LatencyWindowSize: 10,
+		Percentile:        0.95,
+		WaitTime:          1,
+		OpsGenie: &breaker.OpsGenieConfig{
+			Enabled:                true,
+			Priority:               "P3",
+			Team:                   "test-team",
+			MaxOpenDurationSeconds: 3,
+		},
+	}, "")
+	defer b.Close()
+
+	clock := breaker.NewMockClock(time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC))
+	b.(*breaker.BreakerDriver).SetClock(clock)
+	done := func() {
+		start := clock.Now()
+		clock.Advance(10 * time.Millisecond)
+		b.Done(start, clock.Now())
+	}
+
+	// Each cycle opens on memory, closes after the wait time with a trial request and
+	// trips again at once: no single opening lasts max_open_duration_seconds
+	setMemoryOverride(b, false)
+	done()
+	require.True(t, b.Triggered())
+	for i := 0; i < 4; i++ {
+		clock.Advance(1100 * time.Millisecond)
+		setMemoryOverride(b, true)
+		require.True(t, b.Allow(), "cycle %d: the trial request is let through", i)
+		done()
+		require.False(t, b.Triggered(), "cycle %d: the trial request closes the breaker", i)
+
+		setMemoryOverride(b, false)
+		done()
+		require.True(t, b.Triggered(), "cycle %d: memory trips the breaker again", i)
+	}
+
+	stuckOpenAlerts := func() int {
+		count := 0
+		for _, alert := range fake.alerts() {
+			if alert.Details["Alert Type"] == "circuit-stuck-open" {
+				count++
+			}
+		}
+		return count
+	}
+	require.Eventually(t, func() bool { return stuckOpenAlerts() > 0 }, 3*time.Second, 50*time.Millisecond)
+
+	// Closed for a whole wait time, the next trip starts a new episode
+	clock.Advance(1100 * time.Millisecond)
+	setMemoryOverride(b, true)
+	require.True(t, b.Allow())
+	done()
+	require.False(t, b.Triggered())
+	clock.Advance(1100 * time.Millisecond)
+	setMemoryOverride(b, false)
+	done()
+	require.True(t, b.Triggered())
+	time.Sleep(500 * time.Millisecond)
+	assert.Equal(t, 1, stuckOpenAlerts(), "The new episode is not stuck yet")
+}
+
+// TestOpsGenieConnectivityCheck verifies that losing and recovering the connection to
+// OpsGenie is reported once to the connectivity notifier
+func TestOpsGenieConnectivityCheck(t *testing.T) {
+	fake := newFakeOpsGenie(t)
+	client := fake.client(t, &breaker.OpsGenieConfig{
+		Enabled: true,
+		Team:    "test-team",
+	})
+	recorder := breaker.NewRecordingNotifier()
+	client.SetConnectivityNotifier(recorder)
+
+	require.NoError(t, client.CheckConnectivity())
+	assert.True(t, client.Reachable())
+	assert.Empty(t, recorder.RecordedAlerts(), "Nothing changed")
+
+	// OpsGenie fails: the first failed check is reported, the next ones are not
+	fake.unavailable.Store(true)
+	assert.Error(t, client.CheckConnectivity())
+	assert.Error(t, client.CheckConnectivity())
+	assert.False(t, client.Reachable())
+
+	alerts := recorder.RecordedAlerts()
+	require.Len(t, alerts, 1)
+	assert.Equal(t, breaker.AlertTypeOpsGenieUnreachable, alerts[0].Type)
+	assert.Contains(t, alerts[0].Message, "OpsGenie unreachable")
+	assert.NotEmpty(t, alerts[0].Details["Error"])
+
+	fake.unavailable.Store(false)
+	require.NoError(t, client.CheckConnectivity())
+	assert.True(t, client.Reachable())
+	alerts = recorder.RecordedAlerts()
+	require.Len(t, alerts, 2)
+	assert.Equal(t, breaker.AlertTypeOpsGenieRestored, alerts[1].Type)
+
+	assert.Error(t, breaker.ValidateOpsGenieConfig(&breaker.OpsGenieConfig{
+		Enabled:                  true,
+		Priority:                 "P3",
+		Team:                     "test-team",
+		ConnectivityCheckSeconds: -1,
+	}))
+}
+
+// TestFailedReinitializationKeepsTheClient verifies that a client that cannot connect
+// is not installed by Initialize, so alerts keep going through the previous one
+func TestFailedReinitializationKeepsTheClient(t *testing.T) {
+	fake := newFakeOpsGenie(t)
+	client := fake.client(t, &breaker.OpsGenieConfig{
+		Enabled: true,
+		Team:    "test-team",
+	})
+
+	failing := newFakeOpsGenie(t)
+	failing.unavailable.Store(true)
+	t.Setenv(breaker.EnvOpsGenieAPIURL, failing.URL)
+	require.Error(t, client.Initialize())
+
+	assert.True(t, client.IsInitialized())
+	assert.NoError(t, client.TestConnection(), "The previous client talks to the fake")
+}
+
+// TestConnectivityCheckIsSharedByTheClient verifies that the breakers sharing an OpsGenie
+// client run a single connectivity check, which stops when the last of them is closed
+func TestConnectivityCheckIsSharedByTheClient(t *testing.T) {
+	fake := newFakeOpsGenie(t)
+	t.Setenv(breaker.EnvOpsGenieAPIKey, "test-key")
+	t.Setenv(breaker.EnvOpsGenieAPIURL, fake.URL)
+	resetOpsGenieClient(t)
+
+	newBreaker := func() *breaker.BreakerDriver {
+		return breaker.NewBreaker(&breaker.Config{
+			MemoryThreshold:   80,
+			LatencyThreshold:  300,
+			LatencyWindowSize: 10,
+			Percentile:        0.95,
+			WaitTime:          10,
+			OpsGenie: &breaker.OpsGenieConfig{
+				Enabled:                  true,
+				Priority:                 "P3",
+				Team:                     "test-team",
+				ConnectivityCheckSeconds: 1,
+			},
+		}, "").(*breaker.BreakerDriver)
+	}
+	first := newBreaker()
+	second := newBreaker()
+	defer first.Close()
+
+	// One check per second, not one per breaker
+	start := fake.listings.Load()
+	time.Sleep(2500 * time.Millisecond)
+	assert.Equal(t, int64(2), fake.listings.Load()-start)
+
+	// The check goes on while a breaker uses it, and stops with the last one
+	require.NoError(t, second.Close())
+	start = fake.listings.Load()
+	time.Sleep(1000 * time.Millisecond)
+	assert.Equal(t, int64(1), fake.listings.Load()-start)
+
+	require.NoError(t, first.Close())
+	start = fake.listings.Load()
+	time.Sleep(1500 * time.Millisecond)
+	assert.Zero(t, fake.listings.Load()-start)
+}
+
+// TestAlertAggregation verifies that the trips within alert_aggregation_seconds are sent
+// as a single open alert listing the breakers and reasons
+func TestAlertAggregation(t *testing.T) {
+	client := breaker.NewOpsGenieClient(&breaker.OpsGenieConfig{
+		Enabled:                 true,
+		Priority:                "P2",
+		TriggerOnOpen:           true,
+		Team:                    "test-team",
+		AlertAggregationSeconds: 1,
+	})
+	recorder := breaker.NewRecordingNotifier()
+	client.SetNotifier(recorder)
+
+	trips := []breaker.AggregatedTrip{
+		{Breaker: "payments", Reason: breaker.TripReasonLatency, LatencyMs: 900, MemoryOK: true, WaitTime: 10, CorrelationID: "req-2"},
+		{Breaker: "orders", Reason: breaker.TripReasonMemory, LatencyMs: 200, MemoryOK: false, WaitTime: 30, CoalescedTrips: 2},
+		{Breaker: "payments", Reason: breaker.TripReasonLatency, LatencyMs: 1200, MemoryOK: true, WaitTime: 10, CorrelationID: "req-1"},
+	}
+	for _, trip := range trips {
+		require.NoError(t, client.AggregateBreakerOpenAlert(trip))
+	}
+	assert.Empty(t, recorder.RecordedAlerts(), "The alert waits for the end of the window")
+
+	require.Eventually(t, func() bool { return len(recorder.RecordedAlerts()) > 0 }, 3*time.Second, 50*time.Millisecond)
+	alerts := recorder.RecordedAlerts()
+	require.Len(t, alerts, 1)
+	assert.Equal(t, "circuit-open", alerts[0].Type)
+	assert.Contains(t, alerts[0].Message, "(3 trips)")
+	assert.Equal(t, "3", alerts[0].Details["Trip Count"])
+	assert.Equal(t, "orders, payments", alerts[0].Details["Affected Breakers"])
+	assert.Equal(t, "latency, memory", alerts[0].Details["Trigger Reason"])
+	assert.Equal(t, "1200", alerts[0].Details["Latency"])
+	assert.Equal(t, "false", alerts[0].Details["Memory OK"])
+	assert.Equal(t, "req-1, req-2", alerts[0].Details["Correlation IDs"])
+	assert.Equal(t, "2", alerts[0].Details["Coalesced Trips"])
+	assert.Equal(t, "P2", alerts[0].Priority)
+	assert.Contains(t, alerts[0].Tags, "aggregated")
+	assert.Contains(t, alerts[0].Tags, "reason:memory")
+	assert.Contains(t, alerts[0].Tags, "correlation_id:req-1")
+	assert.Contains(t, alerts[0].Tags, "correlation_id:req-2")
+
+	// Trips with their own priority, like the staged alerts, are sent with the most
+	// severe priority among the trips, the global one included
+	recorder.Reset()
+	for _, priority := range []string{"P4", "P1", "P4"} {
+		require.NoError(t, client.AggregateBreakerOpenAlert(breaker.AggregatedTrip{Breaker: "payments", Priority: priority}))
+	}
+	require.NoError(t, client.FlushAggregatedAlerts())
+	alerts = recorder.RecordedAlerts()
+	require.Len(t, alerts, 1)
+	assert.Equal(t, "P1", alerts[0].Priority)
+
+	recorder.Reset()
+	require.NoError(t, client.AggregateBreakerOpenAlert(breaker.AggregatedTrip{Breaker: "payments", Priority: "P4"}))
+	require.NoError(t, client.AggregateBreakerOpenAlert(breaker.AggregatedTrip{Breaker: "orders"}))
+	require.NoError(t, client.FlushAggregatedAlerts())
+	alerts = recorder.RecordedAlerts()
+	require.Len(t, alerts, 1)
+	assert.Equal(t, "P2", alerts[0].Priority, "A trip without its own priority has the global one")
+
+	// A window with a single trip sends the usual open alert
+	recorder.Reset()
+	require.NoError(t, client.AggregateBreakerOpenAlert(trips[0]))
+	require.NoError(t, client.FlushAggregatedAlerts())
+	alerts = recorder.RecordedAlerts()
+	require.Len(t, alerts, 1)
+	assert.Equal(t, "900", alerts[0].Details["Latency"])
+	assert.NotContains(t, alerts[0].Tags, "aggregated")
+	require.NoError(t, client.FlushAggregatedAlerts(), "Nothing left to send")
+	assert.Len(t, recorder.RecordedAlerts(), 1)
+
+	assert.Error(t, breaker.ValidateOpsGenieConfig(&breaker.OpsGenieConfig{
+		Enabled:                 true,
+		Priority:                "P3",
+		Team:                    "test-team",
+		AlertAggregationSeconds: -1,
+	}))
+}
+
+func TestAlertRedaction(t *testing.T) {
+	config := &breaker.OpsGenieConfig{
+		Enabled:             true,
+		Priority:            "P2",
+		TriggerOnOpen:       true,
+		TriggerOnMemory:     true,
+		Team:                "test-team",
+		APICustomAttributes: map[string]string{"Customer": "ACME Corp", "Region": "eu-west-1"},
+		ContactDetails:      breaker.ContactInfo{PrimaryContact: "jane@example.com", SlackChannel: "#payments"},
+		RedactKeys:          []string{"customer", "Primary Contact"},
+		RedactPattern:       `(?i)slack|goroutines`,
+	}
+	client := breaker.NewOpsGenieClient(config)
+	recorder := breaker.NewRecordingNotifier()
+	client.SetNotifier(recorder)
+
+	require.NoError(t, client.SendBreakerOpenAlertWithReason(900, true, 10, breaker.TripReasonLatency))
+	require.NoError(t, client.SendMemoryThresholdAlert(&breaker.MemoryStatus{CurrentUsage: 95, Threshold: 80}))
+	alerts := recorder.RecordedAlerts()
+	require.Len(t, alerts, 2)
+	for _, alert := range alerts {
+		assert.Equal(t, breaker.RedactedValue, alert.Details["Custom_Customer"], alert.Type)
+		assert.Equal(t, breaker.RedactedValue, alert.Details["Goroutines"], alert.Type)
+		assert.Equal(t, "eu-west-1", alert.Details["Custom_Region"], alert.Type)
+		assert.Equal(t, "test-team", alert.Details["Team"], alert.Type)
+
+		assert.Contains(t, alert.Description, "• Primary Contact: ****\n", alert.Type)
+		assert.Contains(t, alert.Description, "• Slack Channel: ****\n", alert.Type)
+		assert.NotContains(t, alert.Description, "jane@example.com", alert.Type)
+		assert.Contains(t, alert.Description, "• Team: test-team", alert.Type)
+	}
+
+	assert.True(t, config.RedactsKey("Custom_customer"))
+	assert.False(t, config.RedactsKey("Region"))
+
+	require.NoError(t, breaker.ValidateOpsGenieConfig(config))
+	config.RedactPattern = "("
+	assert.ErrorContains(t, breaker.ValidateOpsGenieConfig(config), "invalid redact_pattern")
+}
+
+// TestAlertAliasIdentifier verifies that services with the default source get distinct
+// aliases when their bookmaker IDs differ, and that the shared default is reported
+func TestAlertAliasIdentifier(t *testing.T) {
+	for _, envVar := range []string{"BOOKMAKER_ID", "PROJECT_ID", "CLIENT_ID", "SERVICE_ID"} {
+		t.Setenv(envVar, "")
+	}
+
+	openAlias := func(config *breaker.OpsGenieConfig) string {
+		client := breaker.NewOpsGenieClient(config)
+		recorder := breaker.NewRecordingNotifier()
+		client.SetNotifier(recorder)
+		require.NoError(t, client.SendBreakerOpenAlert(900, true, 10))
+		alerts := recorder.RecordedAlerts()
+		require.Len(t, alerts, 1)
+		return alerts[0].Alias
+	}
+	config := func(bookmakerID string) *breaker.OpsGenieConfig {
+		return &breaker.OpsGenieConfig{
+			Enabled:       true,
+			TriggerOnOpen: true,
+			Team:          "test-team",
+			Source:        "go-breaker",
+			BookmakerID:   bookmakerID,
+		}
+	}
+
+	first, second := openAlias(config("bookmaker-1")), openAlias(config("bookmaker-2"))
+	assert.Equal(t, "go-breaker/bookmaker-1-circuit-open", first)
+	assert.NotEqual(t, first, second)
+	assert.False(t, config("bookmaker-1").HasSharedAlertIdentifier())
+
+	shared := config("")
+	assert.True(t, shared.HasSharedAlertIdentifier())
+	assert.Equal(t, "go-breaker-circuit-open", openAlias(shared))
+
+	t.Setenv("BOOKMAKER_ID", "from-env")
+	assert.False(t, shared.HasSharedAlertIdentifier())
+
+	named := &breaker.OpsGenieConfig{APINamespace: "payments", APIName: "charges"}
+	assert.False(t, named.HasSharedAlertIdentifier())
+	assert.False(t, (&breaker.OpsGenieConfig{Source: "payments-api"}).HasSharedAlertIdentifier())
+}
+
+// failingNotifier is a notifier that is always down
+type failingNotifier struct{}
+
+func (failingNotifier) Notify(context.Context, breaker.Alert) error {
+	return errors.New("notifier down")
+}
+
+// TestFallbackNotifier verifies that the alerts OpsGenie fails to create go to the first
+// notifier of the fallback chain that accepts them
+func TestFallbackNotifier(t *testing.T) {
+	fake := newFakeOpsGenie(t)
+	client := fake.client(t, &breaker.OpsGenieConfig{
+		Enabled:         true,
+		TriggerOnOpen:   true,
+		TriggerOnMemory: true,
+		Team:            "test-team",
+	})
+	recorder := breaker.NewRecordingNotifier()
+	client.SetFallbackNotifier(breaker.NewFallbackNotifier(failingNotifier{}, nil, recorder))
+
+	fake.unavailable.Store(true)
+	require.NoError(t, client.SendBreakerOpenAlertWithReason(900, true, 10, breaker.TripReasonLatency))
+	alerts := recorder.RecordedAlerts()
+	require.Len(t, alerts, 1)
+	assert.Equal(t, "circuit-open", alerts[0].Type)
+	assert.Empty(t, fake.alerts())
+
+	// Every notifier fails: the alert is reported as lost
+	client.SetFallbackNotifier(breaker.NewFallbackNotifier(failingNotifier{}, failingNotifier{}))
+	err := client.SendMemoryThresholdAlert(&breaker.MemoryStatus{CurrentUsage: 95, Threshold: 80})
+	assert.ErrorContains(t, err, "notifier 2")
+	assert.Error(t, breaker.NewFallbackNotifier().Notify(context.Background(), breaker.Alert{}))
+}
+
+// TestRecordingNotifier verifies that a client with a notifier records the alerts it
+// would have sent, without an API key or a connection to OpsGenie
+func TestRecordingNotifier(t *testing.T) {
+	client := breaker.NewOpsGenieClient(&breaker.OpsGenieConfig{
+		Enabled:        true,
+		Priority:       "P2",
+		TriggerOnOpen:  true,
+		TriggerOnReset: true,
+		Team:           "test-team",
+	})
+	assert.False(t, client.IsInitialized())
+
+	recorder := breaker.NewRecordingNotifier()
+	client.SetNotifier(recorder)
+	assert.True(t, client.IsInitialized(), "A notifier takes the place of OpsGenie")
+
+	require.NoError(t, client.SendBreakerOpenAlertWithReason(900, true, 10, breaker.TripReasonLatency))
+	require.NoError(t, client.SendBreakerResetAlert())
+	require.NoError(t, client.CloseLastAlert("circuit-open", "recovered"))
+
+	alerts := recorder.RecordedAlerts()
+	require.Len(t, alerts, 2)
+	assert.Equal(t, "circuit-open", alerts[0].Type)
+	assert.Equal(t, "P2", alerts[0].Priority)
+	assert.Contains(t, alerts[0].Tags, "reason:latency")
+	assert.Equal(t, "900", alerts[0].Details["Latency"])
+	assert.Equal(t, "circuit-reset", alerts[1].Type)
+
+	recorder.Reset()
+	assert.Empty(t, recorder.RecordedAlerts())
+
+	// Test mode records the alerts of every client, which need no API key
+	breaker.SetTestMode(true)
+	defer breaker.SetTestMode(false)
+	t.Setenv(breaker.EnvOpsGenieAPIKey, "")
+	other := breaker.NewOpsGenieClient(&breaker.OpsGenieConfig{Enabled: true, TriggerOnOpen: true, Team: "test-team"})
+	require.NoError(t, other.Initialize())
+	require.NoError(t, other.SendBreakerOpenAlert(500, false, 5))
+	require.Len(t, breaker.RecordedAlerts(), 1)
+	assert.Equal(t, "circuit-open", breaker.RecordedAlerts()[0].Type)
+
+	breaker.SetTestMode(false)
+	assert.Nil(t, breaker.RecordedAlerts())
+}
+
+// TestTagsWithColons verifies that a tag value may hold colons, and that a bare URL is
+// not mistaken for a key:value tag
+func TestTagsWithColons(t *testing.T) {
+	tags := []string{"Service:https://api.example.com", "https://status.example.com", "team:"}
+
+	client := breaker.NewOpsGenieClient(&breaker.OpsGenieConfig{
+		Enabled:       true,
+		Priority:      "P3",
+		TriggerOnOpen: true,
+		Team:          "test-team",
+		Tags:          tags,
+	})
+	recorder := breaker.NewRecordingNotifier()
+	client.SetNotifier(recorder)
+
+	require.NoError(t, client.SendBreakerOpenAlert(900, true, 10))
+	alerts := recorder.RecordedAlerts()
+	require.Len(t, alerts, 1)
+	assert.Contains(t, alerts[0].Tags, "Service:https://api.example.com")
+	assert.Contains(t, alerts[0].Tags, "**TAG_KEY_UNDEFINED**:https://status.example.com")
+	assert.Contains(t, alerts[0].Tags, "**TAG_KEY_UNDEFINED**:team:")
+
+	// The load suggests fixes that keep the URLs whole
+	path := filepath.Join(t.TempDir(), "breakers.toml")
+	require.NoError(t, os.WriteFile(path, []byte(`memory_threshold = 80.0
+
+[opsgenie]
+enabled = false
+tags = ["Service:https://api.example.com", "https://status.example.com", "team:"]
+`), 0644))
+
+	var output strings.Builder
+	log.SetOutput(&output)
+	defer log.SetOutput(os.Stderr)
+
+	config, err := breaker.LoadConfig(path)
+	require.NoError(t, err)
+	assert.Equal(t, tags, config.OpsGenie.Tags)
+	assert.Contains(t, output.String(), "Tag[0] = 'Service:https://api.example.com' (valid key:value format)")
+	assert.Contains(t, output.String(), "Suggestion: 'https://status.example.com' → 'URL:https://status.example.com'")
+	assert.Contains(t, output.String(), "Suggestion: 'team:' → 'team:<value>'")
+}
+
+// TestBreakerOpenAlertCorrelationID verifies that the open alert of a latency trip carries
+// the correlation ID of the slow request behind it
+func TestBreakerOpenAlertCorrelationID(t *testing.T) {
+	breaker.SetTestMode(true)
+	defer breaker.SetTestMode(false)
+	resetOpsGenieClient(t)
+
+	b := breaker.NewBreaker(&breaker.Config{
+		MemoryThreshold:   80,
+		LatencyThreshold:  100,
+		LatencyWindowSize: 10,
+		Percentile:        0.95,
+		WaitTime:          60,
+
+		// The third slow request trips the breaker
+		MinSamplesAboveThreshold: 3,
+		OpsGenie: &breaker.OpsGenieConfig{
+			Enabled:       true,
+			TriggerOnOpen: true,
+			Team:          "test-team",
+		},
+	}, "")
+	defer b.Close()
+	driver := b.(*breaker.BreakerDriver)
+	setMemoryOverride(b, true)
+
+	ctx := context.Background()
+	end := time.Now()
+	b.DoneCtx(breaker.WithCorrelationID(ctx, "fast-request"), end.Add(-10*time.Millisecond), end)
+	b.DoneCtx(breaker.WithCorrelationID(ctx, "first-slow-request"), end.Add(-500*time.Millisecond), end)
+	b.DoneCtx(ctx, end.Add(-500*time.Millisecond), end)
+	assert.False(t, b.Triggered())
+	b.DoneCtx(breaker.WithCorrelationID(ctx, "trace-4bf92f3577b34da6"), end.Add(-500*time.Millisecond), end)
+	require.True(t, b.Triggered())
+	assert.Equal(t, "trace-4bf92f3577b34da6", driver.TripCorrelationID())
+
+	var alert breaker.Alert
+	require.Eventually(t, func() bool {
+		for _, recorded := range breaker.RecordedAlerts() {
+			if recorded.Type == "circuit-open" {
+				alert = recorded
+				return true
+			}
+		}
+		return false
+	}, 3*time.Second, 50*time.Millisecond)
+	assert.Contains(t, alert.Tags, "correlation_id:trace-4bf92f3577b34da6")
+	assert.Equal(t, "trace-4bf92f3577b34da6", alert.Details["Correlation ID"])
+
+	assert.Equal(t, "trace-4bf92f3577b34da6", breaker.CorrelationIDFromContext(
+		breaker.WithCorrelationID(ctx, "trace-4bf92f3577b34da6")))
+	assert.Empty(t, breaker.CorrelationIDFromContext(ctx))
+}
+
+func TestBreakerResetAlertReason(t *testing.T) {
+	breaker.SetTestMode(true)
+	defer breaker.SetTestMode(false)
+
+	resetAlert := func(reason string) (breaker.Alert, bool) {
+		for _, recorded := range breaker.RecordedAlerts() {
+			if recorded.Type == "circuit-reset" && recorded.Details["Reset Reason"] == reason {
+				return recorded, true
+			}
+		}
+		return breaker.Alert{}, false
+	}
+	// Each breaker gets its own client, so the reset alert of one does not put the
+	// other's in cooldown
+	newBreaker := func(waitTime int) *breaker.BreakerDriver {
+		resetOpsGenieClient(t)
+		return breakertest.NewTestBreaker(breakertest.WithConfig(func(config *breaker.Config) {
+			config.WaitTime = waitTime
+			config.OpsGenie = &breaker.OpsGenieConfig{
+				Enabled:        true,
+				TriggerOnReset: true,
+				Team:           "test-team",
+			}
+		}))
+	}
+
+	// An operator reset
+	manual := newBreaker(60)
+	defer manual.Close()
+	require.NoError(t, breakertest.TriggerByLatency(manual))
+	manual.Reset()
+
+	var alert breaker.Alert
+	require.Eventually(t, func() bool {
+		var found bool
+		alert, found = resetAlert(breaker.ResetAlertManual)
+		return found
+	}, 3*time.Second, 50*time.Millisecond)
+	assert.Contains(t, alert.Tags, "reset_reason:manual")
+	assert.Contains(t, alert.Message, "RESET (manual)")
+
+	// A reset after the wait time
+	automatic := newBreaker(1)
+	defer automatic.Close()
+	require.NoError(t, breakertest.TriggerByLatency(automatic))
+	time.Sleep(1100 * time.Millisecond)
+	require.True(t, automatic.Allow())
+	start := time.Now()
+	time.Sleep(time.Millisecond)
+	automatic.Done(start, time.Now()) // The trial request closes the breaker
+
+	require.Eventually(t, func() bool {
+		var found bool
+		alert, found = resetAlert(breaker.ResetAlertAutomatic)
+		return found
+	}, 3*time.Second, 50*time.Millisecond)
+	assert.Contains(t, alert.Tags, "reset_reason:automatic")
+	assert.Contains(t, alert.Message, "RESET (automatic)")
+}
+
+// TestUpdateConfigSwapsOpsGenieSection verifies that UpdateConfig gives the OpsGenie
+// client a new section instead of writing over the one alerts are being sent with
+func TestUpdateConfigSwapsOpsGenieSection(t *testing.T) {
+	breaker.SetTestMode(true)
+	defer breaker.SetTestMode(false)
+	resetOpsGenieClient(t)
+
+	config := &breaker.Config{
+		MemoryThreshold:   80,
+		LatencyThreshold:  300,
+		LatencyWindowSize: 10,
+		Percentile:        0.95,
+		WaitTime:          10,
+		OpsGenie: &breaker.OpsGenieConfig{
+			Enabled:       true,
+			TriggerOnOpen: true,
+			Priority:      "P3",
+			Team:          "test-team",
+		},
+	}
+	b := breaker.NewBreaker(config, "").(*breaker.BreakerDriver)
+	defer b.Close()
+	client := breaker.GetOpsGenieClient(config.OpsGenie)
+
+	// The client keeps reading its configuration while it changes (see go test -race)
+	stop := make(chan struct{})
+	var reading sync.WaitGroup
+	reading.Add(1)
+	go func() {
+		defer reading.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				_ = client.EffectivePriority()
+			}
+		}
+	}()
+
+	updated := *config
+	opsGenie := *config.OpsGenie
+	opsGenie.Priority = "P1"
+	updated.OpsGenie = &opsGenie
+	require.NoError(t, b.UpdateConfig(&updated))
+	close(stop)
+	reading.Wait()
+
+	assert.Equal(t, "P1", client.EffectivePriority())
+	assert.Equal(t, "P1", b.Config().OpsGenie.Priority)
+	assert.Equal(t, "P3", config.OpsGenie.Priority, "The section the breaker was created with is not written over")
+	opsGenie.Priority = "P5"
+	assert.Equal(t, "P1", client.EffectivePriority(), "The client does not share the caller's section")
+}
+
+func TestMemoryWarningAlert(t *testing.T) {
+	breaker.SetTestMode(true)
+	defer breaker.SetTestMode(false)
+	resetOpsGenieClient(t)
+
+	// Memory usage is about 25% of the limit: above the warning threshold, below the trip threshold
+	previousLimit := breaker.MemoryLimit
+	defer breaker.SetMemoryLimitFile(previousLimit)
+	breaker.SetMemoryLimitFile(breaker.MemoryUsageBytes() * 4)
+
+	b := breakertest.NewTestBreaker(breakertest.WithConfig(func(config *breaker.Config) {
+		config.MemoryThreshold = 99
+		config.MemoryWarnThreshold = 10
+		config.OpsGenie = &breaker.OpsGenieConfig{
+			Enabled:         true,
+			TriggerOnMemory: true,
+			Priority:        "P2",
+			Team:            "test-team",
+		}
+	}))
+	defer b.Close()
+
+	warnings := func() []breaker.Alert {
+		var alerts []breaker.Alert
+		for _, recorded := range breaker.RecordedAlerts() {
+			if recorded.Type == "memory-warning" {
+				alerts = append(alerts, recorded)
+			}
+		}
+		return alerts
+	}
+
+	end := time.Now()
+	b.Done(end.Add(-10*time.Millisecond), end)
+	require.Eventually(t, func() bool { return len(warnings()) == 1 }, 3*time.Second, 50*time.Millisecond)
+	alert := warnings()[0]
+	assert.Equal(t, "P4", alert.Priority, "The warning should not page anyone")
+	assert.Equal(t, "10.00%", alert.Details["Warning Threshold"])
+	assert.Contains(t, alert.Message, "Memory Usage Approaching Threshold")
+	assert.False(t, b.Triggered(), "A warning does not trip the breaker")
+
+	// Staying above the warning threshold does not warn again
+	b.Done(end.Add(-10*time.Millisecond), end)
+	time.Sleep(100 * time.Millisecond)
+	assert.Len(t, warnings(), 1)
+
+	// The warning threshold must be below the trip threshold
+	config := &breaker.Config{MemoryThreshold: 80, MemoryWarnThreshold: 80, LatencyThreshold: 100,
+		LatencyWindowSize: 10, Percentile: 0.95, WaitTime: 5}
+	assert.ErrorContains(t, breaker.ValidateConfig(config), "memory_warn_threshold")
+}
+
+// TestConfigurationReportIsDeterministic verifies that the mandatory fields are reported
+// in a fixed order, so that reports and logs can be compared
+func TestConfigurationReportIsDeterministic(t *testing.T) {
+	client := breaker.NewOpsGenieClient(&breaker.OpsGenieConfig{
+		Enabled:           true,
+		Region:            "us",
+		Priority:          "P3",
+		Source:            "go-breaker",
+		Team:              "payments-team",
+		Environment:       "an-environment-name-longer-than-twenty-characters",
+		BookmakerID:       strings.Repeat("b", 60),
+		Business:          "payments",
+		AdditionalContext: "canary",
+	})
+
+	report := client.GenerateConfigurationReport()
+	for i := 0; i < 20; i++ {
+		require.Equal(t, report, client.GenerateConfigurationReport(), "The report should not change between calls")
+	}
+
+	// Mandatory fields come in a fixed order, and so do the validation issues
+	positions := make([]int, 0, 6)
+	for _, field := range []string{"Team:", "Environment:", "BookmakerId:", "Host:", "Business:", "AdditionalContext:"} {
+		position := strings.Index(report, " "+field+" ")
+		require.GreaterOrEqual(t, position, 0, "The report should list %s", field)
+		positions = append(positions, position)
+	}
+	assert.IsIncreasing(t, positions)
+	assert.Less(t, strings.Index(report, "Invalid bookmaker_id"), strings.Index(report, "Invalid environment"))
+}
@@ -0,0 +1,112 @@
+package tests
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/lrleon/go-breaker/breaker"
+	"github.com/lrleon/go-breaker/breaker/otelbreaker"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// recordingSpan is a minimal recording span that keeps the events and attributes it receives
+type recordingSpan struct {
+	trace.Span
+	events     []string
+	eventAttrs []map[attribute.Key]attribute.Value
+	attrs      map[attribute.Key]attribute.Value
+}
+
+func newRecordingSpan() *recordingSpan {
+	return &recordingSpan{
+		Span:  trace.SpanFromContext(context.Background()),
+		attrs: make(map[attribute.Key]attribute.Value),
+	}
+}
+
+func (s *recordingSpan) IsRecording() bool { return true }
+
+func (s *recordingSpan) AddEvent(name string, options ...trace.EventOption) {
+	config := trace.NewEventConfig(options...)
+	attrs := make(map[attribute.Key]attribute.Value)
+	for _, kv := range config.Attributes() {
+		attrs[kv.Key] = kv.Value
+	}
+	s.events = append(s.events, name)
+	s.eventAttrs = append(s.eventAttrs, attrs)
+}
+
+func (s *recordingSpan) SetAttributes(kv ...attribute.KeyValue) {
+	for _, attr := range kv {
+		s.attrs[attr.Key] = attr.Value
+	}
+}
+
+func TestOtelBreakerAnnotatesSpans(t *testing.T) {
+	b := breaker.NewBreaker(&breaker.Config{
+		MemoryThreshold:   100,
+		LatencyThreshold:  100,
+		LatencyWindowSize: 4,
+		Percentile:        0.95,
+		WaitTime:          10,
+	}, "")
+	driver := b.(*breaker.BreakerDriver)
+	setMemoryOverride(driver, true)
+	otelbreaker.Instrument(driver)
+
+	span := newRecordingSpan()
+	ctx := trace.ContextWithSpan(context.Background(), span)
+
+	require.True(t, driver.AllowCtx(ctx))
+
+	now := time.Now()
+	for i := 0; i < 4; i++ {
+		driver.DoneCtx(ctx, now.Add(-500*time.Millisecond), now)
+	}
+
+	require.False(t, driver.AllowCtx(ctx), "breaker should be open after slow requests")
+
+	require.Len(t, span.events, 6)
+	assert.Equal(t, otelbreaker.AllowEventName, span.events[0])
+	assert.Equal(t, otelbreaker.DoneEventName, span.events[1])
+	assert.Equal(t, otelbreaker.AllowEventName, span.events[5])
+
+	first := span.eventAttrs[0]
+	assert.Equal(t, otelbreaker.StateClosed, first["breaker.state"].AsString())
+	assert.True(t, first["breaker.allowed"].AsBool())
+
+	done := span.eventAttrs[1]
+	assert.Equal(t, int64(500), done["breaker.latency_ms"].AsInt64())
+
+	last := span.eventAttrs[5]
+	assert.Equal(t, otelbreaker.StateOpen, last["breaker.state"].AsString())
+	assert.False(t, last["breaker.allowed"].AsBool())
+	assert.Equal(t, int64(500), last["breaker.latency_percentile_ms"].AsInt64())
+	assert.True(t, span.attrs["breaker.rejected"].AsBool())
+}
+
+func TestOtelBreakerIgnoresContextWithoutSpan(t *testing.T) {
+	called := false
+	b := breaker.NewBreaker(&breaker.Config{
+		MemoryThreshold:   100,
+		LatencyThreshold:  100,
+		LatencyWindowSize: 4,
+		Percentile:        0.95,
+		WaitTime:          10,
+	}, "")
+	driver := b.(*breaker.BreakerDriver)
+	setMemoryOverride(driver, true)
+
+	hook := otelbreaker.Hook()
+	driver.SetDecisionHook(func(ctx context.Context, event breaker.DecisionEvent) {
+		called = true
+		hook(ctx, event)
+	})
+
+	assert.True(t, driver.AllowCtx(context.Background()))
+	assert.True(t, called, "the decision hook should run for AllowCtx")
+}
@@ -0,0 +1,82 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lrleon/go-breaker/breaker"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBreakerRegistry(t *testing.T) {
+	newConfig := func(name string) *breaker.Config {
+		return &breaker.Config{
+			Name:              name,
+			MemoryThreshold:   80,
+			LatencyThreshold:  100,
+			LatencyWindowSize: 10,
+			Percentile:        0.5,
+			WaitTime:          5,
+		}
+	}
+	dir := t.TempDir()
+
+	payments := breaker.NewBreaker(newConfig("registry-payments"), filepath.Join(dir, "payments.toml"))
+	defer payments.Close()
+	setMemoryOverride(payments, true)
+	search := breaker.NewBreaker(newConfig("registry-search"), filepath.Join(dir, "search.toml"))
+	defer search.Close()
+	unnamed := breaker.NewBreaker(newConfig(""), filepath.Join(dir, "unnamed.toml"))
+	defer unnamed.Close()
+
+	assert.Subset(t, breaker.ListBreakers(), []string{"registry-payments", "registry-search"})
+	assert.Same(t, payments, breaker.GetRegistered("registry-payments"))
+	assert.Nil(t, breaker.GetRegistered("registry-missing"))
+
+	end := time.Now()
+	payments.Done(end.Add(-time.Second), end)
+	require.True(t, payments.Triggered())
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	breaker.AddEndpointToRouter(router, &breaker.BreakerAPI{Driver: unnamed})
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/breaker/list", nil)
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var response struct {
+		Count    int                              `json:"count"`
+		Breakers []breaker.RegisteredBreakerState `json:"breakers"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, len(response.Breakers), response.Count)
+	states := make(map[string]breaker.RegisteredBreakerState)
+	for _, state := range response.Breakers {
+		states[state.Name] = state
+	}
+	require.Contains(t, states, "registry-payments")
+	assert.True(t, states["registry-payments"].Triggered)
+	assert.Equal(t, breaker.TripReasonLatency, states["registry-payments"].TripReason)
+	assert.Equal(t, filepath.Join(dir, "payments.toml"), states["registry-payments"].ConfigFile)
+	require.Contains(t, states, "registry-search")
+	assert.False(t, states["registry-search"].Triggered)
+
+	// A breaker registered again under the same name replaces the first one, which no
+	// longer unregisters it when closed
+	replacement := breaker.NewBreaker(newConfig("registry-search"), filepath.Join(dir, "search.toml"))
+	assert.Same(t, replacement, breaker.GetRegistered("registry-search"))
+	require.NoError(t, search.Close())
+	assert.Same(t, replacement, breaker.GetRegistered("registry-search"))
+
+	// Closing a breaker unregisters it
+	require.NoError(t, replacement.Close())
+	assert.Nil(t, breaker.GetRegistered("registry-search"))
+	assert.NotContains(t, breaker.ListBreakers(), "registry-search")
+}
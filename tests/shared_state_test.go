@@ -0,0 +1,248 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lrleon/go-breaker/breaker"
+	"github.com/lrleon/go-breaker/breaker/breakertest"
+	"github.com/lrleon/go-breaker/breaker/filestore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak"
+)
+
+// memoryStateStore is an in-process StateStore that keeps the last published state
+type memoryStateStore struct {
+	mu          sync.Mutex
+	handlers    map[int]func(breaker.SharedState)
+	nextHandler int
+	last        *breaker.SharedState
+}
+
+func newMemoryStateStore() *memoryStateStore {
+	return &memoryStateStore{handlers: make(map[int]func(breaker.SharedState))}
+}
+
+func (s *memoryStateStore) Publish(_ context.Context, state breaker.SharedState) error {
+	s.mu.Lock()
+	s.last = &state
+	handlers := make([]func(breaker.SharedState), 0, len(s.handlers))
+	for _, handler := range s.handlers {
+		handlers = append(handlers, handler)
+	}
+	s.mu.Unlock()
+
+	for _, handler := range handlers {
+		handler(state)
+	}
+	return nil
+}
+
+func (s *memoryStateStore) Subscribe(ctx context.Context, handler func(breaker.SharedState)) error {
+	s.mu.Lock()
+	id := s.nextHandler
+	s.nextHandler++
+	s.handlers[id] = handler
+	last := s.last
+	s.mu.Unlock()
+
+	if last != nil {
+		handler(*last)
+	}
+	<-ctx.Done()
+
+	s.mu.Lock()
+	delete(s.handlers, id)
+	s.mu.Unlock()
+	return nil
+}
+
+func honoringSharedTrips(config *breaker.Config) {
+	config.HonorSharedTrips = true
+	config.WaitTime = 60
+}
+
+func TestSharedStateStore(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	store := newMemoryStateStore()
+
+	tripping := breakertest.NewTestBreaker(breakertest.WithConfig(honoringSharedTrips))
+	honoring := breakertest.NewTestBreaker(breakertest.WithConfig(honoringSharedTrips))
+	ignoring := breakertest.NewTestBreaker(breakertest.WithWaitTime(60))
+	for _, b := range []*breaker.BreakerDriver{tripping, honoring, ignoring} {
+		b.SetStateStore(store)
+	}
+
+	require.NoError(t, breakertest.TriggerByLatency(tripping))
+	assert.False(t, tripping.RemoteTrip(), "A local trip is not a remote trip")
+
+	assert.Eventually(t, honoring.RemoteTrip, time.Second, 5*time.Millisecond,
+		"A breaker honoring shared trips should open when another replica trips")
+	assert.Equal(t, breaker.TripReasonRemote, honoring.TripReason())
+	assert.False(t, honoring.Allow())
+	assert.True(t, ignoring.Allow(), "A breaker without honor_shared_trips should ignore other replicas")
+
+	// The breaker that tripped closes the others when it resets
+	tripping.Reset()
+	assert.Eventually(t, func() bool { return !honoring.Triggered() }, time.Second, 5*time.Millisecond)
+	assert.True(t, honoring.Allow())
+
+	// A remote reset does not close a breaker that tripped by itself
+	require.NoError(t, breakertest.TriggerByLatency(honoring))
+	require.NoError(t, breakertest.TriggerByLatency(tripping))
+	tripping.Reset()
+	time.Sleep(50 * time.Millisecond)
+	assert.True(t, honoring.Triggered())
+	assert.False(t, honoring.RemoteTrip())
+
+	for _, b := range []*breaker.BreakerDriver{tripping, honoring, ignoring} {
+		assert.NoError(t, b.Close())
+	}
+}
+
+// slowTripStateStore records the published states and takes longer to publish trips
+// than resets, so that concurrent publications would land out of order
+type slowTripStateStore struct {
+	mu        sync.Mutex
+	published []breaker.SharedState
+}
+
+func (s *slowTripStateStore) Publish(_ context.Context, state breaker.SharedState) error {
+	if state.Triggered {
+		time.Sleep(50 * time.Millisecond)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.published = append(s.published, state)
+	return nil
+}
+
+func (s *slowTripStateStore) Subscribe(ctx context.Context, _ func(breaker.SharedState)) error {
+	<-ctx.Done()
+	return nil
+}
+
+func TestSharedStatesArePublishedInOrder(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	store := &slowTripStateStore{}
+	b := breakertest.NewTestBreaker(breakertest.WithWaitTime(60))
+	b.SetStateStore(store)
+
+	require.NoError(t, breakertest.TriggerByLatency(b))
+	b.Reset()
+	require.NoError(t, b.Close()) // Waits for the pending publications
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	require.Len(t, store.published, 2)
+	assert.True(t, store.published[0].Triggered, "The trip should be published first")
+	assert.False(t, store.published[1].Triggered, "The reset should not overtake the trip")
+}
+
+func TestFileStateStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "breaker.json")
+	newStore := func() *filestore.Store {
+		return filestore.New(path, filestore.WithDebounce(10*time.Millisecond),
+			filestore.WithPollInterval(10*time.Millisecond))
+	}
+
+	// Each breaker has its own store, as if it ran in another process
+	tripping := breakertest.NewTestBreaker(breakertest.WithConfig(honoringSharedTrips))
+	defer tripping.Close()
+	honoring := breakertest.NewTestBreaker(breakertest.WithConfig(honoringSharedTrips))
+	defer honoring.Close()
+	tripping.SetStateStore(newStore())
+	honoring.SetStateStore(newStore())
+
+	require.NoError(t, breakertest.TriggerByLatency(tripping))
+	assert.Eventually(t, honoring.RemoteTrip, 2*time.Second, 10*time.Millisecond,
+		"The trip should reach the other replica through the file")
+
+	// A replica that starts while the trip is still in effect honors it
+	late := breakertest.NewTestBreaker(breakertest.WithConfig(honoringSharedTrips))
+	defer late.Close()
+	late.SetStateStore(newStore())
+	assert.Eventually(t, late.RemoteTrip, 2*time.Second, 10*time.Millisecond,
+		"A new replica should honor the saved trip")
+
+	tripping.Reset()
+	assert.Eventually(t, func() bool { return !honoring.Triggered() && !late.Triggered() },
+		2*time.Second, 10*time.Millisecond)
+}
+
+func TestFileStateStoreDebouncesSaves(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "breaker.json")
+	store := filestore.New(path, filestore.WithDebounce(time.Hour))
+
+	var delivered []breaker.SharedState
+	ctx, cancel := context.WithCancel(context.Background())
+	subscribed := make(chan struct{})
+	go func() {
+		defer close(subscribed)
+		_ = store.Subscribe(ctx, func(state breaker.SharedState) { delivered = append(delivered, state) })
+	}()
+	time.Sleep(20 * time.Millisecond) // Let the subscription start
+
+	tripTime := time.Now().Truncate(time.Second)
+	for _, triggered := range []bool{true, false, true} {
+		require.NoError(t, store.Publish(ctx, breaker.SharedState{Triggered: triggered, TripTime: tripTime, Source: "a"}))
+	}
+	cancel()
+	<-subscribed
+
+	// Subscribers see every state at once, but nothing is written before the debounce
+	assert.Len(t, delivered, 3)
+	_, err := os.Stat(path)
+	assert.True(t, os.IsNotExist(err), "No state should be saved before the debounce")
+
+	// Closing saves the latest state only
+	require.NoError(t, store.Close())
+	payload, err := os.ReadFile(path)
+	require.NoError(t, err)
+	var saved breaker.SharedState
+	require.NoError(t, json.Unmarshal(payload, &saved))
+	assert.True(t, saved.Triggered)
+	assert.True(t, saved.TripTime.Equal(tripTime))
+
+	// No temporary files are left behind
+	entries, err := os.ReadDir(filepath.Dir(path))
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
+
+func TestFileStateStoreFallsBackToMemory(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.Chmod(dir, 0o500))
+	defer os.Chmod(dir, 0o700)
+	if err := os.WriteFile(filepath.Join(dir, "probe"), nil, 0o600); err == nil {
+		t.Skip("the directory is still writable (running as root?)")
+	}
+
+	var logs strings.Builder
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	store := filestore.New(filepath.Join(dir, "breaker.json"), filestore.WithDebounce(0))
+	b := breakertest.NewTestBreaker(breakertest.WithConfig(honoringSharedTrips))
+	defer b.Close()
+	b.SetStateStore(store)
+
+	// The trips still work, and the failed writes are reported once
+	for i := 0; i < 3; i++ {
+		require.NoError(t, breakertest.TriggerByLatency(b))
+		b.Reset()
+	}
+	assert.Eventually(t, store.MemoryOnly, 2*time.Second, 10*time.Millisecond)
+	b.SetStateStore(nil) // Waits for the pending publications
+	assert.Equal(t, 1, strings.Count(logs.String(), "keeping the breaker state in memory only"))
+}
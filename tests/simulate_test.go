@@ -0,0 +1,96 @@
+package tests
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lrleon/go-breaker/breaker"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// simulatedTrace returns one record per second from start: fast latencies, a slow period
+// from second 10 to 17 and fast latencies again until second 25
+func simulatedTrace(start time.Time) []breaker.LatencyRecord {
+	var records []breaker.LatencyRecord
+	for second := 0; second <= 25; second++ {
+		latency := 50 * time.Millisecond
+		if second >= 10 && second <= 17 {
+			latency = 500 * time.Millisecond
+		}
+		records = append(records, breaker.LatencyRecord{
+			Value:     int64(latency),
+			Timestamp: start.Add(time.Duration(second) * time.Second),
+		})
+	}
+	return records
+}
+
+func TestSimulate(t *testing.T) {
+	// A trace captured long ago: the simulation only uses the timestamps of the records
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	records := simulatedTrace(start)
+	config := &breaker.Config{
+		MemoryThreshold:   80,
+		LatencyThreshold:  100,
+		LatencyWindowSize: 10,
+		Percentile:        0.5,
+		WaitTime:          5,
+	}
+
+	events := breaker.Simulate(records, config)
+	require.Len(t, events, 2)
+	assert.Equal(t, breaker.SimEvent{
+		Type:                breaker.EventTripped,
+		Time:                start.Add(12 * time.Second),
+		Reason:              breaker.TripReasonLatency,
+		LatencyPercentileMs: 500,
+	}, events[0])
+	assert.Equal(t, breaker.SimEvent{
+		Type:                breaker.EventReset,
+		Time:                start.Add(18 * time.Second),
+		Reason:              breaker.ResetReasonWaitTime,
+		LatencyPercentileMs: 50,
+		Rejected:            5,
+	}, events[1], "The records within the wait time are rejected")
+
+	// The order of the records does not matter, and the result is always the same
+	shuffled := append([]breaker.LatencyRecord(nil), records...)
+	for i, j := 0, len(shuffled)-1; i < j; i, j = i+1, j-1 {
+		shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+	}
+	assert.Equal(t, events, breaker.Simulate(shuffled, config))
+
+	// With recovery_consecutive_checks, that many trial records, one per second, must be
+	// fast before the breaker resets
+	config.RecoveryConsecutiveChecks = 3
+	events = breaker.Simulate(records, config)
+	require.Len(t, events, 2)
+	assert.Equal(t, start.Add(20*time.Second), events[1].Time)
+	assert.Equal(t, 5, events[1].Rejected)
+	config.RecoveryConsecutiveChecks = 0
+
+	// Without a wait time, latencies are kept for five minutes: the slow ones fail the
+	// trials until the fast trials bring the percentile back below the threshold, instead
+	// of letting the breaker flap
+	config.WaitTime = 0
+	events = breaker.Simulate(records, config)
+	require.Len(t, events, 2)
+	assert.Equal(t, breaker.EventTripped, events[0].Type)
+	assert.Equal(t, start.Add(22*time.Second), events[1].Time)
+	assert.Equal(t, int64(50), events[1].LatencyPercentileMs)
+	config.WaitTime = 5
+
+	// The breach has to last breach_duration_seconds
+	config.BreachDurationSeconds = 2
+	events = breaker.Simulate(records, config)
+	require.NotEmpty(t, events)
+	assert.Equal(t, start.Add(14*time.Second), events[0].Time)
+
+	// A higher threshold never trips
+	config.LatencyThreshold = 1000
+	assert.Empty(t, breaker.Simulate(records, config))
+
+	config.Percentile = 2
+	assert.Nil(t, breaker.Simulate(records, config), "Invalid configurations give no events")
+}
@@ -3,10 +3,15 @@
 package tests
 
 import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/gin-gonic/gin"
 	"github.com/lrleon/go-breaker/breaker"
+	"github.com/lrleon/go-breaker/breaker/breakertest"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -35,6 +40,21 @@ func TestStagedAlertManagerInitialization(t *testing.T) {
 
 // TestStagedAlertFlow verifies the complete flow of staged alerts
 func TestStagedAlertFlow(t *testing.T) {
+	// Record the alerts instead of sending them
+	breaker.SetTestMode(true)
+	t.Cleanup(func() { breaker.SetTestMode(false) })
+	resetOpsGenieClient(t)
+
+	recorded := func(alertType string) []breaker.Alert {
+		var alerts []breaker.Alert
+		for _, alert := range breaker.RecordedAlerts() {
+			if alert.Type == alertType {
+				alerts = append(alerts, alert)
+			}
+		}
+		return alerts
+	}
+
 	// Test configuration with short times
 	opsGenieConfig := &breaker.OpsGenieConfig{
 		Enabled:                true,
@@ -45,7 +65,6 @@ func TestStagedAlertFlow(t *testing.T) {
 		TriggerOnReset:         true,
 		APIKey:                 "test-key",
 		Team:                   "test-team",
-		AlertCooldownSeconds:   1,
 	}
 
 	breakerConfig := &breaker.Config{
@@ -69,7 +88,7 @@ func TestStagedAlertFlow(t *testing.T) {
 	// we will verify through behavior
 
 	// Configure memory to not interfere
-	breaker.SetMemoryOK(driver, true)
+	setMemoryOverride(driver, true)
 
 	t.Run("InitialAlertSent", func(t *testing.T) {
 		// Reset the breaker
@@ -85,26 +104,29 @@ func TestStagedAlertFlow(t *testing.T) {
 		}
 
 		// Verify that the breaker was triggered
-		assert.True(t, b.TriggeredByLatencies(), "The breaker should be triggered")
+		assert.True(t, b.Triggered(), "The breaker should be triggered")
 
 		// Give time for the initial alert to be processed
 		time.Sleep(500 * time.Millisecond)
 
-		// At this point, the initial alert should have been sent
-		// We cannot verify directly without mocking OpsGenie,
-		// but we verify that the breaker is still triggered
-		assert.True(t, b.TriggeredByLatencies(), "The breaker should still be triggered")
+		// At this point, the initial low-priority alert should have been sent
+		require.Eventually(t, func() bool { return len(recorded("circuit-open")) > 0 }, 2*time.Second, 50*time.Millisecond)
+		initial := recorded("circuit-open")[0]
+		assert.Equal(t, "P3", initial.Priority)
+		assert.Contains(t, initial.Tags, "reason:"+b.TripReason())
+		assert.Equal(t, "test-team", initial.Details["Team"])
+		assert.True(t, b.Triggered(), "The breaker should still be triggered")
 	})
 
 	t.Run("EscalationAfterTime", func(t *testing.T) {
 		// The breaker is already triggered from the previous test
-		assert.True(t, b.TriggeredByLatencies(), "The breaker should be triggered")
+		assert.True(t, b.Triggered(), "The breaker should be triggered")
 
 		// Wait more than the escalation time
 		time.Sleep(time.Duration(opsGenieConfig.TimeBeforeSendAlert+1) * time.Second)
 
 		// Verify that the breaker is still triggered (for escalation)
-		assert.True(t, b.TriggeredByLatencies(), "The breaker should still be triggered for escalation")
+		assert.True(t, b.Triggered(), "The breaker should still be triggered for escalation")
 
 		// Give additional time for escalation processing
 		time.Sleep(500 * time.Millisecond)
@@ -115,10 +137,10 @@ func TestStagedAlertFlow(t *testing.T) {
 		b.Reset()
 
 		// Verify that it is no longer triggered
-		assert.False(t, b.TriggeredByLatencies(), "The breaker should not be triggered after reset")
+		assert.False(t, b.Triggered(), "The breaker should not be triggered after reset")
 
-		// Give time for the resolution to be processed
-		time.Sleep(500 * time.Millisecond)
+		// The reset alert is sent when the breaker is reset manually
+		assert.Eventually(t, func() bool { return len(recorded("circuit-reset")) > 0 }, 2*time.Second, 50*time.Millisecond)
 	})
 
 	// Cleanup
@@ -152,14 +174,16 @@ func TestStagedAlertRecovery(t *testing.T) {
 
 	b := breaker.NewBreaker(breakerConfig, "test_staged_recovery.toml")
 	driver := b.(*breaker.BreakerDriver)
-	breaker.SetMemoryOK(driver, true)
+	setMemoryOverride(driver, true)
+	clock := breaker.NewMockClock(time.Now())
+	driver.SetClock(clock)
 
 	t.Run("TriggerBreaker", func(t *testing.T) {
 		// Reset to ensure a clean state
 		b.Reset()
 
 		// Trigger the breaker with consistently high latencies
-		now := time.Now()
+		now := clock.Now()
 		for i := 0; i < 10; i++ {
 			latency := 400 + i*10 // 400ms to 490ms - all above the 300ms threshold
 			startTime := now.Add(time.Duration(i)*time.Second - time.Duration(latency)*time.Millisecond)
@@ -167,25 +191,25 @@ func TestStagedAlertRecovery(t *testing.T) {
 			b.Done(startTime, endTime)
 		}
 
-		assert.True(t, b.TriggeredByLatencies(), "The breaker should be triggered")
+		assert.True(t, b.Triggered(), "The breaker should be triggered")
 		t.Logf("Breaker triggered correctly with high latencies")
 	})
 
 	t.Run("AutomaticRecovery", func(t *testing.T) {
 		// Verify that the breaker is triggered before starting
-		assert.True(t, b.TriggeredByLatencies(), "The breaker should be triggered at the start of the test")
+		assert.True(t, b.Triggered(), "The breaker should be triggered at the start of the test")
 
 		// Wait for the breaker's wait time
 		waitDuration := time.Duration(breakerConfig.WaitTime) * time.Second
 		t.Logf("Waiting %v for the breaker to recover...", waitDuration)
-		time.Sleep(waitDuration + 500*time.Millisecond) // A bit more to ensure
+		clock.Advance(waitDuration + 500*time.Millisecond) // A bit more to ensure
 
 		// Verify that it is still triggered (because we haven't added good latencies)
-		assert.True(t, b.TriggeredByLatencies(), "The breaker should still be triggered without new latencies")
+		assert.True(t, b.Triggered(), "The breaker should still be triggered without new latencies")
 
 		// Now simulate recovery by adding low latencies
 		t.Logf("Adding low latencies to simulate recovery...")
-		now := time.Now()
+		now := clock.Now()
 		for i := 0; i < 15; i++ { // More samples to ensure the percentile goes down
 			latency := 100 + i*5 // 100ms to 170ms - all below the 300ms threshold
 			startTime := now.Add(time.Duration(i)*100*time.Millisecond - time.Duration(latency)*time.Millisecond)
@@ -211,7 +235,7 @@ func TestStagedAlertRecovery(t *testing.T) {
 			// If Allow returns true, it means the breaker has recovered
 			if allowed {
 				// Verify the state again
-				isTriggered := b.TriggeredByLatencies()
+				isTriggered := b.Triggered()
 				t.Logf("Final breaker state: Triggered=%v", isTriggered)
 				assert.False(t, isTriggered, "The breaker should have recovered")
 			} else {
@@ -221,7 +245,7 @@ func TestStagedAlertRecovery(t *testing.T) {
 				// Try to manually reset for this test
 				t.Logf("Performing manual reset to continue the test...")
 				b.Reset()
-				assert.False(t, b.TriggeredByLatencies(), "The breaker should be reset after manual reset")
+				assert.False(t, b.Triggered(), "The breaker should be reset after manual reset")
 			}
 		} else {
 			t.Logf("Recovery conditions not met yet: MemoryOK=%v, LatencyOK=%v", memoryOK, latencyOK)
@@ -229,7 +253,7 @@ func TestStagedAlertRecovery(t *testing.T) {
 			// In this case, do a manual reset to complete the test
 			t.Logf("Performing manual reset to complete the test...")
 			b.Reset()
-			assert.False(t, b.TriggeredByLatencies(), "The breaker should be reset after manual reset")
+			assert.False(t, b.Triggered(), "The breaker should be reset after manual reset")
 		}
 	})
 }
@@ -247,7 +271,7 @@ func TestStagedAlertWithoutOpsGenie(t *testing.T) {
 
 	b := breaker.NewBreaker(breakerConfig, "test_no_opsgenie.toml")
 	driver := b.(*breaker.BreakerDriver)
-	breaker.SetMemoryOK(driver, true)
+	setMemoryOverride(driver, true)
 
 	// Trigger the breaker
 	now := time.Now()
@@ -259,7 +283,7 @@ func TestStagedAlertWithoutOpsGenie(t *testing.T) {
 	}
 
 	// The breaker should trigger normally
-	assert.True(t, b.TriggeredByLatencies(), "The breaker should trigger without OpsGenie")
+	assert.True(t, b.Triggered(), "The breaker should trigger without OpsGenie")
 
 	// There should be no staged alert manager
 	// This would be verified indirectly by the absence of staged alert logs
@@ -316,7 +340,7 @@ func TestStagedAlertConfiguration(t *testing.T) {
 
 			// Verify that the breaker works regardless of the configuration
 			driver := b.(*breaker.BreakerDriver)
-			breaker.SetMemoryOK(driver, true)
+			setMemoryOverride(driver, true)
 
 			// Trigger the breaker
 			now := time.Now()
@@ -327,11 +351,263 @@ func TestStagedAlertConfiguration(t *testing.T) {
 				b.Done(startTime, endTime)
 			}
 
-			assert.True(t, b.TriggeredByLatencies(), "The breaker should trigger in %s", tc.name)
+			assert.True(t, b.Triggered(), "The breaker should trigger in %s", tc.name)
 		})
 	}
 }
 
+// TestPriorityEscalationLadder verifies the validation of the ladder and that a breaker
+// that stays open climbs it
+func TestPriorityEscalationLadder(t *testing.T) {
+	t.Run("Validation", func(t *testing.T) {
+		config := &breaker.OpsGenieConfig{
+			PriorityEscalationLadder: []breaker.PriorityEscalationStep{
+				{AfterSeconds: 60, Priority: "P3"},
+				{AfterSeconds: 300, Priority: "P2"},
+				{AfterSeconds: 900, Priority: "P1"},
+			},
+		}
+		assert.NoError(t, breaker.ValidateOpsGenieConfig(config))
+
+		config.PriorityEscalationLadder[2].AfterSeconds = 300
+		err := breaker.ValidateOpsGenieConfig(config)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "priority_escalation_ladder[2].after_seconds")
+
+		config.PriorityEscalationLadder[2] = breaker.PriorityEscalationStep{AfterSeconds: 900, Priority: "P0"}
+		assert.Error(t, breaker.ValidateOpsGenieConfig(config))
+	})
+
+	t.Run("Escalation", func(t *testing.T) {
+		config := &breaker.OpsGenieConfig{
+			Enabled:              true,
+			TimeBeforeSendAlert:  1,
+			InitialAlertPriority: "P4",
+			PriorityEscalationLadder: []breaker.PriorityEscalationStep{
+				{AfterSeconds: 1, Priority: "P3"},
+				{AfterSeconds: 2, Priority: "P1"},
+			},
+		}
+		manager := breaker.NewStagedAlertManager(config, breaker.NewOpsGenieClient(config))
+		defer manager.Stop()
+		clock := breaker.NewMockClock(time.Now())
+		manager.SetClock(clock)
+
+		b := breakertest.NewTestBreaker(breakertest.WithWaitTime(60))
+		defer b.Close()
+		require.NoError(t, breakertest.TriggerByLatency(b))
+
+		manager.OnBreakerTriggered(&breaker.AlertContext{TriggerTime: clock.Now()}, b)
+		ladderStep := func() interface{} {
+			for _, info := range manager.GetPendingAlertsInfo() {
+				return info["ladder_step"]
+			}
+			return nil
+		}
+		manager.CheckPendingAlerts()
+		assert.Equal(t, 0, ladderStep(), "No step is due yet")
+
+		// Both steps are reached by the next check, which sends only the highest one
+		clock.Advance(3 * time.Second)
+		manager.CheckPendingAlerts()
+		assert.Equal(t, 2, ladderStep())
+	})
+}
+
+// TestStagedAlertsAreAggregated verifies that the open alerts of staged alerting go
+// through the aggregation window, keeping their priority and correlation IDs
+func TestStagedAlertsAreAggregated(t *testing.T) {
+	config := &breaker.OpsGenieConfig{
+		Enabled:                 true,
+		Priority:                "P2",
+		TriggerOnOpen:           true,
+		Team:                    "test-team",
+		TimeBeforeSendAlert:     60,
+		InitialAlertPriority:    "P4",
+		AlertAggregationSeconds: 60,
+	}
+	client := breaker.NewOpsGenieClient(config)
+	recorder := breaker.NewRecordingNotifier()
+	client.SetNotifier(recorder)
+	manager := breaker.NewStagedAlertManager(config, client)
+	defer manager.Stop()
+
+	b := breakertest.NewTestBreaker()
+	defer b.Close()
+	for _, correlationID := range []string{"req-1", "req-2"} {
+		manager.OnBreakerTriggered(&breaker.AlertContext{
+			TriggerTime:   time.Now(),
+			TriggerReason: breaker.TripReasonLatency,
+			CorrelationID: correlationID,
+		}, b)
+	}
+
+	initialAlertsSent := func() bool {
+		for _, info := range manager.GetPendingAlertsInfo() {
+			if info["initial_alert_sent"] != true {
+				return false
+			}
+		}
+		return true
+	}
+	require.Eventually(t, initialAlertsSent, time.Second, 5*time.Millisecond)
+	assert.Empty(t, recorder.RecordedAlerts(), "The initial alerts wait for the aggregation window")
+
+	require.NoError(t, client.FlushAggregatedAlerts())
+	alerts := recorder.RecordedAlerts()
+	require.Len(t, alerts, 1)
+	assert.Equal(t, "2", alerts[0].Details["Trip Count"])
+	assert.Equal(t, "P4", alerts[0].Priority, "The initial alerts keep initial_alert_priority")
+	assert.Equal(t, "req-1, req-2", alerts[0].Details["Correlation IDs"])
+}
+
+// TestCoalescedTripsInEscalatedAlert verifies that the escalated alert reports the trips
+// coalesced into its pending alert
+func TestCoalescedTripsInEscalatedAlert(t *testing.T) {
+	config := &breaker.OpsGenieConfig{
+		Enabled:                true,
+		TriggerOnOpen:          true,
+		Team:                   "test-team",
+		TimeBeforeSendAlert:    1,
+		InitialAlertPriority:   "P4",
+		EscalatedAlertPriority: "P1",
+		MaxPendingAlerts:       1,
+	}
+	client := breaker.NewOpsGenieClient(config)
+	recorder := breaker.NewRecordingNotifier()
+	client.SetNotifier(recorder)
+	manager := breaker.NewStagedAlertManager(config, client)
+	defer manager.Stop()
+	clock := breaker.NewMockClock(time.Now())
+	manager.SetClock(clock)
+
+	b := breakertest.NewTestBreaker(breakertest.WithWaitTime(60))
+	defer b.Close()
+	require.NoError(t, breakertest.TriggerByLatency(b))
+	manager.OnBreakerTriggered(&breaker.AlertContext{TriggerTime: clock.Now()}, b)
+	require.Eventually(t, func() bool { return len(recorder.RecordedAlerts()) == 1 }, time.Second, 5*time.Millisecond)
+	assert.NotContains(t, recorder.RecordedAlerts()[0].Details, "Coalesced Trips", "Nothing was coalesced yet")
+
+	for i := 0; i < 3; i++ {
+		manager.OnBreakerTriggered(&breaker.AlertContext{TriggerTime: clock.Now()}, b)
+	}
+	recorder.Reset()
+	clock.Advance(2 * time.Second)
+	manager.CheckPendingAlerts()
+	require.Eventually(t, func() bool { return len(recorder.RecordedAlerts()) == 1 }, time.Second, 5*time.Millisecond)
+	escalated := recorder.RecordedAlerts()[0]
+	assert.Equal(t, "P1", escalated.Priority)
+	assert.Equal(t, "3", escalated.Details["Coalesced Trips"])
+	assert.Contains(t, escalated.Description, "The breaker tripped 3 more times while this alert was pending")
+}
+
+// TestStagedAlertsMaxPending verifies that a flapping breaker does not grow the pending
+// alerts past max_pending_alerts
+func TestStagedAlertsMaxPending(t *testing.T) {
+	config := &breaker.OpsGenieConfig{
+		Enabled:             true,
+		TimeBeforeSendAlert: 60,
+		MaxPendingAlerts:    3,
+	}
+	manager := breaker.NewStagedAlertManager(config, breaker.NewOpsGenieClient(config))
+	defer manager.Stop()
+
+	b := breakertest.NewTestBreaker()
+	defer b.Close()
+
+	for i := 0; i < 100; i++ {
+		manager.OnBreakerTriggered(&breaker.AlertContext{TriggerTime: time.Now()}, b)
+	}
+	assert.Equal(t, 3, manager.GetPendingAlertsCount())
+
+	// The trips past the cap are coalesced into the pending alerts
+	coalesced := 0
+	for _, info := range manager.GetPendingAlertsInfo() {
+		coalesced += info["coalesced_trips"].(int)
+	}
+	assert.Equal(t, 97, coalesced)
+
+	// Without max_pending_alerts the default cap applies
+	config.MaxPendingAlerts = 0
+	for i := 0; i < 100; i++ {
+		manager.OnBreakerTriggered(&breaker.AlertContext{TriggerTime: time.Now()}, b)
+	}
+	assert.Equal(t, 10, manager.GetPendingAlertsCount())
+
+	config.MaxPendingAlerts = -1
+	assert.Error(t, breaker.ValidateOpsGenieConfig(config))
+}
+
+// TestResolvePendingAlerts verifies that pending alerts can be resolved by ID or all at
+// once, through the manager and through /breaker/opsgenie/resolve-pending
+func TestResolvePendingAlerts(t *testing.T) {
+	breaker.SetTestMode(true)
+	t.Cleanup(func() { breaker.SetTestMode(false) })
+
+	config := &breaker.OpsGenieConfig{
+		Enabled:             true,
+		TimeBeforeSendAlert: 60,
+		TriggerOnOpen:       true,
+		Team:                "test-team",
+	}
+	manager := breaker.NewStagedAlertManager(config, breaker.NewOpsGenieClient(config))
+	defer manager.Stop()
+
+	b := breakertest.NewTestBreaker()
+	defer b.Close()
+	for i := 0; i < 3; i++ {
+		manager.OnBreakerTriggered(&breaker.AlertContext{TriggerTime: time.Now()}, b)
+	}
+	require.Equal(t, 3, manager.GetPendingAlertsCount())
+
+	var alertID string
+	for id := range manager.GetPendingAlertsInfo() {
+		alertID = id
+	}
+	assert.Equal(t, 1, manager.ResolvePendingAlerts(alertID))
+	assert.Equal(t, 0, manager.ResolvePendingAlerts(alertID), "Already resolved")
+	assert.Equal(t, 2, manager.ResolvePendingAlerts(""))
+	assert.Equal(t, 0, manager.GetPendingAlertsCount())
+
+	breakerAPI := breaker.NewBreakerAPI(&breaker.Config{
+		MemoryThreshold:   80,
+		LatencyThreshold:  100,
+		LatencyWindowSize: 10,
+		Percentile:        0.95,
+		WaitTime:          600,
+		OpsGenie:          config,
+	})
+	defer breakerAPI.Driver.Close()
+	setMemoryOverride(breakerAPI.Driver, true)
+	driver := breakerAPI.Driver.(*breaker.BreakerDriver)
+
+	end := time.Now()
+	driver.Done(end.Add(-250*time.Millisecond), end)
+	require.True(t, driver.Triggered())
+	require.Eventually(t, func() bool {
+		return driver.GetStagedAlertInfo()["pending_alerts_count"] == 1
+	}, time.Second, 10*time.Millisecond)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	breaker.AddEndpointToRouter(router, breakerAPI)
+	resolve := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/breaker/opsgenie/resolve-pending", strings.NewReader(body))
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := resolve(`{"alert_id": "unknown"}`)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = resolve("")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"resolved":1`)
+	assert.Equal(t, 0, driver.GetStagedAlertInfo()["pending_alerts_count"])
+	assert.True(t, driver.Triggered(), "The breaker itself is left alone")
+}
+
 // BenchmarkStagedAlertPerformance verifies that the system does not significantly affect performance
 func BenchmarkStagedAlertPerformance(b *testing.B) {
 	opsGenieConfig := &breaker.OpsGenieConfig{
@@ -356,7 +632,7 @@ func BenchmarkStagedAlertPerformance(b *testing.B) {
 	// Change variable name to avoid conflict
 	circuitBreaker := breaker.NewBreaker(breakerConfig, "bench_staged_alerts.toml")
 	driver := circuitBreaker.(*breaker.BreakerDriver)
-	breaker.SetMemoryOK(driver, true)
+	setMemoryOverride(driver, true)
 
 	b.ResetTimer()
 
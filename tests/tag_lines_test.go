@@ -0,0 +1,308 @@
+package tests
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/BurntSushi/toml"
+	"github.com/lrleon/go-breaker/breaker"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Layout flags of the tag arrays built by buildTagsTOML
+const (
+	layoutMultiLine     = 1 << iota // One tag per line instead of all tags on one line
+	layoutComments                  // Trailing comments after the tags
+	layoutLiteral                   // Literal ('...') strings where the tag allows it
+	layoutTrailingComma             // A comma after the last tag
+	layoutBlankLines                // Blank and comment lines between the tags
+	layoutDecoy                     // Fake tags in comments and multi-line strings before the real ones
+	layoutDotted                    // opsgenie.tags at the root instead of a [opsgenie] section
+)
+
+// tomlBasicString quotes s as a TOML basic string
+func tomlBasicString(s string) string {
+	var sb strings.Builder
+	sb.WriteByte('"')
+	for _, r := range s {
+		switch {
+		case r == '"' || r == '\\':
+			sb.WriteByte('\\')
+			sb.WriteRune(r)
+		case r < 0x20 || r == 0x7f:
+			fmt.Fprintf(&sb, `\u%04X`, r)
+		default:
+			sb.WriteRune(r)
+		}
+	}
+	sb.WriteByte('"')
+	return sb.String()
+}
+
+// tomlString quotes s as a literal string if the layout asks for it and s allows it
+func tomlString(s string, layout byte) string {
+	if layout&layoutLiteral != 0 && !strings.ContainsAny(s, "'\r\n\x7f") && !strings.ContainsFunc(s, func(r rune) bool {
+		return r < 0x20 && r != '\t'
+	}) {
+		return "'" + s + "'"
+	}
+	return tomlBasicString(s)
+}
+
+// buildTagsTOML returns a config file defining tags with the given layout, and the line
+// where each tag is defined
+func buildTagsTOML(tags []string, layout byte) (string, []int) {
+	var lines []string
+	var tagLines []int
+	add := func(line string) {
+		lines = append(lines, line)
+	}
+
+	add("# Breaker configuration")
+	add("memory_threshold = 80.0")
+	if layout&layoutDecoy != 0 {
+		add(`# tags = ["decoy"]`)
+		add(`description = """`)
+		add("[opsgenie]")
+		add(`tags = ["decoy", "more"]`)
+		add(`"""`)
+		add(`note = 'tags = ["decoy"] # [opsgenie]'`)
+	}
+
+	key := "tags"
+	if layout&layoutDotted != 0 {
+		key = "opsgenie.tags"
+		add("opsgenie.enabled = false")
+	} else {
+		add("[ opsgenie ] # Alerts")
+		add("enabled = false")
+	}
+
+	comment := func(i int) string {
+		if layout&layoutComments == 0 {
+			return ""
+		}
+		return fmt.Sprintf(` # tag %d, "quoted", [bracketed]`, i)
+	}
+
+	if layout&layoutMultiLine == 0 {
+		quoted := make([]string, len(tags))
+		for i, tag := range tags {
+			quoted[i] = tomlString(tag, layout)
+			tagLines = append(tagLines, len(lines)+1)
+		}
+		trailing := ""
+		if layout&layoutTrailingComma != 0 && len(tags) > 0 {
+			trailing = ","
+		}
+		add(key + " = [" + strings.Join(quoted, ", ") + trailing + "]" + comment(0))
+	} else {
+		add(key + " = [" + comment(0))
+		for i, tag := range tags {
+			if layout&layoutBlankLines != 0 {
+				add("")
+				add(fmt.Sprintf(`  # "commented", 'tag' %d`, i))
+			}
+			sep := ","
+			if i == len(tags)-1 && layout&layoutTrailingComma == 0 {
+				sep = ""
+			}
+			tagLines = append(tagLines, len(lines)+1)
+			add("  " + tomlString(tag, layout) + sep + comment(i+1))
+		}
+		add("]")
+	}
+	add("priority = \"P3\"")
+
+	if layout&layoutDotted == 0 {
+		add("")
+		add("[other]")
+		add(`tags = ["not", "opsgenie"]`)
+	}
+	return strings.Join(lines, "\n") + "\n", tagLines
+}
+
+// checkTagLines verifies that the loader maps every tag of content to its line
+func checkTagLines(t *testing.T, content string, tags []string, expectedLines []int) {
+	t.Helper()
+
+	var decoded struct {
+		OpsGenie struct {
+			Tags []string `toml:"tags"`
+		} `toml:"opsgenie"`
+	}
+	_, err := toml.Decode(content, &decoded)
+	require.NoError(t, err, content)
+	require.Equal(t, len(tags), len(decoded.OpsGenie.Tags), content)
+	for i := range tags {
+		require.Equal(t, tags[i], decoded.OpsGenie.Tags[i], content)
+	}
+
+	path := filepath.Join(t.TempDir(), "breakers.toml")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	loader, err := breaker.NewTOMLConfigLoader(path)
+	require.NoError(t, err)
+
+	lines := loader.TagLines()
+	if len(expectedLines) == 0 {
+		require.Empty(t, lines, content)
+		return
+	}
+	require.Equal(t, expectedLines, lines, content)
+}
+
+func TestTagLinesEdgeCases(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		tags    []string
+		lines   []int
+	}{
+		{
+			name: "commented tags",
+			content: `[opsgenie]
+# tags = ["old"]
+tags = [
+  # "disabled",
+  "a", # "b",
+  "c"
+]
+`,
+			tags:  []string{"a", "c"},
+			lines: []int{5, 6},
+		},
+		{
+			name: "commas and brackets in quotes",
+			content: `[opsgenie]
+tags = ["team:a,b", 'path:[x]', "say \"hi, there\"",
+  "last]"]
+`,
+			tags:  []string{"team:a,b", "path:[x]", `say "hi, there"`, "last]"},
+			lines: []int{2, 2, 2, 3},
+		},
+		{
+			name: "multi-line string before the tags",
+			content: `description = """
+[opsgenie]
+tags = ["fake"]
+"""
+[opsgenie]
+tags = ['''multi''', "x"]
+`,
+			tags:  []string{"multi", "x"},
+			lines: []int{6, 6},
+		},
+		{
+			name: "tags of another section",
+			content: `[opsgenie.environment_settings.dev]
+tags = ["dev"]
+
+[opsgenie]
+enabled = false
+`,
+		},
+		{
+			name:    "inline table",
+			content: "opsgenie = { enabled = false, tags = [\n\"a\",\n\"b\"] }\n",
+			tags:    []string{"a", "b"},
+			lines:   []int{2, 3},
+		},
+	}
+
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkTagLines(t, tt.content, tt.tags, tt.lines)
+		})
+	}
+}
+
+// FuzzTagLines builds config files with varied tag-array formats and verifies that the
+// line of every tag is reported correctly
+func FuzzTagLines(f *testing.F) {
+	f.Add("team:backend", "env,prod", `say "hi"`, byte(0))
+	f.Add("a # b", "[c]", "d'e", byte(layoutMultiLine|layoutComments|layoutTrailingComma))
+	f.Add(`"""`, "'''", `\`, byte(layoutMultiLine|layoutBlankLines|layoutDecoy))
+	f.Add("x", "", "tags = [\"y\"]", byte(layoutLiteral|layoutDotted|layoutComments))
+	f.Add("new\nline", "tab\tbed", "ünïcode", byte(0xff))
+
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	f.Fuzz(func(t *testing.T, tag1, tag2, tag3 string, layout byte) {
+		var tags []string
+		for _, tag := range []string{tag1, tag2, tag3} {
+			if !utf8.ValidString(tag) {
+				t.Skip("TOML files are UTF-8")
+			}
+			if tag != "" {
+				tags = append(tags, tag)
+			}
+		}
+
+		content, lines := buildTagsTOML(tags, layout)
+		checkTagLines(t, content, tags, lines)
+	})
+}
+
+// TestTagLinesReportedByValidation verifies that the warning of an invalid tag points
+// at its line, past a commented tag holding a comma
+func TestTagLinesReportedByValidation(t *testing.T) {
+	content := `memory_threshold = 80.0
+
+[opsgenie]
+enabled = false
+tags = [
+  "team:backend", # "skipped, not a tag"
+  "bad tag",
+]
+`
+	path := filepath.Join(t.TempDir(), "breakers.toml")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+
+	var output strings.Builder
+	log.SetOutput(&output)
+	defer log.SetOutput(os.Stderr)
+
+	_, err := breaker.LoadConfig(path)
+	require.NoError(t, err)
+	assert.Contains(t, output.String(), "breakers.toml:6 - Tag[0] = 'team:backend'")
+	assert.Contains(t, output.String(), "breakers.toml:7 - Tag[1] = 'bad tag'")
+}
+
+func TestValidateTags(t *testing.T) {
+	results := breaker.ValidateTags([]string{"Team:platform", "critical", "https://status.example.com"})
+	assert.Equal(t, []breaker.TagValidationResult{
+		{Tag: "Team:platform", IsValid: true, Index: 0},
+		{Tag: "critical", IsValid: false, Index: 1, Suggestion: "Severity:critical"},
+		{Tag: "https://status.example.com", IsValid: false, Index: 2, Suggestion: "URL:https://status.example.com"},
+	}, results)
+	assert.Empty(t, breaker.ValidateTags(nil))
+
+	// The loader adds the lines of the file's tags
+	path := filepath.Join(t.TempDir(), "breakers.toml")
+	require.NoError(t, os.WriteFile(path, []byte(`[opsgenie]
+tags = [
+  "Team:platform",
+  "critical",
+]
+`), 0644))
+	loader, err := breaker.NewTOMLConfigLoader(path)
+	require.NoError(t, err)
+
+	results = loader.ValidateTags([]string{"Team:platform", "critical"})
+	require.Len(t, results, 2)
+	assert.Equal(t, 3, results[0].LineNumber)
+	assert.Equal(t, 4, results[1].LineNumber)
+	assert.False(t, results[1].IsValid)
+	assert.Equal(t, "Severity:critical", results[1].Suggestion)
+}
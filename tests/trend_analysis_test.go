@@ -24,7 +24,7 @@ func TestBreakerTriggersWithIncreasingTrend(t *testing.T) {
 	b := breaker.NewBreaker(config, "test_breakers_trend.toml")
 
 	// Ensure memory checks don't interfere
-	breaker.SetMemoryOK(b.(*breaker.BreakerDriver), true)
+	setMemoryOverride(b, true)
 
 	now := time.Now()
 
@@ -40,7 +40,7 @@ func TestBreakerTriggersWithIncreasingTrend(t *testing.T) {
 			b.Done(startTime, endTime)
 		}
 
-		assert.False(t, b.TriggeredByLatencies(), "The breaker should not trigger with latencies below threshold")
+		assert.False(t, b.Triggered(), "The breaker should not trigger with latencies below threshold")
 	})
 
 	// Case 2: Latencies above threshold but without clear trend - should now trigger
@@ -57,7 +57,7 @@ func TestBreakerTriggersWithIncreasingTrend(t *testing.T) {
 			b.Done(startTime, endTime)
 		}
 
-		assert.True(t, b.TriggeredByLatencies(), "The breaker should trigger with high latencies consistently above threshold, even without a clear upward trend")
+		assert.True(t, b.Triggered(), "The breaker should trigger with high latencies consistently above threshold, even without a clear upward trend")
 	})
 
 	// Case 3: Latencies above threshold with downward trend - should still trigger
@@ -73,7 +73,7 @@ func TestBreakerTriggersWithIncreasingTrend(t *testing.T) {
 			b.Done(startTime, endTime)
 		}
 
-		assert.True(t, b.TriggeredByLatencies(), "The breaker should trigger with high latencies consistently above threshold, even with a downward trend")
+		assert.True(t, b.Triggered(), "The breaker should trigger with high latencies consistently above threshold, even with a downward trend")
 	})
 
 	// Case 4: Latencies above threshold with clear upward trend - SHOULD trigger
@@ -88,7 +88,7 @@ func TestBreakerTriggersWithIncreasingTrend(t *testing.T) {
 			b.Done(startTime, endTime)
 		}
 
-		assert.True(t, b.TriggeredByLatencies(), "The breaker SHOULD trigger with latencies above threshold and upward trend")
+		assert.True(t, b.Triggered(), "The breaker SHOULD trigger with latencies above threshold and upward trend")
 	})
 
 	// Case 5: Latencies initially below threshold but increasing above it - SHOULD trigger
@@ -111,7 +111,7 @@ func TestBreakerTriggersWithIncreasingTrend(t *testing.T) {
 			b.Done(startTime, endTime)
 		}
 
-		assert.True(t, b.TriggeredByLatencies(), "The breaker SHOULD trigger when latencies cross the threshold with upward trend")
+		assert.True(t, b.Triggered(), "The breaker SHOULD trigger when latencies cross the threshold with upward trend")
 	})
 
 	// Case 6: Stepped increase pattern - SHOULD trigger
@@ -132,7 +132,7 @@ func TestBreakerTriggersWithIncreasingTrend(t *testing.T) {
 			b.Done(startTime, endTime)
 		}
 
-		assert.True(t, b.TriggeredByLatencies(), "The breaker SHOULD trigger with an ascending step pattern")
+		assert.True(t, b.Triggered(), "The breaker SHOULD trigger with an ascending step pattern")
 	})
 
 	// Case 7: Verify that without trend analysis, any latency above threshold triggers the breaker
@@ -141,7 +141,7 @@ func TestBreakerTriggersWithIncreasingTrend(t *testing.T) {
 		configNoTrend := *config
 		configNoTrend.TrendAnalysisEnabled = false
 		bNoTrend := breaker.NewBreaker(&configNoTrend, "test_breakers_no_trend.toml")
-		breaker.SetMemoryOK(bNoTrend.(*breaker.BreakerDriver), true)
+		setMemoryOverride(bNoTrend, true)
 
 		// Add latencies above threshold but with downward trend
 		for i := 0; i < 5; i++ {
@@ -151,7 +151,7 @@ func TestBreakerTriggersWithIncreasingTrend(t *testing.T) {
 			bNoTrend.Done(startTime, endTime)
 		}
 
-		assert.True(t, bNoTrend.TriggeredByLatencies(), "Without trend analysis, the breaker SHOULD trigger with latencies above threshold only")
+		assert.True(t, bNoTrend.Triggered(), "Without trend analysis, the breaker SHOULD trigger with latencies above threshold only")
 	})
 }
 
@@ -170,7 +170,7 @@ func TestBreakerPreciseTriggerPoint(t *testing.T) {
 	}
 
 	b := breaker.NewBreaker(config, "test_breakers_precise_trigger.toml")
-	breaker.SetMemoryOK(b.(*breaker.BreakerDriver), true)
+	setMemoryOverride(b, true)
 
 	now := time.Now()
 
@@ -184,7 +184,7 @@ func TestBreakerPreciseTriggerPoint(t *testing.T) {
 	}
 
 	// The breaker should not be triggered initially
-	assert.False(t, b.TriggeredByLatencies(), "The breaker should not be triggered initially")
+	assert.False(t, b.Triggered(), "The breaker should not be triggered initially")
 
 	var breakerTriggeredAt int = -1
 
@@ -194,14 +194,14 @@ func TestBreakerPreciseTriggerPoint(t *testing.T) {
 		endTime := now.Add(time.Duration(i) * time.Second)
 		b.Done(startTime, endTime)
 
-		if b.TriggeredByLatencies() && breakerTriggeredAt == -1 {
+		if b.Triggered() && breakerTriggeredAt == -1 {
 			breakerTriggeredAt = i
 			t.Logf("The breaker triggered after adding latency #%d: %dms", i+1, latency)
 		}
 	}
 
 	// Verify that the breaker triggered and that it was at the expected point (after the 3rd latency)
-	assert.True(t, b.TriggeredByLatencies(), "The breaker should be triggered after all latencies")
+	assert.True(t, b.Triggered(), "The breaker should be triggered after all latencies")
 	assert.Equal(t, 2, breakerTriggeredAt, "The breaker should trigger exactly after the 3rd latency (index 2)")
 }
 
@@ -297,7 +297,7 @@ func TestBreakerWithDifferentTrendPatterns(t *testing.T) {
 	for name, pattern := range patterns {
 		t.Run(name, func(t *testing.T) {
 			b := breaker.NewBreaker(config, "test_breakers_trend_patterns.toml")
-			breaker.SetMemoryOK(b.(*breaker.BreakerDriver), true)
+			setMemoryOverride(b, true)
 
 			now := time.Now()
 
@@ -315,7 +315,7 @@ func TestBreakerWithDifferentTrendPatterns(t *testing.T) {
 					b.Done(startTime, endTime)
 
 					// Check if it triggered
-					if b.TriggeredByLatencies() && triggeredAt == -1 {
+					if b.Triggered() && triggeredAt == -1 {
 						triggeredAt = i
 						t.Logf("Breaker triggered at step %d with latency %d", i, latency)
 					}
@@ -327,7 +327,7 @@ func TestBreakerWithDifferentTrendPatterns(t *testing.T) {
 					t.Logf("Plateau pattern should trigger but didn't")
 					assert.False(t, true, "The breaker should trigger for pattern: %s", pattern.description)
 				} else {
-					assert.True(t, b.TriggeredByLatencies(), "The breaker should trigger for pattern: %s", pattern.description)
+					assert.True(t, b.Triggered(), "The breaker should trigger for pattern: %s", pattern.description)
 				}
 			} else {
 				// Normal handling for other patterns
@@ -338,7 +338,7 @@ func TestBreakerWithDifferentTrendPatterns(t *testing.T) {
 					b.Done(startTime, endTime)
 				}
 
-				result := b.TriggeredByLatencies()
+				result := b.Triggered()
 
 				if pattern.shouldTrigger {
 					assert.True(t, result, "The breaker should trigger for pattern: %s", pattern.description)
@@ -349,3 +349,103 @@ func TestBreakerWithDifferentTrendPatterns(t *testing.T) {
 		})
 	}
 }
+
+// TestPlateauTolerance verifies that plateau_min_fraction lets a plateau with one
+// borderline dip trip the breaker, which the default (every sample above) does not
+func TestPlateauTolerance(t *testing.T) {
+	newBreaker := func(minFraction float64) breaker.Breaker {
+		b := breaker.NewBreaker(&breaker.Config{
+			MemoryThreshold:             90.0,
+			LatencyThreshold:            300,
+			LatencyWindowSize:           10,
+			Percentile:                  0.95,
+			WaitTime:                    60,
+			TrendAnalysisEnabled:        true,
+			TrendAnalysisMinSampleCount: 5,
+			PlateauMinSamples:           10,
+			PlateauMinFraction:          minFraction,
+		}, "")
+		setMemoryOverride(b, true)
+		return b
+	}
+	// Nine samples on a plateau and a last one just below the threshold, so there is no
+	// positive trend
+	record := func(b breaker.Breaker) {
+		now := time.Now()
+		latencies := []int{400, 400, 400, 400, 400, 400, 400, 400, 400, 290}
+		for i, latency := range latencies {
+			end := now.Add(time.Duration(i) * time.Second)
+			b.Done(end.Add(-time.Duration(latency)*time.Millisecond), end)
+			if i < len(latencies)-1 {
+				assert.False(t, b.Triggered(), "Fewer than plateau_min_samples samples must not be a plateau (sample %d)", i)
+			}
+		}
+	}
+
+	strict := newBreaker(0)
+	defer strict.Close()
+	record(strict)
+	assert.False(t, strict.Triggered(), "By default one dip below the threshold hides the plateau")
+
+	tolerant := newBreaker(0.9)
+	defer tolerant.Close()
+	record(tolerant)
+	assert.True(t, tolerant.Triggered(), "Nine of ten samples above the threshold should be a plateau")
+	assert.Equal(t, breaker.TripReasonLatencyPlateau, tolerant.TripReason())
+
+	// A fraction above 1 or a sample count larger than the window can never be met
+	assert.NoError(t, breaker.ValidateConfig(&breaker.Config{
+		MemoryThreshold: 80, LatencyThreshold: 300, LatencyWindowSize: 10, Percentile: 0.95, WaitTime: 1,
+		PlateauMinSamples: 10, PlateauMinFraction: 0.9,
+	}))
+	assert.Error(t, breaker.ValidateConfig(&breaker.Config{
+		MemoryThreshold: 80, LatencyThreshold: 300, LatencyWindowSize: 10, Percentile: 0.95, WaitTime: 1,
+		PlateauMinFraction: 1.5,
+	}))
+	assert.Error(t, breaker.ValidateConfig(&breaker.Config{
+		MemoryThreshold: 80, LatencyThreshold: 300, LatencyWindowSize: 10, Percentile: 0.95, WaitTime: 1,
+		PlateauMinSamples: 11,
+	}))
+}
+
+// TestSparseSamplesTripFarAboveThreshold verifies that latencies far above the threshold
+// trip the breaker even when there are too few samples for trend analysis, while
+// latencies just above it still wait for a trend or a plateau
+func TestSparseSamplesTripFarAboveThreshold(t *testing.T) {
+	newBreaker := func() breaker.Breaker {
+		b := breaker.NewBreaker(&breaker.Config{
+			MemoryThreshold:             90.0,
+			LatencyThreshold:            100,
+			LatencyWindowSize:           20,
+			Percentile:                  0.95,
+			WaitTime:                    60,
+			TrendAnalysisEnabled:        true,
+			TrendAnalysisMinSampleCount: 10,
+		}, "")
+		setMemoryOverride(b, true)
+		return b
+	}
+	record := func(b breaker.Breaker, latencies ...int) {
+		now := time.Now()
+		for i, latency := range latencies {
+			end := now.Add(time.Duration(i) * time.Second)
+			b.Done(end.Add(-time.Duration(latency)*time.Millisecond), end)
+		}
+	}
+
+	severe := newBreaker()
+	defer severe.Close()
+	record(severe, 1000, 1000)
+	assert.True(t, severe.Triggered(), "Two samples at 10x the threshold should trip the breaker")
+	assert.Equal(t, breaker.TripReasonLatencySevere, severe.TripReason())
+
+	mild := newBreaker()
+	defer mild.Close()
+	record(mild, 150, 150)
+	assert.False(t, mild.Triggered(), "Two samples at 1.5x the threshold are not enough without a trend")
+
+	assert.Error(t, breaker.ValidateConfig(&breaker.Config{
+		MemoryThreshold: 80, LatencyThreshold: 300, LatencyWindowSize: 10, Percentile: 0.95, WaitTime: 1,
+		SparseTripFactor: 0.5,
+	}))
+}
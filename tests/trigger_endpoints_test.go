@@ -6,9 +6,11 @@ import (
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/lrleon/go-breaker/breaker"
+	"github.com/lrleon/go-breaker/breaker/breakertest"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -35,7 +37,7 @@ func TestTriggerBreakerByMemoryEndpoint(t *testing.T) {
 	breaker.AddEndpointToRouter(router, breakerAPI)
 
 	// Ensure the breaker starts in a non-triggered state
-	assert.False(t, breakerAPI.Driver.TriggeredByLatencies(), "Breaker should not be triggered initially")
+	assert.False(t, breakerAPI.Driver.Triggered(), "Breaker should not be triggered initially")
 
 	// Create an HTTP test recorder for the memory trigger endpoint
 	w := httptest.NewRecorder()
@@ -88,7 +90,7 @@ func TestTriggerBreakerByLatencyEndpoint(t *testing.T) {
 	breaker.AddEndpointToRouter(router, breakerAPI)
 
 	// Ensure the breaker starts in a non-triggered state
-	assert.False(t, breakerAPI.Driver.TriggeredByLatencies(), "Breaker should not be triggered initially")
+	assert.False(t, breakerAPI.Driver.Triggered(), "Breaker should not be triggered initially")
 
 	// Create an HTTP test recorder for the latency trigger endpoint
 	w := httptest.NewRecorder()
@@ -122,7 +124,7 @@ func TestTriggerBreakerByLatencyEndpoint(t *testing.T) {
 	assert.True(t, triggered, "Breaker should be triggered after latency trigger")
 
 	// Double-check by verifying the breaker state directly
-	assert.True(t, breakerAPI.Driver.TriggeredByLatencies(), "Breaker should be triggered after latency trigger")
+	assert.True(t, breakerAPI.Driver.Triggered(), "Breaker should be triggered after latency trigger")
 }
 
 func TestTriggerEndpointsWithResetFlow(t *testing.T) {
@@ -145,14 +147,14 @@ func TestTriggerEndpointsWithResetFlow(t *testing.T) {
 	breaker.AddEndpointToRouter(router, breakerAPI)
 
 	// 1. Initial state - not triggered
-	assert.False(t, breakerAPI.Driver.TriggeredByLatencies(), "Initial state should not be triggered")
+	assert.False(t, breakerAPI.Driver.Triggered(), "Initial state should not be triggered")
 
 	// 2. Trigger by latency
 	w1 := httptest.NewRecorder()
 	req1, _ := http.NewRequest("GET", "/breaker/trigger-by-latency", nil)
 	router.ServeHTTP(w1, req1)
 	assert.Equal(t, http.StatusOK, w1.Code)
-	assert.True(t, breakerAPI.Driver.TriggeredByLatencies(), "Should be triggered after latency trigger")
+	assert.True(t, breakerAPI.Driver.Triggered(), "Should be triggered after latency trigger")
 
 	// 3. Reset the breaker
 	w2 := httptest.NewRecorder()
@@ -161,14 +163,14 @@ func TestTriggerEndpointsWithResetFlow(t *testing.T) {
 	req2.Header.Set("Content-Type", "application/json")
 	router.ServeHTTP(w2, req2)
 	assert.Equal(t, http.StatusOK, w2.Code)
-	assert.False(t, breakerAPI.Driver.TriggeredByLatencies(), "Should not be triggered after reset")
+	assert.False(t, breakerAPI.Driver.Triggered(), "Should not be triggered after reset")
 
 	// 4. Trigger by memory
 	w3 := httptest.NewRecorder()
 	req3, _ := http.NewRequest("GET", "/breaker/trigger-by-memory", nil)
 	router.ServeHTTP(w3, req3)
 	assert.Equal(t, http.StatusOK, w3.Code)
-	// Note: Memory trigger affects Allow() behavior, not TriggeredByLatencies()
+	// Note: Memory trigger affects Allow() behavior, not Triggered()
 	assert.False(t, breakerAPI.Driver.Allow(), "Should not allow requests after memory trigger")
 
 	// 5. Restore memory check
@@ -229,3 +231,107 @@ func TestRestoreMemoryCheckEndpoint(t *testing.T) {
 	// 3. Verify that requests are now allowed
 	assert.True(t, breakerAPI.Driver.Allow(), "Should allow requests after memory restore")
 }
+
+func TestResetEndpointClearHistory(t *testing.T) {
+	config := &breaker.Config{
+		MemoryThreshold:      80.0,
+		LatencyThreshold:     100,
+		LatencyWindowSize:    5,
+		Percentile:           0.95,
+		WaitTime:             60,
+		TrendAnalysisEnabled: false,
+	}
+
+	breakerAPI := breaker.NewBreakerAPI(config)
+	setMemoryOverride(breakerAPI.Driver, true)
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	breaker.AddEndpointToRouter(router, breakerAPI)
+
+	tripWithSlowRequests := func() {
+		now := time.Now()
+		for i := 0; i < 5; i++ {
+			breakerAPI.Driver.Done(now.Add(-500*time.Millisecond), now)
+		}
+		require.True(t, breakerAPI.Driver.Triggered())
+	}
+
+	reset := func(body string) map[string]interface{} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/breaker/reset", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var response map[string]interface{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		return response
+	}
+
+	// Keeping the history closes the breaker but the slow latencies are still known
+	tripWithSlowRequests()
+	response := reset(`{"confirm": true, "clear_history": false}`)
+	assert.Equal(t, false, response["clear_history"])
+	assert.False(t, breakerAPI.Driver.Triggered())
+	assert.False(t, breakerAPI.Driver.LatencyOK(), "latency history should be preserved")
+	assert.Len(t, breakerAPI.Driver.LatenciesAboveThreshold(100), 5)
+
+	// Without the flag the history is cleared, as before
+	tripWithSlowRequests()
+	response = reset(`{"confirm": true}`)
+	assert.Equal(t, true, response["clear_history"])
+	assert.False(t, breakerAPI.Driver.Triggered())
+	assert.True(t, breakerAPI.Driver.LatencyOK())
+	assert.Empty(t, breakerAPI.Driver.LatenciesAboveThreshold(100))
+}
+
+func TestGlobalDisableEndpoint(t *testing.T) {
+	t.Cleanup(func() { breaker.SetGloballyDisabled(false) })
+
+	config := &breaker.Config{
+		MemoryThreshold:   80.0,
+		LatencyThreshold:  100,
+		LatencyWindowSize: 5,
+		Percentile:        0.95,
+		WaitTime:          60,
+	}
+	breakerAPI := breaker.NewBreakerAPI(config)
+	setMemoryOverride(breakerAPI.Driver, true)
+	other := breakertest.NewTestBreaker()
+	defer other.Close()
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	breaker.AddEndpointToRouter(router, breakerAPI)
+
+	setGlobalDisable := func(body string) (int, map[string]interface{}) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/breaker/global-disable", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+
+		var response map[string]interface{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		return w.Code, response
+	}
+
+	require.NoError(t, breakertest.TriggerByLatency(breakerAPI.Driver))
+	require.NoError(t, breakertest.TriggerByLatency(other))
+	assert.False(t, breakerAPI.Driver.Allow())
+
+	code, response := setGlobalDisable(`{"disabled": true}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, true, response["globally_disabled"])
+	assert.True(t, breaker.IsGloballyDisabled())
+	assert.True(t, breakerAPI.Driver.Allow(), "Allow should ignore the breaker state while globally disabled")
+	assert.True(t, other.Allow(), "The switch should apply to every breaker")
+	assert.True(t, breakerAPI.Driver.Triggered(), "The breaker state itself is kept")
+
+	code, _ = setGlobalDisable(`{}`)
+	assert.Equal(t, http.StatusBadRequest, code, "disabled is required")
+
+	code, response = setGlobalDisable(`{"disabled": false}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, false, response["globally_disabled"])
+	assert.False(t, breakerAPI.Driver.Allow(), "The breaker state applies again once re-enabled")
+}